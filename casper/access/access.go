@@ -0,0 +1,357 @@
+// Package access authenticates clients of REST API and limits them.
+// Client is identified by an API key from config or, if it has none,
+// by its IP address. Every client can have an upload quota, request
+// rate and bandwidth limits. Usage of clients is kept in the repo
+// datastore, so that quotas survive restarts. It is saved in batches
+// by Run, so a single Control must be shared by all HTTP front ends.
+package access
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/core"
+	config "github.com/Casper-dev/Casper-server/repo/config"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+)
+
+var log = logging.Logger("access")
+
+const (
+	authHeader   = "Authorization"
+	apiKeyHeader = "X-Api-Key"
+	bearerPrefix = "Bearer "
+
+	// anonymous clients which were idle for guestIdle are forgotten
+	// when there are more than maxGuests of them
+	maxGuests = 4096
+	guestIdle = 10 * time.Minute
+
+	// FlushInterval is how often Run saves changed usage
+	FlushInterval = 10 * time.Second
+)
+
+var (
+	ErrNoKey  = errors.New("API key is required")
+	ErrBadKey = errors.New("invalid API key")
+	ErrQuota  = errors.New("upload quota exceeded")
+)
+
+// Client is an authenticated client of the API.
+type Client struct {
+	// Name is the name of the API key or "ip:<address>" for anonymous clients
+	Name  string
+	Admin bool
+
+	limits    config.APILimits
+	rate      *bucket
+	bandwidth *bucket
+	usage     *Usage
+	seen      time.Time
+}
+
+// Control checks requests of API clients.
+type Control struct {
+	origins   []string
+	keys      map[string]*Client
+	anonymous *config.APILimits
+	public    config.APILimits
+
+	mtx    sync.Mutex
+	guests map[string]*Client
+	named  map[string]*Client
+	// dirty is usage which is not saved yet
+	dirty map[string]*Usage
+	ds    ds.Datastore
+	now   func() time.Time
+}
+
+// NewControl returns control configured with cfg which keeps usage in d.
+func NewControl(cfg config.RESTAPI, d ds.Datastore) *Control {
+	c := &Control{
+		origins:   cfg.AllowOrigins,
+		keys:      make(map[string]*Client),
+		anonymous: cfg.Anonymous,
+		guests:    make(map[string]*Client),
+		named:     make(map[string]*Client),
+		dirty:     make(map[string]*Usage),
+		ds:        d,
+		now:       time.Now,
+	}
+	if len(cfg.Keys) == 0 && c.anonymous == nil {
+		c.anonymous = &config.APILimits{}
+	}
+	if cfg.Public != nil {
+		c.public = *cfg.Public
+	} else if c.anonymous != nil {
+		c.public = *c.anonymous
+	}
+	for _, k := range cfg.Keys {
+		name := k.Name
+		if name == "" {
+			name = "key-" + hashToken(k.Token)[:8]
+		}
+		c.keys[hashToken(k.Token)] = c.newClient(name, k.Admin, k.APILimits)
+	}
+	return c
+}
+
+// NewNodeControl returns control configured with Casper.RESTAPI of n.
+func NewNodeControl(n *core.IpfsNode) (*Control, error) {
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	return NewControl(cfg.Casper.RESTAPI, n.Repo.Datastore()), nil
+}
+
+// tokens are looked up by hash, so that lookup time does not depend on them
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+func (c *Control) newClient(name string, admin bool, l config.APILimits) *Client {
+	cl := &Client{Name: name, Admin: admin, limits: l}
+	now := c.now()
+	if l.RequestsPerMinute > 0 {
+		rpm := float64(l.RequestsPerMinute)
+		cl.rate = newBucket(rpm/60, rpm, now)
+	}
+	if l.BytesPerSecond > 0 {
+		bps := float64(l.BytesPerSecond)
+		cl.bandwidth = newBucket(bps, bps, now)
+	}
+	return cl
+}
+
+// AllowOrigin returns value of Access-Control-Allow-Origin header
+// for the request. Empty value means that origin is not allowed.
+func (c *Control) AllowOrigin(req *http.Request) string {
+	if len(c.origins) == 0 {
+		return "*"
+	}
+	origin := req.Header.Get("Origin")
+	for _, o := range c.origins {
+		if o == "*" || o == origin {
+			return origin
+		}
+	}
+	return ""
+}
+
+// Authenticate returns client which has sent the request.
+func (c *Control) Authenticate(req *http.Request) (*Client, error) {
+	token := req.Header.Get(apiKeyHeader)
+	if auth := req.Header.Get(authHeader); token == "" && strings.HasPrefix(auth, bearerPrefix) {
+		token = strings.TrimPrefix(auth, bearerPrefix)
+	}
+	if token != "" {
+		cl, ok := c.keys[hashToken(token)]
+		if !ok {
+			return nil, ErrBadKey
+		}
+		return cl, nil
+	}
+	if c.anonymous == nil {
+		return nil, ErrNoKey
+	}
+	return c.guest(req, "ip:", *c.anonymous), nil
+}
+
+// authenticatePublic is Authenticate for resources which don't require
+// API key. Clients without key are limited by Public limits.
+func (c *Control) authenticatePublic(req *http.Request) (*Client, error) {
+	cl, err := c.Authenticate(req)
+	if err != ErrNoKey {
+		return cl, err
+	}
+	return c.guest(req, "public:ip:", c.public), nil
+}
+
+// guest returns anonymous client identified by address of req.
+func (c *Control) guest(req *http.Request, prefix string, l config.APILimits) *Client {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	name := prefix + host
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	cl, ok := c.guests[name]
+	if !ok {
+		if len(c.guests) >= maxGuests {
+			c.forgetGuests()
+		}
+		cl = c.newClient(name, false, l)
+		c.guests[name] = cl
+	}
+	cl.seen = c.now()
+	return cl
+}
+
+// Client returns client with specified name and limits, which is
+// authenticated by other means than API keys (e.g. S3 access keys).
+// Limits are set when client is first requested.
+func (c *Control) Client(name string, l config.APILimits) *Client {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	cl, ok := c.named[name]
+	if !ok {
+		cl = c.newClient(name, false, l)
+		c.named[name] = cl
+	}
+	return cl
+}
+
+func (c *Control) forgetGuests() {
+	now := c.now()
+	for name, cl := range c.guests {
+		if now.Sub(cl.seen) > guestIdle {
+			delete(c.guests, name)
+		}
+	}
+}
+
+// Usage returns usage of the client.
+func (c *Control) Usage(cl *Client) (*Usage, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err := c.loadUsage(cl); err != nil {
+		return nil, err
+	}
+	u := *cl.usage
+	return &u, nil
+}
+
+// AllUsage returns usage of all clients which have ever made a request.
+func (c *Control) AllUsage() ([]*Usage, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if err := c.flush(); err != nil {
+		return nil, err
+	}
+	return allUsage(c.ds)
+}
+
+// Run saves changed usage every FlushInterval until ctx is done.
+func (c *Control) Run(ctx context.Context) {
+	t := time.NewTicker(FlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			if err := c.Flush(); err != nil {
+				log.Error(err)
+			}
+			return
+		}
+		if err := c.Flush(); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// Flush saves changed usage.
+func (c *Control) Flush() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.flush()
+}
+
+func (c *Control) flush() error {
+	for name, u := range c.dirty {
+		if err := saveUsage(c.ds, u); err != nil {
+			return err
+		}
+		delete(c.dirty, name)
+	}
+	return nil
+}
+
+func (c *Control) loadUsage(cl *Client) error {
+	if cl.usage != nil {
+		return nil
+	}
+	u, err := loadUsage(c.ds, cl.Name)
+	if err != nil {
+		return err
+	}
+	cl.usage = u
+	return nil
+}
+
+// update applies f to the usage of the client. Usage is saved by Flush.
+func (c *Control) update(cl *Client, f func(u *Usage) error) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err := c.loadUsage(cl); err != nil {
+		return err
+	}
+	if err := f(cl.usage); err != nil {
+		return err
+	}
+	cl.usage.QuotaBytes = cl.limits.QuotaBytes
+	if cl.usage.Since.IsZero() {
+		cl.usage.Since = c.now().UTC()
+	}
+	c.dirty[cl.Name] = cl.usage
+	return nil
+}
+
+// upload counts n bytes uploaded by the client unless they exceed quota.
+func (c *Control) upload(cl *Client, n int64) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err := c.loadUsage(cl); err != nil {
+		return err
+	}
+	if q := cl.limits.QuotaBytes; q > 0 && cl.usage.Uploaded+n > q {
+		return ErrQuota
+	}
+	cl.usage.Uploaded += n
+	c.dirty[cl.Name] = cl.usage
+	return nil
+}
+
+// throttle waits until the client is allowed to transfer n bytes.
+func (c *Control) throttle(ctx context.Context, cl *Client, n int) error {
+	if cl.bandwidth == nil || n == 0 {
+		return nil
+	}
+	d := cl.bandwidth.reserve(n, c.now())
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type clientKey struct{}
+
+// FromContext returns client which has sent request with context ctx.
+func FromContext(ctx context.Context) *Client {
+	cl, _ := ctx.Value(clientKey{}).(*Client)
+	return cl
+}
@@ -0,0 +1,195 @@
+package access
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/Casper-dev/Casper-server/repo/config"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+)
+
+type testControl struct {
+	*Control
+	handler http.Handler
+	clock   time.Time
+}
+
+func newTestControl(cfg config.RESTAPI, d ds.Datastore) *testControl {
+	tc := &testControl{Control: NewControl(cfg, d), clock: time.Unix(1500000000, 0)}
+	tc.now = func() time.Time { return tc.clock }
+	for _, cl := range tc.keys {
+		// buckets were created with real time
+		if cl.rate != nil {
+			cl.rate.last = tc.clock
+		}
+	}
+	tc.handler = tc.Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.Write(append([]byte(FromContext(req.Context()).Name+":"), b...))
+	}))
+	return tc
+}
+
+func (tc *testControl) do(token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/file", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	tc.handler.ServeHTTP(w, req)
+	return w
+}
+
+func newDatastore() ds.Datastore {
+	return dssync.MutexWrap(ds.NewMapDatastore())
+}
+
+func TestOpen(t *testing.T) {
+	tc := newTestControl(config.RESTAPI{}, newDatastore())
+	w := tc.do("", "data")
+	if w.Code != http.StatusOK || w.Body.String() != "ip:192.0.2.1:data" {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body)
+	}
+	if w = tc.do("unknown", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown key must be rejected, got %d", w.Code)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	cfg := config.RESTAPI{Keys: []config.APIKey{{Name: "dashboard", Token: "secret"}}}
+	tc := newTestControl(cfg, newDatastore())
+
+	if w := tc.do("", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("request without key must be rejected, got %d", w.Code)
+	}
+	if w := tc.do("secret", "x"); w.Code != http.StatusOK || w.Body.String() != "dashboard:x" {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Api-Key", "secret")
+	if cl, err := tc.Authenticate(req); err != nil || cl.Name != "dashboard" {
+		t.Fatalf("X-Api-Key must be accepted: %v %v", cl, err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	cfg := config.RESTAPI{Keys: []config.APIKey{{Token: "k", APILimits: config.APILimits{RequestsPerMinute: 2}}}}
+	tc := newTestControl(cfg, newDatastore())
+
+	for i := 0; i < 2; i++ {
+		if w := tc.do("k", ""); w.Code != http.StatusOK {
+			t.Fatalf("request %d must be allowed, got %d", i, w.Code)
+		}
+	}
+	w := tc.do("k", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "30" {
+		t.Fatalf("expected 429 with Retry-After 30, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	tc.clock = tc.clock.Add(30 * time.Second)
+	if w = tc.do("k", ""); w.Code != http.StatusOK {
+		t.Fatalf("request must be allowed after wait, got %d", w.Code)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	d := newDatastore()
+	cfg := config.RESTAPI{Keys: []config.APIKey{{Name: "c", Token: "k", APILimits: config.APILimits{QuotaBytes: 10}}}}
+	tc := newTestControl(cfg, d)
+
+	if w := tc.do("k", "123456"); w.Code != http.StatusOK {
+		t.Fatalf("upload within quota must be allowed, got %d", w.Code)
+	}
+	if w := tc.do("k", "123456"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("upload over quota must be rejected, got %d", w.Code)
+	}
+
+	// usage is saved in batches and restored from datastore
+	if _, err := d.Get(usageKey("c")); err != ds.ErrNotFound {
+		t.Fatalf("usage must not be saved before flush, got %v", err)
+	}
+	if err := tc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	tc = newTestControl(cfg, d)
+	if w := tc.do("k", "12345"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("quota must survive restart, got %d", w.Code)
+	}
+	if w := tc.do("k", "1234"); w.Code != http.StatusOK {
+		t.Fatalf("upload within quota must be allowed, got %d", w.Code)
+	}
+
+	all, err := tc.AllUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 {
+		t.Fatalf("expected usage of one client, got %d", len(all))
+	}
+	u := all[0]
+	if u.Client != "c" || u.Requests != 2 || u.Rejected != 2 || u.Uploaded != 10 || u.Downloaded != 2+6+2+4 || u.QuotaBytes != 10 {
+		t.Fatalf("unexpected usage %+v", u)
+	}
+}
+
+func TestPublicHandler(t *testing.T) {
+	limits := config.APILimits{RequestsPerMinute: 1}
+	cfg := config.RESTAPI{Keys: []config.APIKey{{Name: "dashboard", Token: "secret"}}, Public: &limits}
+	tc := newTestControl(cfg, newDatastore())
+	h := tc.PublicHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(FromContext(req.Context()).Name))
+	}))
+
+	for i, code := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/link", nil))
+		if w.Code != code {
+			t.Fatalf("request %d: expected %d, got %d", i, code, w.Code)
+		}
+	}
+	if w := tc.do("", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("API must still require key, got %d", w.Code)
+	}
+}
+
+func TestAllowOrigin(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+
+	if o := NewControl(config.RESTAPI{}, newDatastore()).AllowOrigin(req); o != "*" {
+		t.Fatalf("any origin must be allowed by default, got %q", o)
+	}
+	c := NewControl(config.RESTAPI{AllowOrigins: []string{"https://app.example.com"}}, newDatastore())
+	if o := c.AllowOrigin(req); o != "https://app.example.com" {
+		t.Fatalf("configured origin must be allowed, got %q", o)
+	}
+	req.Header.Set("Origin", "https://evil.example.com")
+	if o := c.AllowOrigin(req); o != "" {
+		t.Fatalf("other origin must not be allowed, got %q", o)
+	}
+}
+
+func TestBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newBucket(100, 100, now)
+	if d := b.reserve(100, now); d != 0 {
+		t.Fatalf("burst must be available, got delay %v", d)
+	}
+	if d := b.reserve(50, now); d != 500*time.Millisecond {
+		t.Fatalf("expected delay 500ms, got %v", d)
+	}
+	if d := b.reserve(50, now.Add(2*time.Second)); d != 0 {
+		t.Fatalf("tokens must be refilled, got delay %v", d)
+	}
+}
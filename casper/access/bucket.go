@@ -0,0 +1,63 @@
+package access
+
+import (
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket which is refilled with rate tokens per second
+// up to burst tokens.
+type bucket struct {
+	mtx    sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate, burst float64, now time.Time) *bucket {
+	return &bucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
+
+// allow takes one token if there is one. Otherwise it returns
+// how long to wait until the token is available.
+func (b *bucket) allow(now time.Time) (bool, time.Duration) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, b.delay(1)
+}
+
+// reserve takes n tokens, possibly borrowing them from the future,
+// and returns how long to wait until they are repaid.
+func (b *bucket) reserve(n int, now time.Time) time.Duration {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.refill(now)
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return b.delay(0)
+}
+
+// delay returns time after which there will be at least n tokens.
+func (b *bucket) delay(n float64) time.Duration {
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
@@ -0,0 +1,150 @@
+package access
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// Handler returns handler which authenticates requests, rejects those
+// which exceed limits of their client and passes the rest to next.
+// Bodies of requests and responses are throttled and counted.
+// Client can be obtained from request context with FromContext.
+func (c *Control) Handler(next http.Handler) http.Handler {
+	return c.handler(next, c.Authenticate)
+}
+
+// PublicHandler is Handler for resources which can be requested without
+// API key, like share links. Such requests are limited by Public limits
+// even if anonymous clients are not allowed to use API.
+func (c *Control) PublicHandler(next http.Handler) http.Handler {
+	return c.handler(next, c.authenticatePublic)
+}
+
+func (c *Control) handler(next http.Handler, auth func(*http.Request) (*Client, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cl, err := auth(req)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		c.Limit(cl, w, req, next)
+	})
+}
+
+// Limit serves req of client cl with next unless it exceeds limits
+// of the client. It is used by front ends which authenticate clients
+// themselves.
+func (c *Control) Limit(cl *Client, w http.ResponseWriter, req *http.Request, next http.Handler) {
+	if cl.rate != nil {
+		if ok, wait := cl.rate.allow(c.now()); !ok {
+			c.reject(cl)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+	}
+	if q := cl.limits.QuotaBytes; q > 0 && req.ContentLength > 0 {
+		if u, err := c.Usage(cl); err == nil && u.Uploaded+req.ContentLength > q {
+			c.reject(cl)
+			http.Error(w, ErrQuota.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+
+	ctx := context.WithValue(req.Context(), clientKey{}, cl)
+	req = req.WithContext(ctx)
+	if req.Body != nil {
+		req.Body = &body{ReadCloser: req.Body, c: c, cl: cl, ctx: ctx}
+	}
+	cw := &writer{ResponseWriter: w, c: c, cl: cl, ctx: ctx}
+	next.ServeHTTP(cw, req)
+
+	err := c.update(cl, func(u *Usage) error {
+		u.Requests++
+		u.Downloaded += cw.n
+		u.Last = c.now().UTC()
+		return nil
+	})
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+func (c *Control) reject(cl *Client) {
+	err := c.update(cl, func(u *Usage) error {
+		u.Rejected++
+		return nil
+	})
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// body counts uploaded bytes against quota of the client.
+type body struct {
+	io.ReadCloser
+
+	c   *Control
+	cl  *Client
+	ctx context.Context
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if qerr := b.c.upload(b.cl, int64(n)); qerr != nil {
+			return 0, qerr
+		}
+		if terr := b.c.throttle(b.ctx, b.cl, n); terr != nil {
+			return n, terr
+		}
+	}
+	return n, err
+}
+
+// writer counts downloaded bytes.
+type writer struct {
+	http.ResponseWriter
+
+	c   *Control
+	cl  *Client
+	ctx context.Context
+	n   int64
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if err := w.c.throttle(w.ctx, w.cl, len(p)); err != nil {
+		return 0, err
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *writer) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *writer) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return make(chan bool)
+}
+
+// Hijack lets WebSocket connections take over the connection.
+func (w *writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("connection can not be hijacked")
+}
@@ -0,0 +1,76 @@
+package access
+
+import (
+	"encoding/json"
+	"time"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	"gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+)
+
+const usageKeyPrefix = "/local/api/usage/"
+
+// Usage counts requests of a single client since it was first seen.
+type Usage struct {
+	Client string
+	// Requests is the number of served requests
+	Requests int64
+	// Rejected is the number of requests rejected by limits
+	Rejected int64
+	// Uploaded and Downloaded are sizes of request and response bodies
+	Uploaded   int64
+	Downloaded int64
+	// QuotaBytes is the limit of Uploaded, zero means no limit
+	QuotaBytes int64 `json:",omitempty"`
+	Since      time.Time
+	Last       time.Time
+}
+
+func usageKey(client string) ds.Key {
+	return ds.NewKey(usageKeyPrefix + client)
+}
+
+func loadUsage(d ds.Datastore, client string) (*Usage, error) {
+	v, err := d.Get(usageKey(client))
+	if err == ds.ErrNotFound {
+		return &Usage{Client: client}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	u := &Usage{}
+	if err = json.Unmarshal(v.([]byte), u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func saveUsage(d ds.Datastore, u *Usage) error {
+	b, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return d.Put(usageKey(u.Client), b)
+}
+
+func allUsage(d ds.Datastore) ([]*Usage, error) {
+	res, err := d.Query(query.Query{Prefix: usageKeyPrefix})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]*Usage, 0, len(entries))
+	for _, e := range entries {
+		u := &Usage{}
+		if err = json.Unmarshal(e.Value.([]byte), u); err != nil {
+			log.Errorf("invalid usage record %s: %v", e.Key, err)
+			continue
+		}
+		all = append(all, u)
+	}
+	return all, nil
+}
@@ -0,0 +1,93 @@
+package billing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	inet "gx/ipfs/QmNa31VPzC561NWwRsJLE7nGYZYuuD2QfpK2b1q9BK54J1/go-libp2p-net"
+	pstore "gx/ipfs/QmPgDWmTmuzvP7QE5zwo1TmjbJme9pmZHNujB2453jkCTr/go-libp2p-peerstore"
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
+	pro "gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
+	p2phost "gx/ipfs/Qmc1XhrFEiSeBNn3mpfg6gEuYCt5im2gYmNVmncsvmpeAk/go-libp2p-host"
+)
+
+// ReceiptProtocol is used by clients to deliver receipts to providers.
+const ReceiptProtocol = pro.ID("/casper/receipt/1.0.0")
+
+const streamTimeout = time.Minute
+
+var ErrWrongProvider = errors.New("receipt is issued to another provider")
+
+type response struct {
+	Error string `json:",omitempty"`
+}
+
+// Serve accepts receipts sent to h and saves them to store. Receipt must
+// be issued to h by the remote peer, who may pay with its wallet.
+func Serve(h p2phost.Host, store *Store, verifyWallet VerifyWalletFunc) {
+	h.SetStreamHandler(ReceiptProtocol, func(s inet.Stream) {
+		defer s.Close()
+		s.SetDeadline(time.Now().Add(streamTimeout))
+
+		var resp response
+		if err := accept(h.ID(), s.Conn().RemotePeer(), s, store, verifyWallet); err != nil {
+			log.Warningf("receipt from %s is rejected: %v", s.Conn().RemotePeer(), err)
+			resp.Error = err.Error()
+		}
+		json.NewEncoder(s).Encode(&resp)
+	})
+}
+
+func accept(self, remote peer.ID, s inet.Stream, store *Store, verifyWallet VerifyWalletFunc) error {
+	r := &Receipt{}
+	if err := json.NewDecoder(s).Decode(r); err != nil {
+		return err
+	}
+	if r.Provider != self.Pretty() {
+		return ErrWrongProvider
+	}
+	// streams are authenticated, so receipt can't be relayed by others
+	if r.Client != remote.Pretty() {
+		return ErrWrongClient
+	}
+	if err := r.Verify(verifyWallet); err != nil {
+		return err
+	}
+
+	if ok, err := store.PutReceipt(r); err != nil {
+		return err
+	} else if ok {
+		log.Debugf("receipt for %d bytes of %s from %s", r.Bytes, r.Root, r.Client)
+	}
+	return nil
+}
+
+// Send delivers signed receipt r to provider.
+func Send(ctx context.Context, h p2phost.Host, provider peer.ID, r *Receipt) error {
+	ctx, cancel := context.WithTimeout(ctx, streamTimeout)
+	defer cancel()
+
+	if err := h.Connect(ctx, pstore.PeerInfo{ID: provider}); err != nil {
+		return err
+	}
+	s, err := h.NewStream(ctx, provider, ReceiptProtocol)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(streamTimeout))
+
+	if err = json.NewEncoder(s).Encode(r); err != nil {
+		return err
+	}
+	var resp response
+	if err = json.NewDecoder(s).Decode(&resp); err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package billing
+
+import (
+	"context"
+	"testing"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+	testutil "gx/ipfs/QmWRCn8vruNAzHx8i6SAXinuheRitKEGu8c7m26stKvsYx/go-testutil"
+	mocknet "gx/ipfs/QmefgzMbKZYsmHFkLqxgaTBG9ypeEjrdWRD5WXH4j1cWDL/go-libp2p/p2p/net/mock"
+)
+
+func TestProtocol(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	sk, client := newIdentity(t)
+	psk, provider := newIdentity(t)
+	ch, err := mn.AddPeer(sk, testutil.RandLocalTCPAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ph, err := mn.AddPeer(psk, testutil.RandLocalTCPAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewStore(dssync.MutexWrap(ds.NewMapDatastore()))
+	Serve(ph, store, testVerifyWallet)
+
+	if err = Send(ctx, ch, provider, signedReceipt(t, sk, provider, client, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if err = Send(ctx, ch, provider, signedReceipt(t, sk, client, client, 100)); err == nil {
+		t.Fatal("receipt issued to another provider must be rejected")
+	}
+	// receipt of another client can't be relayed
+	other, otherID := newIdentity(t)
+	if err = Send(ctx, ch, provider, signedReceipt(t, other, provider, otherID, 100)); err == nil {
+		t.Fatal("receipt of another client must be rejected")
+	}
+
+	pending, err := store.Pending(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Receipt.Bytes != 100 || pending[0].Receipt.Client != client.Pretty() {
+		t.Fatalf("unexpected receipts %+v", pending)
+	}
+}
@@ -0,0 +1,141 @@
+// Package billing meters traffic served to other peers and collects
+// download receipts, which clients sign to acknowledge the bytes they
+// have received. Receipts are kept in the repo datastore until they are
+// settled with SC in batches, so that providers are paid for egress
+// they can prove.
+package billing
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"time"
+
+	sc "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+
+	"gx/ipfs/QmT8rehPR3F6bmwL6zjUN8XpiDBFFpMP2myPdC6ApsWfJf/go-base58"
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+)
+
+var (
+	ErrBadSignature = errors.New("receipt signature is invalid")
+	ErrWrongClient  = errors.New("receipt is not signed by its client")
+)
+
+// VerifyWalletFunc checks that sig of payload is made with the key
+// of wallet, see sc_interface.WalletProofSC.
+type VerifyWalletFunc func(wallet string, payload, sig []byte) error
+
+// Receipt acknowledges that Client has received Bytes of the file with
+// root CID Root from Provider. Receipts are incremental: every receipt
+// covers only bytes received since the previous one, and Nonce makes
+// otherwise identical receipts distinct. WalletSig proves that Client
+// may pay with Wallet.
+type Receipt struct {
+	Provider  string
+	Client    string
+	Wallet    string
+	WalletSig []byte
+	Root      string
+	Bytes     uint64
+	Nonce     string
+	Time      time.Time
+
+	PubKey    []byte `json:",omitempty"`
+	Signature []byte `json:",omitempty"`
+}
+
+// NewReceipt returns unsigned receipt with random nonce. Wallet is
+// taken from proof made by sc_interface.SignWalletProof for client.
+func NewReceipt(provider, client peer.ID, proof, root string, bytes uint64) (*Receipt, error) {
+	wallet, sig, err := sc.ParseWalletProof(proof)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 16)
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &Receipt{
+		Provider:  provider.Pretty(),
+		Client:    client.Pretty(),
+		Wallet:    wallet,
+		WalletSig: sig,
+		Root:      root,
+		Bytes:     bytes,
+		Nonce:     base58.Encode(nonce),
+		// JSON keeps time with nanoseconds, but seconds are enough
+		Time: time.Now().UTC().Truncate(time.Second),
+	}, nil
+}
+
+// Payload returns signed part of the receipt.
+func (r *Receipt) Payload() ([]byte, error) {
+	unsigned := *r
+	unsigned.PubKey, unsigned.Signature = nil, nil
+	return json.Marshal(&unsigned)
+}
+
+// Sign signs receipt with sk, which must be the identity of the client.
+func (r *Receipt) Sign(sk ci.PrivKey) error {
+	payload, err := r.Payload()
+	if err != nil {
+		return err
+	}
+	if r.PubKey, err = sk.GetPublic().Bytes(); err != nil {
+		return err
+	}
+	r.Signature, err = sk.Sign(payload)
+	return err
+}
+
+// Verify checks that receipt is signed by its client, who may pay
+// with its wallet.
+func (r *Receipt) Verify(verifyWallet VerifyWalletFunc) error {
+	pk, err := ci.UnmarshalPublicKey(r.PubKey)
+	if err != nil {
+		return err
+	}
+	id, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		return err
+	}
+	if id.Pretty() != r.Client {
+		return ErrWrongClient
+	}
+
+	payload, err := r.Payload()
+	if err != nil {
+		return err
+	}
+	if ok, err := pk.Verify(payload, r.Signature); err != nil || !ok {
+		return ErrBadSignature
+	}
+	return verifyWallet(r.Wallet, sc.WalletPayload(r.Wallet, r.Client), r.WalletSig)
+}
+
+// ID identifies receipt in the store.
+func (r *Receipt) ID() string {
+	sum := sha256.Sum256(r.Signature)
+	return base58.Encode(sum[:16])
+}
+
+// SCReceipt converts r to the format of SC.
+func (r *Receipt) SCReceipt() (sc.DownloadReceipt, error) {
+	payload, err := r.Payload()
+	if err != nil {
+		return sc.DownloadReceipt{}, err
+	}
+	return sc.DownloadReceipt{
+		Client:          r.Client,
+		Wallet:          r.Wallet,
+		WalletSignature: r.WalletSig,
+		FileID:          r.Root,
+		Bytes:           int64(r.Bytes),
+		Payload:         payload,
+		PubKey:          r.PubKey,
+		Signature:       r.Signature,
+	}, nil
+}
@@ -0,0 +1,105 @@
+package billing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	sc "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+)
+
+func newIdentity(t *testing.T) (ci.PrivKey, peer.ID) {
+	sk, pk, err := ci.GenerateKeyPair(ci.RSA, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk, id
+}
+
+// wallet proofs of tests are just wallet payloads
+func testProof(wallet string, client peer.ID) string {
+	return wallet + ":" + hex.EncodeToString(sc.WalletPayload(wallet, client.Pretty()))
+}
+
+func testVerifyWallet(wallet string, payload, sig []byte) error {
+	if !bytes.Equal(payload, sig) {
+		return sc.ErrWrongWallet
+	}
+	return nil
+}
+
+func newReceipt(t *testing.T, provider, client peer.ID, proof string, n uint64) *Receipt {
+	r, err := NewReceipt(provider, client, proof, "root", n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func signedReceipt(t *testing.T, sk ci.PrivKey, provider, client peer.ID, n uint64) *Receipt {
+	r := newReceipt(t, provider, client, testProof("wallet", client), n)
+	if err := r.Sign(sk); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestReceipt(t *testing.T) {
+	sk, client := newIdentity(t)
+	other, _ := newIdentity(t)
+	provider := peer.ID("provider")
+
+	r := signedReceipt(t, sk, provider, client, 100)
+	if err := r.Verify(testVerifyWallet); err != nil {
+		t.Fatal(err)
+	}
+	if r2 := signedReceipt(t, sk, provider, client, 100); r2.ID() == r.ID() {
+		t.Fatal("identical receipts must have different IDs")
+	}
+
+	forged := *r
+	forged.Bytes = 1000
+	if err := forged.Verify(testVerifyWallet); err != ErrBadSignature {
+		t.Fatalf("modified receipt must be rejected, got %v", err)
+	}
+
+	// receipt signed by someone else on behalf of the client
+	stolen := newReceipt(t, provider, client, testProof("wallet", client), 100)
+	if err := stolen.Sign(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := stolen.Verify(testVerifyWallet); err != ErrWrongClient {
+		t.Fatalf("receipt signed by another key must be rejected, got %v", err)
+	}
+
+	// wallet which was not proven to be the client's
+	spent := newReceipt(t, provider, client, testProof("wallet", peer.ID("other")), 100)
+	if err := spent.Sign(sk); err != nil {
+		t.Fatal(err)
+	}
+	if err := spent.Verify(testVerifyWallet); err != sc.ErrWrongWallet {
+		t.Fatalf("receipt with wallet of another client must be rejected, got %v", err)
+	}
+	if _, err := NewReceipt(provider, client, "wallet", "root", 100); err != sc.ErrNoWalletProof {
+		t.Fatalf("receipt without wallet proof must not be made, got %v", err)
+	}
+
+	scr, err := r.SCReceipt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scr.Client != client.Pretty() || scr.Wallet != "wallet" || scr.FileID != "root" || scr.Bytes != 100 {
+		t.Fatalf("unexpected SC receipt %+v", scr)
+	}
+	pk, _ := ci.UnmarshalPublicKey(scr.PubKey)
+	if ok, err := pk.Verify(scr.Payload, scr.Signature); err != nil || !ok {
+		t.Fatal("SC receipt must be verifiable by its payload")
+	}
+}
@@ -0,0 +1,125 @@
+package billing
+
+import (
+	"context"
+	"time"
+
+	sc "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+	"github.com/Casper-dev/Casper-server/exchange/bitswap/decision"
+	config "github.com/Casper-dev/Casper-server/repo/config"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+)
+
+var log = logging.Logger("billing")
+
+const (
+	DefaultSettleInterval = time.Hour
+	DefaultBatchSize      = 50
+	// MeterInterval is how often metered traffic is saved to the store
+	MeterInterval = time.Minute
+)
+
+// ConfirmFunc sends batch of receipts to SC.
+type ConfirmFunc func(receipts []sc.DownloadReceipt) error
+
+// Settler periodically confirms pending receipts with SC.
+type Settler struct {
+	Store     *Store
+	Interval  time.Duration
+	BatchSize int
+	Confirm   ConfirmFunc
+}
+
+// NewSettler returns settler configured with cfg.
+func NewSettler(store *Store, cfg config.Billing, confirm ConfirmFunc) (*Settler, error) {
+	s := &Settler{
+		Store:     store,
+		Interval:  DefaultSettleInterval,
+		BatchSize: DefaultBatchSize,
+		Confirm:   confirm,
+	}
+	if cfg.SettleInterval != "" {
+		var err error
+		if s.Interval, err = time.ParseDuration(cfg.SettleInterval); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.BatchSize > 0 {
+		s.BatchSize = cfg.BatchSize
+	}
+	return s, nil
+}
+
+// Run settles receipts every Interval until ctx is done.
+func (s *Settler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if n, err := s.Settle(); err != nil {
+				log.Errorf("settled %d receipts, then failed: %v", n, err)
+			} else if n > 0 {
+				log.Infof("settled %d receipts", n)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Settle confirms all pending receipts in batches of BatchSize and
+// returns number of settled receipts. Batches which were not confirmed
+// remain pending and are retried next time.
+func (s *Settler) Settle() (int, error) {
+	settled := 0
+	for {
+		pending, err := s.Store.Pending(s.BatchSize)
+		if err != nil || len(pending) == 0 {
+			return settled, err
+		}
+
+		batch := make([]sc.DownloadReceipt, 0, len(pending))
+		ids := make([]string, 0, len(pending))
+		for _, rec := range pending {
+			r, err := rec.Receipt.SCReceipt()
+			if err != nil {
+				return settled, err
+			}
+			batch = append(batch, r)
+			ids = append(ids, rec.Receipt.ID())
+		}
+
+		if err = s.Confirm(batch); err != nil {
+			return settled, err
+		}
+		if err = s.Store.MarkSettled(ids); err != nil {
+			return settled, err
+		}
+		settled += len(ids)
+	}
+}
+
+// Meter saves traffic metered by access to store every MeterInterval
+// and once more when ctx is done.
+func Meter(ctx context.Context, access *decision.DownloadAccess, store *Store) {
+	ticker := time.NewTicker(MeterInterval)
+	defer ticker.Stop()
+
+	flush := func() {
+		if err := store.AddServed(access.TakeUsage()); err != nil {
+			log.Errorf("can't save served traffic: %v", err)
+		}
+	}
+	for {
+		select {
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			flush()
+			return
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package billing
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/exchange/bitswap/decision"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	"gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+)
+
+const (
+	usageKeyPrefix   = "/local/billing/usage/"
+	receiptKeyPrefix = "/local/billing/receipts/"
+)
+
+// Served is the total traffic of the file with root CID Root
+// sent to Peer, who has paid for it with Wallet.
+type Served struct {
+	Peer    string
+	Wallet  string
+	Root    string
+	Bytes   uint64
+	Updated time.Time
+}
+
+// Record is a receipt kept in the store.
+type Record struct {
+	Receipt  *Receipt
+	Received time.Time
+	// Settled is zero until receipt is confirmed with SC
+	Settled time.Time `json:",omitempty"`
+}
+
+// Store keeps served traffic and receipts in a datastore.
+type Store struct {
+	mtx sync.Mutex
+	ds  ds.Datastore
+	now func() time.Time
+}
+
+func NewStore(d ds.Datastore) *Store {
+	return &Store{ds: d, now: time.Now}
+}
+
+// AddServed adds traffic metered by decision engine to the totals.
+func (s *Store) AddServed(usage []decision.Usage) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for _, u := range usage {
+		key := usageKeyPrefix + u.Peer.Pretty() + "/" + u.Wallet + "/" + u.Root.String()
+		served := &Served{Peer: u.Peer.Pretty(), Wallet: u.Wallet, Root: u.Root.String()}
+		if err := s.get(key, served); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+		served.Bytes += u.Bytes
+		served.Updated = s.now()
+		if err := s.put(key, served); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Served returns traffic totals of all peers.
+func (s *Store) Served() ([]*Served, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var served []*Served
+	err := s.query(usageKeyPrefix, func(b []byte) error {
+		v := &Served{}
+		if err := json.Unmarshal(b, v); err != nil {
+			return err
+		}
+		served = append(served, v)
+		return nil
+	})
+	return served, err
+}
+
+// PutReceipt stores verified receipt. It returns false if
+// receipt was already stored, so that it is not paid twice.
+func (s *Store) PutReceipt(r *Receipt) (bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	key := receiptKeyPrefix + r.ID()
+	if ok, err := s.ds.Has(ds.NewKey(key)); err != nil || ok {
+		return false, err
+	}
+	return true, s.put(key, &Record{Receipt: r, Received: s.now()})
+}
+
+// Pending returns at most limit unsettled receipts, oldest first.
+// Non-positive limit means no limit.
+func (s *Store) Pending(limit int) ([]*Record, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var pending []*Record
+	err := s.query(receiptKeyPrefix, func(b []byte) error {
+		rec := &Record{}
+		if err := json.Unmarshal(b, rec); err != nil {
+			return err
+		}
+		if rec.Settled.IsZero() {
+			pending = append(pending, rec)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Received.Before(pending[j].Received)
+	})
+	if limit > 0 && len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return pending, nil
+}
+
+// MarkSettled marks receipts with specified IDs as settled.
+func (s *Store) MarkSettled(ids []string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	now := s.now()
+	for _, id := range ids {
+		rec := &Record{}
+		if err := s.get(receiptKeyPrefix+id, rec); err != nil {
+			return err
+		}
+		rec.Settled = now
+		if err := s.put(receiptKeyPrefix+id, rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) query(prefix string, f func(b []byte) error) error {
+	res, err := s.ds.Query(query.Query{Prefix: prefix})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	for e := range res.Next() {
+		if e.Error != nil {
+			return e.Error
+		}
+		if err := f(e.Value.([]byte)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) get(key string, v interface{}) error {
+	b, err := s.ds.Get(ds.NewKey(key))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b.([]byte), v)
+}
+
+func (s *Store) put(key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.ds.Put(ds.NewKey(key), b)
+}
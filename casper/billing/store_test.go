@@ -0,0 +1,104 @@
+package billing
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	sc "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+	"github.com/Casper-dev/Casper-server/exchange/bitswap/decision"
+	config "github.com/Casper-dev/Casper-server/repo/config"
+
+	blocks "gx/ipfs/QmSn9Td7xgxm9EV7iEjTckpUWmWApggzPxu7eFGWkkpwin/go-block-format"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
+)
+
+func newTestStore() *Store {
+	s := NewStore(dssync.MutexWrap(ds.NewMapDatastore()))
+	clock := time.Unix(1500000000, 0)
+	s.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	return s
+}
+
+func TestServed(t *testing.T) {
+	s := newTestStore()
+	root := blocks.NewBlock([]byte("root")).Cid()
+	p := peer.ID("p")
+
+	for i := 0; i < 2; i++ {
+		err := s.AddServed([]decision.Usage{{Peer: p, Wallet: "wallet", Root: root, Bytes: 100}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	served, err := s.Served()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(served) != 1 || served[0].Bytes != 200 || served[0].Root != root.String() {
+		t.Fatalf("unexpected served traffic %+v", served)
+	}
+}
+
+func TestSettle(t *testing.T) {
+	s := newTestStore()
+	sk, client := newIdentity(t)
+	provider := peer.ID("provider")
+
+	var receipts []*Receipt
+	for i := 0; i < 5; i++ {
+		r := signedReceipt(t, sk, provider, client, uint64(i+1))
+		if ok, err := s.PutReceipt(r); err != nil || !ok {
+			t.Fatalf("receipt must be stored: %v", err)
+		}
+		receipts = append(receipts, r)
+	}
+	if ok, err := s.PutReceipt(receipts[0]); err != nil || ok {
+		t.Fatalf("the same receipt must not be stored twice: %v", err)
+	}
+
+	var batches [][]sc.DownloadReceipt
+	fail := false
+	settler, err := NewSettler(s, config.Billing{BatchSize: 2}, func(rs []sc.DownloadReceipt) error {
+		if fail {
+			return errors.New("SC is unavailable")
+		}
+		batches = append(batches, rs)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fail = true
+	if n, err := settler.Settle(); err == nil || n != 0 {
+		t.Fatalf("failed batch must not be settled, got %d %v", n, err)
+	}
+	if pending, _ := s.Pending(0); len(pending) != 5 {
+		t.Fatalf("receipts must stay pending, got %d", len(pending))
+	}
+
+	fail = false
+	if n, err := settler.Settle(); err != nil || n != 5 {
+		t.Fatalf("expected 5 settled receipts, got %d %v", n, err)
+	}
+	if len(batches) != 3 || len(batches[0]) != 2 || len(batches[2]) != 1 {
+		t.Fatalf("unexpected batches %v", batches)
+	}
+	// oldest receipts are settled first
+	if batches[0][0].Bytes != 1 || batches[2][0].Bytes != 5 {
+		t.Fatalf("receipts must be settled in order, got %v", batches)
+	}
+	if pending, _ := s.Pending(0); len(pending) != 0 {
+		t.Fatalf("no receipts must be pending, got %d", len(pending))
+	}
+
+	if _, err = NewSettler(s, config.Billing{SettleInterval: "never"}, nil); err == nil {
+		t.Fatal("invalid interval must be rejected")
+	}
+}
@@ -6,8 +6,11 @@ import (
 	"fmt"
 	"net"
 	"regexp"
+	"strconv"
 
 	"github.com/Casper-dev/Casper-server/casper/sc"
+	scin "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+	"github.com/Casper-dev/Casper-server/casper/thrift"
 	"github.com/Casper-dev/Casper-server/core"
 	"github.com/Casper-dev/Casper-server/repo/config"
 
@@ -98,7 +101,12 @@ func RegisterSC(ctx context.Context, node *core.IpfsNode, cfg *config.Config, ad
 			log.Error("failed to parse multiaddr:", err)
 			return ErrInvalidLocalAddr
 		}
-		localNode = &ExternalAddr{id, &net.TCPAddr{IP: net.ParseIP(ip), Port: 9090}}
+		port, err := strconv.Atoi(cfg.Casper.ConnectionPort)
+		if err != nil {
+			log.Errorf("invalid connection port '%s': %v", cfg.Casper.ConnectionPort, err)
+			return ErrInvalidLocalAddr
+		}
+		localNode = &ExternalAddr{id, &net.TCPAddr{IP: net.ParseIP(ip), Port: port}}
 	}
 
 	fmt.Println("Full node address:", localNode.String())
@@ -108,6 +116,13 @@ func RegisterSC(ctx context.Context, node *core.IpfsNode, cfg *config.Config, ad
 		log.Warning("no settings for connection to blockchain are specified, using default")
 		settings = nil
 	}
+	// SC bindings keep their state (e.g. positions of event subscriptions
+	// or the whole mock SC) in the repo so that it survives restarts
+	repoSettings := scin.InitOpts{"Datastore": node.Repo.Datastore()}
+	for k, v := range settings {
+		repoSettings[k] = v
+	}
+	settings = repoSettings
 
 	c, err := sc.GetContractByName(ctx, cfg.Casper.UsedChain, settings)
 	if err != nil {
@@ -121,12 +136,16 @@ func RegisterSC(ctx context.Context, node *core.IpfsNode, cfg *config.Config, ad
 	c.AddToken(13370000000)
 
 	taddr := localNode.Thrift()
+	rpcAddr := taddr.String()
+	if cfg.Casper.ThriftOverLibp2p {
+		rpcAddr = thrift.PeerAddr(node.Identity)
+	}
 	connectionString := regexp.MustCompile("ip4/.+/tcp").ReplaceAllString(cfg.Addresses.Swarm[0], "ip4/"+taddr.IP.String()+"/tcp")
 	fmt.Println("Conn string", connectionString)
 	nodeID := localNode.IPFSAddr.ID().Pretty()
-	err = c.RegisterProvider(nodeID, cfg.Casper.TelegramAddress, connectionString, taddr.String(), 13370000000)
+	err = c.RegisterProvider(nodeID, cfg.Casper.TelegramAddress, connectionString, rpcAddr, 13370000000)
 	if err != nil { // the provider is already registered
-		err = c.SetRPCAddr(nodeID, taddr.String())
+		err = c.SetRPCAddr(nodeID, rpcAddr)
 		if err != nil {
 			if isBanned, _ := c.VerifyReplication(localNode.NodeHash()); isBanned {
 				color.New(color.BgRed).Print("    Node is banned    ")
@@ -135,7 +154,7 @@ func RegisterSC(ctx context.Context, node *core.IpfsNode, cfg *config.Config, ad
 			return fmt.Errorf("cant update IP in SC: %v", err)
 		}
 	} else {
-		err = c.SetRPCAddr(nodeID, taddr.String())
+		err = c.SetRPCAddr(nodeID, rpcAddr)
 		if err != nil {
 			log.Error(err)
 		}
@@ -201,6 +220,28 @@ func GetPeersMultiaddrsByHash(hash string) (ret []ma.Multiaddr, err error) {
 	return GetPeersMultiaddrs(hash)
 }
 
+// GetThriftAddr returns address of thrift server of the provider
+// as registered in SC. peer must contain /ipfs/ part. If provider
+// has no RPC address in SC, it is called over libp2p.
+func GetThriftAddr(peer ma.Multiaddr) (string, error) {
+	addr, err := ipfsaddr.ParseMultiaddr(peer)
+	if err != nil {
+		return "", err
+	}
+
+	c, err := sc.GetContract()
+	if err != nil {
+		return "", err
+	}
+
+	rpcAddr, err := c.GetRPCAddr(addr.ID().Pretty())
+	if err != nil || rpcAddr == "" {
+		log.Debugf("no RPC address of %s in SC (%v), using libp2p", addr.ID().Pretty(), err)
+		return thrift.PeerAddr(addr.ID()), nil
+	}
+	return rpcAddr, nil
+}
+
 func GetIpPortsByHash(hash string) (ret []string) {
 	// FIXME
 	c, _ := sc.GetContract()
@@ -0,0 +1,159 @@
+package casper_utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/casper/sc"
+	scin "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+	"github.com/Casper-dev/Casper-server/core"
+
+	pstore "gx/ipfs/QmPgDWmTmuzvP7QE5zwo1TmjbJme9pmZHNujB2453jkCTr/go-libp2p-peerstore"
+	ma "gx/ipfs/QmXY77cVe7rVRQXZZQRioukUM7aRW3BTcAgJe12MCtb3Ji/go-multiaddr"
+	"gx/ipfs/QmeS8cCKawUwejVrsBtmC1toTXmwVWZGiRJqzgTURVWeF9/go-ipfs-addr"
+)
+
+const latencyTimeout = 5 * time.Second
+
+// Candidate is a provider which can be used to store a file.
+type Candidate struct {
+	ID     string
+	Addr   ma.Multiaddr
+	Origin string
+	// Latency is zero if it was not measured or peer is unreachable
+	Latency time.Duration
+}
+
+// GetCandidates returns up to count distinct providers which have enough
+// space to store file of specified size. Providers from exclude are skipped,
+// more peers are requested from SC to make up for them.
+func GetCandidates(size int64, count int, exclude []string) ([]*Candidate, error) {
+	c, err := sc.GetContract()
+	if err != nil {
+		return nil, err
+	}
+
+	peers, err := c.GetPeers(size, count+len(exclude))
+	if err != nil {
+		return nil, err
+	}
+
+	skip := make(map[string]bool, len(exclude)+len(peers))
+	for _, p := range exclude {
+		skip[p] = true
+	}
+
+	var cands []*Candidate
+	for _, peer := range peers {
+		if len(cands) == count {
+			break
+		}
+		if peer == "" || skip[peer] {
+			continue
+		}
+		skip[peer] = true
+
+		ipPort, err := c.GetAPIAddr(peer)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		addr, err := ma.NewMultiaddr(fmt.Sprintf("%s/ipfs/%s", ipPort, peer))
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		cands = append(cands, &Candidate{ID: peer, Addr: addr})
+	}
+
+	ids := make([]string, len(cands))
+	for i, cand := range cands {
+		ids[i] = cand.ID
+	}
+	origins, err := scin.OriginCodes(c, ids)
+	if err != nil {
+		log.Debugf("can't get origins of candidates: %v", err)
+	}
+	for _, cand := range cands {
+		cand.Origin = origins[cand.ID]
+	}
+	return cands, nil
+}
+
+// MeasureLatency pings all candidates concurrently and sets their Latency.
+func MeasureLatency(ctx context.Context, n *core.IpfsNode, cands []*Candidate) {
+	var wg sync.WaitGroup
+	for _, c := range cands {
+		wg.Add(1)
+		go func(c *Candidate) {
+			defer wg.Done()
+
+			addr, err := ipfsaddr.ParseMultiaddr(c.Addr)
+			if err != nil {
+				log.Error(err)
+				return
+			}
+			n.Peerstore.AddAddr(addr.ID(), addr.Transport(), pstore.TempAddrTTL)
+
+			tctx, cancel := context.WithTimeout(ctx, latencyTimeout)
+			defer cancel()
+			pings, err := n.Ping.Ping(tctx, addr.ID())
+			if err != nil {
+				log.Debugf("can't ping %s: %v", c.ID, err)
+				return
+			}
+			select {
+			case t, ok := <-pings:
+				if ok {
+					c.Latency = t
+				}
+			case <-tctx.Done():
+			}
+		}(c)
+	}
+	wg.Wait()
+}
+
+// OrderCandidates returns candidates in order they should be tried.
+// If byLatency is set, candidates with lower latency go first and
+// unreachable ones go last. If spreadOrigins is set, candidates from
+// different origins are interleaved, so that first replicas are placed
+// in as many locations as possible.
+func OrderCandidates(cands []*Candidate, byLatency, spreadOrigins bool) []*Candidate {
+	ret := make([]*Candidate, len(cands))
+	copy(ret, cands)
+
+	if byLatency {
+		sort.SliceStable(ret, func(i, j int) bool {
+			li, lj := ret[i].Latency, ret[j].Latency
+			return li != 0 && (lj == 0 || li < lj)
+		})
+	}
+	if !spreadOrigins {
+		return ret
+	}
+
+	var origins []string
+	groups := make(map[string][]*Candidate)
+	for _, c := range ret {
+		if _, ok := groups[c.Origin]; !ok {
+			origins = append(origins, c.Origin)
+		}
+		groups[c.Origin] = append(groups[c.Origin], c)
+	}
+
+	ret = ret[:0]
+	for len(ret) < len(cands) {
+		for _, o := range origins {
+			if g := groups[o]; len(g) > 0 {
+				ret = append(ret, g[0])
+				groups[o] = g[1:]
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,43 @@
+package casper_utils
+
+import (
+	"testing"
+	"time"
+)
+
+func candidateIDs(cands []*Candidate) (ids string) {
+	for _, c := range cands {
+		ids += c.ID
+	}
+	return ids
+}
+
+func TestOrderCandidates(t *testing.T) {
+	cands := []*Candidate{
+		{ID: "a", Origin: "RU", Latency: 30 * time.Millisecond},
+		{ID: "b", Origin: "RU", Latency: 10 * time.Millisecond},
+		{ID: "c", Origin: "DE"},
+		{ID: "d", Origin: "US", Latency: 20 * time.Millisecond},
+		{ID: "e", Origin: "DE", Latency: 40 * time.Millisecond},
+	}
+
+	tests := []struct {
+		byLatency, spread bool
+		expected          string
+	}{
+		{false, false, "abcde"},
+		{true, false, "bdaec"},
+		{false, true, "acdbe"},
+		{true, true, "bdeac"},
+	}
+	for _, test := range tests {
+		ids := candidateIDs(OrderCandidates(cands, test.byLatency, test.spread))
+		if ids != test.expected {
+			t.Errorf("latency=%t spread=%t: expected %s, got %s", test.byLatency, test.spread, test.expected, ids)
+		}
+	}
+
+	if ids := candidateIDs(cands); ids != "abcde" {
+		t.Fatalf("original slice must not be modified, got %s", ids)
+	}
+}
@@ -0,0 +1,174 @@
+// Package catalog lists UUID files stored on the node. Metadata of a file
+// is kept in its core.UUIDInfo and is refreshed every time contents of
+// the file are replaced, so that clients can find files by name prefix
+// and user-defined tags without keeping a database of their own.
+package catalog
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/core"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+)
+
+// DefaultLimit is the page size used when limit is not specified.
+const DefaultLimit = 100
+
+var (
+	ErrBadTag  = errors.New("tag must be non-empty and must not contain commas")
+	ErrUnknown = errors.New("unknown UUID")
+)
+
+// File is a UUID file with its metadata.
+type File struct {
+	UUID    string
+	Name    string `json:",omitempty"`
+	Type    string `json:",omitempty"`
+	Size    uint64
+	Root    string `json:",omitempty"`
+	Created time.Time
+	Updated time.Time
+	Tags    []string `json:",omitempty"`
+	// Owner is the ID of the owner key, empty if file has no owner
+	Owner string `json:",omitempty"`
+}
+
+// NewFile returns file with specified UUID described by info.
+func NewFile(uuid string, info *core.UUIDInfo) *File {
+	return &File{
+		UUID:    uuid,
+		Name:    info.Name,
+		Type:    info.Type,
+		Size:    info.Size,
+		Root:    info.Root,
+		Created: info.Created,
+		Updated: info.Updated,
+		Tags:    info.Tags,
+		Owner:   info.PubKey,
+	}
+}
+
+// Filter selects files for listing. Zero fields match all files.
+type Filter struct {
+	// Tag must be one of file tags
+	Tag string
+	// Prefix must be a prefix of file name
+	Prefix string
+}
+
+// Match checks if f is selected by filter.
+func (q *Filter) Match(f *File) bool {
+	if !strings.HasPrefix(f.Name, q.Prefix) {
+		return false
+	}
+	if q.Tag == "" {
+		return true
+	}
+	for _, t := range f.Tags {
+		if t == q.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Page is a part of the file list ordered by UUID.
+type Page struct {
+	Files []*File
+	// Next is passed as after to get the next page,
+	// empty if this is the last one
+	Next string `json:",omitempty"`
+}
+
+// List returns up to limit files with UUIDs greater than after
+// which are selected by q.
+func List(q Filter, after string, limit int) *Page {
+	var all []*File
+	core.UUIDInfoCache.Range(func(k, v interface{}) bool {
+		if uuid := k.(string); uuid > after {
+			if f := NewFile(uuid, v.(*core.UUIDInfo)); q.Match(f) {
+				all = append(all, f)
+			}
+		}
+		return true
+	})
+	return paginate(all, limit)
+}
+
+func paginate(files []*File, limit int) *Page {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].UUID < files[j].UUID })
+
+	p := &Page{Files: files}
+	if len(files) > limit {
+		p.Files = files[:limit]
+		p.Next = files[limit-1].UUID
+	}
+	if p.Files == nil {
+		p.Files = []*File{}
+	}
+	return p
+}
+
+// Info returns file with specified UUID.
+func Info(n *core.IpfsNode, uuid string) (*File, error) {
+	info, err := n.GetUUID(uuid)
+	if err == ds.ErrNotFound {
+		return nil, ErrUnknown
+	} else if err != nil {
+		return nil, err
+	}
+	return NewFile(uuid, info), nil
+}
+
+// Tag adds and removes tags of the file with specified UUID
+// and returns the file.
+func Tag(n *core.IpfsNode, uuid string, add, remove []string) (*File, error) {
+	for _, t := range append(append([]string{}, add...), remove...) {
+		if !validTag(t) {
+			return nil, ErrBadTag
+		}
+	}
+	if _, err := Info(n, uuid); err != nil {
+		return nil, err
+	}
+
+	var f *File
+	err := n.UpdateUUID(uuid, func(info *core.UUIDInfo) error {
+		info.Tags = updateTags(info.Tags, add, remove)
+		f = NewFile(uuid, info)
+		return nil
+	})
+	return f, err
+}
+
+func validTag(t string) bool {
+	return t != "" && strings.TrimSpace(t) == t && !strings.Contains(t, ",")
+}
+
+// updateTags returns new sorted list of tags, tags is not modified.
+func updateTags(tags, add, remove []string) []string {
+	set := make(map[string]bool)
+	for _, t := range tags {
+		set[t] = true
+	}
+	for _, t := range add {
+		set[t] = true
+	}
+	for _, t := range remove {
+		delete(set, t)
+	}
+
+	var res []string
+	for t := range set {
+		res = append(res, t)
+	}
+	sort.Strings(res)
+	return res
+}
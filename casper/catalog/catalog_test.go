@@ -0,0 +1,115 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/Casper-dev/Casper-server/core/coreunix"
+	coremock "github.com/Casper-dev/Casper-server/core/mock"
+	dag "github.com/Casper-dev/Casper-server/merkledag"
+)
+
+func TestTouchAndTag(t *testing.T) {
+	n, err := coremock.NewMockNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	data := []byte("<html><body>casper</body></html>")
+	_, root, err := coreunix.AddWrapped(n, bytes.NewReader(data), "page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const uuid = "testTouchAndTag"
+	defer n.RemoveUUID(uuid)
+
+	pn := root.(*dag.ProtoNode)
+	if err = Touch(context.Background(), n, uuid, pn); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Info(n, uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "page" || f.Size != uint64(len(data)) || f.Type != "text/html; charset=utf-8" {
+		t.Fatalf("unexpected metadata %+v", f)
+	}
+	if f.Root != pn.Links()[0].Cid.String() {
+		t.Fatalf("root must be CID of contents, got %s", f.Root)
+	}
+	if f.Created.IsZero() || !f.Updated.Equal(f.Created) {
+		t.Fatalf("unexpected times %v %v", f.Created, f.Updated)
+	}
+
+	if f, err = Tag(n, uuid, []string{"b", "a", "c"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = Tag(n, uuid, nil, []string{"c"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Tags) != 2 || f.Tags[0] != "a" || f.Tags[1] != "b" {
+		t.Fatalf("unexpected tags %v", f.Tags)
+	}
+	if _, err = Tag(n, uuid, []string{"a,b"}, nil); err != ErrBadTag {
+		t.Fatalf("expected bad tag, got %v", err)
+	}
+	if _, err = Tag(n, "unknown", []string{"a"}, nil); err != ErrUnknown {
+		t.Fatalf("expected unknown UUID, got %v", err)
+	}
+
+	// tags are kept when contents are replaced
+	if err = Touch(context.Background(), n, uuid, pn); err != nil {
+		t.Fatal(err)
+	}
+	if f, _ = Info(n, uuid); len(f.Tags) != 2 {
+		t.Fatalf("tags were lost: %+v", f)
+	}
+
+	p := List(Filter{Tag: "a", Prefix: "pa"}, "", 0)
+	if len(p.Files) != 1 || p.Files[0].UUID != uuid {
+		t.Fatalf("file must be listed, got %+v", p.Files)
+	}
+	if p = List(Filter{Tag: "c"}, "", 0); len(p.Files) != 0 {
+		t.Fatalf("file must not be listed, got %+v", p.Files)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	f := &File{Name: "report.pdf", Tags: []string{"docs", "2017"}}
+	for _, c := range []struct {
+		q     Filter
+		match bool
+	}{
+		{Filter{}, true},
+		{Filter{Prefix: "rep"}, true},
+		{Filter{Prefix: "pdf"}, false},
+		{Filter{Tag: "docs"}, true},
+		{Filter{Tag: "doc"}, false},
+		{Filter{Tag: "2017", Prefix: "report"}, true},
+		{Filter{Tag: "2017", Prefix: "x"}, false},
+	} {
+		if c.q.Match(f) != c.match {
+			t.Errorf("%+v: expected match %v", c.q, c.match)
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	var files []*File
+	for _, uuid := range []string{"d", "b", "a", "c", "e"} {
+		files = append(files, &File{UUID: uuid})
+	}
+
+	p := paginate(files, 2)
+	if len(p.Files) != 2 || p.Files[0].UUID != "a" || p.Files[1].UUID != "b" || p.Next != "b" {
+		t.Fatalf("unexpected page %+v next %s", p.Files, p.Next)
+	}
+	if p = paginate(files[:2], 2); p.Next != "" {
+		t.Fatalf("last page must not have next, got %s", p.Next)
+	}
+	if p = paginate(nil, 0); p.Files == nil || len(p.Files) != 0 {
+		t.Fatal("empty page must have empty list")
+	}
+}
@@ -0,0 +1,96 @@
+package catalog
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/core"
+	dag "github.com/Casper-dev/Casper-server/merkledag"
+	ft "github.com/Casper-dev/Casper-server/unixfs"
+	uio "github.com/Casper-dev/Casper-server/unixfs/io"
+
+	cid "gx/ipfs/QmNp85zy9RLrQ5oQD4hPyS39ezrrXpcaa7R4Y9kxdWQLLQ/go-cid"
+	node "gx/ipfs/QmPN7cwmpcc4DWXb4KTB9dNAJgjuPY69h3npsMfhRrQL9c/go-ipld-format"
+	"gx/ipfs/QmT8rehPR3F6bmwL6zjUN8XpiDBFFpMP2myPdC6ApsWfJf/go-base58"
+)
+
+// sniffLen is the number of bytes used to detect content type.
+const sniffLen = 512
+
+// Touch refreshes metadata of the file with specified UUID after its
+// root was replaced with root. Single file is wrapped in a directory,
+// so its name is taken from the link. Root CID of other files is
+// recorded without UUID like versions do.
+func Touch(ctx context.Context, n *core.IpfsNode, uuid string, root *dag.ProtoNode) error {
+	content := root.Copy().(*dag.ProtoNode)
+	content.SetUUID(nil)
+
+	var name string
+	var nd node.Node = content
+	if fsn, err := ft.FSNodeFromBytes(root.Data()); err == nil {
+		if fsn.Type == ft.TDirectory && len(fsn.Data) == 0 && len(root.Links()) == 1 {
+			l := root.Links()[0]
+			var err error
+			if nd, err = l.GetNode(ctx, n.DAG); err != nil {
+				return err
+			}
+			name = l.Name
+		}
+	}
+
+	var size uint64
+	var typ string
+	r, err := uio.NewDagReader(ctx, nd, n.DAG)
+	switch err {
+	case nil:
+		defer r.Close()
+		size, typ = r.Size(), mime.TypeByExtension(filepath.Ext(name))
+		if typ == "" {
+			buf := make([]byte, sniffLen)
+			k, err := io.ReadFull(r, buf)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			typ = http.DetectContentType(buf[:k])
+		}
+	case uio.ErrIsDir:
+		if size, err = nd.Size(); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	now := time.Now().UTC()
+	return n.UpdateUUID(uuid, func(info *core.UUIDInfo) error {
+		if info.Created.IsZero() {
+			info.Created = now
+		}
+		info.Updated = now
+		info.Name, info.Type, info.Size = name, typ, size
+		info.Root = nd.Cid().String()
+		return nil
+	})
+}
+
+// TouchHash refreshes metadata of the file whose root has specified hash.
+// Nothing is done if the root has no UUID.
+func TouchHash(ctx context.Context, n *core.IpfsNode, hash string) error {
+	c, err := cid.Decode(hash)
+	if err != nil {
+		return err
+	}
+	nd, err := n.DAG.Get(ctx, c)
+	if err != nil {
+		return err
+	}
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok || len(pn.UUID()) == 0 {
+		return nil
+	}
+	return Touch(ctx, n, base58.Encode(pn.UUID()), pn)
+}
@@ -0,0 +1,376 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Encrypted stream consists of a header followed by chunks of plaintext
+// sealed with AES-256-GCM. The header is magic "CSPE", format version,
+// key kind, key ID, salt and plaintext chunk size. Every chunk except the
+// last one holds exactly chunk size bytes of plaintext, the last one may be
+// shorter or even empty. File key is derived from the salt, so that nonces
+// are never reused: nonce of a chunk is its index followed by a byte which
+// is 1 for the last chunk. Header is additional data of every chunk, which
+// makes tampering with the header, reordering and truncation detectable.
+// As chunks have fixed size, decrypter can seek without reading the whole
+// stream.
+
+const (
+	FormatVersion    = 1
+	DefaultChunkSize = 64 * 1024
+	maxChunkSize     = 16 * 1024 * 1024
+
+	magic     = "CSPE"
+	keyIDSize = 8
+	headerLen = len(magic) + 2 + keyIDSize + SaltSize + 4
+	nonceSize = 12
+)
+
+var (
+	ErrNotEncrypted = errors.New("data is not encrypted or has unknown format")
+	ErrVersion      = errors.New("unsupported encryption format version")
+	ErrWrongKey     = errors.New("data is encrypted with a different key")
+	ErrNotSeekable  = errors.New("convergent encryption requires seekable input")
+	// ErrAuth is returned when ciphertext does not pass authentication
+	ErrAuth = errors.New("ciphertext is corrupted or key is wrong")
+)
+
+type header struct {
+	kind      KeyKind
+	keyID     [keyIDSize]byte
+	salt      []byte
+	chunkSize int
+}
+
+func (h *header) marshal() []byte {
+	b := make([]byte, 0, headerLen)
+	b = append(b, magic...)
+	b = append(b, FormatVersion, byte(h.kind))
+	b = append(b, h.keyID[:]...)
+	b = append(b, h.salt...)
+	var cs [4]byte
+	binary.BigEndian.PutUint32(cs[:], uint32(h.chunkSize))
+	return append(b, cs[:]...)
+}
+
+func parseHeader(b []byte) (*header, error) {
+	if len(b) < headerLen || string(b[:len(magic)]) != magic {
+		return nil, ErrNotEncrypted
+	}
+	b = b[len(magic):]
+	if b[0] != FormatVersion {
+		return nil, ErrVersion
+	}
+	h := &header{kind: KeyKind(b[1])}
+	b = b[2:]
+	copy(h.keyID[:], b)
+	b = b[keyIDSize:]
+	h.salt = append([]byte(nil), b[:SaltSize]...)
+	h.chunkSize = int(binary.BigEndian.Uint32(b[SaltSize:]))
+	if h.chunkSize <= 0 || h.chunkSize > maxChunkSize {
+		return nil, ErrNotEncrypted
+	}
+	return h, nil
+}
+
+func chunkNonce(idx uint64, last bool) []byte {
+	nonce := make([]byte, nonceSize)
+	binary.BigEndian.PutUint64(nonce, idx)
+	if last {
+		nonce[nonceSize-1] = 1
+	}
+	return nonce
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(c)
+}
+
+type encReader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	header []byte
+	idx    uint64
+	plain  []byte
+	sealed []byte
+	out    []byte
+	done   bool
+}
+
+// NewEncryptReader returns reader of r encrypted with a new file key
+// derived from key. If key is convergent, r must be an io.Seeker.
+func NewEncryptReader(r io.Reader, key *Key) (io.Reader, error) {
+	var salt []byte
+	var err error
+	if key.convergent {
+		rs, ok := r.(io.Seeker)
+		if !ok {
+			return nil, ErrNotSeekable
+		}
+		salt, err = convergentSalt(r, rs, key)
+	} else {
+		salt, err = genSalt()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h := &header{kind: key.kind, keyID: key.id, salt: salt, chunkSize: DefaultChunkSize}
+	aead, err := newAEAD(key.derive(salt))
+	if err != nil {
+		return nil, err
+	}
+
+	hdr := h.marshal()
+	return &encReader{
+		r:      bufio.NewReaderSize(r, h.chunkSize),
+		aead:   aead,
+		header: hdr,
+		plain:  make([]byte, h.chunkSize),
+		sealed: make([]byte, 0, h.chunkSize+aead.Overhead()),
+		out:    hdr,
+	}, nil
+}
+
+// NewEncryptReadCloser is like NewEncryptReader, but closes r on Close.
+func NewEncryptReadCloser(r io.ReadCloser, key *Key) (io.ReadCloser, error) {
+	er, err := NewEncryptReader(r, key)
+	if err != nil {
+		return nil, err
+	}
+	return &aesReadCloser{SR: er, r: &r}, nil
+}
+
+func (e *encReader) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.seal(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+func (e *encReader) seal() error {
+	n, err := io.ReadFull(e.r, e.plain)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	last := n < len(e.plain)
+	if !last {
+		if _, err = e.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	e.out = e.aead.Seal(e.sealed[:0], chunkNonce(e.idx, last), e.plain[:n], e.header)
+	e.idx++
+	e.done = last
+	return nil
+}
+
+// Decrypter reads and authenticates data written by encrypting reader.
+// If the underlying reader is an io.Seeker, Decrypter can seek too.
+type Decrypter struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	header []byte
+	chunk  int
+
+	idx    uint64
+	sealed []byte
+	buf    []byte
+	plain  []byte
+	eof    bool
+	off    int64
+}
+
+// NewDecrypter reads header from r and checks that it can be decrypted with key.
+func NewDecrypter(r io.Reader, key *Key) (*Decrypter, error) {
+	hdr := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrNotEncrypted
+		}
+		return nil, err
+	}
+	return newDecrypter(r, hdr, key)
+}
+
+func newDecrypter(r io.Reader, hdr []byte, key *Key) (*Decrypter, error) {
+	h, err := parseHeader(hdr)
+	if err != nil {
+		return nil, err
+	}
+	if h.kind != key.kind || h.keyID != key.id {
+		return nil, ErrWrongKey
+	}
+	aead, err := newAEAD(key.derive(h.salt))
+	if err != nil {
+		return nil, err
+	}
+	return &Decrypter{
+		r:      r,
+		aead:   aead,
+		header: hdr,
+		chunk:  h.chunkSize,
+		sealed: make([]byte, h.chunkSize+aead.Overhead()),
+		buf:    make([]byte, 0, h.chunkSize),
+	}, nil
+}
+
+// NewDecryptReader returns reader of decrypted r. Data encrypted by old
+// versions with unauthenticated AES-CTR is still decrypted if key is a
+// password.
+func NewDecryptReader(r io.Reader, key *Key) (io.Reader, error) {
+	hdr := make([]byte, headerLen)
+	n, err := io.ReadFull(r, hdr)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	hdr = hdr[:n]
+
+	if n < len(magic) || !bytes.Equal(hdr[:len(magic)], []byte(magic)) {
+		if key.kind != PasswordKey || n < SaltSize {
+			return nil, ErrNotEncrypted
+		}
+		log.Warning("data is encrypted with legacy unauthenticated format")
+		return NewAESReader(io.MultiReader(bytes.NewReader(hdr), r), key.secret), nil
+	}
+	return newDecrypter(r, hdr, key)
+}
+
+func (d *Decrypter) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.eof {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	d.off += int64(n)
+	return n, nil
+}
+
+// open reads and authenticates next chunk.
+func (d *Decrypter) open() error {
+	n, err := io.ReadFull(d.r, d.sealed)
+	switch err {
+	case nil, io.ErrUnexpectedEOF:
+	case io.EOF:
+		// the last chunk is missing
+		return ErrAuth
+	default:
+		return err
+	}
+
+	sealed := d.sealed[:n]
+	if n == len(d.sealed) {
+		// full chunk can be the last one only if there is nothing after it
+		if d.plain, err = d.aead.Open(d.buf[:0], chunkNonce(d.idx, false), sealed, d.header); err == nil {
+			d.idx++
+			return nil
+		}
+	}
+	if d.plain, err = d.aead.Open(d.buf[:0], chunkNonce(d.idx, true), sealed, d.header); err != nil {
+		return ErrAuth
+	}
+	if n == len(d.sealed) {
+		var b [1]byte
+		if m, _ := io.ReadFull(d.r, b[:]); m != 0 {
+			return ErrAuth
+		}
+	}
+	d.idx++
+	d.eof = true
+	return nil
+}
+
+// Size returns size of plaintext. The underlying reader must be an io.Seeker.
+func (d *Decrypter) Size() (int64, error) {
+	s, ok := d.r.(io.Seeker)
+	if !ok {
+		return 0, errors.New("reader is not seekable")
+	}
+	cur, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = s.Seek(cur, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	sealed := end - int64(headerLen)
+	enc := int64(len(d.sealed))
+	chunks := (sealed + enc - 1) / enc
+	size := sealed - chunks*int64(d.aead.Overhead())
+	if chunks == 0 || size < 0 {
+		return 0, ErrAuth
+	}
+	return size, nil
+}
+
+// Seek sets offset in plaintext for the next Read.
+func (d *Decrypter) Seek(offset int64, whence int) (int64, error) {
+	s, ok := d.r.(io.Seeker)
+	if !ok {
+		return 0, errors.New("reader is not seekable")
+	}
+	size, err := d.Size()
+	if err != nil {
+		return 0, err
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.off
+	case io.SeekEnd:
+		offset += size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if offset >= size {
+		d.plain, d.eof, d.off = nil, true, offset
+		return offset, nil
+	}
+
+	idx := offset / int64(d.chunk)
+	if _, err = s.Seek(int64(headerLen)+idx*int64(len(d.sealed)), io.SeekStart); err != nil {
+		return 0, err
+	}
+	d.idx, d.plain, d.eof = uint64(idx), nil, false
+	if err = d.open(); err != nil {
+		return 0, err
+	}
+	d.plain = d.plain[offset-idx*int64(d.chunk):]
+	d.off = offset
+	return offset, nil
+}
@@ -0,0 +1,181 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+)
+
+func encrypt(t *testing.T, data []byte, key *Key) []byte {
+	er, err := NewEncryptReader(bytes.NewReader(data), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := ioutil.ReadAll(er)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enc
+}
+
+func decrypt(enc []byte, key *Key) ([]byte, error) {
+	dr, err := NewDecryptReader(bytes.NewReader(enc), key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(dr)
+}
+
+func randBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := NewPasswordKey([]byte("password"))
+	for _, size := range []int{0, 1, DefaultChunkSize - 1, DefaultChunkSize, 3*DefaultChunkSize + 17} {
+		data := randBytes(size)
+		enc := encrypt(t, data, key)
+		chunks := (size + DefaultChunkSize - 1) / DefaultChunkSize
+		if chunks == 0 {
+			chunks = 1
+		}
+		if len(enc) != headerLen+size+chunks*16 {
+			t.Fatalf("size %d: unexpected ciphertext size %d", size, len(enc))
+		}
+
+		dec, err := decrypt(enc, key)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(dec, data) {
+			t.Fatalf("size %d: decrypted data does not match", size)
+		}
+	}
+}
+
+func TestTampering(t *testing.T) {
+	key := NewPasswordKey([]byte("password"))
+	data := randBytes(2*DefaultChunkSize + 100)
+	enc := encrypt(t, data, key)
+
+	flipped := append([]byte(nil), enc...)
+	flipped[headerLen+DefaultChunkSize+50] ^= 1
+	if _, err := decrypt(flipped, key); err != ErrAuth {
+		t.Fatalf("modified ciphertext must be detected, got %v", err)
+	}
+
+	// chunk size and salt are authenticated too
+	flipped = append([]byte(nil), enc...)
+	flipped[headerLen-1] ^= 1
+	if _, err := decrypt(flipped, key); err == nil {
+		t.Fatal("modified header must be detected")
+	}
+
+	truncated := [][]byte{
+		enc[:headerLen+2*(DefaultChunkSize+16)],
+		enc[:len(enc)-1],
+		append(append([]byte(nil), enc...), 0),
+	}
+	for _, b := range truncated {
+		if _, err := decrypt(b, key); err != ErrAuth {
+			t.Fatalf("ciphertext of length %d must be rejected, got %v", len(b), err)
+		}
+	}
+
+	// full last chunk followed by more data
+	enc2 := encrypt(t, data[:2*DefaultChunkSize], key)
+	if _, err := decrypt(append(enc2, 0), key); err != ErrAuth {
+		t.Fatalf("extra data must be detected, got %v", err)
+	}
+
+	if _, err := decrypt(enc, NewPasswordKey([]byte("wrong"))); err != ErrAuth {
+		t.Fatalf("wrong password must be detected, got %v", err)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	key := NewPasswordKey([]byte("password"))
+	data := randBytes(3*DefaultChunkSize + 1000)
+	enc := encrypt(t, data, key)
+
+	d, err := NewDecrypter(bytes.NewReader(enc), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size, err := d.Size(); err != nil || size != int64(len(data)) {
+		t.Fatalf("unexpected size %d %v", size, err)
+	}
+
+	for _, off := range []int64{DefaultChunkSize + 5, 0, 3*DefaultChunkSize + 999, DefaultChunkSize} {
+		if _, err = d.Seek(off, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 100)
+		n, err := io.ReadFull(d, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], data[off:off+int64(n)]) {
+			t.Fatalf("unexpected data at offset %d", off)
+		}
+	}
+
+	if pos, err := d.Seek(-10, io.SeekEnd); err != nil || pos != int64(len(data)-10) {
+		t.Fatalf("unexpected position %d %v", pos, err)
+	}
+	rest, err := ioutil.ReadAll(d)
+	if err != nil || !bytes.Equal(rest, data[len(data)-10:]) {
+		t.Fatalf("unexpected tail %v", err)
+	}
+}
+
+func TestPrivKey(t *testing.T) {
+	sk1, _, err := ci.GenerateKeyPair(ci.RSA, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk2, _, err := ci.GenerateKeyPair(ci.RSA, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key1, err := NewPrivKeyKey(sk1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key2, err := NewPrivKeyKey(sk2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := randBytes(1000)
+	enc := encrypt(t, data, key1)
+	if dec, err := decrypt(enc, key1); err != nil || !bytes.Equal(dec, data) {
+		t.Fatalf("decryption failed: %v", err)
+	}
+	if _, err := decrypt(enc, key2); err != ErrWrongKey {
+		t.Fatalf("another key must be detected, got %v", err)
+	}
+	if _, err := decrypt(enc, NewPasswordKey([]byte("password"))); err != ErrWrongKey {
+		t.Fatalf("password must not decrypt key encrypted data, got %v", err)
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	data := randBytes(1000)
+	enc, err := ioutil.ReadAll(NewAESEncryptReadCloser(ioutil.NopCloser(bytes.NewReader(data)), []byte("password")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec, err := decrypt(enc, NewPasswordKey([]byte("password"))); err != nil || !bytes.Equal(dec, data) {
+		t.Fatalf("legacy data must be decrypted: %v", err)
+	}
+	if _, err := NewDecrypter(bytes.NewReader(enc), NewPasswordKey([]byte("password"))); err != ErrNotEncrypted {
+		t.Fatalf("decrypter must not accept legacy data, got %v", err)
+	}
+}
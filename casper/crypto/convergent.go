@@ -0,0 +1,43 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"io"
+)
+
+// In convergent mode salt of the file is not random, but derived from
+// the hash of its plaintext and the secret of the key. Identical files
+// encrypted with the same key produce identical ciphertext, so that their
+// blocks are deduplicated, while files of other tenants, which have other
+// secrets, share nothing. Providers still see only ciphertext, but anyone
+// who has the key can check if a given file is stored.
+
+// Convergent returns copy of k which encrypts files in convergent mode.
+// Decryption does not depend on the mode.
+func (k *Key) Convergent() *Key {
+	c := *k
+	c.convergent = true
+	return &c
+}
+
+// convergentSalt reads r to the end, returns salt for its contents and
+// seeks back to where r was.
+func convergentSalt(r io.Reader, s io.Seeker, key *Key) ([]byte, error) {
+	start, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if _, err = io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	if _, err = s.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, key.secret)
+	mac.Write([]byte("casper convergent salt"))
+	mac.Write(h.Sum(nil))
+	return mac.Sum(nil)[:SaltSize], nil
+}
@@ -0,0 +1,56 @@
+package crypto
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestConvergent(t *testing.T) {
+	data := randBytes(2*DefaultChunkSize + 10)
+	key := NewPasswordKey([]byte("tenant")).Convergent()
+
+	enc1 := encrypt(t, data, key)
+	enc2 := encrypt(t, data, key)
+	if !bytes.Equal(enc1, enc2) {
+		t.Fatal("identical files must have identical ciphertext")
+	}
+	if dec, err := decrypt(enc1, NewPasswordKey([]byte("tenant"))); err != nil || !bytes.Equal(dec, data) {
+		t.Fatalf("decryption failed: %v", err)
+	}
+
+	if bytes.Equal(encrypt(t, data, NewPasswordKey([]byte("other")).Convergent()), enc1) {
+		t.Fatal("other tenants must not share ciphertext")
+	}
+	other := append([]byte{1}, data[1:]...)
+	if bytes.Equal(encrypt(t, other, key)[:headerLen], enc1[:headerLen]) {
+		t.Fatal("other contents must have other salt")
+	}
+	if bytes.Equal(encrypt(t, data, NewPasswordKey([]byte("tenant"))), enc1) {
+		t.Fatal("random salt must be used by default")
+	}
+
+	if _, err := NewEncryptReader(ioutil.NopCloser(bytes.NewReader(data)), key); err != ErrNotSeekable {
+		t.Fatalf("convergent encryption of stream must fail, got %v", err)
+	}
+}
+
+func TestConvergentOffset(t *testing.T) {
+	data := randBytes(1000)
+	key := NewPasswordKey([]byte("tenant")).Convergent()
+
+	// salt depends only on the rest of the input
+	r := bytes.NewReader(append([]byte("skipped"), data...))
+	r.Seek(7, 0)
+	er, err := NewEncryptReader(r, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := ioutil.ReadAll(er)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(enc, encrypt(t, data, key)) {
+		t.Fatal("ciphertext must not depend on skipped data")
+	}
+}
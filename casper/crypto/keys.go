@@ -0,0 +1,119 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"path/filepath"
+
+	"github.com/Casper-dev/Casper-server/keystore"
+	config "github.com/Casper-dev/Casper-server/repo/config"
+	serialize "github.com/Casper-dev/Casper-server/repo/fsrepo/serialize"
+
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+
+	pbkdf2 "golang.org/x/crypto/pbkdf2"
+)
+
+type KeyKind byte
+
+const (
+	// PasswordKey derives file keys from a password with PBKDF2
+	PasswordKey KeyKind = 1
+	// PrivKeyKey derives file keys from a keystore key with HMAC-SHA256
+	PrivKeyKey KeyKind = 2
+)
+
+// SelfKeyName is the name of the node identity key, like in 'ipfs key'.
+const SelfKeyName = "self"
+
+// Key is a secret which encryption keys of files are derived from.
+type Key struct {
+	kind       KeyKind
+	id         [keyIDSize]byte
+	secret     []byte
+	convergent bool
+}
+
+func NewPasswordKey(passwd []byte) *Key {
+	return &Key{kind: PasswordKey, secret: passwd}
+}
+
+// NewPrivKeyKey returns key derived from k. Encrypted data records ID
+// of k, so that decryption with another key fails early.
+func NewPrivKeyKey(k ci.PrivKey) (*Key, error) {
+	secret, err := k.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	pub, err := k.GetPublic().Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{kind: PrivKeyKey, secret: secret}
+	sum := sha256.Sum256(pub)
+	copy(key.id[:], sum[:])
+	return key, nil
+}
+
+// derive returns encryption key of the file with salt.
+func (k *Key) derive(salt []byte) []byte {
+	if k.kind == PasswordKey {
+		return pbkdf2.Key(k.secret, salt, iterCount, AESKeySize, sha256.New)
+	}
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write([]byte("casper file key"))
+	mac.Write(salt)
+	return mac.Sum(nil)
+}
+
+// LoadRepoKey reads keystore key name from repository at repoRoot
+// without opening it, so that it can be used by the client while
+// the daemon is running.
+func LoadRepoKey(repoRoot, name string) (ci.PrivKey, error) {
+	var sk ci.PrivKey
+	if name == SelfKeyName {
+		fn, err := config.Filename(repoRoot)
+		if err != nil {
+			return nil, err
+		}
+		cfg, err := serialize.Load(fn)
+		if err != nil {
+			return nil, err
+		}
+		if sk, err = cfg.Identity.DecodePrivateKey(""); err != nil {
+			return nil, err
+		}
+	} else {
+		ks, err := keystore.NewFSKeystore(filepath.Join(repoRoot, "keystore"))
+		if err != nil {
+			return nil, err
+		}
+		if sk, err = ks.Get(name); err != nil {
+			return nil, err
+		}
+	}
+	return sk, nil
+}
+
+// ErrNoKey is returned when neither password nor key name is specified.
+var ErrNoKey = errors.New("no encryption key")
+
+// KeyFromOptions returns key from password or keystore key name,
+// only one of which can be set. Key is loaded with getKey.
+func KeyFromOptions(password, keyName string, getKey func(name string) (ci.PrivKey, error)) (*Key, error) {
+	switch {
+	case password != "" && keyName != "":
+		return nil, errors.New("password and key can not be used together")
+	case password != "":
+		return NewPasswordKey([]byte(password)), nil
+	case keyName != "":
+		sk, err := getKey(keyName)
+		if err != nil {
+			return nil, err
+		}
+		return NewPrivKeyKey(sk)
+	}
+	return nil, ErrNoKey
+}
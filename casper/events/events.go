@@ -0,0 +1,197 @@
+// Package events is an in-process bus of file lifecycle events. Uploads,
+// updates and deletions of files, replication, pings and validation
+// publish events to the bus; REST API streams them to clients and
+// webhooks deliver them to configured URLs. Events are not persisted,
+// but the latest ones are kept in memory so that a client which has
+// reconnected can receive events it has missed.
+package events
+
+import (
+	"sync"
+	"time"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+)
+
+var log = logging.Logger("events")
+
+type Type string
+
+const (
+	// FileStored is published when provider stores a new file
+	FileStored Type = "file.stored"
+	// FileUpdated is published when contents of UUID file are replaced
+	FileUpdated Type = "file.updated"
+	// FileDeleted is published when file is deleted from the node
+	FileDeleted Type = "file.deleted"
+	// ReplicaStored and ReplicaFailed are published by uploading
+	// client for every provider it has tried
+	ReplicaStored Type = "replica.stored"
+	ReplicaFailed Type = "replica.failed"
+	// ReplicationDone and ReplicationFailed are published when file
+	// of a banned provider is replicated or runs out of attempts
+	ReplicationDone   Type = "replication.done"
+	ReplicationFailed Type = "replication.failed"
+	// PingFailed is published when provider does not answer ping
+	PingFailed Type = "ping.failed"
+	// ProviderBanned is published when SC bans a provider
+	ProviderBanned Type = "provider.banned"
+	// ValidationPassed and ValidationFailed are published by validation
+	// initiator. Validation fails if there are dissenters or an error.
+	ValidationPassed Type = "validation.passed"
+	ValidationFailed Type = "validation.failed"
+)
+
+// Event is something which has happened to a file or a provider.
+// Only fields related to the event type are set.
+type Event struct {
+	// ID increases with every published event
+	ID   uint64
+	Type Type
+	Time time.Time
+	UUID string `json:",omitempty"`
+	// Hash is the CID of the file root
+	Hash string `json:",omitempty"`
+	// Peer is the ID or address of the provider
+	Peer string `json:",omitempty"`
+	Size int64  `json:",omitempty"`
+	// Dissenters are providers which failed validation
+	Dissenters []string `json:",omitempty"`
+	Error      string   `json:",omitempty"`
+}
+
+const (
+	// HistorySize is the number of latest events kept for replay
+	HistorySize = 256
+	// subBufSize is the number of events subscriber can lag behind
+	subBufSize = 64
+)
+
+// Subscription receives published events of selected types.
+type Subscription struct {
+	// C is closed when subscription is closed
+	C <-chan Event
+
+	c     chan Event
+	types map[Type]bool
+	bus   *Bus
+	// sink, if set, receives events instead of c, it is called
+	// by publisher under the bus lock and must not block
+	sink func(Event)
+}
+
+// Close stops delivery of events.
+func (s *Subscription) Close() {
+	s.bus.mtx.Lock()
+	defer s.bus.mtx.Unlock()
+	if _, ok := s.bus.subs[s]; ok {
+		delete(s.bus.subs, s)
+		if s.c != nil {
+			close(s.c)
+		}
+	}
+}
+
+func (s *Subscription) wants(t Type) bool {
+	return len(s.types) == 0 || s.types[t]
+}
+
+// Bus delivers events to subscribers.
+type Bus struct {
+	mtx     sync.Mutex
+	seq     uint64
+	history []Event
+	subs    map[*Subscription]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]struct{})}
+}
+
+// Publish assigns ID and time to e and delivers it to subscribers.
+// Subscriber which lags behind loses the event.
+func (b *Bus) Publish(e Event) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.seq++
+	e.ID = b.seq
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if len(b.history) == HistorySize {
+		b.history = append(b.history[:0], b.history[1:]...)
+	}
+	b.history = append(b.history, e)
+
+	for s := range b.subs {
+		if !s.wants(e.Type) {
+			continue
+		}
+		if s.sink != nil {
+			s.sink(e)
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			log.Warningf("subscriber is too slow, event %d is dropped", e.ID)
+		}
+	}
+}
+
+// Subscribe returns subscription to events of specified types, or to all
+// events if no types are specified. Kept events with IDs greater than
+// after are delivered first, zero after means only new events.
+func (b *Bus) Subscribe(after uint64, types ...Type) *Subscription {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	s := &Subscription{types: make(map[Type]bool), bus: b}
+	for _, t := range types {
+		s.types[t] = true
+	}
+
+	var missed []Event
+	if after != 0 {
+		for _, e := range b.history {
+			if e.ID > after && s.wants(e.Type) {
+				missed = append(missed, e)
+			}
+		}
+	}
+	s.c = make(chan Event, subBufSize+len(missed))
+	for _, e := range missed {
+		s.c <- e
+	}
+	s.C = s.c
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// subscribeFunc returns subscription which passes new events of
+// specified types to f as they are published. Subscription has no C.
+func (b *Bus) subscribeFunc(f func(Event), types ...Type) *Subscription {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	s := &Subscription{types: make(map[Type]bool), bus: b, sink: f}
+	for _, t := range types {
+		s.types[t] = true
+	}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// DefaultBus is the bus of the node.
+var DefaultBus = NewBus()
+
+// Publish publishes e to DefaultBus.
+func Publish(e Event) {
+	DefaultBus.Publish(e)
+}
+
+// Subscribe subscribes to events of DefaultBus.
+func Subscribe(after uint64, types ...Type) *Subscription {
+	return DefaultBus.Subscribe(after, types...)
+}
@@ -0,0 +1,193 @@
+package events
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	config "github.com/Casper-dev/Casper-server/repo/config"
+)
+
+func TestSubscribe(t *testing.T) {
+	b := NewBus()
+	b.Publish(Event{Type: FileStored, UUID: "a"})
+	b.Publish(Event{Type: FileDeleted, UUID: "a"})
+
+	all := b.Subscribe(0)
+	defer all.Close()
+	deleted := b.Subscribe(0, FileDeleted)
+	defer deleted.Close()
+
+	b.Publish(Event{Type: FileStored, UUID: "b"})
+	b.Publish(Event{Type: FileDeleted, UUID: "b"})
+
+	if e := <-all.C; e.ID != 3 || e.UUID != "b" || e.Time.IsZero() {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	if e := <-all.C; e.ID != 4 {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	if e := <-deleted.C; e.ID != 4 || e.Type != FileDeleted {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	select {
+	case e := <-deleted.C:
+		t.Fatalf("event %+v must be filtered", e)
+	default:
+	}
+
+	deleted.Close()
+	if _, ok := <-deleted.C; ok {
+		t.Fatal("channel must be closed")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	b := NewBus()
+	for i := 0; i < HistorySize+10; i++ {
+		b.Publish(Event{Type: FileStored})
+	}
+
+	s := b.Subscribe(HistorySize + 5)
+	defer s.Close()
+	for id := uint64(HistorySize + 6); id <= HistorySize+10; id++ {
+		if e := <-s.C; e.ID != id {
+			t.Fatalf("expected event %d, got %d", id, e.ID)
+		}
+	}
+
+	// events which are not kept are lost
+	s2 := b.Subscribe(1)
+	defer s2.Close()
+	if e := <-s2.C; e.ID != 11 {
+		t.Fatalf("expected oldest kept event 11, got %d", e.ID)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		body, _ := ioutil.ReadAll(req.Body)
+		if req.Header.Get(SignatureHeader) != Sign("secret", body) {
+			t.Errorf("invalid signature %q", req.Header.Get(SignatureHeader))
+		}
+		if req.Header.Get(EventHeader) != string(FileStored) || req.Header.Get(DeliveryHeader) != "7" {
+			t.Errorf("unexpected headers %v", req.Header)
+		}
+		if n < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	w := newTestWebhook(srv.URL)
+	if err := w.Deliver(context.Background(), Event{ID: 7, Type: FileStored}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestDeliverRejected(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	if err := newTestWebhook(srv.URL).Deliver(context.Background(), Event{ID: 1}); err == nil {
+		t.Fatal("rejected delivery must fail")
+	}
+	if calls != 1 {
+		t.Fatalf("client error must not be retried, got %d attempts", calls)
+	}
+}
+
+func TestRun(t *testing.T) {
+	got := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got <- req.Header.Get(DeliveryHeader)
+	}))
+	defer srv.Close()
+
+	b := NewBus()
+	w := newTestWebhook(srv.URL)
+	w.Types = []Type{FileDeleted}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx, b)
+
+	// wait until webhook subscribes
+	for {
+		b.mtx.Lock()
+		n := len(b.subs)
+		b.mtx.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	b.Publish(Event{Type: FileStored})
+	b.Publish(Event{Type: FileDeleted})
+
+	select {
+	case id := <-got:
+		if id != "2" {
+			t.Fatalf("expected event 2, got %s", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not delivered")
+	}
+}
+
+func TestSlowReceiver(t *testing.T) {
+	const count = 3 * subBufSize
+	release := make(chan struct{})
+	var delivered int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+		atomic.AddInt32(&delivered, 1)
+	}))
+	defer srv.Close()
+
+	b := NewBus()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go newTestWebhook(srv.URL).Run(ctx, b)
+	for {
+		b.mtx.Lock()
+		n := len(b.subs)
+		b.mtx.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// receiver is blocked while events are published
+	for i := 0; i < count; i++ {
+		b.Publish(Event{Type: FileStored})
+	}
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&delivered) < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d delivered events, got %d", count, atomic.LoadInt32(&delivered))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newTestWebhook(url string) *Webhook {
+	w := NewWebhook(config.Webhook{URL: url, Secret: "secret", MaxAttempts: 3})
+	w.MinBackoff = time.Millisecond
+	return w
+}
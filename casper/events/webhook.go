@@ -0,0 +1,223 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	config "github.com/Casper-dev/Casper-server/repo/config"
+)
+
+const (
+	// SignatureHeader contains "sha256=" followed by hex encoded
+	// HMAC-SHA256 of the request body keyed with webhook secret
+	SignatureHeader = "X-Casper-Signature"
+	EventHeader     = "X-Casper-Event"
+	DeliveryHeader  = "X-Casper-Delivery"
+
+	DefaultMaxAttempts = 5
+	DefaultMinBackoff  = time.Second
+	DefaultMaxBackoff  = 5 * time.Minute
+	DefaultQueueSize   = 4096
+
+	deliveryTimeout = 10 * time.Second
+)
+
+// Webhook posts events as JSON to URL. Events are delivered one by one
+// in order they were published. Failed delivery is retried with
+// exponential backoff, except when receiver rejects the request
+// with a client error. Events wait for delivery in a queue, so that
+// slow receiver does not make the bus drop them.
+type Webhook struct {
+	URL    string
+	Secret string
+	// Types are types of delivered events, all events if empty
+	Types       []Type
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	// QueueSize is the number of events waiting for delivery,
+	// the oldest ones are dropped when it is exceeded
+	QueueSize int
+	Client    *http.Client
+}
+
+// NewWebhook returns webhook described by cfg.
+func NewWebhook(cfg config.Webhook) *Webhook {
+	w := &Webhook{
+		URL:         cfg.URL,
+		Secret:      cfg.Secret,
+		MaxAttempts: cfg.MaxAttempts,
+		MinBackoff:  DefaultMinBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+		QueueSize:   cfg.QueueSize,
+		Client:      &http.Client{Timeout: deliveryTimeout},
+	}
+	if w.MaxAttempts <= 0 {
+		w.MaxAttempts = DefaultMaxAttempts
+	}
+	if w.QueueSize <= 0 {
+		w.QueueSize = DefaultQueueSize
+	}
+	for _, t := range cfg.Events {
+		w.Types = append(w.Types, Type(t))
+	}
+	return w
+}
+
+// Sign returns value of SignatureHeader for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Run delivers events of b until ctx is done.
+func (w *Webhook) Run(ctx context.Context, b *Bus) {
+	// events are queued by publisher, so that none of
+	// them is lost while previous ones are delivered
+	q := newQueue(w.QueueSize)
+	s := b.subscribeFunc(func(e Event) {
+		if dropped, ok := q.push(e); ok {
+			log.Warningf("delivery queue of %s is full, event %d is dropped", w.URL, dropped.ID)
+		}
+	}, w.Types...)
+	defer s.Close()
+
+	for {
+		e, ok := q.pop(ctx)
+		if !ok {
+			return
+		}
+		if err := w.Deliver(ctx, e); err != nil {
+			log.Errorf("event %d was not delivered to %s: %v", e.ID, w.URL, err)
+		}
+	}
+}
+
+// queue keeps events waiting for delivery.
+type queue struct {
+	mtx    sync.Mutex
+	events []Event
+	size   int
+	// ready is signalled when event is pushed
+	ready chan struct{}
+}
+
+func newQueue(size int) *queue {
+	return &queue{size: size, ready: make(chan struct{}, 1)}
+}
+
+// push appends e to the queue. If queue is full, the oldest
+// event is dropped and returned.
+func (q *queue) push(e Event) (dropped Event, ok bool) {
+	q.mtx.Lock()
+	if len(q.events) >= q.size {
+		dropped, ok = q.events[0], true
+		q.events = q.events[1:]
+	}
+	q.events = append(q.events, e)
+	q.mtx.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return dropped, ok
+}
+
+// pop waits for the next event until ctx is done.
+func (q *queue) pop(ctx context.Context) (Event, bool) {
+	for {
+		q.mtx.Lock()
+		if len(q.events) > 0 {
+			e := q.events[0]
+			q.events = q.events[1:]
+			q.mtx.Unlock()
+			return e, true
+		}
+		q.mtx.Unlock()
+
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return Event{}, false
+		}
+	}
+}
+
+// Deliver posts e to URL until it is accepted or attempts are exhausted.
+func (w *Webhook) Deliver(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	backoff := w.MinBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := w.post(ctx, e, body)
+		if err == nil || !retry || attempt >= w.MaxAttempts {
+			return err
+		}
+		log.Debugf("delivery of event %d to %s will be retried: %v", e.ID, w.URL, err)
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+		if backoff *= 2; backoff > w.MaxBackoff {
+			backoff = w.MaxBackoff
+		}
+	}
+}
+
+// post makes a single delivery attempt and reports if it can be retried.
+func (w *Webhook) post(ctx context.Context, e Event, body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(e.Type))
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(e.ID, 10))
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+	}
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("receiver responded with %s", resp.Status)
+	default:
+		return false, fmt.Errorf("receiver rejected event with %s", resp.Status)
+	}
+}
+
+// RunWebhooks delivers events of DefaultBus to webhooks from config until ctx is done.
+func RunWebhooks(ctx context.Context, cfgs []config.Webhook) {
+	for _, cfg := range cfgs {
+		if cfg.URL == "" {
+			continue
+		}
+		go NewWebhook(cfg).Run(ctx, DefaultBus)
+	}
+}
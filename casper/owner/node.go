@@ -0,0 +1,129 @@
+package owner
+
+import (
+	bl "github.com/Casper-dev/Casper-server/blocks"
+	"github.com/Casper-dev/Casper-server/blocks/blockstore"
+	uid "github.com/Casper-dev/Casper-server/casper/uuid"
+	"github.com/Casper-dev/Casper-server/core"
+
+	"gx/ipfs/QmNp85zy9RLrQ5oQD4hPyS39ezrrXpcaa7R4Y9kxdWQLLQ/go-cid"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+)
+
+// Check authorizes operation on the file with specified ID stored on n.
+// auth is encoded signed request which must be one of ops. It is required
+// if file has an owner. Returned info must be stored with Store after
+// operation succeeds. If file has no owner and auth does not create one,
+// r is nil and caller must decide whether operation is allowed.
+// UUID file which is stored on n without known ownership (e.g. replica
+// for which no verified record was received) is never treated as unowned.
+func Check(n *core.IpfsNode, fileID, auth string, ops ...string) (r *Request, next *core.UUIDInfo, err error) {
+	if auth == "" {
+		if _, info, ok := Lookup(fileID); ok {
+			if IsOwned(info) {
+				return nil, nil, ErrUnsigned
+			}
+			return nil, nil, nil
+		}
+		if stored, err := storesUUIDFile(n, fileID); err != nil {
+			return nil, nil, err
+		} else if stored {
+			return nil, nil, ErrUnknownOwner
+		}
+		return nil, nil, nil
+	}
+
+	if r, err = Decode(auth); err != nil {
+		return nil, nil, err
+	}
+	if FileID(r.UUID) != fileID {
+		return nil, nil, ErrWrongFile
+	}
+	known := false
+	for _, op := range ops {
+		known = known || r.Op == op
+	}
+	if !known {
+		return nil, nil, ErrUnknownOp
+	}
+
+	info, err := n.GetUUID(r.UUID)
+	if err == ds.ErrNotFound {
+		info = nil
+		if stored, err := storesUUIDFile(n, fileID); err != nil {
+			return nil, nil, err
+		} else if stored {
+			return nil, nil, ErrUnknownOwner
+		}
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if !IsOwned(info) && r.Op != OpCreate {
+		return nil, nil, nil
+	}
+
+	if next, err = Authorize(info, r); err != nil {
+		return nil, nil, err
+	}
+	return r, next, nil
+}
+
+// Store saves ownership next returned by Check for the file with specified
+// UUID. Other fields of the stored info (name, size, root...) are kept, as
+// they could have changed while operation was performed. ErrReplay is
+// returned if a newer request has been accepted since Check.
+func Store(n *core.IpfsNode, uuid string, next *core.UUIDInfo) error {
+	return n.UpdateUUID(uuid, func(info *core.UUIDInfo) error {
+		if IsOwned(info) && next.Seq <= info.Seq {
+			return ErrReplay
+		}
+		Apply(info, next)
+		return nil
+	})
+}
+
+// storesUUIDFile checks if root of the UUID file with specified ID
+// is stored on n.
+func storesUUIDFile(n *core.IpfsNode, fileID string) (bool, error) {
+	c, err := cid.Decode(fileID)
+	if err != nil {
+		return false, nil
+	}
+	b, err := n.Blockstore.Get(c)
+	if err == blockstore.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	raw := b.RawData()
+	if len(raw) < uid.UUIDLen {
+		return false, nil
+	}
+	id, _ := bl.SplitData(raw)
+	return !uid.IsUUIDNull(id) && uid.UUIDToCid(id).Equals(c), nil
+}
+
+// SignWith signs r with the key of n with specified name
+// and returns encoded request.
+func SignWith(n *core.IpfsNode, keyName string, r *Request) (string, error) {
+	sk, err := n.GetKey(keyName)
+	if err != nil {
+		return "", err
+	}
+	if err = r.Sign(sk); err != nil {
+		return "", err
+	}
+	return r.Encode()
+}
+
+// KeyName returns name of the key which is used to sign requests for
+// the file with specified UUID if name is not set explicitly.
+func KeyName(n *core.IpfsNode, uuid, name string) string {
+	if name != "" {
+		return name
+	}
+	if info, err := n.GetUUID(uuid); err == nil && info.KeyName != "" {
+		return info.KeyName
+	}
+	return "self"
+}
@@ -0,0 +1,312 @@
+// Package owner implements ownership of UUID files.
+//
+// Every UUID is bound to an owner key at creation. Owner can allow other
+// keys (writers) to update and delete the file and can transfer ownership
+// to another key. Each of these operations is described by a Request
+// which is signed by the client and verified by every provider before
+// it acts. Keys are referred to by their IDs, which are computed the same
+// way as peer IDs, so that 'key list -l' can be used to find them.
+package owner
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	uid "github.com/Casper-dev/Casper-server/casper/uuid"
+	"github.com/Casper-dev/Casper-server/core"
+	dag "github.com/Casper-dev/Casper-server/merkledag"
+
+	"gx/ipfs/QmT8rehPR3F6bmwL6zjUN8XpiDBFFpMP2myPdC6ApsWfJf/go-base58"
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+)
+
+// Operations which can be requested
+const (
+	OpCreate   = "create"
+	OpUpdate   = "update"
+	OpDelete   = "delete"
+	OpTransfer = "transfer"
+	// OpShare manages share links of the file, it is allowed only to owner
+	OpShare = "share"
+)
+
+var (
+	ErrUnsigned      = errors.New("request is not signed")
+	ErrBadSignature  = errors.New("invalid request signature")
+	ErrUnknownOp     = errors.New("unknown request operation")
+	ErrWrongFile     = errors.New("request is signed for another file")
+	ErrNotAuthorized = errors.New("key is not allowed to perform operation")
+	ErrReplay        = errors.New("request is older than the last accepted one")
+	ErrAlreadyOwned  = errors.New("file already has an owner")
+	ErrNoOwner       = errors.New("request does not specify owner")
+	ErrUnknownOwner  = errors.New("ownership of the file is not known")
+	ErrBadProof      = errors.New("invalid proof of ownership")
+)
+
+// Request is an operation on a file signed by one of its keys.
+type Request struct {
+	Op   string
+	UUID string
+	// Hash is the new content of the file, see ContentHash.
+	// If it is empty, update is allowed to set any content.
+	Hash string `json:",omitempty"`
+	// Owner and Writers are set by create and transfer requests
+	Owner   string   `json:",omitempty"`
+	Writers []string `json:",omitempty"`
+	// Seq must grow with every request to the same file.
+	// It prevents captured requests from being replayed.
+	Seq int64
+
+	PubKey    []byte `json:",omitempty"`
+	Signature []byte `json:",omitempty"`
+}
+
+// NewRequest returns request with sequence number taken from current time.
+func NewRequest(op, uuid string) *Request {
+	return &Request{Op: op, UUID: uuid, Seq: time.Now().UnixNano()}
+}
+
+// KeyID returns ID of the public key.
+func KeyID(pk ci.PubKey) (string, error) {
+	id, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		return "", err
+	}
+	return id.Pretty(), nil
+}
+
+// FileID returns ID of the file in SC.
+func FileID(uuid string) string {
+	return uid.UUIDToHash(base58.Decode(uuid)).B58String()
+}
+
+func (r *Request) payload() ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = nil
+	return json.Marshal(&unsigned)
+}
+
+// Sign signs request with sk.
+func (r *Request) Sign(sk ci.PrivKey) (err error) {
+	if r.PubKey, err = ci.MarshalPublicKey(sk.GetPublic()); err != nil {
+		return err
+	}
+	data, err := r.payload()
+	if err != nil {
+		return err
+	}
+	r.Signature, err = sk.Sign(data)
+	return err
+}
+
+// Signer verifies signature and returns ID of the key which has signed request.
+func (r *Request) Signer() (string, error) {
+	if len(r.PubKey) == 0 || len(r.Signature) == 0 {
+		return "", ErrUnsigned
+	}
+	pk, err := ci.UnmarshalPublicKey(r.PubKey)
+	if err != nil {
+		return "", err
+	}
+	data, err := r.payload()
+	if err != nil {
+		return "", err
+	}
+	if ok, err := pk.Verify(data, r.Signature); err != nil || !ok {
+		return "", ErrBadSignature
+	}
+	return KeyID(pk)
+}
+
+// Encode returns string representation of the request which can
+// be passed over thrift or in HTTP header.
+func (r *Request) Encode() (string, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Decode parses request encoded by Encode.
+func Decode(s string) (*Request, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	r := new(Request)
+	if err = json.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// IsOwned checks if file described by info is bound to a key.
+func IsOwned(info *core.UUIDInfo) bool {
+	return info != nil && info.PubKey != ""
+}
+
+// CanWrite checks if key with specified ID can update and delete file.
+func CanWrite(info *core.UUIDInfo, id string) bool {
+	if info.PubKey == id {
+		return true
+	}
+	for _, w := range info.Writers {
+		if w == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize checks that r can be performed on the file described by info
+// and returns description of the file after r. info is nil if file
+// is not known yet. info is not modified.
+func Authorize(info *core.UUIDInfo, r *Request) (*core.UUIDInfo, error) {
+	signer, err := r.Signer()
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Op == OpCreate {
+		if r.Owner != signer {
+			return nil, ErrNotAuthorized
+		}
+		if IsOwned(info) && info.PubKey != signer {
+			return nil, ErrAlreadyOwned
+		}
+	} else if !IsOwned(info) {
+		return nil, ErrNotAuthorized
+	}
+
+	next := &core.UUIDInfo{}
+	if info != nil {
+		*next = *info
+		if r.Seq <= info.Seq {
+			return nil, ErrReplay
+		}
+	}
+	next.Seq = r.Seq
+
+	enc, err := r.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	switch r.Op {
+	case OpCreate, OpTransfer:
+		if r.Op == OpTransfer && info.PubKey != signer {
+			return nil, ErrNotAuthorized
+		}
+		if r.Owner == "" {
+			return nil, ErrNoOwner
+		}
+		next.PubKey = r.Owner
+		next.Writers = append([]string{}, r.Writers...)
+		if r.Op == OpCreate {
+			next.Proof = []string{enc}
+		} else {
+			next.Proof = append(append([]string{}, info.Proof...), enc)
+		}
+		next.Last = ""
+	case OpUpdate, OpDelete:
+		if !CanWrite(info, signer) {
+			return nil, ErrNotAuthorized
+		}
+		next.Last = enc
+	case OpShare:
+		if info.PubKey != signer {
+			return nil, ErrNotAuthorized
+		}
+	default:
+		return nil, ErrUnknownOp
+	}
+	return next, nil
+}
+
+// Record is ownership of the file which is sent to new replicas.
+// It contains signed requests, so that it can be verified without
+// trusting the provider which has sent it.
+type Record struct {
+	UUID  string
+	Proof []string
+	Last  string `json:",omitempty"`
+}
+
+// NewRecord returns record of the file described by info.
+func NewRecord(uuid string, info *core.UUIDInfo) *Record {
+	return &Record{UUID: uuid, Proof: info.Proof, Last: info.Last}
+}
+
+// Verify replays requests of the record and returns
+// ownership of the file they result in.
+func (rec *Record) Verify() (*core.UUIDInfo, error) {
+	if len(rec.Proof) == 0 {
+		return nil, ErrUnsigned
+	}
+
+	reqs := rec.Proof
+	if rec.Last != "" {
+		reqs = append(reqs[:len(reqs):len(reqs)], rec.Last)
+	}
+
+	var info *core.UUIDInfo
+	for i, s := range reqs {
+		r, err := Decode(s)
+		if err != nil {
+			return nil, err
+		}
+		if r.UUID != rec.UUID {
+			return nil, ErrWrongFile
+		}
+
+		var op string
+		switch {
+		case i == 0:
+			op = OpCreate
+		case i < len(rec.Proof):
+			op = OpTransfer
+		case r.Op == OpUpdate || r.Op == OpDelete:
+			op = r.Op
+		}
+		if r.Op != op {
+			return nil, ErrBadProof
+		}
+
+		if info, err = Authorize(info, r); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// Apply sets ownership of the file described by info from verified
+// ownership v. Metadata of the file is not changed.
+func Apply(info, v *core.UUIDInfo) {
+	info.PubKey, info.Writers, info.Seq = v.PubKey, v.Writers, v.Seq
+	info.Proof, info.Last = v.Proof, v.Last
+}
+
+// Lookup finds UUID of the file with specified ID among local UUIDs.
+func Lookup(fileID string) (uuid string, info *core.UUIDInfo, ok bool) {
+	core.UUIDInfoCache.Range(func(k, v interface{}) bool {
+		if FileID(k.(string)) == fileID {
+			uuid, info, ok = k.(string), v.(*core.UUIDInfo), true
+			return false
+		}
+		return true
+	})
+	return uuid, info, ok
+}
+
+// ContentHash returns CID of the contents of UUID node nd. Unlike CID
+// of the node itself, which is derived from the UUID, it changes on
+// update, so requests are signed for it.
+func ContentHash(nd *dag.ProtoNode) string {
+	c := nd.Copy().(*dag.ProtoNode)
+	c.SetUUID(nil)
+	return c.Cid().String()
+}
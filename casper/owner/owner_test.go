@@ -0,0 +1,198 @@
+package owner
+
+import (
+	"testing"
+
+	"github.com/Casper-dev/Casper-server/core"
+	dag "github.com/Casper-dev/Casper-server/merkledag"
+
+	"gx/ipfs/QmT8rehPR3F6bmwL6zjUN8XpiDBFFpMP2myPdC6ApsWfJf/go-base58"
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+)
+
+const testUUID = "J5gNENq5bN2dbtbNtYFXvb"
+
+func genKey(t *testing.T) (ci.PrivKey, string) {
+	sk, pk, err := ci.GenerateKeyPair(ci.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := KeyID(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk, id
+}
+
+func signed(t *testing.T, sk ci.PrivKey, r *Request) *Request {
+	if err := r.Sign(sk); err != nil {
+		t.Fatal(err)
+	}
+	s, err := r.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = Decode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestSignature(t *testing.T) {
+	sk, id := genKey(t)
+	r := signed(t, sk, NewRequest(OpUpdate, testUUID))
+	if signer, err := r.Signer(); err != nil || signer != id {
+		t.Fatalf("expected signer %s, got %s (%v)", id, signer, err)
+	}
+
+	r.Hash = "QmOther"
+	if _, err := r.Signer(); err != ErrBadSignature {
+		t.Fatalf("expected ErrBadSignature, got %v", err)
+	}
+	if _, err := NewRequest(OpUpdate, testUUID).Signer(); err != ErrUnsigned {
+		t.Fatalf("expected ErrUnsigned, got %v", err)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	ownerKey, owner := genKey(t)
+	writerKey, writer := genKey(t)
+	otherKey, other := genKey(t)
+
+	create := NewRequest(OpCreate, testUUID)
+	create.Owner = owner
+	create.Writers = []string{writer}
+	info, err := Authorize(nil, signed(t, ownerKey, create))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.PubKey != owner || len(info.Writers) != 1 {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+
+	// somebody else can't claim the file
+	steal := NewRequest(OpCreate, testUUID)
+	steal.Owner = other
+	if _, err = Authorize(info, signed(t, otherKey, steal)); err != ErrAlreadyOwned {
+		t.Fatalf("expected ErrAlreadyOwned, got %v", err)
+	}
+
+	upd := signed(t, writerKey, NewRequest(OpUpdate, testUUID))
+	if info, err = Authorize(info, upd); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Authorize(info, upd); err != ErrReplay {
+		t.Fatalf("expected ErrReplay, got %v", err)
+	}
+	if _, err = Authorize(info, signed(t, otherKey, NewRequest(OpDelete, testUUID))); err != ErrNotAuthorized {
+		t.Fatalf("expected ErrNotAuthorized, got %v", err)
+	}
+
+	// writers can't share the file
+	if _, err = Authorize(info, signed(t, writerKey, NewRequest(OpShare, testUUID))); err != ErrNotAuthorized {
+		t.Fatalf("expected ErrNotAuthorized, got %v", err)
+	}
+
+	// writers can't transfer ownership
+	tr := NewRequest(OpTransfer, testUUID)
+	tr.Owner = other
+	if _, err = Authorize(info, signed(t, writerKey, tr)); err != ErrNotAuthorized {
+		t.Fatalf("expected ErrNotAuthorized, got %v", err)
+	}
+	tr.Seq++
+	if info, err = Authorize(info, signed(t, ownerKey, tr)); err != nil {
+		t.Fatal(err)
+	}
+	if info.PubKey != other || len(info.Writers) != 0 {
+		t.Fatalf("unexpected info after transfer: %+v", info)
+	}
+	if _, err = Authorize(info, signed(t, ownerKey, NewRequest(OpDelete, testUUID))); err != ErrNotAuthorized {
+		t.Fatalf("previous owner must not be authorized, got %v", err)
+	}
+	if _, err = Authorize(info, signed(t, otherKey, NewRequest(OpDelete, testUUID))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Authorize(info, signed(t, otherKey, NewRequest(OpShare, testUUID))); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = Authorize(&core.UUIDInfo{}, signed(t, otherKey, NewRequest(OpUpdate, testUUID))); err != ErrNotAuthorized {
+		t.Fatalf("file without owner can't be updated, got %v", err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	info := &core.UUIDInfo{PubKey: "key"}
+	core.UUIDInfoCache.Store(testUUID, info)
+	defer core.UUIDInfoCache.Delete(testUUID)
+
+	uuid, found, ok := Lookup(FileID(testUUID))
+	if !ok || uuid != testUUID || found != info {
+		t.Fatalf("file was not found")
+	}
+	if _, _, ok = Lookup("QmUnknown"); ok {
+		t.Fatal("unknown file must not be found")
+	}
+}
+
+func TestRecordVerify(t *testing.T) {
+	ownerKey, owner := genKey(t)
+	otherKey, other := genKey(t)
+
+	create := NewRequest(OpCreate, testUUID)
+	create.Owner = owner
+	info, err := Authorize(nil, signed(t, ownerKey, create))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := NewRequest(OpTransfer, testUUID)
+	tr.Owner = other
+	if info, err = Authorize(info, signed(t, ownerKey, tr)); err != nil {
+		t.Fatal(err)
+	}
+	if info, err = Authorize(info, signed(t, otherKey, NewRequest(OpUpdate, testUUID))); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := NewRecord(testUUID, info).Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.PubKey != other || v.Seq != info.Seq {
+		t.Fatalf("unexpected ownership: %+v", v)
+	}
+
+	// provider can't make up ownership
+	forged := NewRecord(testUUID, info)
+	forged.Proof = forged.Proof[1:]
+	if _, err = forged.Verify(); err != ErrBadProof {
+		t.Fatalf("expected ErrBadProof, got %v", err)
+	}
+	steal := NewRequest(OpTransfer, testUUID)
+	steal.Owner = other
+	enc, err := signed(t, otherKey, steal).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged = NewRecord(testUUID, info)
+	forged.Proof = []string{forged.Proof[0], enc}
+	if _, err = forged.Verify(); err != ErrNotAuthorized {
+		t.Fatalf("expected ErrNotAuthorized, got %v", err)
+	}
+	if _, err = (&Record{UUID: testUUID}).Verify(); err != ErrUnsigned {
+		t.Fatalf("expected ErrUnsigned, got %v", err)
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	nd := dag.NodeWithData([]byte("content"))
+	h := nd.Cid().String()
+	nd.SetUUID(base58.Decode(testUUID))
+	if nd.Cid().String() == h {
+		t.Fatal("CID of UUID node must not depend on content")
+	}
+	if ContentHash(nd) != h {
+		t.Fatalf("expected content hash %s, got %s", h, ContentHash(nd))
+	}
+}
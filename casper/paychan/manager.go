@@ -0,0 +1,388 @@
+package paychan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/casper/sc"
+	scin "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+	p2phost "gx/ipfs/Qmc1XhrFEiSeBNn3mpfg6gEuYCt5im2gYmNVmncsvmpeAk/go-libp2p-host"
+)
+
+var log = logging.Logger("paychan")
+
+const (
+	// CloseMargin is how long before expiry payee stops accepting
+	// vouchers and closes the channel, so that the close transaction
+	// is mined before payer can reclaim tokens.
+	CloseMargin = time.Hour
+	// CheckInterval is how often Run looks for expiring channels
+	CheckInterval = 10 * time.Minute
+)
+
+var (
+	ErrWrongRole      = errors.New("operation is not allowed for this side of the channel")
+	ErrChannelClosed  = errors.New("payment channel is closed")
+	ErrExpired        = errors.New("payment channel is expired")
+	ErrNoFunds        = errors.New("payment channel has not enough funds")
+	ErrWrongPayee     = errors.New("payment channel is opened for another provider")
+	ErrWrongSigner    = errors.New("voucher is not sent by payer of the channel")
+	ErrStaleVoucher   = errors.New("voucher amount is not greater than already paid")
+	ErrInvalidAmount  = errors.New("amount must be positive")
+	ErrNothingToClaim = errors.New("no vouchers were received")
+)
+
+// Manager keeps channels of the node in datastore. The same manager
+// is used for channels where node is payer and where it is payee.
+type Manager struct {
+	// mtx serializes changes of channels, vouchers are sent under it,
+	// so that they are never reordered
+	mtx  sync.Mutex
+	ds   ds.Datastore
+	host p2phost.Host
+	sk   ci.PrivKey
+	self peer.ID
+
+	// SC returns contract which must implement scin.PaymentChannelSC
+	SC func() (scin.CasperSC, error)
+	// OnPaid is called when payee receives amount of tokens from payer,
+	// daemon lets payer download for it
+	OnPaid func(payer peer.ID, amount int64)
+	now    func() time.Time
+}
+
+// NewManager returns manager of channels of the node with identity sk.
+// h is used to send vouchers and can be nil if node does not pay.
+func NewManager(d ds.Datastore, h p2phost.Host, sk ci.PrivKey) (*Manager, error) {
+	self, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{
+		ds:   d,
+		host: h,
+		sk:   sk,
+		self: self,
+		SC: func() (scin.CasperSC, error) {
+			return sc.GetContract()
+		},
+		now: time.Now,
+	}, nil
+}
+
+func (m *Manager) contract() (scin.PaymentChannelSC, error) {
+	c, err := m.SC()
+	if err != nil {
+		return nil, err
+	}
+	return scin.PaymentChannels(c)
+}
+
+func (m *Manager) Get(id string) (*Channel, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return getChannel(m.ds, id)
+}
+
+func (m *Manager) List() ([]*Channel, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return listChannels(m.ds)
+}
+
+// Open locks amount of tokens in SC for provider for ttl.
+func (m *Manager) Open(provider peer.ID, amount int64, ttl time.Duration) (*Channel, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	pc, err := m.contract()
+	if err != nil {
+		return nil, err
+	}
+	signer, err := m.sk.GetPublic().Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	now := m.now()
+	expires := now.Add(ttl).Truncate(time.Second)
+	id, err := pc.OpenChannel(provider.Pretty(), signer, amount, expires.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	ch := &Channel{
+		ID:       id,
+		Role:     RolePayer,
+		Peer:     provider.Pretty(),
+		Signer:   signer,
+		Capacity: amount,
+		Expires:  expires,
+		Created:  now,
+		Updated:  now,
+	}
+	log.Infof("opened payment channel %s to %s for %d tokens", id, provider.Pretty(), amount)
+	return ch, putChannel(m.ds, ch)
+}
+
+// Pay sends voucher which pays amount more to the payee of channel id.
+func (m *Manager) Pay(ctx context.Context, id string, amount int64) (*Channel, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	ch, err := getChannel(m.ds, id)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case ch.Role != RolePayer:
+		return nil, ErrWrongRole
+	case ch.Closed:
+		return nil, ErrChannelClosed
+	case !m.now().Before(ch.Expires):
+		return nil, ErrExpired
+	case ch.Remaining() < amount:
+		return nil, ErrNoFunds
+	}
+
+	payee, err := peer.IDB58Decode(ch.Peer)
+	if err != nil {
+		return nil, err
+	}
+	v, err := NewVoucher(m.sk, ch.ID, ch.Paid+amount)
+	if err != nil {
+		return nil, err
+	}
+	if err = send(ctx, m.host, payee, v); err != nil {
+		return nil, err
+	}
+
+	ch.Paid, ch.Voucher, ch.Updated = v.Amount, v, m.now()
+	return ch, putChannel(m.ds, ch)
+}
+
+// Reclaim takes back tokens which were not claimed by payee
+// after the channel has expired.
+func (m *Manager) Reclaim(id string) (*Channel, error) {
+	pc, err := m.contract()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	ch, err := getChannel(m.ds, id)
+	if err != nil {
+		return nil, err
+	}
+	if ch.Role != RolePayer {
+		return nil, ErrWrongRole
+	}
+	if err = pc.ReclaimChannel(id); err != nil {
+		return nil, err
+	}
+	info, err := pc.GetChannel(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ch.Settled, ch.Closed, ch.Updated = info.Claimed, true, m.now()
+	return ch, putChannel(m.ds, ch)
+}
+
+// Receive accepts voucher v sent by payer from. Channel is looked up in
+// SC when its first voucher is received. It returns the amount paid by v.
+func (m *Manager) Receive(from peer.ID, v *Voucher) (int64, error) {
+	paid, err := m.receive(from, v)
+	if err == nil && m.OnPaid != nil {
+		m.OnPaid(from, paid)
+	}
+	return paid, err
+}
+
+func (m *Manager) receive(from peer.ID, v *Voucher) (int64, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	ch, err := getChannel(m.ds, v.Channel)
+	if err == ErrUnknownChannel {
+		ch, err = m.fetch(v.Channel)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case ch.Role != RolePayee:
+		return 0, ErrWrongRole
+	case ch.Peer != from.Pretty():
+		return 0, ErrWrongSigner
+	case ch.Closed:
+		return 0, ErrChannelClosed
+	case !m.now().Before(ch.Expires.Add(-CloseMargin)):
+		return 0, ErrExpired
+	case v.Amount > ch.Capacity:
+		return 0, ErrNoFunds
+	case v.Amount <= ch.Paid:
+		return 0, fmt.Errorf("%v: %d tokens are already paid", ErrStaleVoucher, ch.Paid)
+	}
+	if err = v.Verify(ch.Signer); err != nil {
+		return 0, err
+	}
+
+	paid := v.Amount - ch.Paid
+	ch.Paid, ch.Voucher, ch.Updated = v.Amount, v, m.now()
+	if err = putChannel(m.ds, ch); err != nil {
+		return 0, err
+	}
+	log.Debugf("received %d tokens in channel %s", paid, ch.ID)
+	return paid, nil
+}
+
+// fetch returns new payee channel with state from SC.
+func (m *Manager) fetch(id string) (*Channel, error) {
+	pc, err := m.contract()
+	if err != nil {
+		return nil, err
+	}
+	info, err := pc.GetChannel(id)
+	if err != nil {
+		return nil, err
+	}
+	if info.Payee != m.self.Pretty() {
+		return nil, ErrWrongPayee
+	}
+
+	pk, err := ci.UnmarshalPublicKey(info.Signer)
+	if err != nil {
+		return nil, err
+	}
+	payer, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	return &Channel{
+		ID:       info.ID,
+		Role:     RolePayee,
+		Peer:     payer.Pretty(),
+		Signer:   info.Signer,
+		Capacity: info.Capacity,
+		Expires:  time.Unix(info.Expires, 0),
+		Paid:     info.Claimed,
+		Settled:  info.Claimed,
+		Closed:   info.Closed,
+		Created:  now,
+		Updated:  now,
+	}, nil
+}
+
+// Settle claims the latest voucher of channel id in SC.
+func (m *Manager) Settle(id string) (*Channel, error) {
+	return m.claim(id, false)
+}
+
+// Close claims the latest voucher of channel id in SC
+// and returns the rest of tokens to payer.
+func (m *Manager) Close(id string) (*Channel, error) {
+	return m.claim(id, true)
+}
+
+func (m *Manager) claim(id string, close bool) (*Channel, error) {
+	pc, err := m.contract()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	ch, err := getChannel(m.ds, id)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case ch.Role != RolePayee:
+		return nil, ErrWrongRole
+	case ch.Closed:
+		return nil, ErrChannelClosed
+	case ch.Voucher == nil:
+		return nil, ErrNothingToClaim
+	}
+
+	if close {
+		err = pc.CloseChannel(id, ch.Voucher.SCVoucher())
+	} else {
+		err = pc.SettleChannel(id, ch.Voucher.SCVoucher())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ch.Settled, ch.Closed, ch.Updated = ch.Voucher.Amount, close, m.now()
+	return ch, putChannel(m.ds, ch)
+}
+
+// CloseExpiring closes payee channels which expire within CloseMargin.
+// Channels without vouchers are only marked as closed.
+func (m *Manager) CloseExpiring() error {
+	channels, err := m.List()
+	if err != nil {
+		return err
+	}
+
+	deadline := m.now().Add(CloseMargin)
+	for _, ch := range channels {
+		if ch.Role != RolePayee || ch.Closed || ch.Expires.After(deadline) {
+			continue
+		}
+		if ch.Voucher == nil {
+			m.mtx.Lock()
+			ch.Closed, ch.Updated = true, m.now()
+			err = putChannel(m.ds, ch)
+			m.mtx.Unlock()
+		} else {
+			_, err = m.Close(ch.ID)
+		}
+		if err != nil {
+			log.Errorf("can't close payment channel %s: %v", ch.ID, err)
+			continue
+		}
+		log.Infof("closed expiring payment channel %s, %d tokens claimed", ch.ID, ch.Paid)
+	}
+	return nil
+}
+
+// Run closes expiring channels every CheckInterval until ctx is done.
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.CloseExpiring(); err != nil {
+				log.Error(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package paychan
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/casper/sc/mock"
+	scin "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+	testutil "gx/ipfs/QmWRCn8vruNAzHx8i6SAXinuheRitKEGu8c7m26stKvsYx/go-testutil"
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+	mocknet "gx/ipfs/QmefgzMbKZYsmHFkLqxgaTBG9ypeEjrdWRD5WXH4j1cWDL/go-libp2p/p2p/net/mock"
+)
+
+type testNet struct {
+	sc           *mock.Contract
+	payer, payee *Manager
+}
+
+func newTestNet(t *testing.T, ctx context.Context) *testNet {
+	c := &mock.Contract{}
+	if err := c.Init(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddToken(100); err != nil {
+		t.Fatal(err)
+	}
+
+	mn := mocknet.New(ctx)
+	var managers []*Manager
+	for i := 0; i < 2; i++ {
+		sk, _, err := ci.GenerateKeyPair(ci.RSA, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := mn.AddPeer(sk, testutil.RandLocalTCPAddress())
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := NewManager(dssync.MutexWrap(ds.NewMapDatastore()), h, sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.SC = func() (scin.CasperSC, error) { return c, nil }
+		Serve(h, m)
+		managers = append(managers, m)
+	}
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	n := &testNet{sc: c, payer: managers[0], payee: managers[1]}
+	if err := c.RegisterProvider(n.payee.self.Pretty(), "", "", "", 1000); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestPayments(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := newTestNet(t, ctx)
+	var credited int64
+	n.payee.OnPaid = func(payer peer.ID, amount int64) {
+		if payer == n.payer.self {
+			credited += amount
+		}
+	}
+
+	ch, err := n.payer.Open(n.payee.self, 60, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, amount := range []int64{10, 15} {
+		if _, err = n.payer.Pay(ctx, ch.ID, amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = n.payer.Pay(ctx, ch.ID, 50); err != ErrNoFunds {
+		t.Fatalf("expected ErrNoFunds, got %v", err)
+	}
+
+	received, err := n.payee.Get(ch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.Role != RolePayee || received.Paid != 25 || received.Peer != n.payer.self.Pretty() {
+		t.Fatalf("unexpected payee channel %+v", received)
+	}
+	if credited != 25 {
+		t.Fatalf("payer must be credited with 25 tokens, got %d", credited)
+	}
+
+	// replayed voucher is rejected
+	if _, err = n.payee.Receive(n.payer.self, received.Voucher); err == nil {
+		t.Fatal("stale voucher must be rejected")
+	}
+	// voucher can be sent only by payer
+	v, err := NewVoucher(n.payer.sk, ch.ID, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = n.payee.Receive(n.payee.self, v); err != ErrWrongSigner {
+		t.Fatalf("expected ErrWrongSigner, got %v", err)
+	}
+	forged, err := NewVoucher(n.payee.sk, ch.ID, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = n.payee.Receive(n.payer.self, forged); err != ErrBadSignature {
+		t.Fatalf("expected ErrBadSignature, got %v", err)
+	}
+
+	if _, err = n.payee.Settle(ch.ID); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := n.sc.Balance(n.payee.self.Pretty()); b != 25 {
+		t.Fatalf("payee must be paid 25 tokens, got %d", b)
+	}
+
+	if _, err = n.payer.Pay(ctx, ch.ID, 5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = n.payee.Close(ch.ID); err != nil {
+		t.Fatal(err)
+	}
+	payer, _ := n.sc.Balance(n.sc.GetWallet())
+	payee, _ := n.sc.Balance(n.payee.self.Pretty())
+	if payer != 70 || payee != 30 {
+		t.Fatalf("unexpected balances: payer %d, payee %d", payer, payee)
+	}
+	if _, err = n.payer.Pay(ctx, ch.ID, 5); err == nil {
+		t.Fatal("payment to closed channel must fail")
+	}
+}
+
+func TestCloseExpiring(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := newTestNet(t, ctx)
+
+	ch, err := n.payer.Open(n.payee.self, 60, 3*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = n.payer.Pay(ctx, ch.ID, 20); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = n.payee.CloseExpiring(); err != nil {
+		t.Fatal(err)
+	}
+	if received, _ := n.payee.Get(ch.ID); received.Closed {
+		t.Fatal("channel must not be closed long before expiry")
+	}
+
+	clock := time.Now().Add(2*time.Hour + time.Minute)
+	n.payee.now = func() time.Time { return clock }
+	if _, err = n.payer.Pay(ctx, ch.ID, 5); err == nil {
+		t.Fatal("vouchers must not be accepted shortly before expiry")
+	}
+	if err = n.payee.CloseExpiring(); err != nil {
+		t.Fatal(err)
+	}
+	received, err := n.payee.Get(ch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !received.Closed || received.Settled != 20 {
+		t.Fatalf("expiring channel must be closed, got %+v", received)
+	}
+	if b, _ := n.sc.Balance(n.payee.self.Pretty()); b != 20 {
+		t.Fatalf("payee must be paid 20 tokens, got %d", b)
+	}
+}
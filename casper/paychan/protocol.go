@@ -0,0 +1,78 @@
+package paychan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	inet "gx/ipfs/QmNa31VPzC561NWwRsJLE7nGYZYuuD2QfpK2b1q9BK54J1/go-libp2p-net"
+	pstore "gx/ipfs/QmPgDWmTmuzvP7QE5zwo1TmjbJme9pmZHNujB2453jkCTr/go-libp2p-peerstore"
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
+	pro "gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
+	p2phost "gx/ipfs/Qmc1XhrFEiSeBNn3mpfg6gEuYCt5im2gYmNVmncsvmpeAk/go-libp2p-host"
+)
+
+// Protocol is used by payers to send vouchers to payees.
+const Protocol = pro.ID("/casper/paychan/1.0.0")
+
+const streamTimeout = time.Minute
+
+var ErrNoHost = errors.New("libp2p host is not set for payment channels")
+
+type response struct {
+	Error string `json:",omitempty"`
+	// Paid is the amount paid by the voucher
+	Paid int64
+}
+
+// Serve accepts vouchers sent to h with m.
+func Serve(h p2phost.Host, m *Manager) {
+	h.SetStreamHandler(Protocol, func(s inet.Stream) {
+		defer s.Close()
+		s.SetDeadline(time.Now().Add(streamTimeout))
+
+		var resp response
+		v := &Voucher{}
+		err := json.NewDecoder(s).Decode(v)
+		if err == nil {
+			// streams are authenticated, so remote peer is the payer
+			resp.Paid, err = m.Receive(s.Conn().RemotePeer(), v)
+		}
+		if err != nil {
+			log.Warningf("voucher from %s is rejected: %v", s.Conn().RemotePeer(), err)
+			resp.Error = err.Error()
+		}
+		json.NewEncoder(s).Encode(&resp)
+	})
+}
+
+func send(ctx context.Context, h p2phost.Host, payee peer.ID, v *Voucher) error {
+	if h == nil {
+		return ErrNoHost
+	}
+	ctx, cancel := context.WithTimeout(ctx, streamTimeout)
+	defer cancel()
+
+	if err := h.Connect(ctx, pstore.PeerInfo{ID: payee}); err != nil {
+		return err
+	}
+	s, err := h.NewStream(ctx, payee, Protocol)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(streamTimeout))
+
+	if err = json.NewEncoder(s).Encode(v); err != nil {
+		return err
+	}
+	var resp response
+	if err = json.NewDecoder(s).Decode(&resp); err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package paychan
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	"gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+)
+
+const channelKeyPrefix = "/local/paychan/"
+
+var ErrUnknownChannel = errors.New("unknown payment channel")
+
+type Role string
+
+const (
+	RolePayer Role = "payer"
+	RolePayee Role = "payee"
+)
+
+// Channel is the local state of a payment channel.
+type Channel struct {
+	ID   string
+	Role Role
+	// Peer is the other side of the channel
+	Peer string
+	// Signer is the public key of payer which signs vouchers
+	Signer   []byte
+	Capacity int64
+	Expires  time.Time
+	// Paid is the amount of the latest voucher
+	Paid    int64
+	Voucher *Voucher `json:",omitempty"`
+	// Settled is the amount claimed in SC
+	Settled int64
+	Closed  bool
+	Created time.Time
+	Updated time.Time
+}
+
+// Remaining returns amount which can still be paid.
+func (c *Channel) Remaining() int64 {
+	return c.Capacity - c.Paid
+}
+
+func channelKey(id string) ds.Key {
+	return ds.NewKey(channelKeyPrefix + id)
+}
+
+func getChannel(d ds.Datastore, id string) (*Channel, error) {
+	v, err := d.Get(channelKey(id))
+	if err == ds.ErrNotFound {
+		return nil, ErrUnknownChannel
+	} else if err != nil {
+		return nil, err
+	}
+
+	ch := &Channel{}
+	if err = json.Unmarshal(v.([]byte), ch); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+func putChannel(d ds.Datastore, ch *Channel) error {
+	b, err := json.Marshal(ch)
+	if err != nil {
+		return err
+	}
+	return d.Put(channelKey(ch.ID), b)
+}
+
+// listChannels returns all channels, newest first.
+func listChannels(d ds.Datastore) ([]*Channel, error) {
+	res, err := d.Query(query.Query{Prefix: channelKeyPrefix})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var channels []*Channel
+	for e := range res.Next() {
+		if e.Error != nil {
+			return nil, e.Error
+		}
+		ch := &Channel{}
+		if err = json.Unmarshal(e.Value.([]byte), ch); err != nil {
+			log.Errorf("invalid payment channel at %s: %v", e.Key, err)
+			continue
+		}
+		channels = append(channels, ch)
+	}
+
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Created.After(channels[j].Created) })
+	return channels, nil
+}
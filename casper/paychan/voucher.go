@@ -0,0 +1,52 @@
+// Package paychan implements unidirectional payment channels between
+// clients and providers. Client locks tokens for a provider in SC once
+// and then pays for every download with vouchers, which are signed by
+// its libp2p key and sent over Protocol. Amounts of vouchers are
+// cumulative, so provider has to keep only the latest one and settles
+// it with SC when it wants to, at the latest before channel expires.
+// Contract must implement sc_interface.PaymentChannelSC, which only the
+// mock does until channels are deployed to ETH and NEO.
+package paychan
+
+import (
+	"errors"
+
+	sc "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+)
+
+var ErrBadSignature = errors.New("voucher signature is invalid")
+
+// Voucher lets payee claim Amount from channel Channel.
+type Voucher struct {
+	Channel   string
+	Amount    int64
+	Signature []byte
+}
+
+// NewVoucher returns voucher signed with sk.
+func NewVoucher(sk ci.PrivKey, channel string, amount int64) (*Voucher, error) {
+	sig, err := sk.Sign(sc.VoucherPayload(channel, amount))
+	if err != nil {
+		return nil, err
+	}
+	return &Voucher{Channel: channel, Amount: amount, Signature: sig}, nil
+}
+
+// Verify checks that v is signed by signer.
+func (v *Voucher) Verify(signer []byte) error {
+	pk, err := ci.UnmarshalPublicKey(signer)
+	if err != nil {
+		return err
+	}
+	if ok, err := pk.Verify(sc.VoucherPayload(v.Channel, v.Amount), v.Signature); err != nil || !ok {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// SCVoucher converts v to the format of SC.
+func (v *Voucher) SCVoucher() sc.PaymentVoucher {
+	return sc.PaymentVoucher{ChannelID: v.Channel, Amount: v.Amount, Signature: v.Signature}
+}
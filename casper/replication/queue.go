@@ -0,0 +1,402 @@
+// Package replication implements durable queue of replication jobs.
+// A job is created for every file stored on a banned provider and is
+// kept in the repo datastore until the file is replicated to another
+// provider, so that jobs survive restarts of the node. Failed attempts
+// are retried with exponential backoff.
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/casper/events"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	"gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+)
+
+var log = logging.Logger("replication")
+
+const (
+	DefaultMaxConcurrent = 4
+	DefaultMaxAttempts   = 8
+	DefaultMinBackoff    = time.Minute
+	DefaultMaxBackoff    = time.Hour
+	DefaultPollInterval  = 30 * time.Second
+
+	jobKeyPrefix = "/local/replication/"
+)
+
+var (
+	ErrUnknownJob  = errors.New("unknown replication job")
+	ErrJobRunning  = errors.New("replication job is running")
+	ErrJobFinished = errors.New("replication job is already finished")
+)
+
+type State string
+
+const (
+	StatePending   State = "pending"
+	StateRunning   State = "running"
+	StateDone      State = "done"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled"
+)
+
+// Job describes replication of a single file from a banned provider.
+// Pair (FileID, BannedNode) is unique, so that the same job is not
+// created twice if the provider is reported as banned several times.
+type Job struct {
+	FileID      string
+	BannedNode  string
+	Size        int64
+	State       State
+	Attempts    int
+	LastError   string `json:",omitempty"`
+	NextAttempt time.Time
+	Created     time.Time
+	Updated     time.Time
+}
+
+// ID returns job ID which is used in 'ipfs casper replication' commands.
+func (j *Job) ID() string {
+	return JobID(j.FileID, j.BannedNode)
+}
+
+func JobID(fileID, bannedNode string) string {
+	return fileID + "/" + bannedNode
+}
+
+// ReplicateFunc replicates file with specified ID and size
+// which was stored on bannedNode to some other provider.
+type ReplicateFunc func(ctx context.Context, fileID, bannedNode string, size int64) error
+
+// Queue processes jobs stored in datastore. Only one queue must be
+// used for a datastore, commands use the one run by daemon.
+type Queue struct {
+	MaxConcurrent int
+	MaxAttempts   int
+	MinBackoff    time.Duration
+	MaxBackoff    time.Duration
+	PollInterval  time.Duration
+
+	ds        ds.Datastore
+	replicate ReplicateFunc
+	wake      chan struct{}
+
+	// mtx guards jobs in datastore and running
+	mtx     sync.Mutex
+	running map[string]context.CancelFunc
+}
+
+// NewQueue returns queue which stores jobs in d.
+// replicate can be nil if queue is not going to be run.
+func NewQueue(d ds.Datastore, replicate ReplicateFunc) *Queue {
+	return &Queue{
+		MaxConcurrent: DefaultMaxConcurrent,
+		MaxAttempts:   DefaultMaxAttempts,
+		MinBackoff:    DefaultMinBackoff,
+		MaxBackoff:    DefaultMaxBackoff,
+		PollInterval:  DefaultPollInterval,
+
+		ds:        d,
+		replicate: replicate,
+		wake:      make(chan struct{}, 1),
+		running:   make(map[string]context.CancelFunc),
+	}
+}
+
+// Add creates new job. If job for the same file and banned node
+// already exists, it is returned instead and created is false.
+func (q *Queue) Add(fileID, bannedNode string, size int64) (job *Job, created bool, err error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	id := JobID(fileID, bannedNode)
+	if job, err = q.get(id); err != ErrUnknownJob {
+		return job, false, err
+	}
+
+	now := time.Now()
+	job = &Job{
+		FileID:      fileID,
+		BannedNode:  bannedNode,
+		Size:        size,
+		State:       StatePending,
+		NextAttempt: now,
+		Created:     now,
+		Updated:     now,
+	}
+	if err = q.put(job); err != nil {
+		return nil, false, err
+	}
+
+	log.Infof("replication job %s created", id)
+	q.notify()
+	return job, true, nil
+}
+
+func (q *Queue) Get(id string) (*Job, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return q.get(id)
+}
+
+// List returns all jobs sorted by creation time.
+func (q *Queue) List() ([]*Job, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return q.list()
+}
+
+// Retry makes failed or cancelled job pending again and resets
+// number of attempts. Pending job is rescheduled immediately.
+func (q *Queue) Retry(id string) (*Job, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	job, err := q.get(id)
+	if err != nil {
+		return nil, err
+	}
+	switch job.State {
+	case StateRunning:
+		return nil, ErrJobRunning
+	case StateDone:
+		return nil, ErrJobFinished
+	}
+
+	job.State = StatePending
+	job.Attempts = 0
+	job.NextAttempt = time.Now()
+	if err = q.put(job); err != nil {
+		return nil, err
+	}
+
+	q.notify()
+	return job, nil
+}
+
+// Cancel cancels job. Running replication is interrupted.
+func (q *Queue) Cancel(id string) (*Job, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	job, err := q.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.State == StateDone {
+		return nil, ErrJobFinished
+	}
+
+	job.State = StateCancelled
+	if err = q.put(job); err != nil {
+		return nil, err
+	}
+	if cancel, ok := q.running[id]; ok {
+		cancel()
+	}
+	return job, nil
+}
+
+// Run processes jobs until ctx is done. Jobs which were running
+// when the node was stopped are started again.
+func (q *Queue) Run(ctx context.Context) {
+	if err := q.resume(); err != nil {
+		log.Error(err)
+	}
+
+	ticker := time.NewTicker(q.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := q.schedule(ctx); err != nil {
+			log.Error(err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-q.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (q *Queue) resume() error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	jobs, err := q.list()
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if _, ok := q.running[job.ID()]; job.State == StateRunning && !ok {
+			job.State = StatePending
+			if err = q.put(job); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (q *Queue) schedule(ctx context.Context) error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	jobs, err := q.list()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, job := range jobs {
+		if len(q.running) >= q.MaxConcurrent {
+			return nil
+		}
+		if job.State != StatePending || job.NextAttempt.After(now) {
+			continue
+		}
+
+		job.State = StateRunning
+		job.Attempts++
+		if err = q.put(job); err != nil {
+			return err
+		}
+
+		jctx, cancel := context.WithCancel(ctx)
+		q.running[job.ID()] = cancel
+		go q.process(jctx, *job)
+	}
+	return nil
+}
+
+func (q *Queue) process(ctx context.Context, job Job) {
+	log.Infof("replicating %s (attempt %d)", job.ID(), job.Attempts)
+	err := q.replicate(ctx, job.FileID, job.BannedNode, job.Size)
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	id := job.ID()
+	q.running[id]()
+	delete(q.running, id)
+	defer q.notify()
+
+	stored, gerr := q.get(id)
+	if gerr != nil {
+		log.Error(gerr)
+		return
+	}
+	if stored.State != StateRunning {
+		// job was cancelled while running
+		return
+	}
+
+	e := events.Event{Hash: job.FileID, Peer: job.BannedNode, Size: job.Size}
+	switch {
+	case err == nil:
+		log.Infof("replication job %s finished", id)
+		stored.State = StateDone
+		stored.LastError = ""
+		e.Type = events.ReplicationDone
+		events.Publish(e)
+	case stored.Attempts >= q.MaxAttempts:
+		log.Errorf("replication job %s failed: %v", id, err)
+		stored.State = StateFailed
+		stored.LastError = err.Error()
+		e.Type, e.Error = events.ReplicationFailed, err.Error()
+		events.Publish(e)
+	default:
+		log.Infof("replication job %s will be retried: %v", id, err)
+		stored.State = StatePending
+		stored.LastError = err.Error()
+		stored.NextAttempt = time.Now().Add(q.backoff(stored.Attempts))
+	}
+	if err = q.put(stored); err != nil {
+		log.Error(err)
+	}
+}
+
+// backoff returns delay before next attempt after n failed ones.
+func (q *Queue) backoff(n int) time.Duration {
+	d := q.MinBackoff
+	for i := 1; i < n && d < q.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > q.MaxBackoff {
+		d = q.MaxBackoff
+	}
+	return d
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func jobKey(id string) ds.Key {
+	return ds.NewKey(jobKeyPrefix + id)
+}
+
+func (q *Queue) get(id string) (*Job, error) {
+	if strings.Count(id, "/") != 1 {
+		return nil, ErrUnknownJob
+	}
+
+	v, err := q.ds.Get(jobKey(id))
+	if err == ds.ErrNotFound {
+		return nil, ErrUnknownJob
+	} else if err != nil {
+		return nil, err
+	}
+
+	job := &Job{}
+	if err = json.Unmarshal(v.([]byte), job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (q *Queue) put(job *Job) error {
+	job.Updated = time.Now()
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return q.ds.Put(jobKey(job.ID()), b)
+}
+
+func (q *Queue) list() ([]*Job, error) {
+	res, err := q.ds.Query(query.Query{Prefix: jobKeyPrefix})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var jobs []*Job
+	for e := range res.Next() {
+		if e.Error != nil {
+			return nil, e.Error
+		}
+		job := &Job{}
+		if err = json.Unmarshal(e.Value.([]byte), job); err != nil {
+			log.Errorf("invalid replication job at %s: %v", e.Key, err)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Created.Before(jobs[j].Created) })
+	return jobs, nil
+}
@@ -0,0 +1,189 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+)
+
+func newTestQueue(d ds.Datastore, replicate ReplicateFunc) *Queue {
+	q := NewQueue(d, replicate)
+	q.MinBackoff = time.Millisecond
+	q.MaxBackoff = 4 * time.Millisecond
+	q.PollInterval = 5 * time.Millisecond
+	return q
+}
+
+func waitState(t *testing.T, q *Queue, id string, state State) *Job {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := q.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.State == state {
+			return job
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("job %s has not reached state %s", id, state)
+	return nil
+}
+
+func TestAddIsIdempotent(t *testing.T) {
+	q := newTestQueue(dssync.MutexWrap(ds.NewMapDatastore()), nil)
+	job, created, err := q.Add("file", "node", 10)
+	if err != nil || !created {
+		t.Fatalf("job must be created: %v", err)
+	}
+	if _, created, _ = q.Add("file", "node", 10); created {
+		t.Fatal("duplicate job must not be created")
+	}
+	if _, created, _ = q.Add("file", "other", 10); !created {
+		t.Fatal("job for other node must be created")
+	}
+
+	jobs, err := q.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[0].ID() != job.ID() {
+		t.Fatalf("unexpected jobs: %v", jobs)
+	}
+	if _, err = q.Get("unknown"); err != ErrUnknownJob {
+		t.Fatalf("expected ErrUnknownJob, got %v", err)
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	var calls int
+	var cmtx sync.Mutex
+	q := newTestQueue(dssync.MutexWrap(ds.NewMapDatastore()), func(ctx context.Context, fileID, bannedNode string, size int64) error {
+		cmtx.Lock()
+		defer cmtx.Unlock()
+		if calls++; calls < 3 {
+			return errors.New("no peers")
+		}
+		return nil
+	})
+	q.MaxAttempts = 3
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	job, _, _ := q.Add("file", "node", 10)
+	job = waitState(t, q, job.ID(), StateDone)
+	if job.Attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", job.Attempts)
+	}
+
+	cmtx.Lock()
+	calls = -10
+	cmtx.Unlock()
+	job, _, _ = q.Add("file2", "node", 10)
+	job = waitState(t, q, job.ID(), StateFailed)
+	if job.LastError == "" {
+		t.Fatal("error must be stored")
+	}
+
+	if _, err := q.Retry(job.ID()); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, q, job.ID(), StateFailed)
+}
+
+func TestBackoff(t *testing.T) {
+	q := NewQueue(nil, nil)
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute}
+	for i, d := range expected {
+		if b := q.backoff(i + 1); b != d {
+			t.Fatalf("attempt %d: expected %v, got %v", i+1, d, b)
+		}
+	}
+	if b := q.backoff(100); b != q.MaxBackoff {
+		t.Fatalf("backoff must be capped, got %v", b)
+	}
+}
+
+func TestConcurrencyAndCancel(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan string, 10)
+	q := newTestQueue(dssync.MutexWrap(ds.NewMapDatastore()), func(ctx context.Context, fileID, bannedNode string, size int64) error {
+		started <- fileID
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	q.MaxConcurrent = 2
+
+	for _, f := range []string{"a", "b", "c"} {
+		q.Add(f, "node", 1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	first := <-started
+	<-started
+	select {
+	case f := <-started:
+		t.Fatalf("job %s must wait for a free slot", f)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if _, err := q.Cancel(JobID(first, "node")); err != nil {
+		t.Fatal(err)
+	}
+	// cancelled job frees a slot
+	<-started
+	waitState(t, q, JobID(first, "node"), StateCancelled)
+
+	close(release)
+	var last string
+	for _, f := range []string{"a", "b", "c"} {
+		if f != first {
+			waitState(t, q, JobID(f, "node"), StateDone)
+			last = f
+		}
+	}
+	if _, err := q.Cancel(JobID(last, "node")); err != ErrJobFinished {
+		t.Fatalf("expected ErrJobFinished, got %v", err)
+	}
+}
+
+func TestResume(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	q := newTestQueue(d, nil)
+	job, _, _ := q.Add("file", "node", 1)
+	job.State = StateRunning
+	if err := q.put(job); err != nil {
+		t.Fatal(err)
+	}
+
+	// node was restarted
+	done := make(chan struct{}, 1)
+	q = newTestQueue(d, func(ctx context.Context, fileID, bannedNode string, size int64) error {
+		done <- struct{}{}
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("interrupted job was not resumed")
+	}
+	waitState(t, q, job.ID(), StateDone)
+}
@@ -0,0 +1,183 @@
+package restapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/casper/access"
+	"github.com/Casper-dev/Casper-server/casper/events"
+	path "github.com/Casper-dev/Casper-server/path"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	CasperApiEvents = "events"
+	eventsWebSocket = "ws"
+
+	lastEventIDHeader = "Last-Event-ID"
+	keepAliveInterval = 30 * time.Second
+)
+
+// eventFilter selects events requested by client.
+type eventFilter struct {
+	after uint64
+	types []events.Type
+	uuid  string
+}
+
+func parseEventFilter(req *http.Request) (*eventFilter, error) {
+	q := req.URL.Query()
+	f := &eventFilter{uuid: q.Get("uuid")}
+
+	after := req.Header.Get(lastEventIDHeader)
+	if after == "" {
+		after = q.Get("after")
+	}
+	if after != "" {
+		var err error
+		if f.after, err = strconv.ParseUint(after, 10, 64); err != nil {
+			return nil, errors.New("invalid event ID")
+		}
+	}
+	if types := q.Get("types"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			f.types = append(f.types, events.Type(t))
+		}
+	}
+	return f, nil
+}
+
+// run calls send for every selected event until ctx is done or send fails.
+// keepAlive is called when there were no events for a while.
+func (f *eventFilter) run(ctx context.Context, send func(e events.Event) error, keepAlive func() error) {
+	s := events.Subscribe(f.after, f.types...)
+	defer s.Close()
+
+	t := time.NewTicker(keepAliveInterval)
+	defer t.Stop()
+	for {
+		var err error
+		select {
+		case e, ok := <-s.C:
+			if !ok {
+				return
+			}
+			if f.uuid != "" && e.UUID != f.uuid {
+				continue
+			}
+			err = send(e)
+		case <-t.C:
+			err = keepAlive()
+		case <-ctx.Done():
+			return
+		}
+		if err != nil {
+			log.Debugf("event stream is closed: %v", err)
+			return
+		}
+	}
+}
+
+// processEvents streams events as server-sent events or over WebSocket.
+// Events describe files of all clients, so only admin can receive them.
+func (h *handler) processEvents(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+	if cl := access.FromContext(req.Context()); cl == nil || !cl.Admin {
+		http.Error(w, "only admin can receive events", http.StatusForbidden)
+		return
+	}
+	f, err := parseEventFilter(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if pth := path.SplitList(req.URL.Path); len(pth) == 2 && pth[1] == eventsWebSocket {
+		h.streamWebSocket(w, req, f)
+		return
+	}
+	streamSSE(w, req, f)
+}
+
+func streamSSE(w http.ResponseWriter, req *http.Request, f *eventFilter) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	hdr := w.Header()
+	hdr.Set(contentTypeHeader, "text/event-stream")
+	hdr.Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func(e events.Event) error {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, b); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	keepAlive := func() error {
+		if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	f.run(req.Context(), send, keepAlive)
+}
+
+// streamWebSocket sends every event as a JSON text message.
+func (h *handler) streamWebSocket(w http.ResponseWriter, req *http.Request, f *eventFilter) {
+	s := websocket.Server{
+		// browsers must be allowed by CORS settings, other clients do not send Origin
+		Handshake: func(_ *websocket.Config, req *http.Request) error {
+			if req.Header.Get("Origin") != "" && h.access.AllowOrigin(req) == "" {
+				return errors.New("origin is not allowed")
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			// messages from client are ignored, read fails when it disconnects
+			ctx, cancel := context.WithCancel(req.Context())
+			defer cancel()
+			go func() {
+				defer cancel()
+				ioutil.ReadAll(ws)
+			}()
+
+			send := func(e events.Event) error {
+				return websocket.JSON.Send(ws, e)
+			}
+			keepAlive := func() error {
+				w, err := ws.NewFrameWriter(websocket.PingFrame)
+				if err != nil {
+					return err
+				}
+				_, err = w.Write(nil)
+				return err
+			}
+			f.run(ctx, send, keepAlive)
+		},
+	}
+	s.ServeHTTP(w, req)
+}
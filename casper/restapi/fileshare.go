@@ -1,28 +1,85 @@
 package restapi
 
 import (
-	"context"
+	"encoding/json"
 	"errors"
-	"io"
+	"fmt"
 	"net"
 	"net/http"
 	"strconv"
-	"sync"
+	"time"
 
+	"github.com/Casper-dev/Casper-server/blockservice"
+	"github.com/Casper-dev/Casper-server/casper/access"
+	"github.com/Casper-dev/Casper-server/casper/owner"
+	"github.com/Casper-dev/Casper-server/casper/share"
+	"github.com/Casper-dev/Casper-server/casper/uuid"
 	cmds "github.com/Casper-dev/Casper-server/commands"
-	cmdsHttp "github.com/Casper-dev/Casper-server/commands/http"
 	"github.com/Casper-dev/Casper-server/core"
 	"github.com/Casper-dev/Casper-server/core/corehttp"
-	"github.com/Casper-dev/Casper-server/core/coreunix"
+	"github.com/Casper-dev/Casper-server/exchange/offline"
+	dag "github.com/Casper-dev/Casper-server/merkledag"
+	"github.com/Casper-dev/Casper-server/path"
+
+	b58 "gx/ipfs/QmT8rehPR3F6bmwL6zjUN8XpiDBFFpMP2myPdC6ApsWfJf/go-base58"
 )
 
 const (
 	// CasperFileSharePath is API prefix to all file links
 	CasperFileSharePath = "/casper/share"
+
+	shareTTLParam       = "ttl"
+	shareDownloadsParam = "downloads"
+	sharePasswordParam  = "password"
 )
 
-var errLinkNotFound = errors.New("link does not exist or expired")
-var fileLinkHandlers = &sync.Map{}
+// shareLink is a share link as it is returned by REST API
+type shareLink struct {
+	Link         string
+	UUID         string
+	Created      time.Time
+	Expires      time.Time
+	MaxDownloads int `json:",omitempty"`
+	Downloads    int
+	Protected    bool
+}
+
+func newShareLink(l *share.Link) *shareLink {
+	return &shareLink{
+		Link:         sharePath(l.Magic),
+		UUID:         l.UUID,
+		Created:      l.Created,
+		Expires:      l.Expires,
+		MaxDownloads: l.MaxDownloads,
+		Downloads:    l.Downloads,
+		Protected:    l.Protected(),
+	}
+}
+
+func sharePath(magic string) string {
+	return fmt.Sprintf("%s/%s", CasperFileSharePath, magic)
+}
+
+// newShareStore returns store of share links with limits from node config.
+func newShareStore(n *core.IpfsNode) (*share.Store, error) {
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	s := share.NewStore(n.Repo.Datastore())
+	if ttl := cfg.Casper.ShareLinks.DefaultTTL; ttl != "" {
+		if s.DefaultTTL, err = time.ParseDuration(ttl); err != nil {
+			return nil, fmt.Errorf("invalid Casper.ShareLinks.DefaultTTL: %v", err)
+		}
+	}
+	if ttl := cfg.Casper.ShareLinks.MaxTTL; ttl != "" {
+		if s.MaxTTL, err = time.ParseDuration(ttl); err != nil {
+			return nil, fmt.Errorf("invalid Casper.ShareLinks.MaxTTL: %v", err)
+		}
+	}
+	return s, nil
+}
 
 type fileHandler struct {
 	cctx cmds.Context
@@ -32,55 +89,213 @@ func (fh *fileHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	defer recoverHandler()
 
 	log.Debugf("got file request: %v", req.URL.Path)
-	magic := req.URL.Path
-	val, ok := fileLinkHandlers.Load(magic)
-	if !ok || val == nil {
-		http.Error(w, errLinkNotFound.Error(), http.StatusNotFound)
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, "", http.StatusMethodNotAllowed)
 		return
 	}
 
-	h := w.Header()
-	h.Set(ACAOrigin, "*")
-
-	n, _ := fh.cctx.GetNode()
-	out, size, err := cat(req.Context(), n, val.(string))
-	log.Debugf("%v %d %v", out, size, err)
+	n, err := fh.cctx.GetNode()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, "cant get ipfs node", http.StatusInternalServerError)
+		return
+	}
+	store, err := newShareStore(n)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	status := http.StatusOK
+	// password is entered in browser dialog, it is not accepted in
+	// query, so that it does not get into logs and browser history
+	_, password, _ := req.BasicAuth()
+	link, err := store.Check(req.URL.Path, password)
+	switch err {
+	case nil:
+	case share.ErrNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case share.ErrBadPassword:
+		w.Header().Set("WWW-Authenticate", `Basic realm="casper share"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	mime := req.Header.Get(contentTypeHeader)
-	if mime == "" {
-		mime = "text/plain"
+	w.Header().Set(ACAOrigin, "*")
+	w.Header().Set(ACEHeaders, "Accept-Ranges, Content-Range, Content-Length, Etag, Last-Modified")
+	serveLimited(w, req, n, link.Path, &shareLimit{store: store, magic: link.Magic, password: password})
+}
+
+// shareLimit counts traffic served by the link, so that downloads are
+// counted however the file is requested (ranges, resumed transfers).
+type shareLimit struct {
+	store    *share.Store
+	magic    string
+	password string
+}
+
+func (l *shareLimit) reserve(size uint64) (uint64, error) {
+	_, allowed, err := l.store.Reserve(l.magic, l.password, size)
+	return allowed, err
+}
+
+func (l *shareLimit) release(size, reservation, written uint64) {
+	if err := l.store.Release(l.magic, size, reservation, written); err != nil && err != share.ErrNotFound {
+		log.Error(err)
 	}
+}
 
-	h.Set("Trailer", cmdsHttp.StreamErrHeader)
-	h.Set(contentLengthHeader, strconv.FormatUint(size, 10))
-	h.Set(contentTypeHeader, mime)
-	h.Set(streamHeader, "1")
+var errShareForbidden = errors.New("links can be managed only by admin or by request signed by the owner of the file")
 
-	w.WriteHeader(status)
-	if err = cmdsHttp.FlushCopy(w, out); err != nil {
-		log.Error("err: ", err)
-		h.Set(cmdsHttp.StreamErrHeader, cmdsHttp.SanitizedErrStr(err))
+// authorizeShare checks that client can manage links to the file with
+// specified UUID. Admin can manage all links, other clients must sign
+// share request (see casper/owner) with the owner key of the file.
+func authorizeShare(req *http.Request, n *core.IpfsNode, id string) (int, error) {
+	if cl := access.FromContext(req.Context()); cl != nil && cl.Admin {
+		return 0, nil
 	}
+	auth := req.Header.Get(xAuthHeader)
+	if auth == "" {
+		return http.StatusForbidden, errShareForbidden
+	}
+	r, next, err := owner.Check(n, owner.FileID(id), auth, owner.OpShare)
+	if err != nil {
+		return http.StatusForbidden, err
+	}
+	if r == nil {
+		// file without owner
+		return http.StatusForbidden, errShareForbidden
+	}
+	// sequence number is stored, so that request can't be replayed
+	err = n.UpdateUUID(r.UUID, func(info *core.UUIDInfo) error {
+		if next.Seq <= info.Seq {
+			return owner.ErrReplay
+		}
+		info.Seq = next.Seq
+		return nil
+	})
+	if err == owner.ErrReplay {
+		return http.StatusForbidden, err
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return 0, nil
 }
 
-func cat(ctx context.Context, node *core.IpfsNode, path string) (io.Reader, uint64, error) {
-	read, err := coreunix.Cat(ctx, node, path)
+// processShare creates (POST), lists (GET) and revokes (DELETE) links
+// to the file with UUID from path. If link magic follows UUID in DELETE
+// request, only that link is revoked.
+func (h *handler) processShare(w http.ResponseWriter, req *http.Request) {
+	pth := path.SplitList(req.URL.Path)
+	if len(pth) < 2 {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+
+	n, err := h.cctx.GetNode()
 	if err != nil {
-		return nil, 0, err
+		http.Error(w, "cant get ipfs node", http.StatusInternalServerError)
+		return
+	}
+	store, err := newShareStore(n)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if status, err := authorizeShare(req, n, pth[1]); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodPost:
+		createShare(w, req, n, store, pth[1])
+	case http.MethodGet:
+		links, err := store.List(pth[1])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out := make([]*shareLink, 0, len(links))
+		for _, l := range links {
+			out = append(out, newShareLink(l))
+		}
+		w.Header().Set(contentTypeHeader, mimeTypes[cmds.JSON])
+		json.NewEncoder(w).Encode(out)
+	case http.MethodDelete:
+		magic := ""
+		if len(pth) > 2 {
+			magic = pth[2]
+		}
+		revoked, err := store.Revoke(pth[1], magic)
+		if err == share.ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Debugf("%d links to %s were revoked", revoked, pth[1])
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+func createShare(w http.ResponseWriter, req *http.Request, n *core.IpfsNode, store *share.Store, id string) {
+	var opts share.Options
+	var err error
+	if ttl := req.FormValue(shareTTLParam); ttl != "" {
+		if opts.TTL, err = time.ParseDuration(ttl); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if downloads := req.FormValue(shareDownloadsParam); downloads != "" {
+		if opts.MaxDownloads, err = strconv.Atoi(downloads); err != nil || opts.MaxDownloads < 0 {
+			http.Error(w, "invalid number of downloads", http.StatusBadRequest)
+			return
+		}
+	}
+	// password must not be passed in query
+	opts.Password = req.PostFormValue(sharePasswordParam)
+
+	// We need to take name of first link because we always wrap files
+	// in directory
+	c := uuid.UUIDToCid(b58.Decode(id))
+	bserv := blockservice.New(n.Blockstore, offline.Exchange(n.Blockstore))
+	dserv := dag.NewDAGService(bserv)
+	node, err := dserv.Get(req.Context(), c)
+	if err != nil || node == nil || len(node.Links()) != 1 {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
 	}
-	return read, read.Size(), nil
+
+	link, err := store.Create(id, c.String(), opts)
+	switch err {
+	case nil:
+	case share.ErrInvalidTTL, share.ErrTTLTooLong:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Debugf("file was shared at '%s'", sharePath(link.Magic))
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, sharePath(link.Magic))
 }
 
-func CasperFileShareOption(cctx cmds.Context) corehttp.ServeOption {
+// CasperFileShareOption mounts downloads of share links. They don't
+// require API key, but are rate and bandwidth limited by ac.
+func CasperFileShareOption(cctx cmds.Context, ac *access.Control) corehttp.ServeOption {
 	return func(n *core.IpfsNode, l net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
 		p := CasperFileSharePath + "/"
-		mux.Handle(p, http.StripPrefix(p, &fileHandler{cctx}))
+		mux.Handle(p, http.StripPrefix(p, ac.PublicHandler(&fileHandler{cctx})))
 		return mux, nil
 	}
 }
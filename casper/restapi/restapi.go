@@ -7,16 +7,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"math/rand"
 	"mime"
 	"net"
 	"net/http"
 	"runtime/debug"
 	"strconv"
-	"time"
 
-	blockservice "github.com/Casper-dev/Casper-server/blockservice"
+	access "github.com/Casper-dev/Casper-server/casper/access"
+	catalog "github.com/Casper-dev/Casper-server/casper/catalog"
+	owner "github.com/Casper-dev/Casper-server/casper/owner"
 	uuid "github.com/Casper-dev/Casper-server/casper/uuid"
+	versions "github.com/Casper-dev/Casper-server/casper/versions"
 	cmds "github.com/Casper-dev/Casper-server/commands"
 	files "github.com/Casper-dev/Casper-server/commands/files"
 	cmdsHttp "github.com/Casper-dev/Casper-server/commands/http"
@@ -24,8 +25,6 @@ import (
 	coreCmds "github.com/Casper-dev/Casper-server/core/commands"
 	corehttp "github.com/Casper-dev/Casper-server/core/corehttp"
 	coreunix "github.com/Casper-dev/Casper-server/core/coreunix"
-	offline "github.com/Casper-dev/Casper-server/exchange/offline"
-	dag "github.com/Casper-dev/Casper-server/merkledag"
 	path "github.com/Casper-dev/Casper-server/path"
 
 	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
@@ -35,16 +34,21 @@ import (
 const (
 	CasperApiPath       = "/casper/v0"
 	CasperApiFile       = "file"
+	CasperApiFiles      = "files"
 	CasperApiShare      = "share"
 	CasperApiStat       = "stat"
+	CasperApiStats      = "stats"
+	CasperApiVersions   = "versions"
+	versionParam        = "version"
 	contentTypeHeader   = "Content-Type"
 	streamHeader        = "X-Stream-Output"
 	xPeersHeader        = "X-Peers"
+	xAuthHeader         = "X-Casper-Auth"
 	contentLengthHeader = "Content-Length"
-	linkExpireTimeout   = 5 * time.Minute
 	ACAHeaders          = "Access-Control-Allow-Headers"
 	ACAOrigin           = "Access-Control-Allow-Origin"
 	ACAMethods          = "Access-Control-Allow-Methods"
+	ACEHeaders          = "Access-Control-Expose-Headers"
 )
 
 var mimeTypes = map[string]string{
@@ -56,19 +60,25 @@ var mimeTypes = map[string]string{
 
 var log = logging.Logger("csp/api")
 
-func NewHandler(cctx cmds.Context, root *cmds.Command) http.Handler {
+func NewHandler(cctx cmds.Context, root *cmds.Command, ac *access.Control) http.Handler {
 	// setup request logger
 	cctx.ReqLog = new(cmds.ReqLog)
 
-	return &handler{
-		cctx: cctx,
-		root: root,
+	h := &handler{
+		cctx:   cctx,
+		root:   root,
+		access: ac,
 	}
+	h.limited = ac.Handler(http.HandlerFunc(h.route))
+	return h
 }
 
 type handler struct {
-	cctx cmds.Context
-	root *cmds.Command
+	cctx   cmds.Context
+	root   *cmds.Command
+	access *access.Control
+	// limited is route called by access control
+	limited http.Handler
 }
 
 type commandOpts struct {
@@ -91,21 +101,42 @@ func recoverHandler() {
 func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	defer recoverHandler()
 
-	w.Header().Set(ACAOrigin, "*")
+	if origin := h.access.AllowOrigin(req); origin != "" {
+		w.Header().Set(ACAOrigin, origin)
+		if origin != "*" {
+			w.Header().Add("Vary", "Origin")
+		}
+	}
+	w.Header().Set(ACEHeaders, "Accept-Ranges, Content-Range, Content-Length, Etag, Last-Modified, Location, Retry-After, "+
+		uploadLengthHeader+", "+uploadOffsetHeader)
 	if req.Method == http.MethodOptions {
-		w.Header().Set(ACAMethods, "DELETE, GET, OPTIONS, POST, PUT")
-		w.Header().Set(ACAHeaders, xPeersHeader)
+		w.Header().Set(ACAMethods, "DELETE, GET, HEAD, OPTIONS, PATCH, POST, PUT")
+		w.Header().Set(ACAHeaders, xPeersHeader+", "+xAuthHeader+", Authorization, X-Api-Key, Range, If-Range, If-None-Match, If-Modified-Since, "+
+			uploadLengthHeader+", "+uploadOffsetHeader+", "+contentRangeHeader)
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
+	h.limited.ServeHTTP(w, req)
+}
+
+// route is called for requests which were allowed by access control.
+func (h *handler) route(w http.ResponseWriter, req *http.Request) {
 	pth := path.SplitList(req.URL.Path)
 	if len(pth) > 0 {
 		switch pth[0] {
 		case CasperApiFile:
 			h.processFile(w, req)
+		case CasperApiFiles:
+			h.listFiles(w, req)
 		case CasperApiShare:
 			h.processShare(w, req)
+		case CasperApiUpload:
+			h.processUpload(w, req)
+		case CasperApiStats:
+			h.showStats(w, req)
+		case CasperApiEvents:
+			h.processEvents(w, req)
 		default:
 			http.Error(w, "", http.StatusNotFound)
 			return
@@ -113,7 +144,73 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// showStats writes usage of the client as JSON. Admin client
+// gets usage of all clients with all=1.
+func (h *handler) showStats(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cl := access.FromContext(req.Context())
+	var out interface{}
+	var err error
+	if req.URL.Query().Get("all") == "1" {
+		if !cl.Admin {
+			http.Error(w, "only admin can see usage of all clients", http.StatusForbidden)
+			return
+		}
+		out, err = h.access.AllUsage()
+	} else {
+		out, err = h.access.Usage(cl)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(contentTypeHeader, mimeTypes[cmds.JSON])
+	json.NewEncoder(w).Encode(out)
+}
+
+// isDownload checks if request asks for file contents,
+// which are served without calling 'cat' command.
+func isDownload(req *http.Request) bool {
+	pth := path.SplitList(req.URL.Path)
+	return (req.Method == http.MethodGet || req.Method == http.MethodHead) &&
+		len(pth) == 2 && req.URL.Query().Get("archive") != "1"
+}
+
 func (h *handler) processFile(w http.ResponseWriter, req *http.Request) {
+	if isDownload(req) {
+		n, err := h.cctx.GetNode()
+		if err != nil {
+			http.Error(w, "cant get ipfs node", http.StatusInternalServerError)
+			return
+		}
+		id, p := path.SplitList(req.URL.Path)[1], ""
+		if version := req.URL.Query().Get(versionParam); version != "" {
+			l, err := versions.List(n, id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			v, err := l.Find(version)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			p = "/ipfs/" + v.CID
+		} else {
+			p = getHash(id)
+		}
+		serveFile(w, req, n, p)
+		return
+	}
+	if pth := path.SplitList(req.URL.Path); req.Method == http.MethodGet && len(pth) == 3 && pth[2] == CasperApiVersions {
+		h.listVersions(w, pth[1])
+		return
+	}
+
 	cmdsReq, cmdOpts, err := h.parseRequest(req)
 	if err == cmdsHttp.ErrNotFound {
 		http.Error(w, err.Error(), http.StatusNotFound)
@@ -123,11 +220,54 @@ func (h *handler) processFile(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	h.callCommand(w, req, cmdsReq, cmdOpts)
+}
+
+// listVersions writes history of the file as JSON.
+func (h *handler) listVersions(w http.ResponseWriter, id string) {
 	n, err := h.cctx.GetNode()
 	if err != nil {
 		http.Error(w, "cant get ipfs node", http.StatusInternalServerError)
 		return
 	}
+	l, err := versions.List(n, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(contentTypeHeader, mimeTypes[cmds.JSON])
+	json.NewEncoder(w).Encode(l)
+}
+
+// listFiles writes page of UUID files selected by query parameters as JSON.
+func (h *handler) listFiles(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := req.URL.Query()
+	limit := 0
+	if l := q.Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	p := catalog.List(catalog.Filter{Tag: q.Get("tag"), Prefix: q.Get("prefix")}, q.Get("after"), limit)
+	w.Header().Set(contentTypeHeader, mimeTypes[cmds.JSON])
+	json.NewEncoder(w).Encode(p)
+}
+
+// callCommand calls command and writes its output to w.
+// Response is returned after it has been written.
+func (h *handler) callCommand(w http.ResponseWriter, req *http.Request, cmdsReq cmds.Request, cmdOpts *commandOpts) cmds.Response {
+	n, err := h.cctx.GetNode()
+	if err != nil {
+		http.Error(w, "cant get ipfs node", http.StatusInternalServerError)
+		return nil
+	}
 
 	ctx, cancel := context.WithCancel(n.Context())
 	defer cancel()
@@ -146,7 +286,7 @@ func (h *handler) processFile(w http.ResponseWriter, req *http.Request) {
 	err = cmdsReq.SetRootContext(ctx)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil
 	}
 
 	rlog := h.cctx.ReqLog.Add(cmdsReq)
@@ -159,70 +299,7 @@ func (h *handler) processFile(w http.ResponseWriter, req *http.Request) {
 	//fmt.Printf("Request:\n%s\n", string(b))
 
 	sendResponse(w, req, res, cmdsReq, cmdOpts)
-}
-
-func randString(n int) string {
-	letters := []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
-	s := make([]rune, n)
-	for i, l := 0, len(letters); i < n; i++ {
-		s[i] = letters[rand.Intn(l)]
-	}
-	return string(s)
-}
-
-const magicLength = 8
-
-func genMagic() (magic string) {
-	ok := true
-	for ok {
-		magic = randString(magicLength)
-		_, ok = fileLinkHandlers.Load(magic)
-	}
-	return magic
-}
-
-var errNotShareRequest = fmt.Errorf("not a share request")
-
-func (h *handler) processShare(w http.ResponseWriter, req *http.Request) {
-	pth := path.SplitList(req.URL.Path)
-	if len(pth) < 2 {
-		http.Error(w, "", http.StatusNotFound)
-		return
-	}
-	if req.Method != http.MethodPost {
-		http.Error(w, "", http.StatusBadRequest)
-		return
-	}
-
-	n, err := h.cctx.GetNode()
-	if err != nil {
-		http.Error(w, "cant get ipfs node", http.StatusInternalServerError)
-		return
-	}
-
-	// We need to take name of first link because we always wrap files
-	// in directory
-	id := uuid.UUIDToCid(b58.Decode(pth[1]))
-	bserv := blockservice.New(n.Blockstore, offline.Exchange(n.Blockstore))
-	dserv := dag.NewDAGService(bserv)
-	node, err := dserv.Get(req.Context(), id)
-	if err != nil || node == nil || len(node.Links()) != 1 {
-		http.Error(w, "file not found", http.StatusNotFound)
-		return
-	}
-
-	magic := genMagic()
-	share := fmt.Sprintf("%s/%s", CasperFileSharePath, magic)
-	fileLinkHandlers.Store(magic, id.String())
-	time.AfterFunc(linkExpireTimeout, func() {
-		log.Debugf("link '%s' has expired", share)
-		fileLinkHandlers.Delete(magic)
-	})
-
-	log.Debugf("file was shared at '%s'", share)
-
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, share)
+	return res
 }
 
 func (h *handler) parseRequest(req *http.Request) (cmds.Request, *commandOpts, error) {
@@ -252,24 +329,32 @@ func (h *handler) parseRequest(req *http.Request) (cmds.Request, *commandOpts, e
 		return nil, nil, err
 	}
 
-	optDefs, err := h.root.GetOptions(opts.cmdPath)
+	cmdsReq, err := h.newRequest(opts)
 	if err != nil {
 		return nil, nil, err
 	}
+	return cmdsReq, opts, nil
+}
+
+func (h *handler) newRequest(opts *commandOpts) (cmds.Request, error) {
+	optDefs, err := h.root.GetOptions(opts.cmdPath)
+	if err != nil {
+		return nil, err
+	}
 
 	// ignore error because command exists
 	cmd, _ := h.root.Get(opts.cmdPath[:len(opts.cmdPath)-1])
 	cmdsReq, err := cmds.NewRequest(opts.cmdPath, opts.opts, opts.args, opts.file, cmd, optDefs)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	err = cmd.CheckArguments(cmdsReq)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	return cmdsReq, opts, nil
+	return cmdsReq, nil
 }
 
 func getAddNewFileOpts(req *http.Request) (*commandOpts, error) {
@@ -278,7 +363,12 @@ func getAddNewFileOpts(req *http.Request) (*commandOpts, error) {
 		// file argument is mandatory
 		return nil, err
 	}
+	return newAddFileOpts(req, f)
+}
 
+// newAddFileOpts returns options of 'add' command which stores f as a new
+// file. Peers and owner of the file are taken from req.
+func newAddFileOpts(req *http.Request, f files.File) (*commandOpts, error) {
 	opts := map[string]interface{}{
 		cmds.EncLong:   cmds.JSON,
 		cmds.CallerOpt: cmds.CallerOptWeb,
@@ -292,6 +382,16 @@ func getAddNewFileOpts(req *http.Request) (*commandOpts, error) {
 		opts["peers"] = peers
 	}
 
+	// new file is bound to owner key if client has signed create request
+	if auth := req.Header.Get(xAuthHeader); auth != "" {
+		r, err := owner.Decode(auth)
+		if err != nil {
+			return nil, err
+		}
+		opts["uuid"] = r.UUID
+		opts["auth"] = auth
+	}
+
 	return &commandOpts{
 		cmdPath: []string{"add"},
 		opts:    opts,
@@ -331,6 +431,7 @@ func getReplaceFileOpts(req *http.Request) (*commandOpts, error) {
 			cmds.CallerOpt: cmds.CallerOptWeb,
 			"quiet":        true,
 			"uuid":         pth[1],
+			"auth":         req.Header.Get(xAuthHeader),
 		},
 		args: []string{},
 		file: f,
@@ -394,6 +495,7 @@ func getDeleteFileOpts(req *http.Request) (*commandOpts, error) {
 		opts: map[string]interface{}{
 			cmds.EncLong:   cmds.JSON,
 			cmds.CallerOpt: cmds.CallerOptWeb,
+			"auth":         req.Header.Get(xAuthHeader),
 		},
 		args: []string{getHash(pth[1])},
 	}, nil
@@ -493,10 +595,12 @@ func sendResponse(w http.ResponseWriter, r *http.Request, res cmds.Response, req
 	}
 }
 
-func CasperOption(cctx cmds.Context) corehttp.ServeOption {
+// CasperOption mounts REST API limited by ac, which must be shared
+// with other front ends of the node.
+func CasperOption(cctx cmds.Context, ac *access.Control) corehttp.ServeOption {
 	return func(n *core.IpfsNode, l net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
 		p := CasperApiPath + "/"
-		h := NewHandler(cctx, coreCmds.Root)
+		h := NewHandler(cctx, coreCmds.Root, ac)
 		mux.Handle(p, http.StripPrefix(p, h))
 		return mux, nil
 	}
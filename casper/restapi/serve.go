@@ -0,0 +1,244 @@
+package restapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/casper/access"
+	"github.com/Casper-dev/Casper-server/casper/crypto"
+	"github.com/Casper-dev/Casper-server/core"
+	dag "github.com/Casper-dev/Casper-server/merkledag"
+	path "github.com/Casper-dev/Casper-server/path"
+	ft "github.com/Casper-dev/Casper-server/unixfs"
+	uio "github.com/Casper-dev/Casper-server/unixfs/io"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+)
+
+// Files are served with http.ServeContent, so that clients can request
+// ranges of the file and revalidate cached copies. Root CID of a UUID
+// file never changes, so ETag is taken from the CID of its content.
+// Unixfs does not store modification time, instead every node remembers
+// when it has first served current content of the file.
+
+const modifiedKeyPrefix = "/local/modified/"
+
+type servedFile struct {
+	// Name is the name of the file in wrapping directory
+	Name string
+	// Root is the CID of the requested node
+	Root string
+	// Content is the CID of the file data
+	Content string
+
+	uio.DagReader
+}
+
+// openFile resolves p like 'cat' does: directory with a single
+// file is replaced by that file.
+func openFile(ctx context.Context, n *core.IpfsNode, p string) (*servedFile, error) {
+	r := &path.Resolver{
+		DAG:         n.DAG,
+		ResolveOnce: uio.ResolveUnixfsOnce,
+	}
+	nd, err := core.Resolve(ctx, n.Namesys, r, path.Path(p))
+	if err != nil {
+		return nil, err
+	}
+
+	f := &servedFile{Root: nd.Cid().String()}
+	if v, ok := nd.(*dag.ProtoNode); ok {
+		if fsn, err := ft.FSNodeFromBytes(v.Data()); err == nil {
+			if fsn.Type == ft.TDirectory && len(fsn.Data) == 0 && len(v.Links()) == 1 {
+				l := v.Links()[0]
+				if nd, err = l.GetNode(ctx, n.DAG); err != nil {
+					return nil, err
+				}
+				f.Name = l.Name
+			}
+		}
+	}
+	f.Content = nd.Cid().String()
+
+	if f.DagReader, err = uio.NewDagReader(ctx, nd, n.DAG); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+type modifiedRecord struct {
+	Content string
+	Time    time.Time
+}
+
+// lastModified returns time when content of the file was first served.
+func lastModified(d ds.Datastore, f *servedFile) time.Time {
+	key := ds.NewKey(modifiedKeyPrefix + f.Root)
+	rec := &modifiedRecord{}
+	if v, err := d.Get(key); err == nil {
+		if json.Unmarshal(v.([]byte), rec) == nil && rec.Content == f.Content {
+			return rec.Time
+		}
+	}
+
+	rec = &modifiedRecord{Content: f.Content, Time: time.Now().UTC().Truncate(time.Second)}
+	if b, err := json.Marshal(rec); err == nil {
+		if err = d.Put(key, b); err != nil {
+			log.Error(err)
+		}
+	}
+	return rec.Time
+}
+
+// transferLimit limits traffic of a response. reserve returns the number
+// of bytes which can be written for a file of specified size, release
+// is called with the number of bytes actually written.
+type transferLimit interface {
+	reserve(size uint64) (uint64, error)
+	release(size, reservation, written uint64)
+}
+
+var errTransferLimit = errors.New("transfer limit is reached")
+
+// serveFile writes file at p to w. Range, If-Range, If-None-Match
+// and If-Modified-Since headers of req are honoured. Content type
+// is guessed from the file name or sniffed from its data.
+func serveFile(w http.ResponseWriter, req *http.Request, n *core.IpfsNode, p string) {
+	serveLimited(w, req, n, p, nil)
+}
+
+// serveLimited is serveFile which writes no more than limit allows.
+func serveLimited(w http.ResponseWriter, req *http.Request, n *core.IpfsNode, p string, limit transferLimit) {
+	f, err := openFile(req.Context(), n, p)
+	switch err {
+	case nil:
+	case uio.ErrIsDir:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	h := w.Header()
+	etag := f.Content
+	var content io.ReadSeeker = &sizeSeeker{f}
+	key, status, err := requestKey(req, n)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if key != nil {
+		d, err := crypto.NewDecrypter(content, key)
+		if err == nil {
+			// wrong password is detected only by the first chunk
+			_, err = d.Seek(0, io.SeekStart)
+		}
+		switch err {
+		case nil:
+		case crypto.ErrWrongKey, crypto.ErrAuth:
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		content = d
+		// plaintext must not be stored by shared caches
+		etag += ".decrypted"
+		h.Set("Cache-Control", "private")
+		h.Set("Vary", passwordHeader+", "+keyHeader)
+	}
+	h.Set("Etag", `"`+etag+`"`)
+	// sniffed type must not be reinterpreted by browser
+	h.Set("X-Content-Type-Options", "nosniff")
+
+	if limit != nil {
+		size, err := content.Seek(0, io.SeekEnd)
+		if err == nil {
+			_, err = content.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		allowed, err := limit.reserve(uint64(size))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		lw := &limitedWriter{ResponseWriter: w, left: allowed}
+		defer func() { limit.release(uint64(size), allowed, allowed-lw.left) }()
+		w = lw
+	}
+
+	http.ServeContent(w, req, f.Name, lastModified(n.Repo.Datastore(), f), content)
+}
+
+const (
+	// passwordHeader asks to decrypt the file with password
+	passwordHeader = "X-Casper-Password"
+	// keyHeader asks to decrypt the file with keystore key of the node
+	keyHeader = "X-Casper-Key"
+)
+
+// requestKey returns decryption key requested by headers, nil if
+// the file must be served as is. Keystore keys of the node can be
+// used only by admin clients.
+func requestKey(req *http.Request, n *core.IpfsNode) (*crypto.Key, int, error) {
+	keyName := req.Header.Get(keyHeader)
+	if cl := access.FromContext(req.Context()); keyName != "" && (cl == nil || !cl.Admin) {
+		return nil, http.StatusForbidden, errors.New("only admin can decrypt with keystore keys")
+	}
+	key, err := crypto.KeyFromOptions(req.Header.Get(passwordHeader), keyName, n.GetKey)
+	switch err {
+	case nil:
+		return key, 0, nil
+	case crypto.ErrNoKey:
+		return nil, 0, nil
+	default:
+		return nil, http.StatusBadRequest, err
+	}
+}
+
+type sizeReadSeeker interface {
+	Size() uint64
+
+	io.ReadSeeker
+}
+
+// sizeSeeker allows http.ServeContent to find out size of
+// the file without reading it to the end.
+type sizeSeeker struct {
+	sizeReadSeeker
+}
+
+func (s *sizeSeeker) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekEnd && offset == 0 {
+		return int64(s.Size()), nil
+	}
+
+	return s.sizeReadSeeker.Seek(offset, whence)
+}
+
+// limitedWriter stops response body after left bytes.
+type limitedWriter struct {
+	http.ResponseWriter
+	left uint64
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if uint64(len(p)) > w.left {
+		n, _ := w.ResponseWriter.Write(p[:w.left])
+		w.left -= uint64(n)
+		return n, errTransferLimit
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.left -= uint64(n)
+	return n, err
+}
@@ -0,0 +1,118 @@
+package restapi
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Casper-dev/Casper-server/casper/crypto"
+	"github.com/Casper-dev/Casper-server/core/coreunix"
+	coremock "github.com/Casper-dev/Casper-server/core/mock"
+)
+
+func TestServeFile(t *testing.T) {
+	n, err := coremock.NewMockNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	data := []byte("<html><body>casper</body></html>")
+	_, root, err := coreunix.AddWrapped(n, bytes.NewReader(data), "index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := "/ipfs/" + root.Cid().String()
+
+	serve := func(hdr map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		serveFile(w, req, n, p)
+		return w
+	}
+
+	w := serve(nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	etag, modified := w.Header().Get("Etag"), w.Header().Get("Last-Modified")
+	if etag == "" || modified == "" {
+		t.Fatal("Etag and Last-Modified must be set")
+	}
+	if !bytes.Equal(w.Body.Bytes(), data) {
+		t.Fatalf("unexpected body %q", w.Body)
+	}
+
+	w = serve(map[string]string{"Range": "bytes=6-11"})
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("expected partial content, got %d", w.Code)
+	}
+	if b, _ := ioutil.ReadAll(w.Body); string(b) != "<body>" {
+		t.Fatalf("unexpected range %q", b)
+	}
+
+	if w = serve(map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Fatalf("expected not modified, got %d", w.Code)
+	}
+	if w = serve(map[string]string{"Range": "bytes=0-5", "If-Range": `"other"`}); w.Code != http.StatusOK {
+		t.Fatalf("range must be ignored for another version, got %d", w.Code)
+	}
+	if w = serve(nil); w.Header().Get("Last-Modified") != modified {
+		t.Fatal("Last-Modified must not change while content is the same")
+	}
+}
+
+func TestServeEncrypted(t *testing.T) {
+	n, err := coremock.NewMockNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	data := bytes.Repeat([]byte("casper "), 20000)
+	key := crypto.NewPasswordKey([]byte("secret"))
+	er, err := crypto.NewEncryptReader(bytes.NewReader(data), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, root, err := coreunix.AddWrapped(n, er, "data.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := "/ipfs/" + root.Cid().String()
+
+	serve := func(hdr map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		serveFile(w, req, n, p)
+		return w
+	}
+
+	w := serve(map[string]string{passwordHeader: "secret", "Range": "bytes=70000-70006"})
+	if w.Code != http.StatusPartialContent || w.Body.String() != string(data[70000:70007]) {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body)
+	}
+	if w.Header().Get("Cache-Control") != "private" {
+		t.Fatal("decrypted file must not be cached by shared caches")
+	}
+	if w = serve(map[string]string{passwordHeader: "secret"}); !bytes.Equal(w.Body.Bytes(), data) {
+		t.Fatal("decrypted file does not match")
+	}
+	if w = serve(map[string]string{passwordHeader: "wrong"}); w.Code != http.StatusForbidden {
+		t.Fatalf("wrong password must be rejected, got %d", w.Code)
+	}
+	if w = serve(map[string]string{keyHeader: "self"}); w.Code != http.StatusForbidden {
+		t.Fatalf("keystore key must be available only to admin, got %d", w.Code)
+	}
+}
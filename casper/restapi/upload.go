@@ -0,0 +1,217 @@
+package restapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/Casper-dev/Casper-server/casper/upload"
+	cmds "github.com/Casper-dev/Casper-server/commands"
+	"github.com/Casper-dev/Casper-server/commands/files"
+	path "github.com/Casper-dev/Casper-server/path"
+)
+
+// Resumable uploads are made in three steps:
+//   POST  upload            creates session, size is in Upload-Length header
+//   PATCH upload/<id>       appends request body at Upload-Offset,
+//                           PUT with Content-Range can be used instead
+//   POST  upload/<id>       adds uploaded file like POST file does
+// HEAD upload/<id> returns current offset, so that client knows where
+// to continue after dropped connection. DELETE upload/<id> aborts upload.
+
+const (
+	CasperApiUpload = "upload"
+
+	uploadLengthHeader = "Upload-Length"
+	uploadOffsetHeader = "Upload-Offset"
+	contentRangeHeader = "Content-Range"
+	uploadNameParam    = "name"
+)
+
+var errNoUploadLength = errors.New("Upload-Length header is required")
+
+func (h *handler) uploadStore() (*upload.Store, error) {
+	n, err := h.cctx.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	return upload.NewStore(n.Repo.Datastore(), filepath.Join(h.cctx.ConfigRoot, upload.StagingDir)), nil
+}
+
+func (h *handler) processUpload(w http.ResponseWriter, req *http.Request) {
+	store, err := h.uploadStore()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	pth := path.SplitList(req.URL.Path)
+	if len(pth) == 1 {
+		if req.Method != http.MethodPost {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		createUpload(w, req, store)
+		return
+	}
+
+	id := pth[1]
+	switch req.Method {
+	case http.MethodHead, http.MethodGet:
+		sess, err := store.Get(id)
+		if err != nil {
+			uploadError(w, err, nil)
+			return
+		}
+		writeUploadSession(w, req, sess, http.StatusOK)
+	case http.MethodPatch:
+		offset, err := strconv.ParseInt(req.Header.Get(uploadOffsetHeader), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid Upload-Offset header", http.StatusBadRequest)
+			return
+		}
+		writeUpload(w, store, id, offset, req.Body)
+	case http.MethodPut:
+		offset, size, err := parseContentRange(req.Header.Get(contentRangeHeader))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeUpload(w, store, id, offset, io.LimitReader(req.Body, size))
+	case http.MethodPost:
+		h.commitUpload(w, req, store, id)
+	case http.MethodDelete:
+		if err := store.Remove(id); err != nil {
+			uploadError(w, err, nil)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+func createUpload(w http.ResponseWriter, req *http.Request, store *upload.Store) {
+	hdr := req.Header.Get(uploadLengthHeader)
+	if hdr == "" {
+		http.Error(w, errNoUploadLength.Error(), http.StatusBadRequest)
+		return
+	}
+	length, err := strconv.ParseInt(hdr, 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sess, err := store.Create(req.URL.Query().Get(uploadNameParam), length)
+	if err != nil {
+		uploadError(w, err, nil)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s/%s/%s", CasperApiPath, CasperApiUpload, sess.ID))
+	writeUploadSession(w, req, sess, http.StatusCreated)
+}
+
+func writeUpload(w http.ResponseWriter, store *upload.Store, id string, offset int64, r io.Reader) {
+	sess, err := store.Write(id, offset, r)
+	if err != nil {
+		if sess == nil && err == upload.ErrOffsetMismatch {
+			sess, _ = store.Get(id)
+		}
+		uploadError(w, err, sess)
+		return
+	}
+	w.Header().Set(uploadOffsetHeader, strconv.FormatInt(sess.Offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) commitUpload(w http.ResponseWriter, req *http.Request, store *upload.Store, id string) {
+	written := false
+	err := store.Commit(id, func(f *os.File, sess *upload.Session) error {
+		stat, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		name := sess.Name
+		if name == "" {
+			name = sess.ID
+		}
+		file := files.NewSliceFile("", "", []files.File{files.NewReaderFile(name, name, f, stat)})
+
+		opts, err := newAddFileOpts(req, file)
+		if err != nil {
+			return err
+		}
+		cmdsReq, err := h.newRequest(opts)
+		if err != nil {
+			return err
+		}
+
+		// error returned after response is written
+		// only keeps session for another attempt
+		written = true
+		res := h.callCommand(w, req, cmdsReq, opts)
+		if res == nil {
+			return errors.New("add was not called")
+		}
+		if e := res.Error(); e != nil {
+			return e
+		}
+		return nil
+	})
+	if err != nil && written {
+		log.Errorf("upload %s was not committed: %v", id, err)
+	} else if err != nil {
+		uploadError(w, err, nil)
+	}
+}
+
+func writeUploadSession(w http.ResponseWriter, req *http.Request, sess *upload.Session, status int) {
+	h := w.Header()
+	h.Set(uploadOffsetHeader, strconv.FormatInt(sess.Offset, 10))
+	h.Set(uploadLengthHeader, strconv.FormatInt(sess.Length, 10))
+	h.Set("Cache-Control", "no-store")
+	if req.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	h.Set(contentTypeHeader, mimeTypes[cmds.JSON])
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(sess)
+}
+
+// uploadError writes error with proper status. Current offset is
+// returned if sess is not nil, so that client can continue from it.
+func uploadError(w http.ResponseWriter, err error, sess *upload.Session) {
+	if sess != nil {
+		w.Header().Set(uploadOffsetHeader, strconv.FormatInt(sess.Offset, 10))
+	}
+
+	status := http.StatusInternalServerError
+	switch err {
+	case upload.ErrNotFound:
+		status = http.StatusNotFound
+	case upload.ErrInvalidLength:
+		status = http.StatusBadRequest
+	case upload.ErrOffsetMismatch, upload.ErrIncomplete, upload.ErrBusy:
+		status = http.StatusConflict
+	case upload.ErrTooLarge:
+		status = http.StatusRequestEntityTooLarge
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// parseContentRange returns offset and size of range "bytes <first>-<last>/<length>".
+func parseContentRange(s string) (offset, size int64, err error) {
+	var first, last int64
+	var length string
+	if _, err := fmt.Sscanf(s, "bytes %d-%d/%s", &first, &last, &length); err != nil || first < 0 || last < first {
+		return 0, 0, fmt.Errorf("invalid Content-Range header %q", s)
+	}
+	return first, last - first + 1, nil
+}
@@ -0,0 +1,141 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+
+	owner "github.com/Casper-dev/Casper-server/casper/owner"
+	cmds "github.com/Casper-dev/Casper-server/commands"
+	files "github.com/Casper-dev/Casper-server/commands/files"
+	coreCmds "github.com/Casper-dev/Casper-server/core/commands"
+	coreunix "github.com/Casper-dev/Casper-server/core/coreunix"
+
+	u "gx/ipfs/QmSU6eubNdhXjFBJBSksTp8kv8YRub8mGAPv8tVJHmL2EU/go-ipfs-util"
+)
+
+// File is the data of an object.
+type File interface {
+	io.ReadSeeker
+	io.Closer
+	Size() uint64
+}
+
+// Backend stores data of objects as UUID files. keyName is
+// the name of the key which owns the file.
+type Backend interface {
+	// Put stores data from r as the file with specified UUID.
+	// create is set if the file does not exist yet.
+	Put(ctx context.Context, uuid, name, keyName string, create bool, r io.Reader) error
+	Open(ctx context.Context, uuid string) (File, error)
+	Delete(ctx context.Context, uuid, keyName string) error
+}
+
+// nodeBackend stores files on the local node with the same
+// commands which are used by REST API.
+type nodeBackend struct {
+	cctx cmds.Context
+}
+
+func (b *nodeBackend) Put(ctx context.Context, uuid, name, keyName string, create bool, r io.Reader) error {
+	n, err := b.cctx.GetNode()
+	if err != nil {
+		return err
+	}
+
+	var ownReq *owner.Request
+	if create {
+		sk, err := n.GetKey(keyName)
+		if err != nil {
+			return err
+		}
+		ownReq = owner.NewRequest(owner.OpCreate, uuid)
+		if ownReq.Owner, err = owner.KeyID(sk.GetPublic()); err != nil {
+			return err
+		}
+	} else {
+		ownReq = owner.NewRequest(owner.OpUpdate, uuid)
+	}
+	auth, err := owner.SignWith(n, keyName, ownReq)
+	if err != nil {
+		return err
+	}
+
+	f := files.NewSliceFile("", "", []files.File{files.NewReaderFile(name, name, ioutil.NopCloser(r), nil)})
+	res, err := b.call(ctx, []string{"add"}, map[string]interface{}{
+		cmds.CallerOpt: cmds.CallerOptWeb,
+		"quiet":        true,
+		"uuid":         uuid,
+		"auth":         auth,
+	}, nil, f)
+	if err != nil {
+		return err
+	}
+
+	outChan, ok := res.Output().(<-chan interface{})
+	if !ok {
+		return u.ErrCast()
+	}
+	for range outChan {
+	}
+	if e := res.Error(); e != nil {
+		return e
+	}
+	return nil
+}
+
+func (b *nodeBackend) Open(ctx context.Context, uuid string) (File, error) {
+	n, err := b.cctx.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	return coreunix.Cat(ctx, n, "/ipfs/"+owner.FileID(uuid))
+}
+
+func (b *nodeBackend) Delete(ctx context.Context, uuid, keyName string) error {
+	n, err := b.cctx.GetNode()
+	if err != nil {
+		return err
+	}
+	auth, err := owner.SignWith(n, keyName, owner.NewRequest(owner.OpDelete, uuid))
+	if err != nil {
+		return err
+	}
+
+	_, err = b.call(ctx, []string{"del"}, map[string]interface{}{
+		cmds.CallerOpt: cmds.CallerOptWeb,
+		"auth":         auth,
+	}, []string{owner.FileID(uuid)}, nil)
+	return err
+}
+
+// call runs command like REST API does. Errors of commands which
+// return output only after it is consumed are left in response.
+func (b *nodeBackend) call(ctx context.Context, path []string, opts map[string]interface{}, args []string, f files.File) (cmds.Response, error) {
+	root := coreCmds.Root
+	optDefs, err := root.GetOptions(path)
+	if err != nil {
+		return nil, err
+	}
+	cmd, err := root.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	if args == nil {
+		args = []string{}
+	}
+	req, err := cmds.NewRequest(path, opts, args, f, cmd, optDefs)
+	if err != nil {
+		return nil, err
+	}
+	req.SetInvocContext(b.cctx)
+	if err = req.SetRootContext(ctx); err != nil {
+		return nil, err
+	}
+
+	res := root.Call(req)
+	if e := res.Error(); e != nil {
+		return nil, e
+	}
+	return res, nil
+}
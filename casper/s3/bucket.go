@@ -0,0 +1,227 @@
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxKeys = 1000
+	timeFormat     = "2006-01-02T15:04:05.000Z"
+)
+
+type ownerInfo struct {
+	ID          string
+	DisplayName string
+}
+
+type bucketInfo struct {
+	Name         string
+	CreationDate string
+}
+
+type listBucketsResult struct {
+	XMLName xml.Name     `xml:"ListAllMyBucketsResult"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Owner   ownerInfo    `xml:"Owner"`
+	Buckets []bucketInfo `xml:"Buckets>Bucket"`
+}
+
+type locationConstraint struct {
+	XMLName  xml.Name `xml:"LocationConstraint"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:",chardata"`
+}
+
+type objectInfo struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type commonPrefix struct {
+	Prefix string
+}
+
+type listObjectsResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Xmlns                 string   `xml:"xmlns,attr"`
+	Name                  string
+	Prefix                string
+	Delimiter             string `xml:",omitempty"`
+	StartAfter            string `xml:",omitempty"`
+	ContinuationToken     string `xml:",omitempty"`
+	NextContinuationToken string `xml:",omitempty"`
+	EncodingType          string `xml:",omitempty"`
+	MaxKeys               int
+	KeyCount              int
+	IsTruncated           bool
+	Contents              []objectInfo
+	CommonPrefixes        []commonPrefix
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+func (g *Gateway) listBuckets(w http.ResponseWriter, r *request) error {
+	buckets, err := g.store.buckets(r.cred.AccessKey)
+	if err != nil {
+		return err
+	}
+
+	res := &listBucketsResult{
+		Xmlns: s3Namespace,
+		Owner: ownerInfo{ID: r.cred.AccessKey, DisplayName: r.cred.AccessKey},
+	}
+	for _, b := range buckets {
+		res.Buckets = append(res.Buckets, bucketInfo{Name: b.Name, CreationDate: formatTime(b.Created)})
+	}
+	writeXML(w, http.StatusOK, res)
+	return nil
+}
+
+func (g *Gateway) serveBucket(w http.ResponseWriter, r *request) error {
+	if r.Method == http.MethodPut {
+		// location constraint in body is ignored, all buckets are local
+		if _, err := io.Copy(ioutil.Discard, r.body); err != nil {
+			return r.body.cause(err)
+		}
+		if err := g.store.createBucket(r.bucket, r.cred.AccessKey); err != nil {
+			return err
+		}
+		w.Header().Set("Location", "/"+r.bucket)
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	if _, err := g.ownBucket(r); err != nil {
+		return err
+	}
+
+	q := r.URL.Query()
+	switch r.Method {
+	case http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		if err := g.store.deleteBucket(r.bucket); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet:
+		if _, ok := q["location"]; ok {
+			writeXML(w, http.StatusOK, &locationConstraint{Xmlns: s3Namespace, Location: g.Region})
+			return nil
+		}
+		if q.Get("list-type") != "2" {
+			return errNotImplemented
+		}
+		return g.listObjects(w, r)
+	default:
+		return errMethodNotAllowed
+	}
+	return nil
+}
+
+// listObjects implements ListObjectsV2. Keys which contain delimiter
+// after the prefix are rolled up into common prefixes. Continuation
+// token is the last returned key or common prefix.
+func (g *Gateway) listObjects(w http.ResponseWriter, r *request) error {
+	q := r.URL.Query()
+	res := &listObjectsResult{
+		Xmlns:             s3Namespace,
+		Name:              r.bucket,
+		Prefix:            q.Get("prefix"),
+		Delimiter:         q.Get("delimiter"),
+		StartAfter:        q.Get("start-after"),
+		ContinuationToken: q.Get("continuation-token"),
+		EncodingType:      q.Get("encoding-type"),
+		MaxKeys:           defaultMaxKeys,
+	}
+	if res.EncodingType != "" && res.EncodingType != "url" {
+		return errInvalidArgument
+	}
+	if v := q.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return errInvalidArgument
+		}
+		if n < res.MaxKeys {
+			res.MaxKeys = n
+		}
+	}
+
+	after := res.StartAfter
+	if res.ContinuationToken != "" {
+		b, err := base64.RawURLEncoding.DecodeString(res.ContinuationToken)
+		if err != nil {
+			return errInvalidArgument
+		}
+		after = string(b)
+	}
+
+	objects, err := g.store.objects(r.bucket)
+	if err != nil {
+		return err
+	}
+
+	var last string
+	for _, o := range objects {
+		if !strings.HasPrefix(o.Key, res.Prefix) {
+			continue
+		}
+
+		name, prefix := o.Key, ""
+		if res.Delimiter != "" {
+			if i := strings.Index(o.Key[len(res.Prefix):], res.Delimiter); i >= 0 {
+				prefix = o.Key[:len(res.Prefix)+i+len(res.Delimiter)]
+				name = prefix
+			}
+		}
+		// keys under the same common prefix are sorted together
+		if name <= after || name == last {
+			continue
+		}
+		if res.KeyCount == res.MaxKeys {
+			res.IsTruncated = true
+			res.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+			break
+		}
+
+		last = name
+		res.KeyCount++
+		if prefix != "" {
+			res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: res.encode(prefix)})
+			continue
+		}
+		res.Contents = append(res.Contents, objectInfo{
+			Key:          res.encode(o.Key),
+			LastModified: formatTime(o.Modified),
+			ETag:         `"` + o.ETag + `"`,
+			Size:         o.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+
+	res.Prefix = res.encode(res.Prefix)
+	res.Delimiter = res.encode(res.Delimiter)
+	res.StartAfter = res.encode(res.StartAfter)
+	writeXML(w, http.StatusOK, res)
+	return nil
+}
+
+// encode escapes key if client has asked for url encoding.
+func (res *listObjectsResult) encode(key string) string {
+	if res.EncodingType == "url" {
+		return awsEscape(key, true)
+	}
+	return key
+}
@@ -0,0 +1,87 @@
+package s3
+
+import (
+	"encoding/xml"
+	"net/http"
+)
+
+// apiError is an error which is sent to the client in S3 format.
+type apiError struct {
+	Code    string
+	Message string
+	Status  int
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+var (
+	errAccessDenied          = &apiError{"AccessDenied", "Access Denied", http.StatusForbidden}
+	errInvalidAccessKey      = &apiError{"InvalidAccessKeyId", "The access key ID you provided does not exist in our records.", http.StatusForbidden}
+	errSignatureMismatch     = &apiError{"SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.", http.StatusForbidden}
+	errUnsupportedSignature  = &apiError{"InvalidRequest", "Only AWS4-HMAC-SHA256 signatures are supported.", http.StatusBadRequest}
+	errMalformedAuth         = &apiError{"AuthorizationHeaderMalformed", "The authorization header is malformed.", http.StatusBadRequest}
+	errWrongRegion           = &apiError{"AuthorizationHeaderMalformed", "The authorization header is signed for another region.", http.StatusBadRequest}
+	errTimeSkewed            = &apiError{"RequestTimeTooSkewed", "The difference between the request time and the server's time is too large.", http.StatusForbidden}
+	errExpired               = &apiError{"AccessDenied", "Request has expired.", http.StatusForbidden}
+	errContentSHA256Mismatch = &apiError{"XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.", http.StatusBadRequest}
+	errMalformedChunk        = &apiError{"IncompleteBody", "The request body is not a valid aws-chunked stream.", http.StatusBadRequest}
+	errInvalidDigest         = &apiError{"InvalidDigest", "The Content-MD5 you specified is not valid.", http.StatusBadRequest}
+	errBadDigest             = &apiError{"BadDigest", "The Content-MD5 you specified did not match what we received.", http.StatusBadRequest}
+
+	errNoSuchBucket       = &apiError{"NoSuchBucket", "The specified bucket does not exist.", http.StatusNotFound}
+	errNoSuchKey          = &apiError{"NoSuchKey", "The specified key does not exist.", http.StatusNotFound}
+	errNoSuchUpload       = &apiError{"NoSuchUpload", "The specified multipart upload does not exist.", http.StatusNotFound}
+	errBucketExists       = &apiError{"BucketAlreadyExists", "The requested bucket name is not available.", http.StatusConflict}
+	errBucketOwnedByYou   = &apiError{"BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it.", http.StatusConflict}
+	errBucketNotEmpty     = &apiError{"BucketNotEmpty", "The bucket you tried to delete is not empty.", http.StatusConflict}
+	errInvalidBucketName  = &apiError{"InvalidBucketName", "The specified bucket is not valid.", http.StatusBadRequest}
+	errKeyTooLong         = &apiError{"KeyTooLongError", "Your key is too long.", http.StatusBadRequest}
+	errInvalidArgument    = &apiError{"InvalidArgument", "Invalid argument.", http.StatusBadRequest}
+	errInvalidPart        = &apiError{"InvalidPart", "One or more of the specified parts could not be found.", http.StatusBadRequest}
+	errInvalidPartOrder   = &apiError{"InvalidPartOrder", "The list of parts was not in ascending order.", http.StatusBadRequest}
+	errEntityTooSmall     = &apiError{"EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size.", http.StatusBadRequest}
+	errMalformedXML       = &apiError{"MalformedXML", "The XML you provided was not well-formed.", http.StatusBadRequest}
+	errMethodNotAllowed   = &apiError{"MethodNotAllowed", "The specified method is not allowed against this resource.", http.StatusMethodNotAllowed}
+	errNotImplemented     = &apiError{"NotImplemented", "A header or query you provided implies functionality that is not implemented.", http.StatusNotImplemented}
+	errInternal           = &apiError{"InternalError", "We encountered an internal error. Please try again.", http.StatusInternalServerError}
+	errIncompleteBody     = &apiError{"IncompleteBody", "You did not provide the number of bytes specified by the Content-Length HTTP header.", http.StatusBadRequest}
+	errMissingContentSize = &apiError{"MissingContentLength", "You must provide the Content-Length HTTP header.", http.StatusLengthRequired}
+)
+
+type errorResponse struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string
+	Message  string
+	Resource string
+}
+
+// writeError sends err to the client. Errors which are not apiError
+// are logged and reported as internal errors.
+func writeError(w http.ResponseWriter, req *http.Request, err error) {
+	e, ok := err.(*apiError)
+	if !ok {
+		log.Errorf("%s %s: %v", req.Method, req.URL.Path, err)
+		e = errInternal
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(e.Status)
+	if req.Method != http.MethodHead {
+		writeXMLBody(w, &errorResponse{Code: e.Code, Message: e.Message, Resource: req.URL.Path})
+	}
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	writeXMLBody(w, v)
+}
+
+func writeXMLBody(w http.ResponseWriter, v interface{}) {
+	w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		log.Error(err)
+	}
+}
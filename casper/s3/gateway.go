@@ -0,0 +1,229 @@
+// Package s3 implements S3-compatible HTTP front end. Every bucket
+// belongs to one of locally configured access keys and its objects are
+// UUID files owned by the keystore key of that access key, so that they
+// can also be managed with REST API and 'casper owner'. Buckets and the
+// mapping of object keys to UUIDs are kept in the repo datastore.
+//
+// Only path-style requests (/<bucket>/<key>) signed with AWS Signature
+// Version 4 are supported.
+package s3
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/casper/access"
+	cmds "github.com/Casper-dev/Casper-server/commands"
+	core "github.com/Casper-dev/Casper-server/core"
+	corehttp "github.com/Casper-dev/Casper-server/core/corehttp"
+	config "github.com/Casper-dev/Casper-server/repo/config"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+)
+
+var log = logging.Logger("s3")
+
+const (
+	// DefaultRegion is used if region is not configured
+	DefaultRegion = "us-east-1"
+	// PartsDir is the directory in repo where parts of multipart uploads are stored
+	PartsDir = "s3parts"
+	// MinPartSize is the minimal size of every part except the last one
+	MinPartSize = 5 << 20
+
+	defaultKeyName = "self"
+	s3Namespace    = "http://s3.amazonaws.com/doc/2006-03-01/"
+)
+
+type Gateway struct {
+	// Region is the region requests must be signed for
+	Region string
+	// MinPartSize is the minimal size of parts of multipart upload
+	MinPartSize int64
+	// Access limits requests of every access key, nil means no limits
+	Access *access.Control
+
+	creds   map[string]config.S3Credential
+	store   *store
+	backend Backend
+	dir     string
+	now     func() time.Time
+}
+
+// NewGateway returns gateway which keeps buckets and objects in d,
+// parts of multipart uploads in dir and data of objects in b.
+func NewGateway(cfg config.S3, d ds.Datastore, dir string, b Backend) *Gateway {
+	g := &Gateway{
+		Region:      cfg.Region,
+		MinPartSize: MinPartSize,
+		creds:       make(map[string]config.S3Credential),
+		store:       &store{ds: d},
+		backend:     b,
+		dir:         dir,
+		now:         time.Now,
+	}
+	if g.Region == "" {
+		g.Region = DefaultRegion
+	}
+	for _, c := range cfg.Credentials {
+		if c.KeyName == "" {
+			c.KeyName = defaultKeyName
+		}
+		g.creds[c.AccessKey] = c
+	}
+	return g
+}
+
+// ServeOption mounts S3 gateway configured in Casper.S3 at the root
+// of mux, so it must be served on its own listener. Requests are limited
+// by ac, which must be shared with other front ends of the node.
+func ServeOption(cctx cmds.Context, ac *access.Control) corehttp.ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		cfg, err := n.Repo.Config()
+		if err != nil {
+			return nil, err
+		}
+		dir := filepath.Join(cctx.ConfigRoot, PartsDir)
+		g := NewGateway(cfg.Casper.S3, n.Repo.Datastore(), dir, &nodeBackend{cctx: cctx})
+		g.Access = ac
+		mux.Handle("/", g)
+		return mux, nil
+	}
+}
+
+// request is an authenticated request.
+type request struct {
+	*http.Request
+
+	cred   config.S3Credential
+	bucket string
+	key    string
+	// body is the payload which is verified while it is read
+	body *bodyReader
+
+	sig        *signature
+	signingKey []byte
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r, err := g.authenticate(req)
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	if g.Access == nil {
+		g.serve(w, req, r)
+		return
+	}
+
+	cl := g.Access.Client("s3:"+r.cred.AccessKey, r.cred.APILimits)
+	g.Access.Limit(cl, w, req, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		g.serve(w, req, r)
+	}))
+}
+
+// serve handles authenticated request r. Payload is read from req,
+// so that it is counted by access control.
+func (g *Gateway) serve(w http.ResponseWriter, req *http.Request, r *request) {
+	body, err := r.sig.payloadReader(req, r.signingKey)
+	if err != nil {
+		writeError(w, req, err)
+		return
+	}
+	r.Request, r.body = req, &bodyReader{r: body}
+
+	switch {
+	case r.bucket == "":
+		if req.Method != http.MethodGet {
+			err = errMethodNotAllowed
+			break
+		}
+		err = g.listBuckets(w, r)
+	case r.key == "":
+		err = g.serveBucket(w, r)
+	default:
+		err = g.serveObject(w, r)
+	}
+	if err != nil {
+		writeError(w, req, err)
+	}
+}
+
+// authenticate checks signature of req and returns credential it was signed with.
+func (g *Gateway) authenticate(req *http.Request) (*request, error) {
+	sig, err := parseSignature(req)
+	if err != nil {
+		return nil, err
+	}
+	if sig.Region != g.Region {
+		return nil, errWrongRegion
+	}
+	cred, ok := g.creds[sig.AccessKey]
+	if !ok {
+		return nil, errInvalidAccessKey
+	}
+	if err = sig.checkTime(g.now()); err != nil {
+		return nil, err
+	}
+	key, err := sig.verify(req, cred.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &request{Request: req, cred: cred, sig: sig, signingKey: key}
+	p := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2)
+	r.bucket = p[0]
+	if len(p) == 2 {
+		r.key = p[1]
+	}
+	return r, nil
+}
+
+// ownBucket returns bucket of the request if it belongs to its credential.
+func (g *Gateway) ownBucket(r *request) (*Bucket, error) {
+	b, err := g.store.bucket(r.bucket)
+	if err != nil {
+		return nil, err
+	}
+	if b.Owner != r.cred.AccessKey {
+		return nil, errAccessDenied
+	}
+	return b, nil
+}
+
+// bodyReader remembers the first error of the payload, so that
+// it can be reported after a command which has consumed it fails.
+type bodyReader struct {
+	r   io.Reader
+	err error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// cause returns error of the payload if there was one or err otherwise.
+func (b *bodyReader) cause(err error) error {
+	switch {
+	case b.err == nil:
+		return err
+	case isAPIError(b.err):
+		return b.err
+	default:
+		return errIncompleteBody
+	}
+}
+
+func isAPIError(err error) bool {
+	_, ok := err.(*apiError)
+	return ok
+}
@@ -0,0 +1,336 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	config "github.com/Casper-dev/Casper-server/repo/config"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+)
+
+type memFile struct {
+	*bytes.Reader
+}
+
+func (f memFile) Size() uint64 { return uint64(f.Reader.Size()) }
+func (f memFile) Close() error { return nil }
+
+// memBackend keeps files in memory and records their owner keys.
+type memBackend struct {
+	mtx   sync.Mutex
+	files map[string][]byte
+	keys  map[string]string
+}
+
+func (b *memBackend) Put(ctx context.Context, uuid, name, keyName string, create bool, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errors.New("add failed")
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if _, ok := b.files[uuid]; ok == create {
+		return fmt.Errorf("create is %v for %s", create, uuid)
+	}
+	b.files[uuid], b.keys[uuid] = data, keyName
+	return nil
+}
+
+func (b *memBackend) Open(ctx context.Context, uuid string) (File, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	data, ok := b.files[uuid]
+	if !ok {
+		return nil, errors.New("no file " + uuid)
+	}
+	return memFile{bytes.NewReader(data)}, nil
+}
+
+func (b *memBackend) Delete(ctx context.Context, uuid, keyName string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	delete(b.files, uuid)
+	return nil
+}
+
+var testCreds = []config.S3Credential{
+	{AccessKey: "alice", SecretKey: "alice-secret", KeyName: "alice-key"},
+	{AccessKey: "bob", SecretKey: "bob-secret"},
+}
+
+type testGateway struct {
+	*Gateway
+	t       *testing.T
+	backend *memBackend
+}
+
+func newTestGateway(t *testing.T) (*testGateway, func()) {
+	dir, err := ioutil.TempDir("", "casper-s3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &memBackend{files: make(map[string][]byte), keys: make(map[string]string)}
+	g := NewGateway(config.S3{Credentials: testCreds}, dssync.MutexWrap(ds.NewMapDatastore()), dir, b)
+	return &testGateway{Gateway: g, t: t, backend: b}, func() { os.RemoveAll(dir) }
+}
+
+// do sends request signed with credential of user.
+func (g *testGateway) do(user, method, target string, body []byte, hdr map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	for k, v := range hdr {
+		req.Header.Set(k, v)
+	}
+
+	now := time.Now().UTC()
+	sig := &signature{
+		AccessKey:     user,
+		Date:          now,
+		Region:        g.Region,
+		Scope:         now.Format(scopeDateFmt) + "/" + g.Region + "/s3/aws4_request",
+		SignedHeaders: []string{"host", "x-amz-content-sha256", "x-amz-date"},
+		PayloadHash:   hexSHA256(body),
+	}
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", sig.PayloadHash)
+
+	creq, err := canonicalRequest(req, sig)
+	if err != nil {
+		g.t.Fatal(err)
+	}
+	secret := ""
+	for _, c := range testCreds {
+		if c.AccessKey == user {
+			secret = c.SecretKey
+		}
+	}
+	sts := strings.Join([]string{sigAlgorithm, now.Format(amzDateFormat), sig.Scope, hexSHA256([]byte(creq))}, "\n")
+	sig.Signature = hex.EncodeToString(hmacSHA256(signingKey(secret, sig), sts))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		sigAlgorithm, user, sig.Scope, strings.Join(sig.SignedHeaders, ";"), sig.Signature))
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	return w
+}
+
+func (g *testGateway) expect(w *httptest.ResponseRecorder, status int) {
+	if w.Code != status {
+		g.t.Fatalf("expected status %d, got %d: %s", status, w.Code, w.Body)
+	}
+}
+
+func (g *testGateway) decode(w *httptest.ResponseRecorder, v interface{}) {
+	g.expect(w, http.StatusOK)
+	if err := xml.Unmarshal(w.Body.Bytes(), v); err != nil {
+		g.t.Fatal(err)
+	}
+}
+
+func TestObjects(t *testing.T) {
+	g, cleanup := newTestGateway(t)
+	defer cleanup()
+
+	g.expect(g.do("alice", http.MethodPut, "/photos", nil, nil), http.StatusOK)
+	g.expect(g.do("alice", http.MethodPut, "/photos", nil, nil), http.StatusConflict)
+	g.expect(g.do("alice", http.MethodPut, "/Bad_Name", nil, nil), http.StatusBadRequest)
+
+	data := []byte("0123456789")
+	w := g.do("alice", http.MethodPut, "/photos/2018/cat.jpg", data, map[string]string{
+		"Content-Type":    "image/jpeg",
+		"X-Amz-Meta-Camp": "summer",
+	})
+	g.expect(w, http.StatusOK)
+	if etag := w.Header().Get("ETag"); etag != `"781e5e245d69b566979b86e28d23f2c7"` {
+		t.Fatalf("ETag must be MD5 of data, got %s", etag)
+	}
+	o, err := g.store.object("photos", "2018/cat.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.backend.keys[o.UUID] != "alice-key" {
+		t.Fatalf("object must be owned by key of credential, got %q", g.backend.keys[o.UUID])
+	}
+
+	w = g.do("alice", http.MethodGet, "/photos/2018/cat.jpg", nil, map[string]string{"Range": "bytes=2-5"})
+	g.expect(w, http.StatusPartialContent)
+	if w.Body.String() != "2345" || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("unexpected range %q of %s", w.Body, w.Header().Get("Content-Type"))
+	}
+	w = g.do("alice", http.MethodHead, "/photos/2018/cat.jpg", nil, nil)
+	g.expect(w, http.StatusOK)
+	if w.Header().Get("Content-Length") != "10" || w.Header().Get("X-Amz-Meta-Camp") != "summer" {
+		t.Fatalf("unexpected headers %v", w.Header())
+	}
+
+	// overwrite keeps UUID of the object
+	g.expect(g.do("alice", http.MethodPut, "/photos/2018/cat.jpg", []byte("new"), nil), http.StatusOK)
+	if o2, _ := g.store.object("photos", "2018/cat.jpg"); o2.UUID != o.UUID || o2.Size != 3 {
+		t.Fatalf("unexpected object after update %+v", o2)
+	}
+
+	// other users can not see the bucket
+	g.expect(g.do("bob", http.MethodGet, "/photos/2018/cat.jpg", nil, nil), http.StatusForbidden)
+	g.expect(g.do("bob", http.MethodPut, "/photos", nil, nil), http.StatusConflict)
+	buckets := &listBucketsResult{}
+	g.decode(g.do("bob", http.MethodGet, "/", nil, nil), buckets)
+	if len(buckets.Buckets) != 0 {
+		t.Fatalf("unexpected buckets %v", buckets.Buckets)
+	}
+
+	g.expect(g.do("alice", http.MethodDelete, "/photos", nil, nil), http.StatusConflict)
+	g.expect(g.do("alice", http.MethodDelete, "/photos/2018/cat.jpg", nil, nil), http.StatusNoContent)
+	g.expect(g.do("alice", http.MethodDelete, "/photos/2018/cat.jpg", nil, nil), http.StatusNoContent)
+	g.expect(g.do("alice", http.MethodGet, "/photos/2018/cat.jpg", nil, nil), http.StatusNotFound)
+	if len(g.backend.files) != 0 {
+		t.Fatal("file of deleted object must be removed")
+	}
+	g.expect(g.do("alice", http.MethodDelete, "/photos", nil, nil), http.StatusNoContent)
+}
+
+func TestListObjects(t *testing.T) {
+	g, cleanup := newTestGateway(t)
+	defer cleanup()
+
+	g.expect(g.do("alice", http.MethodPut, "/docs", nil, nil), http.StatusOK)
+	keys := []string{"a.txt", "b/1.txt", "b/2.txt", "b/c/3.txt", "d e+f.txt", "z.txt"}
+	for _, k := range keys {
+		g.expect(g.do("alice", http.MethodPut, "/docs/"+awsEscape(k, true), []byte(k), nil), http.StatusOK)
+	}
+
+	list := func(query string) *listObjectsResult {
+		res := &listObjectsResult{}
+		g.decode(g.do("alice", http.MethodGet, "/docs?list-type=2&"+query, nil, nil), res)
+		return res
+	}
+	names := func(res *listObjectsResult) (names []string) {
+		for _, o := range res.Contents {
+			names = append(names, o.Key)
+		}
+		for _, p := range res.CommonPrefixes {
+			names = append(names, p.Prefix)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	if res := list(""); strings.Join(names(res), ",") != strings.Join(keys, ",") {
+		t.Fatalf("unexpected keys %v", names(res))
+	}
+	if res := list("delimiter=/"); strings.Join(names(res), ",") != "a.txt,b/,d e+f.txt,z.txt" {
+		t.Fatalf("unexpected keys with delimiter %v", names(res))
+	}
+	if res := list("prefix=b/&delimiter=/"); strings.Join(names(res), ",") != "b/1.txt,b/2.txt,b/c/" {
+		t.Fatalf("unexpected keys with prefix %v", names(res))
+	}
+	if res := list("prefix=d&encoding-type=url"); strings.Join(names(res), ",") != "d%20e%2Bf.txt" {
+		t.Fatalf("unexpected encoded keys %v", names(res))
+	}
+
+	// pages of two entries
+	var all []string
+	token := ""
+	for i := 0; ; i++ {
+		res := list("delimiter=/&max-keys=2&continuation-token=" + token)
+		all = append(all, names(res)...)
+		if !res.IsTruncated {
+			break
+		}
+		if i > 3 || res.KeyCount != 2 {
+			t.Fatalf("unexpected page %+v", res)
+		}
+		token = res.NextContinuationToken
+	}
+	if strings.Join(all, ",") != "a.txt,b/,d e+f.txt,z.txt" {
+		t.Fatalf("unexpected pages %v", all)
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	g, cleanup := newTestGateway(t)
+	defer cleanup()
+	g.MinPartSize = 4
+
+	g.expect(g.do("alice", http.MethodPut, "/backup", nil, nil), http.StatusOK)
+	init := &initiateUploadResult{}
+	g.decode(g.do("alice", http.MethodPost, "/backup/db.tar?uploads", nil, map[string]string{"Content-Type": "application/x-tar"}), init)
+
+	parts := []string{"aaaa", "bbbb", "cc"}
+	etags := make([]string, len(parts))
+	for i, p := range parts {
+		w := g.do("alice", http.MethodPut, fmt.Sprintf("/backup/db.tar?partNumber=%d&uploadId=%s", i+1, init.UploadId), []byte(p), nil)
+		g.expect(w, http.StatusOK)
+		etags[i] = w.Header().Get("ETag")
+	}
+	// part can be uploaded again
+	w := g.do("alice", http.MethodPut, "/backup/db.tar?partNumber=2&uploadId="+init.UploadId, []byte("BBBB"), nil)
+	g.expect(w, http.StatusOK)
+	etags[1] = w.Header().Get("ETag")
+
+	complete := func(nums ...int) *httptest.ResponseRecorder {
+		body := "<CompleteMultipartUpload>"
+		for _, n := range nums {
+			body += fmt.Sprintf("<Part><PartNumber>%d</PartNumber><ETag>%s</ETag></Part>", n, etags[n-1])
+		}
+		body += "</CompleteMultipartUpload>"
+		return g.do("alice", http.MethodPost, "/backup/db.tar?uploadId="+init.UploadId, []byte(body), nil)
+	}
+	g.expect(complete(2, 1), http.StatusBadRequest)
+	g.expect(complete(3, 3), http.StatusBadRequest)
+	g.expect(complete(1, 3, 2), http.StatusBadRequest)
+
+	res := &completeUploadResult{}
+	g.decode(complete(1, 2, 3), res)
+	if !strings.HasSuffix(res.ETag, `-3"`) {
+		t.Fatalf("unexpected ETag %s", res.ETag)
+	}
+
+	w = g.do("alice", http.MethodGet, "/backup/db.tar", nil, nil)
+	g.expect(w, http.StatusOK)
+	if w.Body.String() != "aaaaBBBBcc" || w.Header().Get("Content-Type") != "application/x-tar" {
+		t.Fatalf("unexpected object %q", w.Body)
+	}
+	if _, err := os.Stat(g.uploadDir(init.UploadId)); !os.IsNotExist(err) {
+		t.Fatalf("parts must be removed after completion: %v", err)
+	}
+	g.expect(complete(1, 2, 3), http.StatusNotFound)
+
+	g.decode(g.do("alice", http.MethodPost, "/backup/other?uploads", nil, nil), init)
+	g.expect(g.do("alice", http.MethodDelete, "/backup/other?uploadId="+init.UploadId, nil, nil), http.StatusNoContent)
+	g.expect(g.do("alice", http.MethodPut, "/backup/other?partNumber=1&uploadId="+init.UploadId, []byte("x"), nil), http.StatusNotFound)
+}
+
+func TestAuthentication(t *testing.T) {
+	g, cleanup := newTestGateway(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	g.expect(w, http.StatusForbidden)
+
+	g.expect(g.do("mallory", http.MethodGet, "/", nil, nil), http.StatusForbidden)
+
+	g.expect(g.do("alice", http.MethodPut, "/data", nil, nil), http.StatusOK)
+	g.expect(g.do("alice", http.MethodGet, "/data?list-type=2", nil, nil), http.StatusOK)
+
+	// server clock is an hour ahead of client
+	g.now = func() time.Time { return time.Now().Add(time.Hour) }
+	g.expect(g.do("alice", http.MethodGet, "/data?list-type=2", nil, nil), http.StatusForbidden)
+}
@@ -0,0 +1,234 @@
+package s3
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Parts of multipart uploads are stored in files <dir>/<upload ID>/<part
+// number> until upload is completed. Complete upload is added as a single
+// file whose ETag is computed from ETags of parts like S3 does.
+
+const (
+	maxPartNumber = 10000
+	idBytes       = 16
+	// maxCompleteBody limits the list of parts in complete request
+	maxCompleteBody = 1 << 20
+)
+
+type initiateUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string
+	Key      string
+	UploadId string
+}
+
+type completeUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []struct {
+		PartNumber int
+		ETag       string
+	} `xml:"Part"`
+}
+
+type completeUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string
+	Bucket   string
+	Key      string
+	ETag     string
+}
+
+func (g *Gateway) uploadDir(id string) string {
+	return filepath.Join(g.dir, id)
+}
+
+func (g *Gateway) partPath(id string, n int) string {
+	return filepath.Join(g.uploadDir(id), strconv.Itoa(n))
+}
+
+func (g *Gateway) createUpload(w http.ResponseWriter, r *request) error {
+	id, err := genID()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(g.uploadDir(id), 0700); err != nil {
+		return err
+	}
+
+	u := &Upload{
+		ID:          id,
+		Bucket:      r.bucket,
+		Key:         r.key,
+		ContentType: r.Header.Get("Content-Type"),
+		Meta:        userMeta(r.Header),
+		Initiated:   g.now().UTC(),
+	}
+	if err = g.store.putUpload(u); err != nil {
+		return err
+	}
+	log.Debugf("multipart upload %s of %s/%s started", id, r.bucket, r.key)
+
+	writeXML(w, http.StatusOK, &initiateUploadResult{
+		Xmlns:    s3Namespace,
+		Bucket:   r.bucket,
+		Key:      r.key,
+		UploadId: id,
+	})
+	return nil
+}
+
+func (g *Gateway) uploadPart(w http.ResponseWriter, r *request, id string) error {
+	n, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || n < 1 || n > maxPartNumber {
+		return errInvalidArgument
+	}
+	u, err := g.store.upload(r.bucket, r.key, id)
+	if err != nil {
+		return err
+	}
+
+	// part is written to temporary file, so that failed
+	// upload does not replace previous data of the part
+	f, err := ioutil.TempFile(g.uploadDir(id), "part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	h := md5.New()
+	size, err := io.Copy(io.MultiWriter(f, h), r.body)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return r.body.cause(err)
+	}
+	if err = os.Rename(f.Name(), g.partPath(id, n)); err != nil {
+		return err
+	}
+
+	p := &Part{ETag: hex.EncodeToString(h.Sum(nil)), Size: size}
+	if err = g.store.setPart(u, n, p); err != nil {
+		return err
+	}
+	w.Header().Set("ETag", `"`+p.ETag+`"`)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (g *Gateway) completeUpload(w http.ResponseWriter, r *request, id string) error {
+	u, err := g.store.upload(r.bucket, r.key, id)
+	if err != nil {
+		return err
+	}
+
+	req := &completeUpload{}
+	if err = xml.NewDecoder(io.LimitReader(r.body, maxCompleteBody)).Decode(req); err != nil {
+		if r.body.err != nil {
+			return r.body.cause(err)
+		}
+		return errMalformedXML
+	}
+	if len(req.Parts) == 0 {
+		return errMalformedXML
+	}
+
+	// ETag of the object is MD5 of binary MD5s of its parts
+	h := md5.New()
+	var readers []io.Reader
+	for i, rp := range req.Parts {
+		if i > 0 && rp.PartNumber <= req.Parts[i-1].PartNumber {
+			return errInvalidPartOrder
+		}
+		p, ok := u.Parts[rp.PartNumber]
+		if !ok || strings.Trim(rp.ETag, `"`) != p.ETag {
+			return errInvalidPart
+		}
+		if i < len(req.Parts)-1 && p.Size < g.MinPartSize {
+			return errEntityTooSmall
+		}
+		sum, _ := hex.DecodeString(p.ETag)
+		h.Write(sum)
+
+		f, err := os.Open(g.partPath(id, rp.PartNumber))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+
+	o := &Object{
+		Key:         u.Key,
+		ContentType: u.ContentType,
+		Meta:        u.Meta,
+		ETag:        fmt.Sprintf("%s-%d", hex.EncodeToString(h.Sum(nil)), len(req.Parts)),
+	}
+	if err = g.storeObject(r.Context(), r, o, io.MultiReader(readers...)); err != nil {
+		return err
+	}
+	if err = g.removeUpload(id); err != nil {
+		log.Error(err)
+	}
+	log.Debugf("multipart upload %s was completed", id)
+
+	writeXML(w, http.StatusOK, &completeUploadResult{
+		Xmlns:    s3Namespace,
+		Location: "/" + r.bucket + "/" + awsEscape(r.key, true),
+		Bucket:   r.bucket,
+		Key:      r.key,
+		ETag:     `"` + o.ETag + `"`,
+	})
+	return nil
+}
+
+func (g *Gateway) abortUpload(w http.ResponseWriter, r *request, id string) error {
+	if _, err := g.store.upload(r.bucket, r.key, id); err != nil {
+		return err
+	}
+	if err := g.removeUpload(id); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (g *Gateway) removeUpload(id string) error {
+	if err := g.store.deleteUpload(id); err != nil {
+		return err
+	}
+	return os.RemoveAll(g.uploadDir(id))
+}
+
+func genID() (string, error) {
+	b := make([]byte, idBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validID checks that id can be used as a file name.
+func validID(id string) bool {
+	if len(id) != 2*idBytes {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
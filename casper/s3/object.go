@@ -0,0 +1,192 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	uuid "github.com/Casper-dev/Casper-server/casper/uuid"
+
+	b58 "gx/ipfs/QmT8rehPR3F6bmwL6zjUN8XpiDBFFpMP2myPdC6ApsWfJf/go-base58"
+)
+
+const (
+	metaHeaderPrefix   = "X-Amz-Meta-"
+	defaultContentType = "binary/octet-stream"
+)
+
+func (g *Gateway) serveObject(w http.ResponseWriter, r *request) error {
+	if len(r.key) > maxKeyLength {
+		return errKeyTooLong
+	}
+	if _, err := g.ownBucket(r); err != nil {
+		return err
+	}
+
+	q := r.URL.Query()
+	_, uploads := q["uploads"]
+	uploadID := q.Get("uploadId")
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return g.getObject(w, r)
+	case http.MethodPut:
+		if uploadID != "" {
+			return g.uploadPart(w, r, uploadID)
+		}
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			return errNotImplemented
+		}
+		return g.putObject(w, r)
+	case http.MethodPost:
+		if uploads {
+			return g.createUpload(w, r)
+		}
+		if uploadID != "" {
+			return g.completeUpload(w, r, uploadID)
+		}
+		return errNotImplemented
+	case http.MethodDelete:
+		if uploadID != "" {
+			return g.abortUpload(w, r, uploadID)
+		}
+		return g.deleteObject(w, r)
+	}
+	return errMethodNotAllowed
+}
+
+func (g *Gateway) putObject(w http.ResponseWriter, r *request) error {
+	o := &Object{
+		Key:         r.key,
+		ContentType: r.Header.Get("Content-Type"),
+		Meta:        userMeta(r.Header),
+	}
+	if err := g.storeObject(r.Context(), r, o, r.body); err != nil {
+		return r.body.cause(err)
+	}
+	w.Header().Set("ETag", `"`+o.ETag+`"`)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// storeObject stores data from rd as object o. Existing object is updated
+// in place, so that its UUID does not change. ETag is the MD5 of the data
+// unless it is already set.
+func (g *Gateway) storeObject(ctx context.Context, r *request, o *Object, rd io.Reader) error {
+	create := false
+	if prev, err := g.store.object(r.bucket, o.Key); err == nil {
+		o.UUID = prev.UUID
+	} else if err == errNoSuchKey {
+		o.UUID = b58.Encode(uuid.GenUUID())
+		create = true
+	} else {
+		return err
+	}
+
+	h := md5.New()
+	c := &countReader{r: io.TeeReader(rd, h)}
+	if err := g.backend.Put(ctx, o.UUID, path.Base(o.Key), r.cred.KeyName, create, c); err != nil {
+		return err
+	}
+
+	o.Size = c.n
+	if o.ETag == "" {
+		o.ETag = hex.EncodeToString(h.Sum(nil))
+	}
+	o.Modified = g.now().UTC()
+
+	prev, err := g.store.putObject(r.bucket, o)
+	if err != nil {
+		return err
+	}
+	// the same key was created concurrently with another UUID
+	if prev != nil && prev.UUID != o.UUID {
+		if err := g.backend.Delete(ctx, prev.UUID, r.cred.KeyName); err != nil {
+			log.Errorf("replaced object %s was not deleted: %v", prev.UUID, err)
+		}
+	}
+	return nil
+}
+
+func (g *Gateway) getObject(w http.ResponseWriter, r *request) error {
+	o, err := g.store.object(r.bucket, r.key)
+	if err != nil {
+		return err
+	}
+	f, err := g.backend.Open(r.Context(), o.UUID)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := w.Header()
+	h.Set("ETag", `"`+o.ETag+`"`)
+	if o.ContentType != "" {
+		h.Set("Content-Type", o.ContentType)
+	} else {
+		h.Set("Content-Type", defaultContentType)
+	}
+	for k, v := range o.Meta {
+		h.Set(metaHeaderPrefix+k, v)
+	}
+	http.ServeContent(w, r.Request, "", o.Modified, &sizeSeeker{f})
+	return nil
+}
+
+func (g *Gateway) deleteObject(w http.ResponseWriter, r *request) error {
+	o, err := g.store.object(r.bucket, r.key)
+	if err == nil {
+		if err = g.backend.Delete(r.Context(), o.UUID, r.cred.KeyName); err != nil {
+			return err
+		}
+		_, err = g.store.deleteObject(r.bucket, r.key)
+	}
+	// deleting missing object succeeds
+	if err != nil && err != errNoSuchKey {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// userMeta returns x-amz-meta-* headers without prefix.
+func userMeta(h http.Header) map[string]string {
+	var meta map[string]string
+	for k := range h {
+		if strings.HasPrefix(k, metaHeaderPrefix) {
+			if meta == nil {
+				meta = make(map[string]string)
+			}
+			meta[strings.TrimPrefix(k, metaHeaderPrefix)] = h.Get(k)
+		}
+	}
+	return meta
+}
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// sizeSeeker allows http.ServeContent to find out size of
+// the file without reading it to the end.
+type sizeSeeker struct {
+	File
+}
+
+func (s *sizeSeeker) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekEnd && offset == 0 {
+		return int64(s.Size()), nil
+	}
+	return s.File.Seek(offset, whence)
+}
@@ -0,0 +1,399 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Requests are authenticated with AWS Signature Version 4, either in
+// Authorization header or in query string of presigned URL. Payload
+// is verified while it is read: hash from x-amz-content-sha256 is
+// checked at the end of the body and every chunk of streaming upload
+// is checked against its own signature.
+
+const (
+	sigAlgorithm   = "AWS4-HMAC-SHA256"
+	chunkAlgorithm = "AWS4-HMAC-SHA256-PAYLOAD"
+	sigTerminator  = "aws4_request"
+	sigService     = "s3"
+	amzDateFormat  = "20060102T150405Z"
+	scopeDateFmt   = "20060102"
+
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	streamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+
+	// maxSkew is the difference between client and server
+	// clocks which is allowed for header signatures
+	maxSkew = 15 * time.Minute
+	// maxExpires is the longest lifetime of presigned URL
+	maxExpires = 7 * 24 * time.Hour
+	// maxChunkSize limits memory used by streaming uploads
+	maxChunkSize = 16 << 20
+)
+
+var emptySHA256 = hex.EncodeToString(sha256.New().Sum(nil))
+
+// signature describes how request was signed.
+type signature struct {
+	AccessKey     string
+	Date          time.Time
+	Scope         string
+	Region        string
+	SignedHeaders []string
+	Signature     string
+	PayloadHash   string
+	Presigned     bool
+	Expires       time.Duration
+}
+
+// parseSignature extracts signature from Authorization header or query.
+func parseSignature(req *http.Request) (*signature, error) {
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		return parseAuthHeader(req, auth)
+	}
+	if req.URL.Query().Get("X-Amz-Algorithm") != "" {
+		return parsePresigned(req)
+	}
+	return nil, errAccessDenied
+}
+
+func parseAuthHeader(req *http.Request, auth string) (*signature, error) {
+	if !strings.HasPrefix(auth, sigAlgorithm+" ") {
+		return nil, errUnsupportedSignature
+	}
+
+	fields := make(map[string]string)
+	for _, f := range strings.Split(strings.TrimPrefix(auth, sigAlgorithm+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(f), "=", 2)
+		if len(kv) != 2 {
+			return nil, errMalformedAuth
+		}
+		fields[kv[0]] = kv[1]
+	}
+
+	sig := &signature{
+		SignedHeaders: strings.Split(fields["SignedHeaders"], ";"),
+		Signature:     fields["Signature"],
+		PayloadHash:   req.Header.Get("X-Amz-Content-Sha256"),
+	}
+	if sig.Signature == "" || fields["SignedHeaders"] == "" || sig.PayloadHash == "" {
+		return nil, errMalformedAuth
+	}
+
+	date := req.Header.Get("X-Amz-Date")
+	if date == "" {
+		date = req.Header.Get("Date")
+	}
+	if err := sig.setCredential(fields["Credential"], date); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+func parsePresigned(req *http.Request) (*signature, error) {
+	q := req.URL.Query()
+	if q.Get("X-Amz-Algorithm") != sigAlgorithm {
+		return nil, errUnsupportedSignature
+	}
+
+	sig := &signature{
+		SignedHeaders: strings.Split(q.Get("X-Amz-SignedHeaders"), ";"),
+		Signature:     q.Get("X-Amz-Signature"),
+		PayloadHash:   unsignedPayload,
+		Presigned:     true,
+	}
+	if h := q.Get("X-Amz-Content-Sha256"); h != "" {
+		sig.PayloadHash = h
+	}
+	expires, err := strconv.ParseInt(q.Get("X-Amz-Expires"), 10, 64)
+	if err != nil || expires < 0 || time.Duration(expires)*time.Second > maxExpires {
+		return nil, errMalformedAuth
+	}
+	sig.Expires = time.Duration(expires) * time.Second
+	if sig.Signature == "" || q.Get("X-Amz-SignedHeaders") == "" {
+		return nil, errMalformedAuth
+	}
+
+	if err := sig.setCredential(q.Get("X-Amz-Credential"), q.Get("X-Amz-Date")); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// setCredential parses "<access key>/<date>/<region>/s3/aws4_request".
+func (sig *signature) setCredential(cred, date string) error {
+	parts := strings.Split(cred, "/")
+	if len(parts) != 5 || parts[3] != sigService || parts[4] != sigTerminator {
+		return errMalformedAuth
+	}
+
+	t, err := time.Parse(amzDateFormat, date)
+	if err != nil {
+		if t, err = http.ParseTime(date); err != nil {
+			return errMalformedAuth
+		}
+	}
+	if t.UTC().Format(scopeDateFmt) != parts[1] {
+		return errMalformedAuth
+	}
+
+	sig.AccessKey = parts[0]
+	sig.Date = t.UTC()
+	sig.Region = parts[2]
+	sig.Scope = strings.Join(parts[1:], "/")
+	return nil
+}
+
+// checkTime verifies that signature is neither too old nor from the future.
+func (sig *signature) checkTime(now time.Time) error {
+	if sig.Presigned {
+		if now.Before(sig.Date.Add(-maxSkew)) || now.After(sig.Date.Add(sig.Expires)) {
+			return errExpired
+		}
+		return nil
+	}
+	if d := now.Sub(sig.Date); d > maxSkew || d < -maxSkew {
+		return errTimeSkewed
+	}
+	return nil
+}
+
+// signingKey derives key for the date and region of the scope.
+func signingKey(secret string, sig *signature) []byte {
+	k := hmacSHA256([]byte("AWS4"+secret), sig.Date.Format(scopeDateFmt))
+	k = hmacSHA256(k, sig.Region)
+	k = hmacSHA256(k, sigService)
+	return hmacSHA256(k, sigTerminator)
+}
+
+// verify checks signature of req with secret key.
+func (sig *signature) verify(req *http.Request, secret string) ([]byte, error) {
+	creq, err := canonicalRequest(req, sig)
+	if err != nil {
+		return nil, err
+	}
+	sts := strings.Join([]string{
+		sigAlgorithm,
+		sig.Date.Format(amzDateFormat),
+		sig.Scope,
+		hexSHA256([]byte(creq)),
+	}, "\n")
+
+	key := signingKey(secret, sig)
+	expected := hex.EncodeToString(hmacSHA256(key, sts))
+	if !hmac.Equal([]byte(expected), []byte(sig.Signature)) {
+		log.Debugf("signature mismatch, canonical request:\n%s", creq)
+		return nil, errSignatureMismatch
+	}
+	return key, nil
+}
+
+func canonicalRequest(req *http.Request, sig *signature) (string, error) {
+	var headers []string
+	for _, name := range sig.SignedHeaders {
+		var value string
+		switch name {
+		case "host":
+			value = req.Host
+		case "content-length":
+			value = strconv.FormatInt(req.ContentLength, 10)
+			if v := req.Header.Get("Content-Length"); v != "" {
+				value = v
+			}
+		default:
+			vs, ok := req.Header[http.CanonicalHeaderKey(name)]
+			if !ok {
+				return "", errMalformedAuth
+			}
+			trimmed := make([]string, len(vs))
+			for i, v := range vs {
+				trimmed[i] = strings.Join(strings.Fields(v), " ")
+			}
+			value = strings.Join(trimmed, ",")
+		}
+		headers = append(headers, name+":"+value+"\n")
+	}
+
+	return strings.Join([]string{
+		req.Method,
+		awsEscape(req.URL.Path, true),
+		canonicalQuery(req.URL.Query(), sig.Presigned),
+		strings.Join(headers, ""),
+		strings.Join(sig.SignedHeaders, ";"),
+		sig.PayloadHash,
+	}, "\n"), nil
+}
+
+func canonicalQuery(q url.Values, presigned bool) string {
+	var pairs []string
+	for k, vs := range q {
+		if presigned && k == "X-Amz-Signature" {
+			continue
+		}
+		for _, v := range vs {
+			pairs = append(pairs, awsEscape(k, false)+"="+awsEscape(v, false))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes everything except unreserved characters
+// and, if keepSlash is set, slashes.
+func awsEscape(s string, keepSlash bool) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// payloadReader returns body of req which fails at the end if it does
+// not match hashes sent by the client.
+func (sig *signature) payloadReader(req *http.Request, key []byte) (io.Reader, error) {
+	var r io.Reader = req.Body
+
+	switch sig.PayloadHash {
+	case unsignedPayload:
+	case streamingPayload:
+		if sig.Presigned {
+			return nil, errUnsupportedSignature
+		}
+		r = &chunkReader{
+			r:       bufio.NewReader(r),
+			key:     key,
+			prefix:  chunkAlgorithm + "\n" + sig.Date.Format(amzDateFormat) + "\n" + sig.Scope + "\n",
+			prevSig: sig.Signature,
+		}
+	default:
+		sum, err := hex.DecodeString(sig.PayloadHash)
+		if err != nil || len(sum) != sha256.Size {
+			return nil, errMalformedAuth
+		}
+		r = &hashReader{r: r, h: sha256.New(), sum: sum, err: errContentSHA256Mismatch}
+	}
+
+	if v := req.Header.Get("Content-Md5"); v != "" {
+		sum, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(sum) != md5.Size {
+			return nil, errInvalidDigest
+		}
+		r = &hashReader{r: r, h: md5.New(), sum: sum, err: errBadDigest}
+	}
+	return r, nil
+}
+
+// hashReader returns err at EOF if hash of the data is not sum.
+type hashReader struct {
+	r   io.Reader
+	h   hash.Hash
+	sum []byte
+	err error
+}
+
+func (r *hashReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.h.Write(p[:n])
+	if err == io.EOF && !bytes.Equal(r.h.Sum(nil), r.sum) {
+		return n, r.err
+	}
+	return n, err
+}
+
+// chunkReader decodes aws-chunked body. Every chunk is a line with hex
+// size and signature of data followed by data and CRLF. Signature is
+// chained to the signature of the previous chunk and body ends with
+// a chunk of zero size.
+type chunkReader struct {
+	r       *bufio.Reader
+	key     []byte
+	prefix  string
+	prevSig string
+
+	buf  []byte
+	done bool
+	err  error
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.nextChunk()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *chunkReader) nextChunk() error {
+	line, err := r.r.ReadString('\n')
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	parts := strings.SplitN(line, ";chunk-signature=", 2)
+	if len(parts) != 2 {
+		return errMalformedChunk
+	}
+	size, err := strconv.ParseInt(parts[0], 16, 64)
+	if err != nil || size < 0 || size > maxChunkSize {
+		return errMalformedChunk
+	}
+
+	data := make([]byte, size+2)
+	if _, err = io.ReadFull(r.r, data); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		return errMalformedChunk
+	}
+	data = data[:size]
+
+	sts := r.prefix + r.prevSig + "\n" + emptySHA256 + "\n" + hexSHA256(data)
+	expected := hex.EncodeToString(hmacSHA256(r.key, sts))
+	if !hmac.Equal([]byte(expected), []byte(parts[1])) {
+		return errSignatureMismatch
+	}
+
+	r.prevSig = expected
+	r.buf = data
+	r.done = size == 0
+	return nil
+}
@@ -0,0 +1,281 @@
+package s3
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	"gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+)
+
+// Buckets, objects and multipart uploads are kept in the repo datastore.
+// Object keys are hex-encoded in datastore keys, because S3 keys may
+// contain anything including "//" and "..".
+
+const (
+	bucketKeyPrefix = "/local/s3/bucket/"
+	objectKeyPrefix = "/local/s3/object/"
+	uploadKeyPrefix = "/local/s3/upload/"
+
+	maxKeyLength = 1024
+)
+
+var bucketNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// Bucket is a namespace of objects which belongs to one access key.
+type Bucket struct {
+	Name    string
+	Owner   string
+	Created time.Time
+}
+
+// Object is a UUID file stored under a key.
+type Object struct {
+	Key         string
+	UUID        string
+	Size        int64
+	ETag        string
+	ContentType string            `json:",omitempty"`
+	Meta        map[string]string `json:",omitempty"`
+	Modified    time.Time
+}
+
+// Upload is an incomplete multipart upload.
+type Upload struct {
+	ID          string
+	Bucket      string
+	Key         string
+	ContentType string            `json:",omitempty"`
+	Meta        map[string]string `json:",omitempty"`
+	Initiated   time.Time
+	Parts       map[int]*Part `json:",omitempty"`
+}
+
+// Part is an uploaded part of multipart upload.
+type Part struct {
+	ETag string
+	Size int64
+}
+
+type store struct {
+	mtx sync.Mutex
+	ds  ds.Datastore
+}
+
+func validBucketName(name string) bool {
+	return bucketNameRe.MatchString(name) && !strings.Contains(name, "..")
+}
+
+func bucketKey(name string) ds.Key {
+	return ds.NewKey(bucketKeyPrefix + name)
+}
+
+func objectKey(bucket, key string) ds.Key {
+	return ds.NewKey(objectKeyPrefix + bucket + "/" + hex.EncodeToString([]byte(key)))
+}
+
+func uploadKey(id string) ds.Key {
+	return ds.NewKey(uploadKeyPrefix + id)
+}
+
+func (s *store) get(k ds.Key, v interface{}) (bool, error) {
+	b, err := s.ds.Get(k)
+	if err == ds.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(b.([]byte), v)
+}
+
+func (s *store) put(k ds.Key, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.ds.Put(k, b)
+}
+
+// query returns values of all entries with prefix.
+func (s *store) query(prefix string) ([][]byte, error) {
+	res, err := s.ds.Query(query.Query{Prefix: prefix})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([][]byte, len(entries))
+	for i, e := range entries {
+		values[i] = e.Value.([]byte)
+	}
+	return values, nil
+}
+
+func (s *store) bucket(name string) (*Bucket, error) {
+	if !validBucketName(name) {
+		return nil, errNoSuchBucket
+	}
+	b := &Bucket{}
+	if ok, err := s.get(bucketKey(name), b); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errNoSuchBucket
+	}
+	return b, nil
+}
+
+func (s *store) createBucket(name, owner string) error {
+	if !validBucketName(name) {
+		return errInvalidBucketName
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	b := &Bucket{}
+	if ok, err := s.get(bucketKey(name), b); err != nil {
+		return err
+	} else if ok && b.Owner == owner {
+		return errBucketOwnedByYou
+	} else if ok {
+		return errBucketExists
+	}
+	return s.put(bucketKey(name), &Bucket{Name: name, Owner: owner, Created: time.Now().UTC()})
+}
+
+func (s *store) deleteBucket(name string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	objects, err := s.query(objectKeyPrefix + name + "/")
+	if err != nil {
+		return err
+	}
+	if len(objects) > 0 {
+		return errBucketNotEmpty
+	}
+	return s.ds.Delete(bucketKey(name))
+}
+
+// buckets returns buckets of the owner sorted by name.
+func (s *store) buckets(owner string) ([]*Bucket, error) {
+	values, err := s.query(bucketKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var buckets []*Bucket
+	for _, v := range values {
+		b := &Bucket{}
+		if err := json.Unmarshal(v, b); err != nil {
+			log.Errorf("invalid bucket: %v", err)
+			continue
+		}
+		if b.Owner == owner {
+			buckets = append(buckets, b)
+		}
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Name < buckets[j].Name })
+	return buckets, nil
+}
+
+func (s *store) object(bucket, key string) (*Object, error) {
+	o := &Object{}
+	if ok, err := s.get(objectKey(bucket, key), o); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errNoSuchKey
+	}
+	return o, nil
+}
+
+// putObject stores o and returns object which it has replaced.
+func (s *store) putObject(bucket string, o *Object) (*Object, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	prev, err := s.object(bucket, o.Key)
+	if err == errNoSuchKey {
+		prev = nil
+	} else if err != nil {
+		return nil, err
+	}
+	return prev, s.put(objectKey(bucket, o.Key), o)
+}
+
+// deleteObject removes object and returns it.
+func (s *store) deleteObject(bucket, key string) (*Object, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	o, err := s.object(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return o, s.ds.Delete(objectKey(bucket, key))
+}
+
+// objects returns objects of the bucket sorted by key.
+func (s *store) objects(bucket string) ([]*Object, error) {
+	values, err := s.query(objectKeyPrefix + bucket + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]*Object, 0, len(values))
+	for _, v := range values {
+		o := &Object{}
+		if err := json.Unmarshal(v, o); err != nil {
+			log.Errorf("invalid object: %v", err)
+			continue
+		}
+		objects = append(objects, o)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (s *store) upload(bucket, key, id string) (*Upload, error) {
+	u := &Upload{}
+	if !validID(id) {
+		return nil, errNoSuchUpload
+	}
+	if ok, err := s.get(uploadKey(id), u); err != nil {
+		return nil, err
+	} else if !ok || u.Bucket != bucket || u.Key != key {
+		return nil, errNoSuchUpload
+	}
+	return u, nil
+}
+
+func (s *store) putUpload(u *Upload) error {
+	return s.put(uploadKey(u.ID), u)
+}
+
+// setPart records part of the upload.
+func (s *store) setPart(u *Upload, n int, p *Part) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	cur, err := s.upload(u.Bucket, u.Key, u.ID)
+	if err != nil {
+		return err
+	}
+	if cur.Parts == nil {
+		cur.Parts = make(map[int]*Part)
+	}
+	cur.Parts[n] = p
+	return s.putUpload(cur)
+}
+
+func (s *store) deleteUpload(id string) error {
+	return s.ds.Delete(uploadKey(id))
+}
@@ -0,0 +1,877 @@
+package mock
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/casper/sc/poller"
+	sc "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dsq "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+)
+
+var log = logging.Logger("sc/mock")
+
+// ChainName is used in config
+const ChainName = "Mock"
+
+const (
+	// DefaultWallet is used when no wallet is specified in options
+	DefaultWallet = "0x000000000000000000000000000000000000c5e7"
+	// DefaultBanThreshold is a number of failed pings in a row
+	// after which provider is banned
+	DefaultBanThreshold = 3
+	// DefaultPollInterval is used for shared directory
+	// if "PollInterval" is not specified
+	DefaultPollInterval = time.Second
+
+	dsKeyPrefix      = "/local/mocksc"
+	providerKeyspace = dsKeyPrefix + "/provider/"
+	fileKeyspace     = dsKeyPrefix + "/file/"
+	balanceKeyspace  = dsKeyPrefix + "/balance/"
+	servedKeyspace   = dsKeyPrefix + "/served/"
+)
+
+var (
+	ErrNotInitialized     = errors.New("mock SC is not initialized")
+	ErrUnknownProvider    = errors.New("provider is not registered")
+	ErrProviderRegistered = errors.New("provider is already registered")
+	ErrNoSpace            = errors.New("provider has not enough free space")
+	ErrBadReceipt         = errors.New("download receipt is not signed by client")
+	ErrNoPingTarget       = errors.New("there are no other providers to ping")
+	ErrConsensusSize      = errors.New("consensus matrix does not match number of nodes")
+)
+
+type provider struct {
+	Telegram   string
+	IPAddr     string
+	ThriftAddr string
+	APIAddr    string
+	Origin     string
+	Size       int64
+	Free       int64
+	Failures   int
+	Banned     bool
+	Files      []string
+}
+
+type file struct {
+	Size  int64
+	Peers []string
+}
+
+// Contract is an in-process implementation of CasperSC.
+// All state is kept in a datastore: either in the one provided
+// via "Datastore" option (e.g. repo datastore) or in memory.
+// Nodes running in separate processes share the state if they
+// are given the same "Dir", see shared.go.
+type Contract struct {
+	mtx    sync.Mutex
+	ds     ds.Datastore
+	wallet string
+	banAt  int
+
+	// dir is the shared directory, state is kept in ds
+	// backed by it and events are polled from there
+	dir          string
+	flock        io.Closer
+	local        ds.Datastore
+	pollInterval time.Duration
+
+	subMtx        sync.Mutex
+	verifSubs     map[chan verificationTarget]struct{}
+	consensusSubs map[chan consensusResult]struct{}
+	checkSubs     map[chan struct{}]struct{}
+}
+
+type verificationTarget struct {
+	fileID string
+	nodeID string
+}
+
+type consensusResult struct {
+	fileID    string
+	consensus [4][32]byte
+}
+
+var _ sc.CasperSC = &Contract{}
+
+// Init accepts the following options:
+//   - "Datastore" (ds.Datastore) to store state in; in-memory map is used if omitted
+//   - "Dir" (string) shared by nodes of the local network to store state in instead;
+//     "Datastore" then only keeps positions of event subscriptions
+//   - "PollInterval" (duration string) of checking "Dir" for new events
+//   - "Wallet" (string) to identify current node as a client
+//   - "BanThreshold" (number) of failed pings after which provider is banned
+func (c *Contract) Init(ctx context.Context, opts sc.InitOpts) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.local, _ = opts["Datastore"].(ds.Datastore)
+	if dir, ok := opts["Dir"].(string); ok && dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		c.dir = dir
+		c.ds = &fileDatastore{dir: dir}
+	} else if c.local != nil {
+		c.ds = c.local
+	} else {
+		c.ds = dssync.MutexWrap(ds.NewMapDatastore())
+	}
+
+	c.pollInterval = poller.ParseInterval(opts["PollInterval"])
+	if c.pollInterval <= 0 {
+		c.pollInterval = DefaultPollInterval
+	}
+
+	c.wallet = DefaultWallet
+	if w, ok := opts["Wallet"].(string); ok && w != "" {
+		c.wallet = w
+	}
+
+	c.banAt = DefaultBanThreshold
+	switch v := opts["BanThreshold"].(type) {
+	case int:
+		c.banAt = v
+	case float64: // value is read from JSON config
+		c.banAt = int(v)
+	}
+	if c.banAt <= 0 {
+		c.banAt = DefaultBanThreshold
+	}
+
+	return nil
+}
+
+func (c *Contract) Initialized() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.ds != nil
+}
+
+func (c *Contract) GetWallet() string {
+	return c.wallet
+}
+
+var _ sc.WalletProofSC = &Contract{}
+
+// SignWallet signs payload with HMAC keyed by the wallet, as wallets
+// of the mock have no keys. Such proofs are only good for tests.
+func (c *Contract) SignWallet(payload []byte) ([]byte, error) {
+	return walletMAC(c.wallet, payload), nil
+}
+
+func (c *Contract) VerifyWallet(wallet string, payload, sig []byte) error {
+	if !hmac.Equal(walletMAC(wallet, payload), sig) {
+		return sc.ErrWrongWallet
+	}
+	return nil
+}
+
+func walletMAC(wallet string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(wallet))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func (c *Contract) AddToken(amount int64) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	b, err := c.getBalance(c.wallet)
+	if err != nil {
+		return err
+	}
+	return c.putJSON(balanceKeyspace+c.wallet, b+amount)
+}
+
+// CheckVerification emits ConsensusResult event with nodes
+// that were outvoted by the majority of other nodes.
+func (c *Contract) CheckVerification(fileID string, nodeIDs []string, consensus [][]bool) error {
+	if len(consensus) != len(nodeIDs) {
+		return ErrConsensusSize
+	}
+	for _, row := range consensus {
+		if len(row) != len(nodeIDs) {
+			return ErrConsensusSize
+		}
+	}
+
+	var result [4][32]byte
+	n := 0
+	for j, id := range nodeIDs {
+		agree, disagree := 0, 0
+		for i := range nodeIDs {
+			if i == j {
+				continue
+			}
+			if consensus[i][j] {
+				agree++
+			} else {
+				disagree++
+			}
+		}
+		if disagree > agree && n < len(result) {
+			bs, err := sc.HashToBytes(id)
+			if err != nil {
+				return err
+			}
+			result[n] = bs
+			n++
+		}
+	}
+
+	c.PublishConsensusResult(fileID, result)
+	return nil
+}
+
+// ConfirmDownload checks signatures of receipts and their wallets and adds acknowledged
+// bytes to the traffic served by the provider, see Served.
+func (c *Contract) ConfirmDownload(nodeID string, receipts []sc.DownloadReceipt) error {
+	var total int64
+	for _, r := range receipts {
+		if err := c.checkReceipt(r); err != nil {
+			return err
+		}
+		total += r.Bytes
+	}
+
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	if _, err := c.getProvider(nodeID); err != nil {
+		return err
+	}
+	served, err := c.getServed(nodeID)
+	if err != nil {
+		return err
+	}
+	return c.putJSON(servedKeyspace+nodeID, served+total)
+}
+
+// Served returns number of bytes served by provider and confirmed
+// with ConfirmDownload.
+func (c *Contract) Served(nodeID string) (int64, error) {
+	if err := c.lock(); err != nil {
+		return 0, err
+	}
+	defer c.unlock()
+	return c.getServed(nodeID)
+}
+
+func (c *Contract) checkReceipt(r sc.DownloadReceipt) error {
+	pk, err := ci.UnmarshalPublicKey(r.PubKey)
+	if err != nil {
+		return err
+	}
+	id, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		return err
+	}
+	if id.Pretty() != r.Client {
+		return ErrBadReceipt
+	}
+	if ok, err := pk.Verify(r.Payload, r.Signature); err != nil || !ok {
+		return ErrBadReceipt
+	}
+	if c.VerifyWallet(r.Wallet, sc.WalletPayload(r.Wallet, r.Client), r.WalletSignature) != nil {
+		return ErrBadReceipt
+	}
+	return nil
+}
+
+func (c *Contract) ConfirmUpdate(nodeID string, fileID string, size int64) error {
+	return c.ConfirmUpload(nodeID, fileID, size)
+}
+
+func (c *Contract) ConfirmUpload(nodeID string, fileID string, size int64) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	p, err := c.getProvider(nodeID)
+	if err != nil {
+		return err
+	}
+	f, err := c.getFile(fileID)
+	if err != nil {
+		return err
+	}
+
+	if !contains(p.Files, fileID) {
+		p.Files = append(p.Files, fileID)
+	} else {
+		// file is updated, release space occupied by the previous version
+		p.Free += f.Size
+	}
+	if p.Free < size {
+		return ErrNoSpace
+	}
+	p.Free -= size
+
+	if !contains(f.Peers, nodeID) {
+		f.Peers = append(f.Peers, nodeID)
+	}
+	f.Size = size
+
+	if err = c.putJSON(fileKeyspace+fileID, f); err != nil {
+		return err
+	}
+	return c.putJSON(providerKeyspace+nodeID, p)
+}
+
+func (c *Contract) GetAPIAddr(nodeID string) (string, error) {
+	if err := c.lock(); err != nil {
+		return "", err
+	}
+	defer c.unlock()
+
+	p, err := c.getProvider(nodeID)
+	if err != nil {
+		return "", err
+	}
+	if p.APIAddr != "" {
+		return p.APIAddr, nil
+	}
+	return p.IPAddr, nil
+}
+
+func (c *Contract) GetFile(nodeID string, number int64) (string, int64, error) {
+	if err := c.lock(); err != nil {
+		return "", 0, err
+	}
+	defer c.unlock()
+
+	p, err := c.getProvider(nodeID)
+	if err != nil {
+		return "", 0, err
+	}
+	if number < 0 || number >= int64(len(p.Files)) {
+		return "", 0, errors.New("file number is out of range")
+	}
+
+	fileID := p.Files[number]
+	f, err := c.getFile(fileID)
+	if err != nil {
+		return "", 0, err
+	}
+	return fileID, f.Size, nil
+}
+
+func (c *Contract) GetNumberOfFiles(nodeID string) (int64, error) {
+	if err := c.lock(); err != nil {
+		return 0, err
+	}
+	defer c.unlock()
+
+	p, err := c.getProvider(nodeID)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(p.Files)), nil
+}
+
+func (c *Contract) GetPeers(size int64, count int) ([]string, error) {
+	if err := c.lock(); err != nil {
+		return nil, err
+	}
+	defer c.unlock()
+
+	ids, err := c.providers(func(p *provider) bool {
+		return !p.Banned && p.Free >= size
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the same peer can be returned multiple times
+	// if there are less suitable peers than requested
+	peers := make([]string, 0, count)
+	for len(ids) > 0 && len(peers) < count {
+		perm := rand.Perm(len(ids))
+		for i := 0; i < len(perm) && len(peers) < count; i++ {
+			peers = append(peers, ids[perm[i]])
+		}
+	}
+	return peers, nil
+}
+
+func (c *Contract) GetPingTarget(nodeID string) (string, bool, error) {
+	if err := c.lock(); err != nil {
+		return "", false, err
+	}
+	ids, err := c.providers(func(p *provider) bool { return !p.Banned })
+	c.unlock()
+	if err != nil {
+		return "", false, err
+	}
+
+	c.publishProviderCheck()
+
+	targets := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id != nodeID {
+			targets = append(targets, id)
+		}
+	}
+	if len(targets) == 0 {
+		return "", false, ErrNoPingTarget
+	}
+	return targets[rand.Intn(len(targets))], false, nil
+}
+
+func (c *Contract) GetRPCAddr(nodeID string) (string, error) {
+	if err := c.lock(); err != nil {
+		return "", err
+	}
+	defer c.unlock()
+
+	p, err := c.getProvider(nodeID)
+	if err != nil {
+		return "", err
+	}
+	return p.ThriftAddr, nil
+}
+
+func (c *Contract) IsPrepaid(address string) (bool, error) {
+	if err := c.lock(); err != nil {
+		return false, err
+	}
+	defer c.unlock()
+
+	b, err := c.getBalance(address)
+	return b > 0, err
+}
+
+func (c *Contract) NotifyDelete(nodeID string, fileID string, size int64) error {
+	return c.NotifySpaceFreed(nodeID, fileID, size)
+}
+
+func (c *Contract) NotifySpaceFreed(nodeID string, fileID string, size int64) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	p, err := c.getProvider(nodeID)
+	if err != nil {
+		return err
+	}
+	f, err := c.getFile(fileID)
+	if err != nil {
+		return err
+	}
+
+	if contains(p.Files, fileID) {
+		p.Files = remove(p.Files, fileID)
+		p.Free += f.Size
+		if p.Free > p.Size {
+			p.Free = p.Size
+		}
+	}
+	f.Peers = remove(f.Peers, nodeID)
+
+	if len(f.Peers) == 0 {
+		err = c.ds.Delete(ds.NewKey(fileKeyspace + fileID))
+	} else {
+		err = c.putJSON(fileKeyspace+fileID, f)
+	}
+	if err != nil {
+		return err
+	}
+	return c.putJSON(providerKeyspace+nodeID, p)
+}
+
+func (c *Contract) NotifyVerificationTarget(nodeID string, fileID string) error {
+	if c.dir != "" {
+		return c.appendEvent(&event{Kind: verificationEvent, FileID: fileID, NodeID: nodeID})
+	}
+
+	c.subMtx.Lock()
+	defer c.subMtx.Unlock()
+
+	for ch := range c.verifSubs {
+		select {
+		case ch <- verificationTarget{fileID: fileID, nodeID: nodeID}:
+		default:
+			log.Warningf("verification target subscriber is too slow, event dropped")
+		}
+	}
+	return nil
+}
+
+func (c *Contract) PrePay(amount int64) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	b, err := c.getBalance(c.wallet)
+	if err != nil {
+		return err
+	}
+	if amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+
+	// tokens are only marked as prepaid, so keep them on the same balance
+	return c.putJSON(balanceKeyspace+c.wallet, b+amount)
+}
+
+func (c *Contract) RegisterProvider(nodeID string, telegram string, ipAddr string, thriftAddr string, size int64) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	if _, err := c.getProvider(nodeID); err == nil {
+		return ErrProviderRegistered
+	} else if err != ErrUnknownProvider {
+		return err
+	}
+
+	return c.putJSON(providerKeyspace+nodeID, &provider{
+		Telegram:   telegram,
+		IPAddr:     ipAddr,
+		ThriftAddr: thriftAddr,
+		Size:       size,
+		Free:       size,
+	})
+}
+
+func (c *Contract) GetOriginCode(nodeID string) (string, error) {
+	if err := c.lock(); err != nil {
+		return "", err
+	}
+	defer c.unlock()
+
+	p, err := c.getProvider(nodeID)
+	if err != nil {
+		return "", err
+	}
+	return p.Origin, nil
+}
+
+func (c *Contract) SetOriginCode(nodeID, originCode string) error {
+	return c.updateProvider(nodeID, func(p *provider) { p.Origin = originCode })
+}
+
+func (c *Contract) SendPingResult(nodeID string, success bool) (bool, error) {
+	banned := false
+	err := c.updateProvider(nodeID, func(p *provider) {
+		if success {
+			p.Failures = 0
+			return
+		}
+		p.Failures++
+		if !p.Banned && p.Failures >= c.banAt {
+			p.Banned = true
+			banned = true
+		}
+	})
+	return banned, err
+}
+
+func (c *Contract) ShowStoringPeers(fileID string) ([]string, error) {
+	if err := c.lock(); err != nil {
+		return nil, err
+	}
+	defer c.unlock()
+
+	f, err := c.getFile(fileID)
+	if err != nil {
+		return nil, err
+	}
+	return f.Peers, nil
+}
+
+func (c *Contract) SetAPIAddr(nodeID string, addr string) error {
+	return c.updateProvider(nodeID, func(p *provider) { p.APIAddr = addr })
+}
+
+func (c *Contract) SetRPCAddr(nodeID string, addr string) error {
+	return c.updateProvider(nodeID, func(p *provider) { p.ThriftAddr = addr })
+}
+
+func (c *Contract) VerifyReplication(nodeID string) (bool, error) {
+	if err := c.lock(); err != nil {
+		return false, err
+	}
+	defer c.unlock()
+
+	p, err := c.getProvider(nodeID)
+	if err != nil {
+		return false, err
+	}
+	return p.Banned, nil
+}
+
+// PublishConsensusResult emits ConsensusResult event
+// to all subscribers as if it was received from SC.
+func (c *Contract) PublishConsensusResult(fileID string, consensus [4][32]byte) {
+	if c.dir != "" {
+		if err := c.appendEvent(&event{Kind: consensusEvent, FileID: fileID, Consensus: consensus}); err != nil {
+			log.Errorf("cannot publish consensus result: %v", err)
+		}
+		return
+	}
+
+	c.subMtx.Lock()
+	defer c.subMtx.Unlock()
+
+	for ch := range c.consensusSubs {
+		select {
+		case ch <- consensusResult{fileID: fileID, consensus: consensus}:
+		default:
+			log.Warningf("consensus result subscriber is too slow, event dropped")
+		}
+	}
+}
+
+func (c *Contract) publishProviderCheck() {
+	if c.dir != "" {
+		if err := c.appendEvent(&event{Kind: checkEvent}); err != nil {
+			log.Errorf("cannot publish provider check: %v", err)
+		}
+		return
+	}
+
+	c.subMtx.Lock()
+	defer c.subMtx.Unlock()
+
+	for ch := range c.checkSubs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (c *Contract) SubscribeVerificationTarget(ctx context.Context, callback sc.VerificationTargetFunc) error {
+	if c.dir != "" {
+		return c.pollEvents(ctx, verificationEvent, func(e *event) { callback(e.FileID, e.NodeID) })
+	}
+
+	ch := make(chan verificationTarget, subscriptionBufLen)
+	c.subMtx.Lock()
+	if c.verifSubs == nil {
+		c.verifSubs = make(map[chan verificationTarget]struct{})
+	}
+	c.verifSubs[ch] = struct{}{}
+	c.subMtx.Unlock()
+
+	defer func() {
+		c.subMtx.Lock()
+		delete(c.verifSubs, ch)
+		c.subMtx.Unlock()
+	}()
+
+	for {
+		select {
+		case e := <-ch:
+			callback(e.fileID, e.nodeID)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *Contract) SubscribeConsensusResult(ctx context.Context, callback sc.ConsensusResultFunc) error {
+	if c.dir != "" {
+		return c.pollEvents(ctx, consensusEvent, func(e *event) { callback(e.FileID, e.Consensus) })
+	}
+
+	ch := make(chan consensusResult, subscriptionBufLen)
+	c.subMtx.Lock()
+	if c.consensusSubs == nil {
+		c.consensusSubs = make(map[chan consensusResult]struct{})
+	}
+	c.consensusSubs[ch] = struct{}{}
+	c.subMtx.Unlock()
+
+	defer func() {
+		c.subMtx.Lock()
+		delete(c.consensusSubs, ch)
+		c.subMtx.Unlock()
+	}()
+
+	for {
+		select {
+		case e := <-ch:
+			callback(e.fileID, e.consensus)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *Contract) SubscribeProviderCheck(ctx context.Context, callback sc.ProviderCheckFunc) error {
+	if c.dir != "" {
+		return c.pollEvents(ctx, checkEvent, func(*event) { callback() })
+	}
+
+	ch := make(chan struct{}, subscriptionBufLen)
+	c.subMtx.Lock()
+	if c.checkSubs == nil {
+		c.checkSubs = make(map[chan struct{}]struct{})
+	}
+	c.checkSubs[ch] = struct{}{}
+	c.subMtx.Unlock()
+
+	defer func() {
+		c.subMtx.Lock()
+		delete(c.checkSubs, ch)
+		c.subMtx.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ch:
+			callback()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+const subscriptionBufLen = 16
+
+func (c *Contract) updateProvider(nodeID string, update func(p *provider)) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	p, err := c.getProvider(nodeID)
+	if err != nil {
+		return err
+	}
+	update(p)
+	return c.putJSON(providerKeyspace+nodeID, p)
+}
+
+// providers returns IDs of all registered providers satisfying filter.
+func (c *Contract) providers(filter func(p *provider) bool) ([]string, error) {
+	if c.ds == nil {
+		return nil, ErrNotInitialized
+	}
+
+	res, err := c.ds.Query(dsq.Query{Prefix: providerKeyspace})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var ids []string
+	for {
+		e, ok := res.NextSync()
+		if !ok {
+			return ids, nil
+		}
+		if e.Error != nil {
+			return nil, e.Error
+		}
+		p := &provider{}
+		if err := json.Unmarshal(e.Value.([]byte), p); err != nil {
+			return nil, err
+		}
+		if filter(p) {
+			ids = append(ids, strings.TrimPrefix(e.Key, providerKeyspace))
+		}
+	}
+}
+
+func (c *Contract) getProvider(nodeID string) (*provider, error) {
+	p := &provider{}
+	if err := c.getJSON(providerKeyspace+nodeID, p); err == ds.ErrNotFound {
+		return nil, ErrUnknownProvider
+	} else if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (c *Contract) getFile(fileID string) (*file, error) {
+	f := &file{}
+	if err := c.getJSON(fileKeyspace+fileID, f); err != nil && err != ds.ErrNotFound {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (c *Contract) getBalance(wallet string) (b int64, err error) {
+	if err = c.getJSON(balanceKeyspace+wallet, &b); err == ds.ErrNotFound {
+		return 0, nil
+	}
+	return b, err
+}
+
+func (c *Contract) getServed(nodeID string) (n int64, err error) {
+	if err = c.getJSON(servedKeyspace+nodeID, &n); err == ds.ErrNotFound {
+		return 0, nil
+	}
+	return n, err
+}
+
+func (c *Contract) getJSON(key string, v interface{}) error {
+	if c.ds == nil {
+		return ErrNotInitialized
+	}
+
+	val, err := c.ds.Get(ds.NewKey(key))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(val.([]byte), v)
+}
+
+func (c *Contract) putJSON(key string, v interface{}) error {
+	if c.ds == nil {
+		return ErrNotInitialized
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.ds.Put(ds.NewKey(key), b)
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(ss []string, s string) []string {
+	ret := ss[:0]
+	for _, v := range ss {
+		if v != s {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
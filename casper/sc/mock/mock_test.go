@@ -0,0 +1,332 @@
+package mock_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/casper/sc/mock"
+	scin "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+)
+
+func newContract(t *testing.T, opts scin.InitOpts) *mock.Contract {
+	c := &mock.Contract{}
+	if err := c.Init(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"node1", "node2", "node3"} {
+		if err := c.RegisterProvider(id, "", "/ip4/127.0.0.1/tcp/4001", "127.0.0.1:9090", 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+func TestUploadAndDelete(t *testing.T) {
+	c := newContract(t, nil)
+
+	if err := c.RegisterProvider("node1", "", "", "", 1); err != mock.ErrProviderRegistered {
+		t.Fatalf("expected ErrProviderRegistered, got: %v", err)
+	}
+
+	peers, err := c.GetPeers(100, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 4 {
+		t.Fatalf("expected 4 peers, got %d", len(peers))
+	}
+
+	for _, id := range []string{"node1", "node2"} {
+		if err := c.ConfirmUpload(id, "file", 600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.ConfirmUpload("node1", "other", 600); err != mock.ErrNoSpace {
+		t.Fatalf("expected ErrNoSpace, got: %v", err)
+	}
+
+	stored, err := c.ShowStoringPeers("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("expected file to be stored on 2 peers, got %v", stored)
+	}
+
+	// node1 and node2 have not enough space for another 600 bytes
+	peers, err = c.GetPeers(600, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range peers {
+		if p != "node3" {
+			t.Fatalf("unexpected peer %s", p)
+		}
+	}
+
+	id, size, err := c.GetFile("node1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "file" || size != 600 {
+		t.Fatalf("unexpected file: %s (%d)", id, size)
+	}
+
+	if err = c.NotifySpaceFreed("node1", "file", 600); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := c.GetNumberOfFiles("node1"); n != 0 {
+		t.Fatalf("expected no files on node1, got %d", n)
+	}
+	if stored, _ = c.ShowStoringPeers("file"); len(stored) != 1 || stored[0] != "node2" {
+		t.Fatalf("expected file to be stored on node2 only, got %v", stored)
+	}
+}
+
+func TestBan(t *testing.T) {
+	c := newContract(t, scin.InitOpts{"BanThreshold": 2})
+
+	for i, expected := range []bool{false, false, true, false} {
+		// successful ping resets failure counter
+		banned, err := c.SendPingResult("node2", i == 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if banned != expected {
+			t.Fatalf("ping #%d: expected banned=%t, got %t", i, expected, banned)
+		}
+	}
+
+	if banned, _ := c.VerifyReplication("node2"); !banned {
+		t.Fatal("node2 must be banned")
+	}
+	for i := 0; i < 10; i++ {
+		target, _, err := c.GetPingTarget("node1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if target != "node3" {
+			t.Fatalf("unexpected ping target: %s", target)
+		}
+	}
+	// node1 is the only unbanned provider node3 can ping
+	if target, _, err := c.GetPingTarget("node3"); err != nil || target != "node1" {
+		t.Fatalf("node must not ping itself or banned nodes, got: %s %v", target, err)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	c := newContract(t, scin.InitOpts{"Datastore": d, "Wallet": "wallet"})
+	if err := c.PrePay(10); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetRPCAddr("node1", "10.0.0.1:9091"); err != nil {
+		t.Fatal(err)
+	}
+
+	c2 := &mock.Contract{}
+	if err := c2.Init(context.Background(), scin.InitOpts{"Datastore": d}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := c2.IsPrepaid("wallet"); !ok {
+		t.Fatal("wallet must be prepaid")
+	}
+	if ok, _ := c2.IsPrepaid(c2.GetWallet()); ok {
+		t.Fatal("default wallet must not be prepaid")
+	}
+	if addr, _ := c2.GetRPCAddr("node1"); addr != "10.0.0.1:9091" {
+		t.Fatalf("unexpected RPC address: %s", addr)
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	c := newContract(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	targets := make(chan string, 1)
+	consensus := make(chan string, 1)
+	checks := make(chan struct{}, 1)
+	go c.SubscribeVerificationTarget(ctx, func(fileID, nodeID string) { targets <- fileID + "@" + nodeID })
+	go c.SubscribeConsensusResult(ctx, func(fileID string, _ [4][32]byte) { consensus <- fileID })
+	go c.SubscribeProviderCheck(ctx, func() { checks <- struct{}{} })
+
+	// wait for subscriptions to be registered
+	time.Sleep(50 * time.Millisecond)
+
+	c.NotifyVerificationTarget("node1", "file")
+	c.PublishConsensusResult("file", [4][32]byte{})
+	c.GetPingTarget("node1")
+
+	timeout := time.After(time.Second)
+	select {
+	case v := <-targets:
+		if v != "file@node1" {
+			t.Fatalf("unexpected verification target: %s", v)
+		}
+	case <-timeout:
+		t.Fatal("verification target was not received")
+	}
+	select {
+	case <-consensus:
+	case <-timeout:
+		t.Fatal("consensus result was not received")
+	}
+	select {
+	case <-checks:
+	case <-timeout:
+		t.Fatal("provider check was not received")
+	}
+}
+
+func TestConfirmDownload(t *testing.T) {
+	c := newContract(t, nil)
+
+	sk, pk, err := ci.GenerateKeyPair(ci.RSA, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := pk.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsig, err := newContract(t, scin.InitOpts{"Wallet": "wallet"}).SignWallet(scin.WalletPayload("wallet", id.Pretty()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt := func(payload string, bytes int64) scin.DownloadReceipt {
+		sig, err := sk.Sign([]byte(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return scin.DownloadReceipt{
+			Client:          id.Pretty(),
+			Wallet:          "wallet",
+			WalletSignature: wsig,
+			FileID:          "file",
+			Bytes:           bytes,
+			Payload:         []byte(payload),
+			PubKey:          pub,
+			Signature:       sig,
+		}
+	}
+
+	if err := c.ConfirmDownload("node1", []scin.DownloadReceipt{receipt("a", 100), receipt("b", 50)}); err != nil {
+		t.Fatal(err)
+	}
+	if served, err := c.Served("node1"); err != nil || served != 150 {
+		t.Fatalf("expected 150 bytes served, got %d %v", served, err)
+	}
+
+	forged := receipt("c", 1000)
+	forged.Payload = []byte("d")
+	if err := c.ConfirmDownload("node1", []scin.DownloadReceipt{forged}); err != mock.ErrBadReceipt {
+		t.Fatalf("expected ErrBadReceipt, got %v", err)
+	}
+	stolen := receipt("e", 1000)
+	stolen.Client = "other"
+	if err := c.ConfirmDownload("node1", []scin.DownloadReceipt{stolen}); err != mock.ErrBadReceipt {
+		t.Fatalf("expected ErrBadReceipt, got %v", err)
+	}
+	spent := receipt("g", 1000)
+	spent.Wallet = "other"
+	if err := c.ConfirmDownload("node1", []scin.DownloadReceipt{spent}); err != mock.ErrBadReceipt {
+		t.Fatalf("receipt must be signed by the key of its wallet, got %v", err)
+	}
+	if err := c.ConfirmDownload("unknown", []scin.DownloadReceipt{receipt("f", 1)}); err != mock.ErrUnknownProvider {
+		t.Fatalf("expected ErrUnknownProvider, got %v", err)
+	}
+	if served, _ := c.Served("node1"); served != 150 {
+		t.Fatalf("rejected receipts must not be counted, got %d", served)
+	}
+}
+
+func TestCheckVerification(t *testing.T) {
+	c := newContract(t, nil)
+
+	nodes := []string{"node1", "node2", "node3"}
+	if err := c.CheckVerification("file", nodes, [][]bool{{true, true, true}, {true, true, true}}); err != mock.ErrConsensusSize {
+		t.Fatalf("expected ErrConsensusSize, got: %v", err)
+	}
+	if err := c.CheckVerification("file", nodes, [][]bool{{true, true}, {true, true}, {true, true}}); err != mock.ErrConsensusSize {
+		t.Fatalf("expected ErrConsensusSize, got: %v", err)
+	}
+}
+
+func TestWalletProof(t *testing.T) {
+	c := newContract(t, scin.InitOpts{"Wallet": "client"})
+
+	proof, err := scin.SignWalletProof(c, "peer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wallet, err := scin.VerifyWalletProof(c, proof, "peer"); err != nil || wallet != "client" {
+		t.Fatalf("expected wallet of the client, got %s: %v", wallet, err)
+	}
+	if _, err := scin.VerifyWalletProof(c, proof, "other"); err != scin.ErrWrongWallet {
+		t.Fatalf("proof must be bound to the peer, got: %v", err)
+	}
+	if _, err := scin.VerifyWalletProof(c, "client", "peer"); err != scin.ErrNoWalletProof {
+		t.Fatalf("expected ErrNoWalletProof, got: %v", err)
+	}
+}
+
+func TestSharedDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mocksc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := scin.InitOpts{"Dir": dir, "PollInterval": "10ms"}
+	c1 := newContract(t, opts)
+	// contracts of different nodes have their own local datastores
+	opts2 := scin.InitOpts{"Dir": dir, "PollInterval": "10ms", "Datastore": dssync.MutexWrap(ds.NewMapDatastore())}
+	c2 := &mock.Contract{}
+	if err := c2.Init(context.Background(), opts2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c1.ConfirmUpload("node1", "file", 100); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := c2.ShowStoringPeers("file"); err != nil || len(stored) != 1 || stored[0] != "node1" {
+		t.Fatalf("expected file to be stored on node1, got %v %v", stored, err)
+	}
+	if peers, err := c2.GetPeers(0, 3); err != nil || len(peers) != 3 {
+		t.Fatalf("expected 3 peers, got %v %v", peers, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// event published before subscription is not delivered
+	c1.NotifyVerificationTarget("node1", "old")
+
+	targets := make(chan string, 2)
+	go c2.SubscribeVerificationTarget(ctx, func(fileID, nodeID string) { targets <- fileID + "@" + nodeID })
+	time.Sleep(50 * time.Millisecond)
+
+	c1.NotifyVerificationTarget("node2", "file")
+	select {
+	case v := <-targets:
+		if v != "file@node2" {
+			t.Fatalf("unexpected verification target: %s", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("verification target was not received")
+	}
+}
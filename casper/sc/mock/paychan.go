@@ -0,0 +1,213 @@
+package mock
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"time"
+
+	sc "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+)
+
+const channelKeyspace = dsKeyPrefix + "/channel/"
+
+var (
+	ErrUnknownChannel  = errors.New("unknown payment channel")
+	ErrChannelClosed   = errors.New("payment channel is closed")
+	ErrNotExpired      = errors.New("payment channel has not expired yet")
+	ErrNotPayer        = errors.New("payment channel is not funded by this wallet")
+	ErrBadVoucher      = errors.New("voucher is not signed by channel signer")
+	ErrVoucherAmount   = errors.New("voucher amount exceeds channel capacity")
+	ErrNoFunds         = errors.New("not enough tokens")
+	ErrInvalidDuration = errors.New("payment channel must expire in the future")
+)
+
+var _ sc.PaymentChannelSC = &Contract{}
+
+// OpenChannel locks amount of tokens of the contract wallet.
+func (c *Contract) OpenChannel(payee string, signer []byte, amount int64, expires int64) (string, error) {
+	if _, err := ci.UnmarshalPublicKey(signer); err != nil {
+		return "", err
+	}
+	if expires <= time.Now().Unix() {
+		return "", ErrInvalidDuration
+	}
+	if amount <= 0 {
+		return "", errors.New("amount must be positive")
+	}
+
+	if err := c.lock(); err != nil {
+		return "", err
+	}
+	defer c.unlock()
+
+	if _, err := c.getProvider(payee); err != nil {
+		return "", err
+	}
+	b, err := c.getBalance(c.wallet)
+	if err != nil {
+		return "", err
+	}
+	if b < amount {
+		return "", ErrNoFunds
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	ch := &sc.ChannelInfo{
+		ID:       hex.EncodeToString(id),
+		Payer:    c.wallet,
+		Signer:   signer,
+		Payee:    payee,
+		Capacity: amount,
+		Expires:  expires,
+	}
+	if err = c.putJSON(balanceKeyspace+c.wallet, b-amount); err != nil {
+		return "", err
+	}
+	return ch.ID, c.putJSON(channelKeyspace+ch.ID, ch)
+}
+
+func (c *Contract) GetChannel(channelID string) (sc.ChannelInfo, error) {
+	if err := c.lock(); err != nil {
+		return sc.ChannelInfo{}, err
+	}
+	defer c.unlock()
+
+	ch, err := c.getChannel(channelID)
+	if err != nil {
+		return sc.ChannelInfo{}, err
+	}
+	return *ch, nil
+}
+
+// SettleChannel pays out the difference between voucher amount and
+// already claimed amount to the balance of payee.
+func (c *Contract) SettleChannel(channelID string, v sc.PaymentVoucher) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	ch, err := c.getOpenChannel(channelID)
+	if err != nil {
+		return err
+	}
+	if err = c.claim(ch, v); err != nil {
+		return err
+	}
+	return c.putJSON(channelKeyspace+ch.ID, ch)
+}
+
+// CloseChannel settles v and refunds the rest to payer.
+func (c *Contract) CloseChannel(channelID string, v sc.PaymentVoucher) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	ch, err := c.getOpenChannel(channelID)
+	if err != nil {
+		return err
+	}
+	if err = c.claim(ch, v); err != nil {
+		return err
+	}
+	return c.close(ch)
+}
+
+func (c *Contract) ReclaimChannel(channelID string) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	ch, err := c.getOpenChannel(channelID)
+	if err != nil {
+		return err
+	}
+	if ch.Payer != c.wallet {
+		return ErrNotPayer
+	}
+	if time.Now().Unix() < ch.Expires {
+		return ErrNotExpired
+	}
+	return c.close(ch)
+}
+
+// claim checks voucher and pays its amount which was not claimed yet.
+// Vouchers with amount not greater than claimed one are accepted but pay
+// nothing, so that payee can close the channel with the settled voucher.
+func (c *Contract) claim(ch *sc.ChannelInfo, v sc.PaymentVoucher) error {
+	if v.ChannelID != ch.ID {
+		return ErrBadVoucher
+	}
+	pk, err := ci.UnmarshalPublicKey(ch.Signer)
+	if err != nil {
+		return err
+	}
+	if ok, err := pk.Verify(sc.VoucherPayload(v.ChannelID, v.Amount), v.Signature); err != nil || !ok {
+		return ErrBadVoucher
+	}
+	if v.Amount > ch.Capacity {
+		return ErrVoucherAmount
+	}
+	if v.Amount <= ch.Claimed {
+		return nil
+	}
+
+	b, err := c.getBalance(ch.Payee)
+	if err != nil {
+		return err
+	}
+	if err = c.putJSON(balanceKeyspace+ch.Payee, b+v.Amount-ch.Claimed); err != nil {
+		return err
+	}
+	ch.Claimed = v.Amount
+	return nil
+}
+
+func (c *Contract) close(ch *sc.ChannelInfo) error {
+	b, err := c.getBalance(ch.Payer)
+	if err != nil {
+		return err
+	}
+	if err = c.putJSON(balanceKeyspace+ch.Payer, b+ch.Capacity-ch.Claimed); err != nil {
+		return err
+	}
+	ch.Closed = true
+	return c.putJSON(channelKeyspace+ch.ID, ch)
+}
+
+// Balance returns tokens of wallet or provider node.
+func (c *Contract) Balance(wallet string) (int64, error) {
+	if err := c.lock(); err != nil {
+		return 0, err
+	}
+	defer c.unlock()
+	return c.getBalance(wallet)
+}
+
+func (c *Contract) getOpenChannel(channelID string) (*sc.ChannelInfo, error) {
+	ch, err := c.getChannel(channelID)
+	if err != nil {
+		return nil, err
+	}
+	if ch.Closed {
+		return nil, ErrChannelClosed
+	}
+	return ch, nil
+}
+
+func (c *Contract) getChannel(channelID string) (*sc.ChannelInfo, error) {
+	ch := &sc.ChannelInfo{}
+	if err := c.getJSON(channelKeyspace+channelID, ch); err == ds.ErrNotFound {
+		return nil, ErrUnknownChannel
+	} else if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
@@ -0,0 +1,111 @@
+package mock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/casper/sc/mock"
+	scin "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+)
+
+func TestPaymentChannel(t *testing.T) {
+	c := newContract(t, nil)
+	if err := c.AddToken(100); err != nil {
+		t.Fatal(err)
+	}
+
+	sk, pk, err := ci.GenerateKeyPair(ci.RSA, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := pk.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	voucher := func(id string, amount int64) scin.PaymentVoucher {
+		sig, err := sk.Sign(scin.VoucherPayload(id, amount))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return scin.PaymentVoucher{ChannelID: id, Amount: amount, Signature: sig}
+	}
+	expires := time.Now().Add(time.Hour).Unix()
+
+	if _, err = c.OpenChannel("node1", signer, 1000, expires); err != mock.ErrNoFunds {
+		t.Fatalf("expected ErrNoFunds, got %v", err)
+	}
+	id, err := c.OpenChannel("node1", signer, 60, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := c.Balance(c.GetWallet()); b != 40 {
+		t.Fatalf("channel capacity must be locked, balance is %d", b)
+	}
+
+	if err = c.SettleChannel(id, voucher(id, 20)); err != nil {
+		t.Fatal(err)
+	}
+	// stale voucher pays nothing
+	if err = c.SettleChannel(id, voucher(id, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.SettleChannel(id, voucher(id, 70)); err != mock.ErrVoucherAmount {
+		t.Fatalf("expected ErrVoucherAmount, got %v", err)
+	}
+	forged := voucher(id, 30)
+	forged.Amount = 50
+	if err = c.SettleChannel(id, forged); err != mock.ErrBadVoucher {
+		t.Fatalf("expected ErrBadVoucher, got %v", err)
+	}
+	if b, _ := c.Balance("node1"); b != 20 {
+		t.Fatalf("payee must get 20 tokens, got %d", b)
+	}
+
+	if err = c.ReclaimChannel(id); err != mock.ErrNotExpired {
+		t.Fatalf("expected ErrNotExpired, got %v", err)
+	}
+	if err = c.CloseChannel(id, voucher(id, 45)); err != nil {
+		t.Fatal(err)
+	}
+	ch, err := c.GetChannel(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ch.Closed || ch.Claimed != 45 {
+		t.Fatalf("unexpected channel state %+v", ch)
+	}
+	payer, _ := c.Balance(c.GetWallet())
+	payee, _ := c.Balance("node1")
+	if payer != 55 || payee != 45 {
+		t.Fatalf("unexpected balances after close: payer %d, payee %d", payer, payee)
+	}
+	if err = c.SettleChannel(id, voucher(id, 50)); err != mock.ErrChannelClosed {
+		t.Fatalf("expected ErrChannelClosed, got %v", err)
+	}
+}
+
+func TestReclaimChannel(t *testing.T) {
+	c := newContract(t, nil)
+	if err := c.AddToken(100); err != nil {
+		t.Fatal(err)
+	}
+	_, pk, err := ci.GenerateKeyPair(ci.RSA, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, _ := pk.Bytes()
+
+	id, err := c.OpenChannel("node1", signer, 60, time.Now().Add(time.Second).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Until(time.Unix(time.Now().Unix()+1, 0)))
+	if err = c.ReclaimChannel(id); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := c.Balance(c.GetWallet()); b != 100 {
+		t.Fatalf("tokens must be returned, balance is %d", b)
+	}
+}
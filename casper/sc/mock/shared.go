@@ -0,0 +1,243 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/casper/sc/poller"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dsq "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+	lock "gx/ipfs/QmWi28zbQG6B1xfaaWx5cYoLn3kBFU6pQ6GWQNRV5P6dNe/lock"
+)
+
+// Nodes of the local network (e.g. in CI) run in separate processes,
+// so with "Dir" option state of the mock is kept in files of the shared
+// directory. Every change is made under a file lock and events are
+// appended to the log, which is polled by subscribers.
+
+const (
+	lockFile      = "mocksc.lock"
+	valueSuffix   = ".json"
+	lockRetry     = 10 * time.Millisecond
+	lockTimeout   = 10 * time.Second
+	eventSeqKey   = dsKeyPrefix + "/eventseq"
+	eventKeyspace = dsKeyPrefix + "/event/"
+
+	verificationEvent = "verification"
+	consensusEvent    = "consensus"
+	checkEvent        = "check"
+)
+
+var ErrLockTimeout = errors.New("cannot lock shared directory of mock SC")
+
+type event struct {
+	Kind      string
+	FileID    string      `json:",omitempty"`
+	NodeID    string      `json:",omitempty"`
+	Consensus [4][32]byte `json:",omitempty"`
+}
+
+// lock must be held while state is read or modified.
+func (c *Contract) lock() error {
+	c.mtx.Lock()
+	if c.dir == "" {
+		return nil
+	}
+
+	path := filepath.Join(c.dir, lockFile)
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		l, err := lock.Lock(path)
+		if err == nil {
+			c.flock = l
+			return nil
+		}
+		if time.Now().After(deadline) {
+			c.mtx.Unlock()
+			log.Errorf("cannot lock %s: %v", path, err)
+			return ErrLockTimeout
+		}
+		time.Sleep(lockRetry)
+	}
+}
+
+func (c *Contract) unlock() {
+	if c.flock != nil {
+		if err := c.flock.Close(); err != nil {
+			log.Error(err)
+		}
+		c.flock = nil
+	}
+	c.mtx.Unlock()
+}
+
+func eventKey(seq uint64) string {
+	return fmt.Sprintf("%s%020d", eventKeyspace, seq)
+}
+
+func (c *Contract) lastEvent() (seq uint64, err error) {
+	if err = c.getJSON(eventSeqKey, &seq); err == ds.ErrNotFound {
+		return 0, nil
+	}
+	return seq, err
+}
+
+func (c *Contract) appendEvent(e *event) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	seq, err := c.lastEvent()
+	if err != nil {
+		return err
+	}
+	seq++
+	if err = c.putJSON(eventKey(seq), e); err != nil {
+		return err
+	}
+	return c.putJSON(eventSeqKey, seq)
+}
+
+// pollEvents invokes handle for every new event of kind. Events are
+// numbered from 1, position of the subscriber is stored in local datastore.
+func (c *Contract) pollEvents(ctx context.Context, kind string, handle func(e *event)) error {
+	latest := func(context.Context) (uint64, error) {
+		if err := c.lock(); err != nil {
+			return 0, err
+		}
+		defer c.unlock()
+		return c.lastEvent()
+	}
+
+	cursor := poller.NewCursor(c.local, ChainName+"/"+kind)
+	if _, ok := cursor.Get(); !ok {
+		// skip events published before the first subscription
+		head, err := latest(ctx)
+		if err != nil {
+			return err
+		}
+		if err = cursor.Set(head + 1); err != nil {
+			return err
+		}
+	}
+
+	return poller.Poll(ctx, c.pollInterval, cursor, latest, func(ctx context.Context, from, to uint64) error {
+		for seq := from; seq <= to; seq++ {
+			e := &event{}
+			if err := c.getJSON(eventKey(seq), e); err == ds.ErrNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if e.Kind == kind {
+				handle(e)
+			}
+		}
+		return nil
+	})
+}
+
+// fileDatastore keeps every value in a separate file,
+// files are replaced atomically, so they can be read without lock.
+type fileDatastore struct {
+	dir string
+}
+
+var _ ds.Datastore = &fileDatastore{}
+
+func (d *fileDatastore) path(key ds.Key) string {
+	return filepath.Join(d.dir, filepath.FromSlash(key.String())) + valueSuffix
+}
+
+func (d *fileDatastore) Put(key ds.Key, value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return ds.ErrInvalidType
+	}
+
+	p := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(p), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (d *fileDatastore) Get(key ds.Key) (interface{}, error) {
+	b, err := ioutil.ReadFile(d.path(key))
+	if os.IsNotExist(err) {
+		return nil, ds.ErrNotFound
+	}
+	return b, err
+}
+
+func (d *fileDatastore) Has(key ds.Key) (bool, error) {
+	_, err := os.Stat(d.path(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (d *fileDatastore) Delete(key ds.Key) error {
+	err := os.Remove(d.path(key))
+	if os.IsNotExist(err) {
+		return ds.ErrNotFound
+	}
+	return err
+}
+
+func (d *fileDatastore) Query(q dsq.Query) (dsq.Results, error) {
+	var entries []dsq.Entry
+	root := filepath.Join(d.dir, filepath.FromSlash(ds.NewKey(q.Prefix).String()))
+	err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if fi.IsDir() || !strings.HasSuffix(p, valueSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(d.dir, strings.TrimSuffix(p, valueSuffix))
+		if err != nil {
+			return err
+		}
+
+		e := dsq.Entry{Key: ds.NewKey(filepath.ToSlash(rel)).String()}
+		if !q.KeysOnly {
+			if e.Value, err = ioutil.ReadFile(p); os.IsNotExist(err) {
+				// removed after listing
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dsq.NaiveQueryApply(q, dsq.ResultsWithEntries(q, entries)), nil
+}
@@ -22,8 +22,6 @@ var _ sc.CasperSC = &Contract{}
 var errNotImplemented = errors.New("not implemented")
 
 func (c *Contract) Init(ctx context.Context, opts sc.InitOpts) (err error) {
-	fmt.Printf("opts in Multi.Init(): %+v\n", opts)
-
 	if c.neo == nil {
 		c.neo = &neosc.Contract{}
 	}
@@ -31,10 +29,43 @@ func (c *Contract) Init(ctx context.Context, opts sc.InitOpts) (err error) {
 		c.eth = &solsc.Contract{}
 	}
 
-	if err = c.neo.Init(ctx, opts["NEO"].(sc.InitOpts)); err != nil {
+	neoOpts, ethOpts := chainOpts(opts, "NEO"), chainOpts(opts, "ETH")
+	if err = c.neo.Init(ctx, neoOpts); err != nil {
 		return err
 	}
-	return c.eth.Init(ctx, opts["ETH"].(sc.InitOpts))
+	return c.eth.Init(ctx, ethOpts)
+}
+
+// sharedOpts are passed from Multi contract to every chain.
+var sharedOpts = []string{"Datastore", sc.KeysOption}
+
+// chainOpts returns options of the specified chain
+// with the shared options passed to Multi contract.
+func chainOpts(opts sc.InitOpts, chain string) sc.InitOpts {
+	sub, _ := opts[chain].(sc.InitOpts)
+	ret := sc.InitOpts{}
+	for _, k := range sharedOpts {
+		if v, ok := opts[k]; ok {
+			ret[k] = v
+		}
+	}
+	for k, v := range sub {
+		ret[k] = v
+	}
+	return ret
+}
+
+// chainsErr returns error of the call which was made on both chains.
+func chainsErr(neoErr, ethErr error) error {
+	switch {
+	case neoErr != nil && ethErr != nil:
+		return fmt.Errorf("NEO: %v; ETH: %v", neoErr, ethErr)
+	case neoErr != nil:
+		return fmt.Errorf("NEO: %v", neoErr)
+	case ethErr != nil:
+		return fmt.Errorf("ETH: %v", ethErr)
+	}
+	return nil
 }
 
 func (c *Contract) Initialized() bool {
@@ -46,14 +77,34 @@ func (c *Contract) GetWallet() string {
 	return c.eth.GetWallet()
 }
 
+var _ sc.WalletProofSC = &Contract{}
+
+// SignWallet and VerifyWallet use ETH, as its wallet is used.
+func (c *Contract) SignWallet(payload []byte) ([]byte, error) {
+	wp, err := sc.WalletProofs(c.eth)
+	if err != nil {
+		return nil, err
+	}
+	return wp.SignWallet(payload)
+}
+
+func (c *Contract) VerifyWallet(wallet string, payload, sig []byte) error {
+	wp, err := sc.WalletProofs(c.eth)
+	if err != nil {
+		return err
+	}
+	return wp.VerifyWallet(wallet, payload, sig)
+}
+
 func (c *Contract) AddToken(amount int64) error {
 	c.neo.AddToken(amount)
 	return c.eth.AddToken(amount)
 }
 
-func (c *Contract) ConfirmDownload() error {
-	c.neo.ConfirmDownload()
-	return c.eth.ConfirmDownload()
+func (c *Contract) ConfirmDownload(nodeID string, receipts []sc.DownloadReceipt) error {
+	neoErr := c.neo.ConfirmDownload(nodeID, receipts)
+	ethErr := c.eth.ConfirmDownload(nodeID, receipts)
+	return chainsErr(neoErr, ethErr)
 }
 
 func (c *Contract) ConfirmUpdate(nodeID string, fileID string, size int64) error {
@@ -66,6 +117,12 @@ func (c *Contract) ConfirmUpload(nodeID string, fileID string, size int64) error
 	return c.eth.ConfirmUpload(nodeID, fileID, size)
 }
 
+func (c *Contract) CheckVerification(fileID string, nodeIDs []string, consensus [][]bool) error {
+	neoErr := c.neo.CheckVerification(fileID, nodeIDs, consensus)
+	ethErr := c.eth.CheckVerification(fileID, nodeIDs, consensus)
+	return chainsErr(neoErr, ethErr)
+}
+
 func (c *Contract) GetFile(nodeID string, number int64) (name string, size int64, err error) {
 	return c.eth.GetFile(nodeID, number)
 }
@@ -147,19 +204,27 @@ func (c *Contract) VerifyReplication(nodeID string) (bool, error) {
 	return c.eth.VerifyReplication(nodeID)
 }
 
+func (c *Contract) GetOriginCode(nodeID string) (string, error) {
+	return c.eth.GetOriginCode(nodeID)
+}
+
+func (c *Contract) GetOriginCodes(nodeIDs []string) (map[string]string, error) {
+	return sc.OriginCodes(c.eth, nodeIDs)
+}
+
 func (c *Contract) SetOriginCode(nodeID, originCode string) error {
 	c.neo.SetOriginCode(nodeID, originCode)
 	return c.eth.SetOriginCode(nodeID, originCode)
 }
 
 func (c *Contract) SubscribeVerificationTarget(ctx context.Context, callback sc.VerificationTargetFunc) error {
-	return errNotImplemented
+	return c.eth.SubscribeVerificationTarget(ctx, callback)
 }
 
 func (c *Contract) SubscribeConsensusResult(ctx context.Context, callback sc.ConsensusResultFunc) error {
-	return errNotImplemented
+	return c.eth.SubscribeConsensusResult(ctx, callback)
 }
 
 func (c *Contract) SubscribeProviderCheck(ctx context.Context, callback sc.ProviderCheckFunc) error {
-	return errNotImplemented
+	return c.eth.SubscribeProviderCheck(ctx, callback)
 }
@@ -0,0 +1,237 @@
+package neo
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Casper-dev/Casper-server/casper/sc/poller"
+	sc "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+)
+
+// Names of notifications emitted by SC via Runtime.Notify.
+// The first element of notification state is always event name.
+const (
+	eventVerificationTarget = "VerificationTarget"
+	eventConsensusResult    = "ConsensusResult"
+	eventProviderCheck      = "ProviderCheckEvent"
+)
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+	ID      int           `json:"id"`
+}
+
+type rpcError struct {
+	Code    int64  `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type blockInfo struct {
+	Tx []struct {
+		TxID string `json:"txid"`
+		Type string `json:"type"`
+	} `json:"tx"`
+}
+
+type stackItem struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+type notification struct {
+	Contract string    `json:"contract"`
+	State    stackItem `json:"state"`
+}
+
+// applicationLog is a response of ApplicationLogs plugin.
+// Older versions of plugin return notifications without executions.
+type applicationLog struct {
+	Executions []struct {
+		Notifications []notification `json:"notifications"`
+	} `json:"executions"`
+	Notifications []notification `json:"notifications"`
+}
+
+// call performs JSON-RPC call to NEO node.
+// Client from neo-go is not used here, because it lacks needed methods.
+func (c *Contract) call(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	b, err := json.Marshal(rpcRequest{JSONRPC: "2.0", Method: method, Params: params, ID: 1})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: remote responded with status %d", method, resp.StatusCode)
+	}
+
+	var r rpcResponse
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return fmt.Errorf("%s: %s (code %d)", method, r.Error.Message, r.Error.Code)
+	}
+	return json.Unmarshal(r.Result, result)
+}
+
+func (c *Contract) latestBlock(ctx context.Context) (uint64, error) {
+	var count uint64
+	if err := c.call(ctx, "getblockcount", &count); err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, errors.New("chain is empty")
+	}
+	return count - 1, nil
+}
+
+// scanNotifications invokes callback with the arguments
+// of every notification with specified name emitted by our SC.
+func (c *Contract) scanNotifications(ctx context.Context, from, to uint64, name string, callback func(args [][]byte)) error {
+	for i := from; i <= to; i++ {
+		var block blockInfo
+		if err := c.call(ctx, "getblock", &block, i, 1); err != nil {
+			return err
+		}
+
+		for _, tx := range block.Tx {
+			if tx.Type != "InvocationTransaction" {
+				continue
+			}
+
+			var alog applicationLog
+			if err := c.call(ctx, "getapplicationlog", &alog, tx.TxID); err != nil {
+				return err
+			}
+
+			notifications := alog.Notifications
+			for _, e := range alog.Executions {
+				notifications = append(notifications, e.Notifications...)
+			}
+			for _, n := range notifications {
+				if !c.isOurContract(n.Contract) {
+					continue
+				}
+				args, err := decodeArray(n.State)
+				if err != nil || len(args) == 0 || string(args[0]) != name {
+					continue
+				}
+				callback(args[1:])
+			}
+		}
+	}
+	return nil
+}
+
+// isOurContract compares script hashes ignoring prefix and byte order.
+func (c *Contract) isOurContract(hash string) bool {
+	hash = strings.ToLower(strings.TrimPrefix(hash, "0x"))
+	contract := strings.ToLower(strings.TrimPrefix(c.contract, "0x"))
+	if hash == contract {
+		return true
+	}
+
+	b, err := hex.DecodeString(hash)
+	if err != nil {
+		return false
+	}
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return hex.EncodeToString(b) == contract
+}
+
+func decodeArray(item stackItem) ([][]byte, error) {
+	if item.Type != "Array" {
+		return nil, errInvalidResult
+	}
+
+	var items []stackItem
+	if err := json.Unmarshal(item.Value, &items); err != nil {
+		return nil, err
+	}
+
+	ret := make([][]byte, len(items))
+	for i, it := range items {
+		var s string
+		if err := json.Unmarshal(it.Value, &s); err != nil {
+			// not a ByteArray or String, skip it
+			continue
+		}
+		if it.Type == "ByteArray" {
+			b, err := hex.DecodeString(s)
+			if err != nil {
+				return nil, err
+			}
+			ret[i] = b
+		} else {
+			ret[i] = []byte(s)
+		}
+	}
+	return ret, nil
+}
+
+func (c *Contract) poll(ctx context.Context, name string, callback func(args [][]byte)) error {
+	cursor := poller.NewCursor(c.ds, ChainName+"/"+name)
+	return poller.Poll(ctx, c.pollInterval, cursor, c.latestBlock, func(ctx context.Context, from, to uint64) error {
+		return c.scanNotifications(ctx, from, to, name, callback)
+	})
+}
+
+func (c *Contract) SubscribeVerificationTarget(ctx context.Context, callback sc.VerificationTargetFunc) error {
+	return c.poll(ctx, eventVerificationTarget, func(args [][]byte) {
+		if len(args) < 2 {
+			log.Errorf("invalid %s notification", eventVerificationTarget)
+			return
+		}
+		callback(string(args[0]), string(args[1]))
+	})
+}
+
+func (c *Contract) SubscribeConsensusResult(ctx context.Context, callback sc.ConsensusResultFunc) error {
+	return c.poll(ctx, eventConsensusResult, func(args [][]byte) {
+		if len(args) < 1 {
+			log.Errorf("invalid %s notification", eventConsensusResult)
+			return
+		}
+		var consensus [4][32]byte
+		for i := 1; i < len(args) && i <= len(consensus); i++ {
+			copy(consensus[i-1][:], args[i])
+		}
+		callback(string(args[0]), consensus)
+	})
+}
+
+func (c *Contract) SubscribeProviderCheck(ctx context.Context, callback sc.ProviderCheckFunc) error {
+	return c.poll(ctx, eventProviderCheck, func(args [][]byte) {
+		callback()
+	})
+}
@@ -4,14 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
-	"github.com/davecgh/go-spew/spew"
+	"github.com/Casper-dev/Casper-server/casper/sc/poller"
 	sc "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+	"github.com/davecgh/go-spew/spew"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
 
 	rpc "github.com/CityOfZion/neo-go/pkg/rpc"
 	wallet "github.com/CityOfZion/neo-go/pkg/wallet"
 )
 
+var log = logging.Logger("sc/neo")
+
 const (
 	roleNormal = 1
 	roleBanned = 2
@@ -34,10 +41,13 @@ type Contract struct {
 	neonAPI  string
 	rpc      *rpc.Client
 	wif      *wallet.WIF
+
+	// ds is used to persist positions of event subscriptions
+	ds           ds.Datastore
+	pollInterval time.Duration
 }
 
 const (
-	defaultWIFKey   = "KxDgvEKzgSBPPfuVfw67oPQBSjidEiqTHURKSDL1R7yGaGYAeYnr"
 	defaultContract = "c2fd3d71d1e0caa18092a65f5529a5cf87b8e799"
 )
 
@@ -50,8 +60,12 @@ func (c *Contract) Init(ctx context.Context, opts sc.InitOpts) (err error) {
 	if gateway, ok = opts["Gateway"].(string); !ok {
 		return errors.New("must provide Gateway")
 	}
-	if wif, ok = opts["WIF"].(string); !ok {
-		return errors.New("must provide WIF")
+	wif, plain, err := sc.ChainKey(opts, ChainName, "WIF")
+	if err != nil {
+		return err
+	}
+	if plain {
+		log.Warning("WIF is read from config, move it to wallet with 'ipfs wallet import' and remove it from config")
 	}
 	if neonapi, ok = opts["NeonAPI"].(string); !ok {
 		return errors.New("must provide NeonAPI")
@@ -75,6 +89,8 @@ func (c *Contract) Init(ctx context.Context, opts sc.InitOpts) (err error) {
 	if c.contract, ok = opts["ContractAddress"].(string); !ok {
 		c.contract = defaultContract
 	}
+	c.ds, _ = opts["Datastore"].(ds.Datastore)
+	c.pollInterval = poller.ParseInterval(opts["PollInterval"])
 
 	return err
 }
@@ -96,10 +112,13 @@ func (c *Contract) AddToken(amount int64) error {
 	return c.performTransaction(res)
 }
 
-func (c *Contract) ConfirmDownload() error {
-	// TODO refactor when this method will do anything useful
-	_, err := c.callContractMethod("confirmdownload")
-	return err
+// ConfirmDownload fails, as deployed contract does not accept receipts
+// yet and confirming download without them would lose them.
+func (c *Contract) ConfirmDownload(nodeID string, receipts []sc.DownloadReceipt) error {
+	if len(receipts) == 0 {
+		return nil
+	}
+	return sc.ErrReceiptsUnsupported
 }
 
 func (c *Contract) ConfirmUpdate(nodeID string, fileID string, size int64) error {
@@ -236,6 +255,11 @@ func (c *Contract) NotifyDelete(nodeID string, fileID string, size int64) error
 	return c.performTransaction(res)
 }
 
+func (c *Contract) CheckVerification(fileID string, nodeIDs []string, consensus [][]bool) error {
+	// TODO implement 'checkverification' in SC
+	return errNotImplemented
+}
+
 func (c *Contract) NotifySpaceFreed(nodeID string, fileID string, size int64) error {
 	res, err := c.callContractMethod("notifyspacefreed", nodeID, fileID, size)
 	if err != nil {
@@ -316,19 +340,12 @@ func (c *Contract) VerifyReplication(nodeID string) (bool, error) {
 	return false, err
 }
 
-func (c *Contract) SetOriginCode(nodeID, originCode string) error {
+func (c *Contract) GetOriginCode(nodeID string) (string, error) {
 	///TODO: implement on NEO
-	return errNotImplemented
-}
-
-func (c *Contract) SubscribeVerificationTarget(ctx context.Context, callback sc.VerificationTargetFunc) error {
-	return errNotImplemented
+	return "", errNotImplemented
 }
 
-func (c *Contract) SubscribeConsensusResult(ctx context.Context, callback sc.ConsensusResultFunc) error {
-	return errNotImplemented
-}
-
-func (c *Contract) SubscribeProviderCheck(ctx context.Context, callback sc.ProviderCheckFunc) error {
+func (c *Contract) SetOriginCode(nodeID, originCode string) error {
+	///TODO: implement on NEO
 	return errNotImplemented
 }
@@ -0,0 +1,157 @@
+// Package poller implements polling-based subscriptions to SC events.
+// Blockchain bindings provide functions which return current block number
+// and scan specified range of blocks for events, while poller keeps track
+// of the last scanned block and persists it in a datastore (if provided),
+// so that no events are lost between restarts.
+package poller
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+)
+
+var log = logging.Logger("sc/poller")
+
+const (
+	// DefaultInterval is used when zero interval is passed to Poll
+	DefaultInterval = 15 * time.Second
+	// MaxBlocksPerScan limits range of blocks scanned at once
+	MaxBlocksPerScan = 1000
+
+	cursorKeyPrefix = "/local/sc/cursor/"
+)
+
+// LatestFunc returns number of the latest block in chain.
+type LatestFunc = func(ctx context.Context) (uint64, error)
+
+// ScanFunc scans blocks in range [from; to] and invokes callbacks for found events.
+type ScanFunc = func(ctx context.Context, from, to uint64) error
+
+// Cursor stores number of the next block to be scanned.
+type Cursor struct {
+	mtx  sync.Mutex
+	ds   ds.Datastore
+	key  ds.Key
+	next uint64
+	set  bool
+}
+
+// NewCursor returns cursor with the specified name. If d is nil,
+// cursor is kept in memory only.
+func NewCursor(d ds.Datastore, name string) *Cursor {
+	return &Cursor{ds: d, key: ds.NewKey(cursorKeyPrefix + name)}
+}
+
+// Get returns number of the next block to scan and
+// false if cursor has never been set.
+func (c *Cursor) Get() (uint64, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.set || c.ds == nil {
+		return c.next, c.set
+	}
+
+	v, err := c.ds.Get(c.key)
+	if err != nil {
+		if err != ds.ErrNotFound {
+			log.Error(err)
+		}
+		return 0, false
+	}
+	b, ok := v.([]byte)
+	if !ok || len(b) != 8 {
+		log.Errorf("invalid cursor value stored at %s", c.key)
+		return 0, false
+	}
+
+	c.next, c.set = binary.BigEndian.Uint64(b), true
+	return c.next, true
+}
+
+// Set stores number of the next block to scan.
+func (c *Cursor) Set(next uint64) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.next, c.set = next, true
+	if c.ds == nil {
+		return nil
+	}
+
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, next)
+	return c.ds.Put(c.key, b)
+}
+
+// ParseInterval parses polling interval specified in SC options,
+// e.g. "PollInterval": "15s". Zero is returned if v is not a valid duration.
+func ParseInterval(v interface{}) time.Duration {
+	s, ok := v.(string)
+	if !ok {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		log.Warningf("invalid polling interval '%s': %v", s, err)
+		return 0
+	}
+	return d
+}
+
+// Poll scans new blocks every interval until ctx is done.
+// If cursor was never set, scanning starts from the latest block.
+// Errors are logged and failed range is scanned again on the next tick,
+// so callbacks can be invoked more than once for the same event.
+func Poll(ctx context.Context, interval time.Duration, cursor *Cursor, latest LatestFunc, scan ScanFunc) error {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := pollOnce(ctx, cursor, latest, scan); err != nil {
+			log.Errorf("error while polling events: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func pollOnce(ctx context.Context, cursor *Cursor, latest LatestFunc, scan ScanFunc) error {
+	head, err := latest(ctx)
+	if err != nil {
+		return err
+	}
+
+	from, ok := cursor.Get()
+	if !ok {
+		// do not replay the whole history on the first run
+		from = head
+	}
+
+	for from <= head {
+		to := head
+		if to-from >= MaxBlocksPerScan {
+			to = from + MaxBlocksPerScan - 1
+		}
+		if err = scan(ctx, from, to); err != nil {
+			return err
+		}
+		if err = cursor.Set(to + 1); err != nil {
+			return err
+		}
+		from = to + 1
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+)
+
+func TestCursorPersistence(t *testing.T) {
+	d := ds.NewMapDatastore()
+	c := NewCursor(d, "test")
+	if _, ok := c.Get(); ok {
+		t.Fatal("new cursor must not be set")
+	}
+	if err := c.Set(42); err != nil {
+		t.Fatal(err)
+	}
+
+	c2 := NewCursor(d, "test")
+	if next, ok := c2.Get(); !ok || next != 42 {
+		t.Fatalf("expected 42, got %d (set=%t)", next, ok)
+	}
+}
+
+func TestPollOnce(t *testing.T) {
+	ctx := context.Background()
+	head := uint64(10)
+	latest := func(context.Context) (uint64, error) { return head, nil }
+
+	type span struct{ from, to uint64 }
+	var scanned []span
+	scan := func(_ context.Context, from, to uint64) error {
+		scanned = append(scanned, span{from, to})
+		return nil
+	}
+
+	// first run starts from the head
+	c := NewCursor(nil, "test")
+	if err := pollOnce(ctx, c, latest, scan); err != nil {
+		t.Fatal(err)
+	}
+	if len(scanned) != 1 || scanned[0] != (span{10, 10}) {
+		t.Fatalf("unexpected scans: %v", scanned)
+	}
+
+	// long ranges are split
+	scanned = nil
+	head = 10 + MaxBlocksPerScan + 5
+	if err := pollOnce(ctx, c, latest, scan); err != nil {
+		t.Fatal(err)
+	}
+	if len(scanned) != 2 || scanned[0] != (span{11, 10 + MaxBlocksPerScan}) || scanned[1] != (span{11 + MaxBlocksPerScan, head}) {
+		t.Fatalf("unexpected scans: %v", scanned)
+	}
+
+	// failed range is scanned again
+	scanned = nil
+	head += 3
+	failing := func(context.Context, uint64, uint64) error { return errors.New("fail") }
+	if err := pollOnce(ctx, c, latest, failing); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := pollOnce(ctx, c, latest, scan); err != nil {
+		t.Fatal(err)
+	}
+	if len(scanned) != 1 || scanned[0] != (span{head - 2, head}) {
+		t.Fatalf("unexpected scans: %v", scanned)
+	}
+}
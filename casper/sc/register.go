@@ -2,7 +2,9 @@ package sc
 
 import (
 	"context"
+	"fmt"
 
+	mock "github.com/Casper-dev/Casper-server/casper/sc/mock"
 	multi "github.com/Casper-dev/Casper-server/casper/sc/multichain"
 	neo "github.com/Casper-dev/Casper-server/casper/sc/neo"
 	scin "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
@@ -16,34 +18,53 @@ var contracts = map[string]scin.CasperSC{
 	Ethereum: &sol.Contract{},
 	NEO:      &neo.Contract{},
 	Multi:    &multi.Contract{},
+	Mock:     &mock.Contract{},
 }
 
 var argsCache = make(map[string]scin.InitOpts, 2)
 
+// keySource gives private keys of wallets to contracts
+var keySource scin.KeySource
+
+// usedChain is the name of the chain which was last requested
+// by name; it is used by GetContract and GetContractContext.
+var usedChain = DefaultChain
+
 const (
 	Ethereum     = sol.ChainName
 	NEO          = neo.ChainName
 	Multi        = multi.ChainName
+	Mock         = mock.ChainName
 	DefaultChain = Ethereum
 )
 
+// SetKeySource sets the source of private keys which is passed
+// to contracts on initialization.
+func SetKeySource(ks scin.KeySource) {
+	keySource = ks
+}
+
 func GetContract(args ...interface{}) (scin.CasperSC, error) {
 	return GetContractContext(context.Background(), args...)
 }
 
 func GetContractContext(ctx context.Context, args ...interface{}) (scin.CasperSC, error) {
-	return GetContractByName(ctx, DefaultChain, args...)
+	return GetContractByName(ctx, usedChain, args...)
 }
 
 func GetContractByName(ctx context.Context, name string, args ...interface{}) (c scin.CasperSC, err error) {
 	log.Debugf("name=%s, args=%+v", name, args)
-	c = contracts[name]
+	c, ok := contracts[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown chain: %s", name)
+	}
+	usedChain = name
 	if len(args) > 0 {
 		argsCache[name] = args[0].(scin.InitOpts)
 	}
 	log.Debugf("sc already sinitialized: %t", c.Initialized())
 	if !c.Initialized() {
-		err = c.Init(ctx, argsCache[name])
+		err = c.Init(ctx, withKeys(argsCache[name]))
 		if err != nil {
 			log.Errorf("error while initializing SC: %v", err)
 		}
@@ -51,3 +72,16 @@ func GetContractByName(ctx context.Context, name string, args ...interface{}) (c
 
 	return c, err
 }
+
+// withKeys returns copy of opts with key source set.
+func withKeys(opts scin.InitOpts) scin.InitOpts {
+	if keySource == nil {
+		return opts
+	}
+	ret := make(scin.InitOpts, len(opts)+1)
+	for k, v := range opts {
+		ret[k] = v
+	}
+	ret[scin.KeysOption] = keySource
+	return ret
+}
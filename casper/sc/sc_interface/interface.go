@@ -1,6 +1,13 @@
 package sc_interface
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+// ErrReceiptsUnsupported is returned by ConfirmDownload if deployed
+// contract does not accept receipts, they must be kept until it does.
+var ErrReceiptsUnsupported = errors.New("SC does not accept download receipts")
 
 // Events which can be handled asynchronously
 // TODO probably will be removed
@@ -10,6 +17,22 @@ type ProviderCheckFunc = func()
 
 type InitOpts = map[string]interface{}
 
+// DownloadReceipt is signed by client to acknowledge that it has received
+// Bytes of file FileID, which was paid with Wallet, from the provider.
+// Signature of Payload is made with the key PubKey, which is the libp2p
+// identity of Client. WalletSignature of WalletPayload of Wallet and Client
+// is made with the key of Wallet.
+type DownloadReceipt struct {
+	Client          string
+	Wallet          string
+	WalletSignature []byte
+	FileID          string
+	Bytes           int64
+	Payload         []byte
+	PubKey          []byte
+	Signature       []byte
+}
+
 // CasperSC interface must be implemented by every
 // binding to blockchain.
 // For example, see solidity binding in sc_solidity.go
@@ -31,10 +54,14 @@ type CasperSC interface {
 	// TODO remove when deploy
 	AddToken(amount int64) error
 
-	// ConfirmDownload can be invoked by client after he/she has
-	// successfully downloaded the file?
-	// TODO what is the purpose of this function?
-	ConfirmDownload() error
+	// CheckVerification is invoked by verification initiator to report
+	// results of storage proof validation of file with specified id.
+	// consensus[i][j] is true if node i agrees with checksum reported by node j.
+	CheckVerification(fileID string, nodeIDs []string, consensus [][]bool) error
+
+	// ConfirmDownload is invoked by provider to get paid for the traffic
+	// acknowledged by clients with receipts. Receipts are sent in batches.
+	ConfirmDownload(nodeID string, receipts []DownloadReceipt) error
 
 	// ConfirmUpdate is invoked by provider after it has successfully
 	// updated file with specified id
@@ -47,6 +74,9 @@ type CasperSC interface {
 	// GetAPIAddr
 	GetAPIAddr(nodeID string) (string, error)
 
+	// GetOriginCode returns geo location code set by SetOriginCode
+	GetOriginCode(nodeID string) (string, error)
+
 	// GetFile
 	GetFile(nodeID string, number int64) (string, int64, error)
 
@@ -106,6 +136,31 @@ type CasperSC interface {
 	VerifyReplication(nodeID string) (bool, error)
 
 	SubscribeVerificationTarget(ctx context.Context, callback VerificationTargetFunc) error
+	// SubscribeConsensusResult invokes callback with IDs of nodes which store
+	// bad copy of the file (in the format of HashToBytes; unused entries are zeroed).
 	SubscribeConsensusResult(ctx context.Context, callback ConsensusResultFunc) error
 	SubscribeProviderCheck(ctx context.Context, callback ProviderCheckFunc) error
 }
+
+// OriginCodesSC is an optional extension of CasperSC which is implemented
+// by bindings which can read origin codes of many providers with one call.
+type OriginCodesSC interface {
+	// GetOriginCodes returns origin codes of nodeIDs, unknown nodes are left out.
+	GetOriginCodes(nodeIDs []string) (map[string]string, error)
+}
+
+// OriginCodes returns origin codes of nodeIDs with a single call if c
+// supports it, otherwise they are requested one by one and nodes which
+// origin can't be read are left out.
+func OriginCodes(c CasperSC, nodeIDs []string) (map[string]string, error) {
+	if oc, ok := c.(OriginCodesSC); ok {
+		return oc.GetOriginCodes(nodeIDs)
+	}
+	codes := make(map[string]string, len(nodeIDs))
+	for _, id := range nodeIDs {
+		if code, err := c.GetOriginCode(id); err == nil {
+			codes[id] = code
+		}
+	}
+	return codes, nil
+}
@@ -0,0 +1,31 @@
+package sc_interface
+
+import "errors"
+
+// KeysOption is the option of InitOpts with KeySource.
+const KeysOption = "Keys"
+
+// ErrNoKey is returned when there is no wallet for the chain.
+var ErrNoKey = errors.New("no wallet for the chain, create one with 'ipfs wallet new' or 'ipfs wallet import'")
+
+// KeySource gives private key of the wallet used on chain in the format
+// of that chain, e.g. hex for ETH and WIF for NEO.
+type KeySource interface {
+	PrivateKey(chain string) (string, error)
+}
+
+// ChainKey returns private key of chain from KeySource in opts. Keys
+// kept in config in plain text in option legacy are still accepted,
+// plain reports if such key was returned.
+func ChainKey(opts InitOpts, chain, legacy string) (key string, plain bool, err error) {
+	if ks, ok := opts[KeysOption].(KeySource); ok {
+		key, err = ks.PrivateKey(chain)
+		if err != ErrNoKey {
+			return key, false, err
+		}
+	}
+	if key, ok := opts[legacy].(string); ok && key != "" {
+		return key, true, nil
+	}
+	return "", false, ErrNoKey
+}
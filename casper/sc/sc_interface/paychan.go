@@ -0,0 +1,78 @@
+package sc_interface
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrNoPaymentChannels is returned by PaymentChannels if binding
+// does not support payment channels.
+var ErrNoPaymentChannels = errors.New("SC does not support payment channels")
+
+// ChannelInfo is the state of unidirectional payment channel in SC.
+// Tokens locked by Payer can be claimed by Payee with vouchers signed
+// by Signer until Expires (unix time), after which Payer can take back
+// what was not claimed.
+type ChannelInfo struct {
+	ID    string
+	Payer string
+	// Signer is the public key which signs vouchers,
+	// it is the libp2p identity of the client
+	Signer   []byte
+	Payee    string
+	Capacity int64
+	// Claimed is the amount already paid out to Payee
+	Claimed int64
+	Expires int64
+	Closed  bool
+}
+
+// PaymentVoucher lets payee claim Amount from the channel. Amounts are
+// cumulative, so only the latest voucher is settled. Signature is made
+// by the signer of the channel over VoucherPayload.
+type PaymentVoucher struct {
+	ChannelID string
+	Amount    int64
+	Signature []byte
+}
+
+// VoucherPayload returns message which is signed by vouchers.
+func VoucherPayload(channelID string, amount int64) []byte {
+	return []byte("casper voucher:" + channelID + ":" + strconv.FormatInt(amount, 10))
+}
+
+// PaymentChannelSC is an optional extension of CasperSC which is
+// implemented by bindings supporting payment channels. Vouchers are
+// exchanged off-chain, so that only opening and settlement of the
+// channel are transactions. Only Mock implements it: contracts deployed
+// to ETH and NEO have no channels yet, their bindings will implement it
+// once they are deployed.
+type PaymentChannelSC interface {
+	// OpenChannel is invoked by client to lock amount of tokens of its
+	// wallet for payee until expires. It returns ID of the channel.
+	OpenChannel(payee string, signer []byte, amount int64, expires int64) (string, error)
+
+	// GetChannel returns current state of the channel.
+	GetChannel(channelID string) (ChannelInfo, error)
+
+	// SettleChannel is invoked by payee to claim the amount of voucher
+	// which exceeds already claimed one. Channel remains open.
+	SettleChannel(channelID string, v PaymentVoucher) error
+
+	// CloseChannel is invoked by payee to settle the final voucher
+	// and return the rest of the tokens to payer.
+	CloseChannel(channelID string, v PaymentVoucher) error
+
+	// ReclaimChannel is invoked by payer after the channel has expired
+	// to take back tokens which were not claimed.
+	ReclaimChannel(channelID string) error
+}
+
+// PaymentChannels returns payment channel extension of c.
+func PaymentChannels(c CasperSC) (PaymentChannelSC, error) {
+	pc, ok := c.(PaymentChannelSC)
+	if !ok {
+		return nil, ErrNoPaymentChannels
+	}
+	return pc, nil
+}
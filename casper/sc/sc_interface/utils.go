@@ -0,0 +1,33 @@
+package sc_interface
+
+import (
+	"errors"
+
+	b58 "gx/ipfs/QmT8rehPR3F6bmwL6zjUN8XpiDBFFpMP2myPdC6ApsWfJf/go-base58"
+	mh "gx/ipfs/QmU9a9NV9RdPNwZQDYd5uKsm6N6LJLSvLbywDDYFbaaC6P/go-multihash"
+)
+
+// HashToBytes converts base58-encoded node ID to the format
+// in which node IDs are passed in SC events.
+func HashToBytes(nodeID string) (bs [32]byte, err error) {
+	dh, err := mh.Decode(b58.Decode(nodeID))
+	if err != nil {
+		return bs, err
+	} else if dh.Code != mh.SHA2_256 {
+		return bs, errors.New("invalid multihash (expected SHA2_256)")
+	}
+
+	// SHA2_256 digest has exactly 32 bytes in it
+	copy(bs[:], dh.Digest[:])
+	return bs, nil
+}
+
+// BytesToHash is the inverse of HashToBytes.
+func BytesToHash(id [32]byte) (string, error) {
+	raw, _ := mh.Encode(id[:], mh.SHA2_256)
+	mh, err := mh.Cast(raw)
+	if err != nil {
+		return "", err
+	}
+	return mh.B58String(), nil
+}
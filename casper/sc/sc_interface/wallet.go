@@ -0,0 +1,88 @@
+package sc_interface
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrNoWalletProofs is returned by WalletProofs if binding
+	// can't sign with the key of the wallet.
+	ErrNoWalletProofs = errors.New("SC does not support wallet proofs")
+	// ErrWrongWallet is returned if proof is not signed by the key of the wallet.
+	ErrWrongWallet = errors.New("wallet proof is not signed by the wallet")
+	// ErrNoWalletProof is returned by ParseWalletProof if there is no signature.
+	ErrNoWalletProof = errors.New("wallet proof is required")
+)
+
+// WalletPayload returns message which is signed with the key of wallet
+// to let peer with libp2p identity peerID pay with it.
+func WalletPayload(wallet, peerID string) []byte {
+	return []byte("casper wallet:" + wallet + ":" + peerID)
+}
+
+// WalletProofSC is an optional extension of CasperSC which is
+// implemented by bindings which can prove ownership of their wallet.
+// Clients present such proofs to providers along with the wallet, which
+// pays for their downloads.
+type WalletProofSC interface {
+	// SignWallet signs payload with the key of the wallet returned by GetWallet.
+	SignWallet(payload []byte) ([]byte, error)
+
+	// VerifyWallet checks that sig of payload is made with the key of wallet.
+	VerifyWallet(wallet string, payload, sig []byte) error
+}
+
+// WalletProofs returns wallet proof extension of c.
+func WalletProofs(c CasperSC) (WalletProofSC, error) {
+	wp, ok := c.(WalletProofSC)
+	if !ok {
+		return nil, ErrNoWalletProofs
+	}
+	return wp, nil
+}
+
+// SignWalletProof returns wallet of c with the proof that peerID may pay
+// with it. Proof is encoded as "<wallet>:<hex signature>".
+func SignWalletProof(c CasperSC, peerID string) (string, error) {
+	wp, err := WalletProofs(c)
+	if err != nil {
+		return "", err
+	}
+	wallet := c.GetWallet()
+	sig, err := wp.SignWallet(WalletPayload(wallet, peerID))
+	if err != nil {
+		return "", err
+	}
+	return wallet + ":" + hex.EncodeToString(sig), nil
+}
+
+// ParseWalletProof splits proof made by SignWalletProof.
+func ParseWalletProof(proof string) (wallet string, sig []byte, err error) {
+	i := strings.LastIndex(proof, ":")
+	if i < 0 {
+		return "", nil, ErrNoWalletProof
+	}
+	if sig, err = hex.DecodeString(proof[i+1:]); err != nil {
+		return "", nil, err
+	}
+	return proof[:i], sig, nil
+}
+
+// VerifyWalletProof checks that proof lets peerID pay with its wallet,
+// which is returned.
+func VerifyWalletProof(c CasperSC, proof, peerID string) (string, error) {
+	wp, err := WalletProofs(c)
+	if err != nil {
+		return "", err
+	}
+	wallet, sig, err := ParseWalletProof(proof)
+	if err != nil {
+		return "", err
+	}
+	if err = wp.VerifyWallet(wallet, WalletPayload(wallet, peerID), sig); err != nil {
+		return "", err
+	}
+	return wallet, nil
+}
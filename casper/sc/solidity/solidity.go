@@ -2,55 +2,165 @@ package solidity
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"errors"
+	"fmt"
 	"math/big"
 	"strings"
 	"time"
 
+	"github.com/Casper-dev/Casper-server/casper/sc/poller"
 	sc "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+	"github.com/Casper-dev/Casper-server/casper/sc/txmgr"
 
 	"github.com/Casper-dev/Casper-SC/casper"
 	"github.com/Casper-dev/Casper-SC/casper_sc"
 
-	b58 "gx/ipfs/QmT8rehPR3F6bmwL6zjUN8XpiDBFFpMP2myPdC6ApsWfJf/go-base58"
-	mh "gx/ipfs/QmU9a9NV9RdPNwZQDYd5uKsm6N6LJLSvLbywDDYFbaaC6P/go-multihash"
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
 
-	"github.com/davecgh/go-spew/spew"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
 // ChainName is used in config
 const ChainName = "ETH"
 
+var log = logging.Logger("sc/solidity")
+
 // Type assertions
 var _ sc.CasperSC = &Contract{}
+var _ sc.WalletProofSC = &Contract{}
+var _ sc.OriginCodesSC = &Contract{}
 
 type Contract struct {
 	casper *casper.Casper
 	eth    *ethclient.Client
 	auth   *bind.TransactOpts
-}
-
+	tx     *txmgr.Manager
+	// key of the wallet signs wallet proofs
+	key *ecdsa.PrivateKey
+
+	// ds is used to persist positions of event subscriptions
+	ds           ds.Datastore
+	pollInterval time.Duration
+}
+
+// Init accepts the following options:
+//   - "Gateway" (string) is URL of ETH node
+//   - "ContractAddress" (string) overrides address of deployed contract
+//   - "PrivateKey" (string) is deprecated, key is read from wallet
+//   - "Datastore" (ds.Datastore) to persist subscriptions and pending transactions
+//   - "PollInterval" (duration) of event subscriptions
+//   - "GasPrice" and "MaxGasPrice" (wei) of transactions; node suggests price by default
+//   - "GasBumpPercent" (number) is how much price of stuck transaction is raised
+//   - "StuckAfter" (duration) is how long transaction is waited for before bump
+//   - "Confirmations" (number) of blocks after which transaction is final
+//   - "TxPollInterval" (duration) of checks of transaction receipts
+//   - "BatchWindow" (duration) in which notifications are collected
 func (c *Contract) Init(ctx context.Context, opts sc.InitOpts) (err error) {
 	var gateway, privkey string
 	var ok bool
 	if gateway, ok = opts["Gateway"].(string); !ok {
 		return errors.New("must provide gateway")
 	}
-	if privkey, ok = opts["PrivateKey"].(string); !ok {
-		return errors.New("must provide privatekey")
+	privkey, plain, err := sc.ChainKey(opts, ChainName, "PrivateKey")
+	if err != nil {
+		return err
+	}
+	if plain {
+		log.Warning("private key is read from config, move it to wallet with 'ipfs wallet import' and remove it from config")
+	}
+
+	if c.key, err = crypto.HexToECDSA(strings.TrimPrefix(privkey, "0x")); err != nil {
+		return err
 	}
 
 	iopts := &Casper_SC.InitOpts{Gateway: gateway, PrivateKey: privkey}
 	if addr, ok := opts["ContractAddress"].(string); ok {
 		iopts.ContractAddress = addr
 	}
-	spew.Dump(opts)
+	c.ds, _ = opts["Datastore"].(ds.Datastore)
+	c.pollInterval = poller.ParseInterval(opts["PollInterval"])
 	c.casper, c.eth, c.auth, err = Casper_SC.InitSC(ctx, iopts)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// Init is called again whenever contract is requested and not
+	// initialized, but nonces of the account must be tracked by
+	// a single manager
+	if c.tx != nil && c.tx.From() == c.auth.From {
+		return nil
+	}
+	c.tx = txmgr.New(c.eth, c.auth, c.ds, txConfig(opts))
+	if err = c.tx.Resume(ctx); err != nil {
+		log.Errorf("resuming pending transactions: %v", err)
+	}
+	return nil
+}
+
+// txConfig parses options of transaction manager.
+func txConfig(opts sc.InitOpts) txmgr.Config {
+	return txmgr.Config{
+		GasPrice:      weiOpt(opts["GasPrice"]),
+		MaxGasPrice:   weiOpt(opts["MaxGasPrice"]),
+		BumpPercent:   int(intOpt(opts["GasBumpPercent"])),
+		StuckAfter:    poller.ParseInterval(opts["StuckAfter"]),
+		Confirmations: uint64(intOpt(opts["Confirmations"])),
+		PollInterval:  poller.ParseInterval(opts["TxPollInterval"]),
+		BatchWindow:   poller.ParseInterval(opts["BatchWindow"]),
+	}
+}
+
+func intOpt(v interface{}) int64 {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case float64: // value is read from JSON config
+		return int64(v)
+	}
+	return 0
+}
+
+// weiOpt parses amount of wei, which is usually written as string,
+// because it does not fit into JSON number.
+func weiOpt(v interface{}) *big.Int {
+	switch v := v.(type) {
+	case string:
+		if n, ok := new(big.Int).SetString(v, 10); ok && n.Sign() > 0 {
+			return n
+		}
+		log.Warningf("invalid amount of wei: '%s'", v)
+	case int, float64:
+		if n := intOpt(v); n > 0 {
+			return big.NewInt(n)
+		}
+	}
+	return nil
+}
+
+// transact sends transaction and waits until it is confirmed.
+// Data of its logs is returned.
+func (c *Contract) transact(name string, fn txmgr.TxFunc) (string, error) {
+	r, err := c.tx.Transact(context.Background(), name, fn)
+	if r == nil {
+		return "", err
+	}
+	var data string
+	for _, l := range r.Logs {
+		data += string(l.Data)
+	}
+	return data, err
+}
+
+// notify sends idempotent call, which is coalesced with the calls of
+// the same method with the same key queued before it is sent.
+func (c *Contract) notify(name, key string, fn txmgr.TxFunc) error {
+	return c.tx.Notify(context.Background(), name, name+"/"+key, fn)
 }
 
 func (c *Contract) Initialized() bool {
@@ -61,34 +171,60 @@ func (c *Contract) GetWallet() string {
 	return c.auth.From.String()
 }
 
-func (c *Contract) AddToken(amount int64) error {
-	_, err := Casper_SC.ValidateMineTX(func() (*types.Transaction, error) {
-		return c.casper.AddToken(c.auth, big.NewInt(amount))
-	}, c.eth)
+// walletHash returns hash of payload signed as personal message,
+// so that proofs can be made by usual ETH wallets too.
+func walletHash(payload []byte) []byte {
+	prefix := fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(payload))
+	return crypto.Keccak256([]byte(prefix), payload)
+}
 
-	return err
+func (c *Contract) SignWallet(payload []byte) ([]byte, error) {
+	return crypto.Sign(walletHash(payload), c.key)
+}
+
+func (c *Contract) VerifyWallet(wallet string, payload, sig []byte) error {
+	if !common.IsHexAddress(wallet) {
+		return fmt.Errorf("invalid wallet %s", wallet)
+	}
+	pub, err := crypto.SigToPub(walletHash(payload), sig)
+	if err != nil {
+		return err
+	}
+	if crypto.PubkeyToAddress(*pub) != common.HexToAddress(wallet) {
+		return sc.ErrWrongWallet
+	}
+	return nil
 }
 
-func (c *Contract) ConfirmDownload() error {
-	_, err := Casper_SC.ValidateMineTX(func() (tx *types.Transaction, err error) {
-		return c.casper.ConfirmDownload(c.auth)
-	}, c.eth)
+func (c *Contract) AddToken(amount int64) error {
+	_, err := c.transact("AddToken", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.casper.AddToken(opts, big.NewInt(amount))
+	})
 
 	return err
 }
 
+// ConfirmDownload fails, as deployed contract does not accept receipts
+// yet and confirming download without them would lose them.
+func (c *Contract) ConfirmDownload(nodeID string, receipts []sc.DownloadReceipt) error {
+	if len(receipts) == 0 {
+		return nil
+	}
+	return sc.ErrReceiptsUnsupported
+}
+
 func (c *Contract) ConfirmUpdate(nodeID string, fileID string, size int64) error {
-	_, err := Casper_SC.ValidateMineTX(func() (tx *types.Transaction, err error) {
-		return c.casper.ConfirmUpdate(c.auth, nodeID, fileID, big.NewInt(size))
-	}, c.eth)
+	_, err := c.transact("ConfirmUpdate", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.casper.ConfirmUpdate(opts, nodeID, fileID, big.NewInt(size))
+	})
 
 	return err
 }
 
 func (c *Contract) ConfirmUpload(nodeID string, fileID string, size int64) error {
-	_, err := Casper_SC.ValidateMineTX(func() (tx *types.Transaction, err error) {
-		return c.casper.ConfirmUpload(c.auth, nodeID, fileID, big.NewInt(size))
-	}, c.eth)
+	_, err := c.transact("ConfirmUpload", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.casper.ConfirmUpload(opts, nodeID, fileID, big.NewInt(size))
+	})
 
 	return err
 }
@@ -152,23 +288,48 @@ func (c *Contract) NotifyDelete(string, string, int64) error {
 	return nil
 }
 
+func (c *Contract) CheckVerification(fileID string, nodeIDs []string, consensus [][]bool) error {
+	var ids [4][32]byte
+	var flat [16]bool
+	for i := 0; i < len(nodeIDs) && i < len(ids); i++ {
+		id, err := sc.HashToBytes(nodeIDs[i])
+		if err != nil {
+			return err
+		}
+		ids[i] = id
+		for j := 0; j < len(consensus[i]) && j < len(ids); j++ {
+			flat[i*len(ids)+j] = consensus[i][j]
+		}
+	}
+
+	_, err := c.transact("CheckVerification", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.casper.CheckVerification(opts, fileID, flat, ids)
+	})
+
+	return err
+}
+
 func (c *Contract) NotifySpaceFreed(nodeID string, fileID string, size int64) error {
-	_, err := Casper_SC.ValidateMineTX(func() (tx *types.Transaction, err error) {
-		return c.casper.NotifySpaceFreed(c.auth, nodeID, fileID, big.NewInt(size))
-	}, c.eth)
+	_, err := c.transact("NotifySpaceFreed", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.casper.NotifySpaceFreed(opts, nodeID, fileID, big.NewInt(size))
+	})
 
 	return err
 }
 
 func (c *Contract) NotifyVerificationTarget(nodeID string, fileID string) error {
-	_, err := c.casper.NotifyVerificationTarget(c.auth, fileID, nodeID)
+	// validation round starts right after the notification,
+	// so it is not waited for
+	_, err := c.tx.Send(context.Background(), "NotifyVerificationTarget", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.casper.NotifyVerificationTarget(opts, fileID, nodeID)
+	})
 	return err
 }
 
 func (c *Contract) PrePay(amount int64) error {
-	_, err := Casper_SC.ValidateMineTX(func() (*types.Transaction, error) {
-		return c.casper.PrePay(c.auth, big.NewInt(amount))
-	}, c.eth)
+	_, err := c.transact("PrePay", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.casper.PrePay(opts, big.NewInt(amount))
+	})
 
 	return err
 }
@@ -176,35 +337,72 @@ func (c *Contract) PrePay(amount int64) error {
 func (c *Contract) RegisterProvider(nodeID string, telegram string, ipAddr string, thriftAddr string, size int64) error {
 	var telegramBytes [32]byte
 	copy(telegramBytes[:], telegram)
-	_, err := Casper_SC.ValidateMineTX(func() (*types.Transaction, error) {
-		return c.casper.RegisterProvider(c.auth, nodeID, telegramBytes, ipAddr, thriftAddr, big.NewInt(size))
-	}, c.eth)
+	_, err := c.transact("RegisterProvider", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.casper.RegisterProvider(opts, nodeID, telegramBytes, ipAddr, thriftAddr, big.NewInt(size))
+	})
 
 	return err
 }
 
+func (c *Contract) GetOriginCode(nodeID string) (string, error) {
+	codes, err := c.GetOriginCodes([]string{nodeID})
+	if err != nil {
+		return "", err
+	}
+	code, ok := codes[nodeID]
+	if !ok {
+		return "", errors.New("unknown provider: " + nodeID)
+	}
+	return code, nil
+}
+
+// GetOriginCodes reads list of all peers once, as contract has no call
+// which returns origin of a single peer.
+func (c *Contract) GetOriginCodes(nodeIDs []string) (map[string]string, error) {
+	ids, _, _, codes, err := c.casper.GetAllPeers(nil)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[[32]byte]string, len(ids))
+	for i := range ids {
+		if i < len(codes) {
+			byID[ids[i]] = strings.TrimRight(string(codes[i][:]), "\x00")
+		}
+	}
+
+	origins := make(map[string]string, len(nodeIDs))
+	for _, nodeID := range nodeIDs {
+		id, err := sc.HashToBytes(nodeID)
+		if err != nil {
+			return nil, err
+		}
+		if code, ok := byID[id]; ok {
+			origins[nodeID] = code
+		}
+	}
+	return origins, nil
+}
+
 func (c *Contract) SetOriginCode(nodeID, originCode string) error {
 	var originCode2 [4]byte
 	copy(originCode2[:], []byte(originCode))
-	_, err := Casper_SC.ValidateMineTX(func() (*types.Transaction, error) {
-		return c.casper.SetCountryCode(c.auth, nodeID, originCode2)
-	}, c.eth)
-
-	return err
+	return c.notify("SetCountryCode", nodeID, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.casper.SetCountryCode(opts, nodeID, originCode2)
+	})
 }
 
 func (c *Contract) RemoveProviderMachine(nodeID string) error {
-	_, err := Casper_SC.ValidateMineTX(func() (tx *types.Transaction, err error) {
-		return c.casper.RemoveProviderMachine(c.auth, nodeID)
-	}, c.eth)
+	_, err := c.transact("RemoveProviderMachine", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.casper.RemoveProviderMachine(opts, nodeID)
+	})
 
 	return err
 }
 
 func (c *Contract) SendPingResult(nodeID string, success bool) (bool, error) {
-	result, err := Casper_SC.ValidateMineTX(func() (tx *types.Transaction, err error) {
-		return c.casper.SendPingResult(c.auth, nodeID, success)
-	}, c.eth)
+	result, err := c.transact("SendPingResult", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.casper.SendPingResult(opts, nodeID, success)
+	})
 
 	return strings.Contains(result, "Banned!"), err
 }
@@ -218,19 +416,15 @@ func (c *Contract) ShowStoringPeers(fileID string) ([]string, error) {
 }
 
 func (c *Contract) SetAPIAddr(nodeID string, addr string) error {
-	_, err := Casper_SC.ValidateMineTX(func() (*types.Transaction, error) {
-		return c.casper.SetAPIAddr(c.auth, nodeID, addr)
-	}, c.eth)
-
-	return err
+	return c.notify("SetAPIAddr", nodeID, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.casper.SetAPIAddr(opts, nodeID, addr)
+	})
 }
 
 func (c *Contract) SetRPCAddr(nodeID string, addr string) error {
-	_, err := Casper_SC.ValidateMineTX(func() (*types.Transaction, error) {
-		return c.casper.SetRPCAddr(c.auth, nodeID, addr)
-	}, c.eth)
-
-	return err
+	return c.notify("SetRPCAddr", nodeID, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.casper.SetRPCAddr(opts, nodeID, addr)
+	})
 }
 
 func (c *Contract) VerifyReplication(nodeID string) (bool, error) {
@@ -238,41 +432,58 @@ func (c *Contract) VerifyReplication(nodeID string) (bool, error) {
 }
 
 func (c *Contract) SubscribeVerificationTarget(ctx context.Context, callback sc.VerificationTargetFunc) error {
-	return Casper_SC.SubscribeToReplicationLogs(ctx, func(log *casper.CasperVerificationTarget) {
-		callback(log.UUID, log.Id)
+	return c.poll(ctx, "VerificationTarget", func(opts *bind.FilterOpts) error {
+		it, err := c.casper.FilterVerificationTarget(opts)
+		if err != nil {
+			return err
+		}
+		defer it.Close()
+		for it.Next() {
+			callback(it.Event.UUID, it.Event.Id)
+		}
+		return it.Error()
 	})
 }
 
 func (c *Contract) SubscribeConsensusResult(ctx context.Context, callback sc.ConsensusResultFunc) error {
-	return Casper_SC.SubscribeToConsensusLogs(ctx, func(log *casper.CasperConsensusResult) {
-		callback(log.UUID, log.Consensus)
+	return c.poll(ctx, "ConsensusResult", func(opts *bind.FilterOpts) error {
+		it, err := c.casper.FilterConsensusResult(opts)
+		if err != nil {
+			return err
+		}
+		defer it.Close()
+		for it.Next() {
+			callback(it.Event.UUID, it.Event.Consensus)
+		}
+		return it.Error()
 	})
 }
 
 func (c *Contract) SubscribeProviderCheck(ctx context.Context, callback sc.ProviderCheckFunc) error {
-	return Casper_SC.SubscribeToProvidersCheckLogs(ctx, func(log *casper.CasperProviderCheckEvent) {
-		callback()
+	return c.poll(ctx, "ProviderCheck", func(opts *bind.FilterOpts) error {
+		it, err := c.casper.FilterProviderCheckEvent(opts)
+		if err != nil {
+			return err
+		}
+		defer it.Close()
+		for it.Next() {
+			callback()
+		}
+		return it.Error()
 	})
 }
 
-func hashToBytes(nodeID string) (bs [32]byte, err error) {
-	dh, err := mh.Decode(b58.Decode(nodeID))
-	if err != nil {
-		return bs, err
-	} else if dh.Code != mh.SHA2_256 {
-		return bs, errors.New("invalid multihash (expected SHA2_256)")
-	}
-
-	// SHA2_256 digest has exactly 32 bytes in it
-	copy(bs[:], dh.Digest[:])
-	return bs, nil
-}
-
-func bytesToHash(id [32]byte) (string, error) {
-	raw, _ := mh.Encode(id[:], mh.SHA2_256)
-	mh, err := mh.Cast(raw)
-	if err != nil {
-		return "", err
+// poll scans new blocks for events using log filters.
+func (c *Contract) poll(ctx context.Context, event string, filter func(opts *bind.FilterOpts) error) error {
+	cursor := poller.NewCursor(c.ds, ChainName+"/"+event)
+	latest := func(ctx context.Context) (uint64, error) {
+		h, err := c.eth.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return 0, err
+		}
+		return h.Number.Uint64(), nil
 	}
-	return mh.B58String(), nil
+	return poller.Poll(ctx, c.pollInterval, cursor, latest, func(ctx context.Context, from, to uint64) error {
+		return filter(&bind.FilterOpts{Start: from, End: &to, Context: ctx})
+	})
 }
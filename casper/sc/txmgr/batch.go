@@ -0,0 +1,71 @@
+package txmgr
+
+import (
+	"context"
+	"time"
+)
+
+// notification is a queued idempotent call. Callers which
+// queued the same key share the result of a single transaction.
+type notification struct {
+	name string
+	fn   TxFunc
+	done chan struct{}
+	err  error
+}
+
+type batch struct {
+	keys  []string
+	queue map[string]*notification
+}
+
+// Notify queues idempotent call, like setting an address, and waits
+// until it is confirmed. Calls queued within BatchWindow are sent
+// together, and only the latest of the calls with the same key is sent.
+func (m *Manager) Notify(ctx context.Context, name, key string, fn TxFunc) error {
+	m.batchMtx.Lock()
+	if m.batch == nil {
+		m.batch = &batch{queue: make(map[string]*notification)}
+		time.AfterFunc(m.cfg.BatchWindow, m.flush)
+	}
+	n, ok := m.batch.queue[key]
+	if !ok {
+		n = &notification{done: make(chan struct{})}
+		m.batch.queue[key] = n
+		m.batch.keys = append(m.batch.keys, key)
+	}
+	n.name, n.fn = name, fn
+	m.batchMtx.Unlock()
+
+	select {
+	case <-n.done:
+		return n.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush sends queued notifications in order of their keys
+// and waits for them concurrently.
+func (m *Manager) flush() {
+	m.batchMtx.Lock()
+	b := m.batch
+	m.batch = nil
+	m.batchMtx.Unlock()
+
+	ctx := context.Background()
+	log.Debugf("sending %d notifications", len(b.keys))
+	for _, key := range b.keys {
+		n := b.queue[key]
+		tx, err := m.Send(ctx, n.name, n.fn)
+		if err != nil {
+			n.err = err
+			close(n.done)
+			continue
+		}
+		go func(n *notification, tx *Tx) {
+			_, n.err = tx.Wait(ctx)
+			close(n.done)
+		}(n, tx)
+	}
+}
@@ -0,0 +1,121 @@
+package txmgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	"gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+)
+
+const journalKeyPrefix = "/local/txmgr/"
+
+// Entry is a transaction which was sent but is not confirmed yet.
+// Every bump replaces the transaction with the one of the same nonce,
+// so all of them are kept in Hashes, because any can be mined.
+type Entry struct {
+	// Name is the contract method, it is used in logs
+	Name     string
+	Nonce    uint64
+	GasPrice *big.Int
+	// Hashes of all sent versions, the latest is the last
+	Hashes []common.Hash
+	// Raw is RLP encoding of the latest version
+	Raw     []byte
+	Created time.Time
+	// Sent is the time of the latest broadcast
+	Sent time.Time
+}
+
+func newEntry(name string, tx *types.Transaction, now time.Time) (*Entry, error) {
+	e := &Entry{Name: name, Nonce: tx.Nonce(), Created: now}
+	return e, e.setTx(tx, now)
+}
+
+// Tx decodes the latest version of the transaction.
+func (e *Entry) Tx() (*types.Transaction, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(e.Raw, tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (e *Entry) setTx(tx *types.Transaction, now time.Time) error {
+	raw, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		return err
+	}
+	e.Raw = raw
+	e.GasPrice = tx.GasPrice()
+	e.Hashes = append(e.Hashes, tx.Hash())
+	e.Sent = now
+	return nil
+}
+
+// journal persists entries of one account, so that they are tracked
+// and their nonces are not reused after restart.
+type journal struct {
+	ds     ds.Datastore
+	prefix string
+}
+
+func newJournal(d ds.Datastore, from common.Address) *journal {
+	return &journal{ds: d, prefix: journalKeyPrefix + from.Hex() + "/"}
+}
+
+func (j *journal) key(nonce uint64) ds.Key {
+	return ds.NewKey(fmt.Sprintf("%s%020d", j.prefix, nonce))
+}
+
+func (j *journal) put(e *Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return j.ds.Put(j.key(e.Nonce), b)
+}
+
+func (j *journal) remove(nonce uint64) error {
+	err := j.ds.Delete(j.key(nonce))
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// list returns all entries ordered by nonce.
+func (j *journal) list() ([]*Entry, error) {
+	res, err := j.ds.Query(query.Query{Prefix: j.prefix})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var entries []*Entry
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		b, ok := r.Value.([]byte)
+		if !ok {
+			log.Errorf("invalid journal entry at %s", r.Key)
+			continue
+		}
+		e := new(Entry)
+		if err := json.Unmarshal(b, e); err != nil {
+			log.Errorf("invalid journal entry at %s: %v", r.Key, err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, k int) bool { return entries[i].Nonce < entries[k].Nonce })
+	return entries, nil
+}
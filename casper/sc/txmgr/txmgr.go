@@ -0,0 +1,457 @@
+// Package txmgr sends transactions of the ETH binding. Nonces are
+// assigned locally, so that concurrent calls do not collide, and every
+// sent transaction is kept in a journal until it has enough
+// confirmations. Transactions which are not mined for a while are
+// replaced with the same ones with a higher gas price.
+package txmgr
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+)
+
+var log = logging.Logger("sc/txmgr")
+
+const (
+	DefaultBumpPercent   = 10
+	DefaultStuckAfter    = 3 * time.Minute
+	DefaultConfirmations = 1
+	DefaultPollInterval  = 5 * time.Second
+	DefaultBatchWindow   = 2 * time.Second
+)
+
+var (
+	// ErrTxFailed is returned when transaction was mined, but reverted.
+	ErrTxFailed = errors.New("transaction failed")
+	// ErrReplaced is returned when nonce of transaction was used
+	// by another one, e.g. sent with the same key by other program.
+	ErrReplaced = errors.New("transaction nonce was used by another transaction")
+)
+
+// Backend is the part of ethclient.Client used by Manager.
+type Backend interface {
+	bind.ContractTransactor
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// Config describes gas policy and confirmation of transactions.
+// Zero values mean defaults.
+type Config struct {
+	// GasPrice is the price of new transactions. If it is nil,
+	// price suggested by the node is used.
+	GasPrice *big.Int
+	// MaxGasPrice limits suggested and bumped prices, nil means no limit
+	MaxGasPrice *big.Int
+	// BumpPercent is how much price is raised when transaction is stuck.
+	// Nodes do not accept replacements raised by less than 10%.
+	BumpPercent int
+	// StuckAfter is how long transaction is waited for before bump
+	StuckAfter time.Duration
+	// Confirmations is the number of blocks, including the one with
+	// transaction, after which it is considered final
+	Confirmations uint64
+	// PollInterval is how often receipts are checked
+	PollInterval time.Duration
+	// BatchWindow is how long notifications are collected before sending
+	BatchWindow time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.BumpPercent < DefaultBumpPercent {
+		c.BumpPercent = DefaultBumpPercent
+	}
+	if c.StuckAfter <= 0 {
+		c.StuckAfter = DefaultStuckAfter
+	}
+	if c.Confirmations == 0 {
+		c.Confirmations = DefaultConfirmations
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = DefaultPollInterval
+	}
+	if c.BatchWindow <= 0 {
+		c.BatchWindow = DefaultBatchWindow
+	}
+	return c
+}
+
+// TxFunc sends transaction made with opts, usually by calling
+// a method of contract binding.
+type TxFunc = func(opts *bind.TransactOpts) (*types.Transaction, error)
+
+// Manager sends transactions from a single account.
+type Manager struct {
+	backend  Backend
+	from     common.Address
+	signer   bind.SignerFn
+	gasLimit uint64
+	cfg      Config
+	journal  *journal
+
+	// now is used to detect stuck transactions
+	now func() time.Time
+
+	// sendMtx serializes nonce assignment and broadcast,
+	// so that failed sends do not leave gaps
+	sendMtx  sync.Mutex
+	nonce    uint64
+	nonceSet bool
+
+	batchMtx sync.Mutex
+	batch    *batch
+}
+
+// New returns manager of transactions signed with auth. Pending
+// transactions are journaled in d; if it is nil, they are kept
+// in memory only.
+func New(backend Backend, auth *bind.TransactOpts, d ds.Datastore, cfg Config) *Manager {
+	if d == nil {
+		d = dssync.MutexWrap(ds.NewMapDatastore())
+	}
+	return &Manager{
+		backend:  backend,
+		from:     auth.From,
+		signer:   auth.Signer,
+		gasLimit: auth.GasLimit,
+		cfg:      cfg.withDefaults(),
+		journal:  newJournal(d, auth.From),
+		now:      time.Now,
+	}
+}
+
+// Tx is a sent transaction.
+type Tx struct {
+	Entry *Entry
+
+	done    chan struct{}
+	receipt *types.Receipt
+	err     error
+}
+
+// Wait returns receipt of the transaction after it has enough
+// confirmations. Transaction is tracked even if ctx is done.
+func (t *Tx) Wait(ctx context.Context) (*types.Receipt, error) {
+	select {
+	case <-t.done:
+		return t.receipt, t.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Transact sends transaction and waits for its receipt.
+func (m *Manager) Transact(ctx context.Context, name string, fn TxFunc) (*types.Receipt, error) {
+	tx, err := m.Send(ctx, name, fn)
+	if err != nil {
+		return nil, err
+	}
+	return tx.Wait(ctx)
+}
+
+// Send assigns the next nonce to transaction, sends it and starts
+// tracking it. Transaction is journaled before it is broadcast.
+func (m *Manager) Send(ctx context.Context, name string, fn TxFunc) (*Tx, error) {
+	m.sendMtx.Lock()
+	defer m.sendMtx.Unlock()
+
+	nonce, err := m.nextNonce(ctx)
+	if err != nil {
+		return nil, err
+	}
+	price, err := m.gasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry *Entry
+	opts := &bind.TransactOpts{
+		From:     m.from,
+		Nonce:    new(big.Int).SetUint64(nonce),
+		GasPrice: price,
+		GasLimit: m.gasLimit,
+		Context:  ctx,
+		Signer: func(s types.Signer, addr common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			signed, err := m.signer(s, addr, tx)
+			if err != nil {
+				return nil, err
+			}
+			if entry, err = newEntry(name, signed, m.now()); err != nil {
+				return nil, err
+			}
+			return signed, m.journal.put(entry)
+		},
+	}
+
+	if _, err = fn(opts); err != nil {
+		if entry != nil {
+			if err := m.journal.remove(nonce); err != nil {
+				log.Error(err)
+			}
+		}
+		// node may have accepted transaction anyway,
+		// so nonce is requested from it again
+		m.nonceSet = false
+		return nil, err
+	}
+	if entry == nil {
+		return nil, errors.New("transaction was not signed by manager")
+	}
+	m.nonce = nonce + 1
+
+	log.Infof("sent %s: hash=%s nonce=%d gasPrice=%s", name, entry.Hashes[0].Hex(), nonce, price)
+	return m.track(entry), nil
+}
+
+// Resume broadcasts transactions left in journal by the previous
+// run and tracks them until they are confirmed.
+func (m *Manager) Resume(ctx context.Context) error {
+	entries, err := m.journal.list()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		log.Infof("resuming %s: nonce=%d", e.Name, e.Nonce)
+		m.rebroadcast(ctx, e)
+		m.track(e)
+	}
+	return nil
+}
+
+// From returns address of the account.
+func (m *Manager) From() common.Address {
+	return m.from
+}
+
+// Pending returns transactions which are not confirmed yet.
+func (m *Manager) Pending() ([]*Entry, error) {
+	return m.journal.list()
+}
+
+// nextNonce returns nonce for the next transaction. It is requested
+// from node after start and failures and is never lower than nonces
+// of journaled transactions.
+func (m *Manager) nextNonce(ctx context.Context) (uint64, error) {
+	if m.nonceSet {
+		return m.nonce, nil
+	}
+
+	nonce, err := m.backend.PendingNonceAt(ctx, m.from)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := m.journal.list()
+	if err != nil {
+		return 0, err
+	}
+	if n := len(entries); n > 0 && entries[n-1].Nonce >= nonce {
+		nonce = entries[n-1].Nonce + 1
+	}
+	m.nonce, m.nonceSet = nonce, true
+	return nonce, nil
+}
+
+func (m *Manager) gasPrice(ctx context.Context) (*big.Int, error) {
+	price := m.cfg.GasPrice
+	if price == nil {
+		var err error
+		if price, err = m.backend.SuggestGasPrice(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return m.capPrice(price), nil
+}
+
+func (m *Manager) capPrice(price *big.Int) *big.Int {
+	if m.cfg.MaxGasPrice != nil && price.Cmp(m.cfg.MaxGasPrice) > 0 {
+		return new(big.Int).Set(m.cfg.MaxGasPrice)
+	}
+	return price
+}
+
+// track starts watching transaction in background.
+func (m *Manager) track(e *Entry) *Tx {
+	t := &Tx{Entry: e, done: make(chan struct{})}
+	go func() {
+		t.receipt, t.err = m.watch(context.Background(), e)
+		if t.err != nil {
+			log.Errorf("%s (nonce=%d): %v", e.Name, e.Nonce, t.err)
+		}
+		close(t.done)
+	}()
+	return t
+}
+
+// watch polls receipts of all versions of transaction and bumps its
+// price if it is stuck. Confirmations are counted from the head seen
+// when receipt was found first.
+func (m *Manager) watch(ctx context.Context, e *Entry) (*types.Receipt, error) {
+	ticker := time.NewTicker(m.cfg.PollInterval)
+	defer ticker.Stop()
+
+	var seen bool
+	var seenAt uint64
+	for {
+		r, err := m.check(ctx, e)
+		switch {
+		case err == ErrReplaced:
+			return nil, m.finish(e, err)
+		case err != nil:
+			log.Warningf("checking %s (nonce=%d): %v", e.Name, e.Nonce, err)
+		case r == nil:
+			seen = false
+			if m.now().Sub(e.Sent) >= m.cfg.StuckAfter {
+				m.bump(ctx, e)
+			}
+		default:
+			head, err := m.head(ctx)
+			if err != nil {
+				log.Warning(err)
+				break
+			}
+			if !seen {
+				seen, seenAt = true, head
+			}
+			if head+1-seenAt >= m.cfg.Confirmations {
+				if r.Status == types.ReceiptStatusFailed {
+					return r, m.finish(e, ErrTxFailed)
+				}
+				return r, m.finish(e, nil)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// check returns receipt of the mined version of transaction or nil.
+func (m *Manager) check(ctx context.Context, e *Entry) (*types.Receipt, error) {
+	// nonce is checked first, so that mined transaction
+	// cannot be missed between the two calls
+	mined, err := m.backend.NonceAt(ctx, m.from, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(e.Hashes) - 1; i >= 0; i-- {
+		r, err := m.backend.TransactionReceipt(ctx, e.Hashes[i])
+		if err == ethereum.NotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			return r, nil
+		}
+	}
+	if mined > e.Nonce {
+		return nil, ErrReplaced
+	}
+	return nil, nil
+}
+
+func (m *Manager) finish(e *Entry, err error) error {
+	if jerr := m.journal.remove(e.Nonce); jerr != nil {
+		log.Error(jerr)
+	}
+	return err
+}
+
+func (m *Manager) head(ctx context.Context) (uint64, error) {
+	h, err := m.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	return h.Number.Uint64(), nil
+}
+
+// bump replaces transaction with the one with a higher gas price.
+// If price has reached MaxGasPrice, transaction is broadcast again.
+func (m *Manager) bump(ctx context.Context, e *Entry) {
+	old, err := e.Tx()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	price := new(big.Int).Mul(old.GasPrice(), big.NewInt(int64(100+m.cfg.BumpPercent)))
+	price.Div(price, big.NewInt(100))
+	if price.Cmp(old.GasPrice()) <= 0 {
+		price.Add(old.GasPrice(), big.NewInt(1))
+	}
+	if suggested, err := m.backend.SuggestGasPrice(ctx); err == nil && suggested.Cmp(price) > 0 {
+		price = suggested
+	}
+	price = m.capPrice(price)
+	if price.Cmp(old.GasPrice()) <= 0 {
+		log.Warningf("%s (nonce=%d) is stuck at max gas price %s", e.Name, e.Nonce, old.GasPrice())
+		m.rebroadcast(ctx, e)
+		return
+	}
+
+	var tx *types.Transaction
+	if to := old.To(); to != nil {
+		tx = types.NewTransaction(old.Nonce(), *to, old.Value(), old.Gas(), price, old.Data())
+	} else {
+		tx = types.NewContractCreation(old.Nonce(), old.Value(), old.Gas(), price, old.Data())
+	}
+	signed, err := m.signer(types.HomesteadSigner{}, m.from, tx)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	// the new version is journaled first, because it may be mined
+	// even if node returns error
+	next := *e
+	next.Hashes = append([]common.Hash(nil), e.Hashes...)
+	if err = next.setTx(signed, m.now()); err != nil {
+		log.Error(err)
+		return
+	}
+	if err = m.journal.put(&next); err != nil {
+		log.Error(err)
+		return
+	}
+	*e = next
+
+	log.Infof("bumping %s (nonce=%d): gasPrice %s -> %s", e.Name, e.Nonce, old.GasPrice(), price)
+	if err = m.backend.SendTransaction(ctx, signed); err != nil {
+		log.Warningf("sending replacement of %s (nonce=%d): %v", e.Name, e.Nonce, err)
+	}
+}
+
+func (m *Manager) rebroadcast(ctx context.Context, e *Entry) {
+	tx, err := e.Tx()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	e.Sent = m.now()
+	if err = m.backend.SendTransaction(ctx, tx); err != nil && !isKnown(err) {
+		log.Warningf("rebroadcasting %s (nonce=%d): %v", e.Name, e.Nonce, err)
+	}
+}
+
+// isKnown reports if node already has transaction.
+func isKnown(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "known transaction") || strings.Contains(msg, "already known")
+}
@@ -0,0 +1,403 @@
+package txmgr
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Casper-dev/Casper-SC/casper"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+)
+
+// simBackend adds head tracking to simulated backend, which does not
+// implement HeaderByNumber, and can hold sent transactions back to
+// simulate ones stuck in the mempool.
+type simBackend struct {
+	*backends.SimulatedBackend
+
+	mtx  sync.Mutex
+	head int64
+	hold bool
+	held []*types.Transaction
+	sent int
+}
+
+func (b *simBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return &types.Header{Number: big.NewInt(b.head)}, nil
+}
+
+func (b *simBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	b.mtx.Lock()
+	b.sent++
+	if b.hold {
+		b.held = append(b.held, tx)
+		b.mtx.Unlock()
+		return nil
+	}
+	b.mtx.Unlock()
+	return b.SimulatedBackend.SendTransaction(ctx, tx)
+}
+
+func (b *simBackend) Commit() {
+	b.SimulatedBackend.Commit()
+	b.mtx.Lock()
+	b.head++
+	b.mtx.Unlock()
+}
+
+func (b *simBackend) setHold(hold bool) {
+	b.mtx.Lock()
+	b.hold = hold
+	b.mtx.Unlock()
+}
+
+func (b *simBackend) counts() (sent, held int) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.sent, len(b.held)
+}
+
+// mine commits a block every few milliseconds until test is done.
+func (b *simBackend) mine(t *testing.T) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(5 * time.Millisecond):
+				b.Commit()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+type fixture struct {
+	key     *ecdsa.PrivateKey
+	auth    *bind.TransactOpts
+	backend *simBackend
+	casper  *casper.Casper
+}
+
+func newFixture(t *testing.T) *fixture {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := bind.NewKeyedTransactor(key)
+	alloc := core.GenesisAlloc{auth.From: {Balance: big.NewInt(1e18)}}
+	b := &simBackend{SimulatedBackend: backends.NewSimulatedBackend(alloc)}
+
+	auth.GasLimit = 4712388
+	// contract is almost as big as the block
+	auth.GasLimit = 4712388
+	_, _, c, err := casper.DeployCasper(auth, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Commit()
+	auth.GasLimit = 0
+
+	// addresses can be set only for registered provider,
+	// which must have tokens
+	if _, err = c.AddToken(auth, big.NewInt(1)); err != nil {
+		t.Fatal(err)
+	}
+	b.Commit()
+	if _, err = c.RegisterProvider(auth, "node", [32]byte{}, "ip", "rpc", big.NewInt(1)); err != nil {
+		t.Fatal(err)
+	}
+	b.Commit()
+	b.sent = 0
+
+	return &fixture{key: key, auth: auth, backend: b, casper: c}
+}
+
+func (f *fixture) manager(d ds.Datastore) *Manager {
+	return New(f.backend, f.auth, d, Config{
+		Confirmations: 2,
+		PollInterval:  5 * time.Millisecond,
+		BatchWindow:   20 * time.Millisecond,
+	})
+}
+
+// transfer returns TxFunc which sends 1 wei to nobody.
+func transfer(b Backend) TxFunc {
+	return func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		tx := types.NewTransaction(opts.Nonce.Uint64(), common.Address{}, big.NewInt(1), 21000, opts.GasPrice, nil)
+		signed, err := opts.Signer(types.HomesteadSigner{}, opts.From, tx)
+		if err != nil {
+			return nil, err
+		}
+		return signed, b.SendTransaction(opts.Context, signed)
+	}
+}
+
+// clock is a manual clock of manager.
+type clock struct {
+	mtx sync.Mutex
+	now time.Time
+}
+
+func newClock(m *Manager) *clock {
+	c := &clock{now: time.Now()}
+	m.now = func() time.Time {
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+		return c.now
+	}
+	return c
+}
+
+func (c *clock) add(d time.Duration) {
+	c.mtx.Lock()
+	c.now = c.now.Add(d)
+	c.mtx.Unlock()
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrentTransact(t *testing.T) {
+	f := newFixture(t)
+	defer f.backend.mine(t)()
+	m := f.manager(nil)
+
+	const n = 10
+	ctx := context.Background()
+	receipts := make([]*types.Receipt, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			receipts[i], errs[i] = m.Transact(ctx, "AddToken", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+				return f.casper.AddToken(opts, big.NewInt(1))
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range receipts {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if receipts[i].Status != types.ReceiptStatusSuccessful {
+			t.Fatalf("transaction %d failed", i)
+		}
+	}
+	nonce, err := f.backend.NonceAt(ctx, f.auth.From, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// deployment and registrations are made before
+	if nonce != n+3 {
+		t.Fatalf("expected nonce %d, got %d", n+3, nonce)
+	}
+	if p, _ := m.Pending(); len(p) != 0 {
+		t.Fatalf("journal is not empty: %d", len(p))
+	}
+}
+
+func TestBumpStuck(t *testing.T) {
+	f := newFixture(t)
+	m := f.manager(nil)
+
+	clock := newClock(m)
+
+	f.backend.setHold(true)
+	tx, err := m.Send(context.Background(), "transfer", transfer(f.backend))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { _, held := f.backend.counts(); return held == 1 })
+
+	// the held transaction never reaches the chain, so only its
+	// replacement can be mined
+	f.backend.setHold(false)
+	defer f.backend.mine(t)()
+	clock.add(DefaultStuckAfter)
+
+	r, err := tx.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.Entry.Hashes) != 2 {
+		t.Fatalf("expected 2 versions, got %d", len(tx.Entry.Hashes))
+	}
+	if r.TxHash != tx.Entry.Hashes[1] {
+		t.Fatal("receipt is not of the replacement")
+	}
+	if tx.Entry.GasPrice.Cmp(big.NewInt(1)) <= 0 {
+		t.Fatalf("gas price was not bumped: %s", tx.Entry.GasPrice)
+	}
+}
+
+func TestMaxGasPrice(t *testing.T) {
+	f := newFixture(t)
+	m := New(f.backend, f.auth, nil, Config{
+		GasPrice:     big.NewInt(100),
+		MaxGasPrice:  big.NewInt(50),
+		PollInterval: 5 * time.Millisecond,
+	})
+	clock := newClock(m)
+
+	f.backend.setHold(true)
+	if _, err := m.Send(context.Background(), "transfer", transfer(f.backend)); err != nil {
+		t.Fatal(err)
+	}
+	clock.add(DefaultStuckAfter)
+
+	// stuck transaction is broadcast again with the same price
+	waitFor(t, func() bool { sent, _ := f.backend.counts(); return sent >= 2 })
+	p, err := m.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != 1 || len(p[0].Hashes) != 1 {
+		t.Fatal("transaction was bumped above max gas price")
+	}
+	if p[0].GasPrice.Int64() != 50 {
+		t.Fatalf("expected gas price 50, got %s", p[0].GasPrice)
+	}
+}
+
+func TestResume(t *testing.T) {
+	f := newFixture(t)
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+
+	// the first run sends transaction which is lost by node
+	f.backend.setHold(true)
+	if _, err := f.manager(d).Send(context.Background(), "transfer", transfer(f.backend)); err != nil {
+		t.Fatal(err)
+	}
+	f.backend.setHold(false)
+	defer f.backend.mine(t)()
+
+	m := f.manager(d)
+	if err := m.Resume(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// nonce of journaled transaction is not reused
+	tx, err := m.Send(context.Background(), "transfer", transfer(f.backend))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Entry.Nonce != 4 {
+		t.Fatalf("expected nonce 4, got %d", tx.Entry.Nonce)
+	}
+	if _, err = tx.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { p, _ := m.Pending(); return len(p) == 0 })
+}
+
+func TestFailedSendReleasesNonce(t *testing.T) {
+	f := newFixture(t)
+	defer f.backend.mine(t)()
+	m := f.manager(nil)
+
+	// estimation fails for calls to address without code
+	bad, err := casper.NewCasper(common.Address{1}, f.backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Send(context.Background(), "SetAPIAddr", func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return bad.SetAPIAddr(opts, "node", "addr")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	tx, err := m.Send(context.Background(), "transfer", transfer(f.backend))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Entry.Nonce != 3 {
+		t.Fatalf("expected nonce 3, got %d", tx.Entry.Nonce)
+	}
+	if _, err = tx.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotifyCoalesces(t *testing.T) {
+	f := newFixture(t)
+	defer f.backend.mine(t)()
+	m := f.manager(nil)
+
+	setAPI := func(addr string) TxFunc {
+		return func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return f.casper.SetAPIAddr(opts, "node", addr)
+		}
+	}
+	setRPC := func(addr string) TxFunc {
+		return func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return f.casper.SetRPCAddr(opts, "node", addr)
+		}
+	}
+	calls := []struct {
+		key string
+		fn  TxFunc
+	}{
+		{"api", setAPI("api1")},
+		{"api", setAPI("api2")},
+		{"rpc", setRPC("rpc1")},
+		{"api", setAPI("api3")},
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, len(calls))
+	for i, c := range calls {
+		wg.Add(1)
+		go func(i int, key string, fn TxFunc) {
+			defer wg.Done()
+			errs[i] = m.Notify(context.Background(), key, key, fn)
+		}(i, c.key, c.fn)
+		time.Sleep(time.Millisecond)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sent, _ := f.backend.counts(); sent != 2 {
+		t.Fatalf("expected 2 transactions, got %d", sent)
+	}
+	rpc, api, err := f.casper.GetNodeAddr(nil, "node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if api != "api3" || rpc != "rpc1" {
+		t.Fatalf("expected the latest addresses, got %s %s", api, rpc)
+	}
+}
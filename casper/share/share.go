@@ -0,0 +1,399 @@
+// Package share implements links which give access to a single file
+// without knowing its UUID. Links are kept in the repo datastore, so
+// that they survive restarts of the node, and can be limited by time,
+// number of downloads and password.
+package share
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	"gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+)
+
+var log = logging.Logger("share")
+
+const (
+	DefaultTTL = 24 * time.Hour
+
+	linkKeyPrefix = "/local/share/"
+	magicBytes    = 18
+	saltBytes     = 16
+	hashBytes     = 32
+)
+
+var (
+	ErrNotFound    = errors.New("link does not exist or expired")
+	ErrBadPassword = errors.New("invalid link password")
+	ErrInvalidTTL  = errors.New("link TTL must be positive")
+	ErrTTLTooLong  = errors.New("link TTL exceeds maximum")
+)
+
+// Options describe limits of a new link.
+type Options struct {
+	// TTL is lifetime of the link. Zero means Store.DefaultTTL
+	// limited by Store.MaxTTL.
+	TTL time.Duration
+	// MaxDownloads is the number of times file can be downloaded
+	// with the link. Zero means no limit.
+	MaxDownloads int
+	// Password is required to open link if it is not empty.
+	Password string
+}
+
+type password struct {
+	Salt []byte
+	Hash []byte
+}
+
+// Link is a shared file.
+type Link struct {
+	Magic string
+	UUID  string
+	// Path is the path of the file which is served by the link
+	Path         string
+	Created      time.Time
+	Expires      time.Time
+	MaxDownloads int `json:",omitempty"`
+	Downloads    int
+	// Served is the number of bytes served by the link
+	Served   uint64    `json:",omitempty"`
+	Password *password `json:",omitempty"`
+}
+
+// Protected checks if link requires password.
+func (l *Link) Protected() bool {
+	return l.Password != nil
+}
+
+func (l *Link) expired(now time.Time) bool {
+	return !now.Before(l.Expires) || (l.MaxDownloads > 0 && l.Downloads >= l.MaxDownloads)
+}
+
+// mtx guards links in datastore, because every HTTP handler
+// creates its own Store.
+var mtx sync.Mutex
+
+// reserved is the traffic which is being served by each link.
+var reserved = make(map[string]uint64)
+
+type Store struct {
+	// DefaultTTL is used for links created without TTL
+	DefaultTTL time.Duration
+	// MaxTTL limits lifetime of links if it is positive
+	MaxTTL time.Duration
+
+	ds ds.Datastore
+}
+
+// NewStore returns store which keeps links in d.
+func NewStore(d ds.Datastore) *Store {
+	return &Store{DefaultTTL: DefaultTTL, ds: d}
+}
+
+// Create shares file with specified UUID and path.
+func (s *Store) Create(uuid, path string, opts Options) (*Link, error) {
+	ttl := opts.TTL
+	if ttl == 0 {
+		ttl = s.DefaultTTL
+		if s.MaxTTL > 0 && ttl > s.MaxTTL {
+			ttl = s.MaxTTL
+		}
+	}
+	if ttl < 0 {
+		return nil, ErrInvalidTTL
+	}
+	if s.MaxTTL > 0 && ttl > s.MaxTTL {
+		return nil, ErrTTLTooLong
+	}
+
+	now := time.Now()
+	link := &Link{
+		UUID:         uuid,
+		Path:         path,
+		Created:      now,
+		Expires:      now.Add(ttl),
+		MaxDownloads: opts.MaxDownloads,
+	}
+	if opts.Password != "" {
+		salt, err := randomBytes(saltBytes)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := hashPassword(opts.Password, salt)
+		if err != nil {
+			return nil, err
+		}
+		link.Password = &password{Salt: salt, Hash: hash}
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	for link.Magic == "" {
+		magic, err := genMagic()
+		if err != nil {
+			return nil, err
+		}
+		if has, err := s.ds.Has(linkKey(magic)); err != nil {
+			return nil, err
+		} else if !has {
+			link.Magic = magic
+		}
+	}
+	if err := s.put(link); err != nil {
+		return nil, err
+	}
+	log.Debugf("file %s was shared at %s until %s", uuid, link.Magic, link.Expires)
+	return link, nil
+}
+
+// Reserve checks password of the link and reserves traffic for one
+// response which serves file of specified size. Link limited by downloads
+// allows MaxDownloads*size bytes in total, so partial and resumed transfers
+// are counted by what they serve. It returns the number of bytes which can
+// be served, Release must be called when response is finished.
+func (s *Store) Reserve(magic, pass string, size uint64) (*Link, uint64, error) {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	link, err := s.check(magic, pass)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	allowed := size
+	if link.MaxDownloads > 0 && size > 0 {
+		total := uint64(link.MaxDownloads) * size
+		used := link.Served + reserved[magic]
+		if used >= total {
+			return nil, 0, ErrNotFound
+		}
+		if total-used < allowed {
+			allowed = total - used
+		}
+	}
+	reserved[magic] += allowed
+	return link, allowed, nil
+}
+
+// Release returns traffic reserved by Reserve and counts served bytes.
+// Every size bytes served make one download. Link is removed after the
+// last allowed download.
+func (s *Store) Release(magic string, size, reservation, served uint64) error {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if reserved[magic] <= reservation {
+		delete(reserved, magic)
+	} else {
+		reserved[magic] -= reservation
+	}
+
+	link, err := s.get(magic)
+	if err != nil {
+		// revoked while file was served
+		return err
+	}
+	if size == 0 {
+		link.Downloads++
+	} else {
+		link.Served += served
+		link.Downloads = int(link.Served / size)
+	}
+	if link.MaxDownloads > 0 && link.Downloads >= link.MaxDownloads {
+		return s.ds.Delete(linkKey(magic))
+	}
+	return s.put(link)
+}
+
+// Check checks password of the link without reserving traffic.
+func (s *Store) Check(magic, pass string) (*Link, error) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	return s.check(magic, pass)
+}
+
+// Get returns link without checking password.
+func (s *Store) Get(magic string) (*Link, error) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	return s.get(magic)
+}
+
+// List returns active links of the file with specified UUID sorted by
+// creation time. All links are returned if uuid is empty.
+func (s *Store) List(uuid string) ([]*Link, error) {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	links, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*Link
+	for _, link := range links {
+		if uuid == "" || link.UUID == uuid {
+			res = append(res, link)
+		}
+	}
+	return res, nil
+}
+
+// Revoke removes link. If magic is empty, all links of the
+// file are removed. It returns the number of removed links.
+func (s *Store) Revoke(uuid, magic string) (int, error) {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if magic != "" {
+		link, err := s.get(magic)
+		if err != nil {
+			return 0, err
+		}
+		if link.UUID != uuid {
+			return 0, ErrNotFound
+		}
+		return 1, s.ds.Delete(linkKey(magic))
+	}
+
+	links, err := s.list()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, link := range links {
+		if link.UUID != uuid {
+			continue
+		}
+		if err = s.ds.Delete(linkKey(link.Magic)); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func linkKey(magic string) ds.Key {
+	return ds.NewKey(linkKeyPrefix + magic)
+}
+
+// get returns link if it is still active. Expired link is removed.
+func (s *Store) get(magic string) (*Link, error) {
+	if magic == "" {
+		return nil, ErrNotFound
+	}
+
+	v, err := s.ds.Get(linkKey(magic))
+	if err == ds.ErrNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	link := &Link{}
+	if err = json.Unmarshal(v.([]byte), link); err != nil {
+		return nil, err
+	}
+	if link.expired(time.Now()) {
+		log.Debugf("link %s has expired", magic)
+		if err = s.ds.Delete(linkKey(magic)); err != nil {
+			log.Error(err)
+		}
+		return nil, ErrNotFound
+	}
+	return link, nil
+}
+
+func (s *Store) check(magic, pass string) (*Link, error) {
+	link, err := s.get(magic)
+	if err != nil {
+		return nil, err
+	}
+	if link.Protected() {
+		hash, err := hashPassword(pass, link.Password.Salt)
+		if err != nil {
+			return nil, err
+		}
+		if subtle.ConstantTimeCompare(hash, link.Password.Hash) != 1 {
+			return nil, ErrBadPassword
+		}
+	}
+	return link, nil
+}
+
+func (s *Store) put(link *Link) error {
+	b, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+	return s.ds.Put(linkKey(link.Magic), b)
+}
+
+// list returns all active links. Expired links are removed.
+func (s *Store) list() ([]*Link, error) {
+	res, err := s.ds.Query(query.Query{Prefix: linkKeyPrefix})
+	if err != nil {
+		return nil, err
+	}
+	// expired links are removed after query has finished
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var links []*Link
+	var expired []string
+	for _, e := range entries {
+		link := &Link{}
+		if err = json.Unmarshal(e.Value.([]byte), link); err != nil {
+			log.Errorf("invalid share link at %s: %v", e.Key, err)
+			continue
+		}
+		if link.expired(now) {
+			expired = append(expired, link.Magic)
+			continue
+		}
+		links = append(links, link)
+	}
+	for _, magic := range expired {
+		if err = s.ds.Delete(linkKey(magic)); err != nil {
+			log.Error(err)
+		}
+	}
+
+	sort.Slice(links, func(i, j int) bool { return links[i].Created.Before(links[j].Created) })
+	return links, nil
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func genMagic() (string, error) {
+	b, err := randomBytes(magicBytes)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashPassword(pass string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(pass), salt, 1<<15, 8, 1, hashBytes)
+}
@@ -0,0 +1,164 @@
+package share
+
+import (
+	"testing"
+	"time"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+)
+
+const testSize = 10
+
+func newTestStore() *Store {
+	return NewStore(dssync.MutexWrap(ds.NewMapDatastore()))
+}
+
+// download serves the whole file with the link.
+func download(s *Store, magic, pass string) error {
+	_, allowed, err := s.Reserve(magic, pass, testSize)
+	if err != nil {
+		return err
+	}
+	return s.Release(magic, testSize, allowed, allowed)
+}
+
+func TestLinkSurvivesRestart(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	link, err := NewStore(d).Create("uuid", "/ipfs/hash", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(link.Magic) < 24 {
+		t.Fatalf("magic %q is too short", link.Magic)
+	}
+	if ttl := link.Expires.Sub(link.Created); ttl != DefaultTTL {
+		t.Fatalf("expected default TTL, got %s", ttl)
+	}
+
+	if err = download(NewStore(d), link.Magic, ""); err != nil {
+		t.Fatal(err)
+	}
+	opened, err := NewStore(d).Get(link.Magic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened.Path != "/ipfs/hash" || opened.Downloads != 1 {
+		t.Fatalf("unexpected link: %+v", opened)
+	}
+	if err = download(NewStore(d), "unknown", ""); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestLinkLimits(t *testing.T) {
+	s := newTestStore()
+	s.MaxTTL = time.Hour
+	if _, err := s.Create("uuid", "p", Options{TTL: 2 * time.Hour}); err != ErrTTLTooLong {
+		t.Fatalf("expected ErrTTLTooLong, got %v", err)
+	}
+	if _, err := s.Create("uuid", "p", Options{TTL: -time.Hour}); err != ErrInvalidTTL {
+		t.Fatalf("expected ErrInvalidTTL, got %v", err)
+	}
+
+	short, err := s.Create("uuid", "p", Options{TTL: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err = download(s, short.Magic, ""); err != ErrNotFound {
+		t.Fatalf("expired link must not open, got %v", err)
+	}
+
+	twice, err := s.Create("uuid", "p", Options{MaxDownloads: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err = download(s, twice.Magic, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = download(s, twice.Magic, ""); err != ErrNotFound {
+		t.Fatalf("link must not open after last download, got %v", err)
+	}
+}
+
+func TestPartialDownloads(t *testing.T) {
+	s := newTestStore()
+	link, err := s.Create("uuid", "p", Options{MaxDownloads: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, allowed, err := s.Reserve(link.Magic, "", testSize)
+	if err != nil || allowed != testSize {
+		t.Fatalf("expected %d bytes, got %d: %v", testSize, allowed, err)
+	}
+	// parallel requests can't serve more than the limit
+	if _, _, err = s.Reserve(link.Magic, "", testSize); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	// ranges and interrupted transfers are counted by served bytes
+	if err = s.Release(link.Magic, testSize, allowed, 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, allowed, err = s.Reserve(link.Magic, "", testSize); err != nil || allowed != testSize-4 {
+		t.Fatalf("expected %d bytes, got %d: %v", testSize-4, allowed, err)
+	}
+	if err = s.Release(link.Magic, testSize, allowed, allowed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Get(link.Magic); err != ErrNotFound {
+		t.Fatalf("link must be removed after the last download, got %v", err)
+	}
+}
+
+func TestLinkPassword(t *testing.T) {
+	s := newTestStore()
+	link, err := s.Create("uuid", "p", Options{Password: "secret", MaxDownloads: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !link.Protected() {
+		t.Fatal("link must be protected")
+	}
+
+	for _, pass := range []string{"", "wrong"} {
+		if err = download(s, link.Magic, pass); err != ErrBadPassword {
+			t.Fatalf("expected ErrBadPassword for %q, got %v", pass, err)
+		}
+	}
+	// failed attempts are not counted as downloads
+	if err = download(s, link.Magic, "secret"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListAndRevoke(t *testing.T) {
+	s := newTestStore()
+	a1, _ := s.Create("a", "p", Options{})
+	a2, _ := s.Create("a", "p", Options{})
+	b, _ := s.Create("b", "p", Options{})
+
+	links, err := s.List("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 2 || links[0].Magic != a1.Magic || links[1].Magic != a2.Magic {
+		t.Fatalf("unexpected links: %v", links)
+	}
+
+	if _, err = s.Revoke("a", b.Magic); err != ErrNotFound {
+		t.Fatalf("link of other file must not be revoked, got %v", err)
+	}
+	if n, err := s.Revoke("a", a1.Magic); err != nil || n != 1 {
+		t.Fatalf("expected 1 revoked link, got %d: %v", n, err)
+	}
+	if n, err := s.Revoke("a", ""); err != nil || n != 1 {
+		t.Fatalf("expected 1 revoked link, got %d: %v", n, err)
+	}
+	if links, _ = s.List(""); len(links) != 1 || links[0].Magic != b.Magic {
+		t.Fatalf("unexpected links: %v", links)
+	}
+}
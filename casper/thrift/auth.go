@@ -0,0 +1,193 @@
+package thrift
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+)
+
+// Certificates used by thrift over TLS are self-signed and carry
+// node's libp2p public key together with signature of certificate key
+// made by libp2p private key. This way peer on the other side of
+// connection is identified by the same peer ID which is used in SC.
+
+var (
+	ErrNoIdentity     = errors.New("thrift identity is not set")
+	ErrNoIdentityCert = errors.New("certificate does not contain libp2p identity")
+	ErrBadIdentitySig = errors.New("invalid signature of certificate key")
+	ErrWrongPeer      = errors.New("thrift server is run by unexpected peer")
+)
+
+// identityExtensionID is an OID of certificate extension with signed identity.
+var identityExtensionID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 53594, 1, 1}
+
+const (
+	identitySigPrefix = "casper-thrift-tls:"
+	identityCertTTL   = 365 * 24 * time.Hour
+)
+
+type signedIdentity struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+var (
+	identityMtx  sync.RWMutex
+	identityCert *tls.Certificate
+)
+
+// SetIdentity generates certificate bound to sk which is used by thrift
+// server and clients. It must be called before RunServer or any call
+// to a server which requires authentication.
+func SetIdentity(sk ci.PrivKey) error {
+	cert, err := NewIdentityCert(sk)
+	if err != nil {
+		return err
+	}
+
+	identityMtx.Lock()
+	identityCert = cert
+	identityMtx.Unlock()
+	return nil
+}
+
+func getIdentityCert() (*tls.Certificate, error) {
+	identityMtx.RLock()
+	defer identityMtx.RUnlock()
+	if identityCert == nil {
+		return nil, ErrNoIdentity
+	}
+	return identityCert, nil
+}
+
+// NewIdentityCert returns self-signed certificate with fresh key
+// which is signed by sk.
+func NewIdentityCert(sk ci.PrivKey) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	keyBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := ci.MarshalPublicKey(sk.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+	sig, err := sk.Sign(append([]byte(identitySigPrefix), keyBytes...))
+	if err != nil {
+		return nil, err
+	}
+	ext, err := asn1.Marshal(signedIdentity{PubKey: pub, Signature: sig})
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:    serial,
+		Subject:         pkix.Name{CommonName: "casper"},
+		NotBefore:       now.Add(-time.Hour),
+		NotAfter:        now.Add(identityCertTTL),
+		ExtraExtensions: []pkix.Extension{{Id: identityExtensionID, Value: ext}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// PeerFromCert returns ID of the peer which has signed certificate key.
+func PeerFromCert(cert *x509.Certificate) (peer.ID, error) {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(identityExtensionID) {
+			continue
+		}
+
+		var si signedIdentity
+		if _, err := asn1.Unmarshal(ext.Value, &si); err != nil {
+			return "", err
+		}
+		pub, err := ci.UnmarshalPublicKey(si.PubKey)
+		if err != nil {
+			return "", err
+		}
+		ok, err := pub.Verify(append([]byte(identitySigPrefix), cert.RawSubjectPublicKeyInfo...), si.Signature)
+		if err != nil || !ok {
+			return "", ErrBadIdentitySig
+		}
+		return peer.IDFromPublicKey(pub)
+	}
+	return "", ErrNoIdentityCert
+}
+
+func peerFromRawCerts(rawCerts [][]byte) (peer.ID, error) {
+	if len(rawCerts) == 0 {
+		return "", ErrNoIdentityCert
+	}
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return "", err
+	}
+	return PeerFromCert(cert)
+}
+
+// identityTLSConfig returns config which requires other side to present
+// identity certificate. Certificate chains are not checked, because
+// certificates are self-signed: peer is identified by its key instead.
+// If expected is not empty, other side must be that peer.
+func identityTLSConfig(expected peer.ID) (*tls.Config, error) {
+	cert, err := getIdentityCert()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates:       []tls.Certificate{*cert},
+		ClientAuth:         tls.RequireAnyClientCert,
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			id, err := peerFromRawCerts(rawCerts)
+			if err != nil {
+				return err
+			}
+			if expected != "" && id != expected {
+				return ErrWrongPeer
+			}
+			return nil
+		},
+	}, nil
+}
+
+type callerKey struct{}
+
+// WithCaller returns context of a request made by peer with specified id.
+func WithCaller(ctx context.Context, id peer.ID) context.Context {
+	return context.WithValue(ctx, callerKey{}, id)
+}
+
+// CallerFromContext returns ID of the peer which has made request.
+// ok is false if request was not authenticated.
+func CallerFromContext(ctx context.Context) (id peer.ID, ok bool) {
+	id, ok = ctx.Value(callerKey{}).(peer.ID)
+	return id, ok && id != ""
+}
@@ -0,0 +1,132 @@
+package thrift
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"github.com/Casper-dev/Casper-thrift/casperproto"
+
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
+)
+
+// callerHandler responds to Ping with ID of the caller
+type callerHandler struct {
+	casperproto.CasperServer
+}
+
+func (h *callerHandler) Ping(ctx context.Context) (*casperproto.PingResult_, error) {
+	id, ok := CallerFromContext(ctx)
+	if !ok {
+		return nil, ErrNoIdentity
+	}
+	return &casperproto.PingResult_{Timestamp: 1, ID: id.Pretty()}, nil
+}
+
+func genIdentity(t *testing.T) (ci.PrivKey, peer.ID) {
+	sk, pk, err := ci.GenerateKeyPair(ci.RSA, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk, id
+}
+
+func TestIdentityCert(t *testing.T) {
+	sk, id := genIdentity(t)
+	cert, err := NewIdentityCert(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := PeerFromCert(c); err != nil || got != id {
+		t.Fatalf("expected %s, got %s (%v)", id.Pretty(), got.Pretty(), err)
+	}
+
+	// identity can't be moved to a certificate with other key
+	other, err := NewIdentityCert(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oc, err := x509.ParseCertificate(other.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.RawSubjectPublicKeyInfo = oc.RawSubjectPublicKeyInfo
+	if _, err = PeerFromCert(c); err != ErrBadIdentitySig {
+		t.Fatalf("expected ErrBadIdentitySig, got %v", err)
+	}
+
+	if _, err = PeerFromCert(&x509.Certificate{}); err != ErrNoIdentityCert {
+		t.Fatalf("expected ErrNoIdentityCert, got %v", err)
+	}
+}
+
+func TestSecureServer(t *testing.T) {
+	defer func() {
+		identityMtx.Lock()
+		identityCert = nil
+		identityMtx.Unlock()
+	}()
+
+	if _, err := RunClientClosure("127.0.0.1:1", nil); err != ErrNoIdentity {
+		t.Fatalf("expected ErrNoIdentity, got %v", err)
+	}
+
+	// the same identity is used by both sides in tests
+	sk, id := genIdentity(t)
+	if err := SetIdentity(sk); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := identityTLSConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go serveTLS(l, casperproto.NewCasperServerProcessor(&callerHandler{}), defaultThriftOpts)
+
+	r, err := RunClientClosure(l.Addr().String(), func(c *ThriftClient) (interface{}, error) {
+		return c.Ping(context.Background())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.(*casperproto.PingResult_).ID; got != id.Pretty() {
+		t.Fatalf("expected caller %s, got %s", id.Pretty(), got)
+	}
+
+	// server must be run by the expected peer
+	if _, err = RunClientClosureTo(l.Addr().String(), id, func(c *ThriftClient) (interface{}, error) {
+		return c.Ping(context.Background())
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_, other := genIdentity(t)
+	if _, err = RunClientClosureTo(l.Addr().String(), other, func(c *ThriftClient) (interface{}, error) {
+		return c.Ping(context.Background())
+	}); err == nil {
+		t.Fatal("connection to unexpected peer must fail")
+	}
+
+	// clients without certificate are rejected
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err == nil {
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	if err == nil {
+		t.Fatal("connection without certificate must fail")
+	}
+}
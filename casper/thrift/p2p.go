@@ -0,0 +1,113 @@
+package thrift
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Casper-dev/Casper-thrift/casperproto"
+
+	"git.apache.org/thrift.git/lib/go/thrift"
+
+	inet "gx/ipfs/QmNa31VPzC561NWwRsJLE7nGYZYuuD2QfpK2b1q9BK54J1/go-libp2p-net"
+	pstore "gx/ipfs/QmPgDWmTmuzvP7QE5zwo1TmjbJme9pmZHNujB2453jkCTr/go-libp2p-peerstore"
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
+	pro "gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
+	p2phost "gx/ipfs/Qmc1XhrFEiSeBNn3mpfg6gEuYCt5im2gYmNVmncsvmpeAk/go-libp2p-host"
+)
+
+var log = logging.Logger("thrift")
+
+// ProtocolID is used to serve CasperServer over libp2p streams
+const ProtocolID = pro.ID("/casper/thrift/1.0.0")
+
+// P2PAddrPrefix marks thrift addresses which contain peer ID instead of
+// host:port. Calls to such addresses are made over libp2p streams.
+const P2PAddrPrefix = "/ipfs/"
+
+var ErrNoHost = errors.New("libp2p host is not set for thrift")
+
+var (
+	hostMtx     sync.RWMutex
+	defaultHost p2phost.Host
+)
+
+// SetHost sets host which is used to dial addresses returned by PeerAddr.
+func SetHost(h p2phost.Host) {
+	hostMtx.Lock()
+	defaultHost = h
+	hostMtx.Unlock()
+}
+
+func getHost() p2phost.Host {
+	hostMtx.RLock()
+	defer hostMtx.RUnlock()
+	return defaultHost
+}
+
+// PeerAddr returns thrift address which is dialed by peer ID over libp2p.
+func PeerAddr(id peer.ID) string {
+	return P2PAddrPrefix + id.Pretty()
+}
+
+// IsPeerAddr checks if addr was returned by PeerAddr.
+func IsPeerAddr(addr string) bool {
+	return strings.HasPrefix(addr, P2PAddrPrefix)
+}
+
+// ServeP2P registers handler as ProtocolID handler on h.
+// h is also used by clients to dial other peers by ID.
+func ServeP2P(h p2phost.Host, handler casperproto.CasperServer) {
+	SetHost(h)
+
+	pf := defaultThriftOpts.ProtocolFactory
+	processor := casperproto.NewCasperServerProcessor(handler)
+	h.SetStreamHandler(ProtocolID, func(s inet.Stream) {
+		defer s.Close()
+
+		// streams are authenticated by libp2p, so remote peer is the caller
+		ctx := WithCaller(context.Background(), s.Conn().RemotePeer())
+		processRequests(ctx, processor, thrift.NewStreamTransportRW(s), pf)
+	})
+}
+
+// RunClientClosurePeer opens libp2p stream to peer with specified id
+// and invokes cb with client which uses that stream.
+func RunClientClosurePeer(ctx context.Context, h p2phost.Host, id peer.ID, cb ClientFunc) (interface{}, error) {
+	return runClientClosurePeer(ctx, h, id, cb, defaultThriftOpts)
+}
+
+func runClientClosurePeer(ctx context.Context, h p2phost.Host, id peer.ID, cb ClientFunc, opts ThriftOpts) (interface{}, error) {
+	if h == nil {
+		return nil, ErrNoHost
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	// addresses are taken from peerstore or found via routing
+	if err := h.Connect(tctx, pstore.PeerInfo{ID: id}); err != nil {
+		return nil, err
+	}
+	s, err := h.NewStream(tctx, id, ProtocolID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(opts.Timeout))
+
+	return cb(newThriftClient(thrift.NewStreamTransportRW(s), opts.ProtocolFactory))
+}
+
+func runClientClosureAddr(addr string, cb ClientFunc, opts ThriftOpts) (interface{}, error) {
+	id, err := peer.IDB58Decode(strings.TrimPrefix(addr, P2PAddrPrefix))
+	if err != nil {
+		return nil, err
+	}
+	if opts.Peer != "" && id != opts.Peer {
+		return nil, ErrWrongPeer
+	}
+	return runClientClosurePeer(context.Background(), getHost(), id, cb, opts)
+}
@@ -0,0 +1,63 @@
+package thrift
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Casper-dev/Casper-thrift/casperproto"
+
+	mocknet "gx/ipfs/QmefgzMbKZYsmHFkLqxgaTBG9ypeEjrdWRD5WXH4j1cWDL/go-libp2p/p2p/net/mock"
+)
+
+type pingHandler struct {
+	casperproto.CasperServer
+	id string
+}
+
+func (h *pingHandler) Ping(ctx context.Context) (*casperproto.PingResult_, error) {
+	return &casperproto.PingResult_{Timestamp: 1, ID: h.id}, nil
+}
+
+func TestP2P(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshLinked(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+	server, client := hosts[0], hosts[1]
+	ServeP2P(server, &pingHandler{id: "server"})
+	SetHost(client)
+	defer SetHost(nil)
+
+	ping := func(c *ThriftClient) (interface{}, error) {
+		// several calls are performed over the same stream
+		if _, err := c.Ping(ctx); err != nil {
+			return nil, err
+		}
+		return c.Ping(ctx)
+	}
+
+	r, err := RunClientClosurePeer(ctx, client, server.ID(), ping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := r.(*casperproto.PingResult_).ID; id != "server" {
+		t.Fatalf("unexpected ID: %s", id)
+	}
+
+	r, err = RunClientClosure(PeerAddr(server.ID()), ping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := r.(*casperproto.PingResult_).ID; id != "server" {
+		t.Fatalf("unexpected ID: %s", id)
+	}
+
+	SetHost(nil)
+	if _, err = RunClientClosure(PeerAddr(server.ID()), ping); err != ErrNoHost {
+		t.Fatalf("expected ErrNoHost, got %v", err)
+	}
+}
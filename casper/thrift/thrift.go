@@ -3,13 +3,17 @@ package thrift
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/Casper-dev/Casper-thrift/casperproto"
 
 	"git.apache.org/thrift.git/lib/go/thrift"
+
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
 )
 
 type ThriftOpts struct {
@@ -17,6 +21,9 @@ type ThriftOpts struct {
 	ProtocolFactory  thrift.TProtocolFactory
 	Secure           bool
 	Timeout          time.Duration
+	// Peer is the expected ID of the server, it is checked by client
+	// if set. Server is not authenticated otherwise.
+	Peer peer.ID
 }
 
 type ThriftClient struct {
@@ -26,7 +33,7 @@ type ThriftClient struct {
 var defaultThriftOpts = ThriftOpts{
 	ProtocolFactory:  thrift.NewTBinaryProtocolFactoryDefault(),
 	TransportFactory: thrift.NewTBufferedTransportFactory(8192),
-	Secure:           false,
+	Secure:           true,
 	Timeout:          thriftDefaultTimeout,
 }
 var defaultHTTPProfocolFactory = thrift.NewTBinaryProtocolFactoryDefault()
@@ -85,10 +92,28 @@ func RunClientClosure(addr string, cb ClientFunc) (interface{}, error) {
 	return RunClientClosureOpts(addr, cb, defaultThriftOpts)
 }
 
+// RunClientClosureTo connects to thrift server at addr, which must be
+// run by peer with specified id, and invokes cb.
+func RunClientClosureTo(addr string, id peer.ID, cb ClientFunc) (interface{}, error) {
+	opts := defaultThriftOpts
+	opts.Peer = id
+	return RunClientClosureOpts(addr, cb, opts)
+}
+
+// RunClientClosureOpts connects to thrift server at addr and invokes cb.
+// addr is either host:port or peer address returned by PeerAddr.
 func RunClientClosureOpts(addr string, cb ClientFunc, opts ThriftOpts) (result interface{}, err error) {
+	if IsPeerAddr(addr) {
+		return runClientClosureAddr(addr, cb, opts)
+	}
+
 	var transport thrift.TTransport
 	if opts.Secure {
-		transport, err = thrift.NewTSSLSocketTimeout(addr, &tls.Config{InsecureSkipVerify: true}, opts.Timeout)
+		var cfg *tls.Config
+		if cfg, err = identityTLSConfig(opts.Peer); err != nil {
+			return nil, err
+		}
+		transport, err = thrift.NewTSSLSocketTimeout(addr, cfg, opts.Timeout)
 	} else {
 		transport, err = thrift.NewTSocketTimeout(addr, opts.Timeout)
 	}
@@ -114,28 +139,99 @@ func RunServerDefault(addr string, handler casperproto.CasperServer) error {
 	return RunServer(addr, handler, defaultThriftOpts)
 }
 
+// RunServer serves handler on addr. If opts.Secure is set, connections
+// are made over TLS with identity certificates (see SetIdentity) and
+// ID of the caller is available to handler via CallerFromContext.
 func RunServer(addr string, handler casperproto.CasperServer, opts ThriftOpts) error {
-	var transport thrift.TServerTransport
-	var err error
+	processor := casperproto.NewCasperServerProcessor(handler)
 	if opts.Secure {
-		cfg := new(tls.Config)
-		if cert, err := tls.LoadX509KeyPair("server.crt", "server.key"); err == nil {
-			cfg.Certificates = append(cfg.Certificates, cert)
-		} else {
-			return err
-		}
-		transport, err = thrift.NewTSSLServerSocketTimeout(addr, cfg, opts.Timeout)
-	} else {
-		transport, err = thrift.NewTServerSocketTimeout(addr, opts.Timeout)
+		return runSecureServer(addr, processor, opts)
 	}
+
+	transport, err := thrift.NewTServerSocketTimeout(addr, opts.Timeout)
 	if err != nil {
 		return err
 	}
-
-	processor := casperproto.NewCasperServerProcessor(handler)
 	server := thrift.NewTSimpleServer4(processor, transport, opts.TransportFactory, opts.ProtocolFactory)
 
 	fmt.Printf("Starting the simple server on %s ...\n", addr)
 
 	return server.Serve()
 }
+
+func runSecureServer(addr string, processor thrift.TProcessor, opts ThriftOpts) error {
+	cfg, err := identityTLSConfig("")
+	if err != nil {
+		return err
+	}
+	l, err := tls.Listen("tcp", addr, cfg)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	fmt.Printf("Starting the TLS server on %s ...\n", addr)
+
+	return serveTLS(l, processor, opts)
+}
+
+func serveTLS(l net.Listener, processor thrift.TProcessor, opts ThriftOpts) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveTLSConn(conn.(*tls.Conn), processor, opts)
+	}
+}
+
+func serveTLSConn(conn *tls.Conn, processor thrift.TProcessor, opts ThriftOpts) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(opts.Timeout))
+	if err := conn.Handshake(); err != nil {
+		log.Debugf("TLS handshake with %s failed: %v", conn.RemoteAddr(), err)
+		return
+	}
+	id, err := peerFromRawCerts(rawCerts(conn.ConnectionState().PeerCertificates))
+	if err != nil {
+		log.Debugf("can't identify %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+
+	t, err := opts.TransportFactory.GetTransport(thrift.NewTSocketFromConnTimeout(conn, opts.Timeout))
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	processRequests(WithCaller(context.Background(), id), processor, t, opts.ProtocolFactory)
+}
+
+func rawCerts(certs []*x509.Certificate) [][]byte {
+	raw := make([][]byte, len(certs))
+	for i, c := range certs {
+		raw[i] = c.Raw
+	}
+	return raw
+}
+
+// processRequests serves requests from t until connection is closed.
+func processRequests(ctx context.Context, processor thrift.TProcessor, t thrift.TTransport, pf thrift.TProtocolFactory) {
+	in, out := pf.GetProtocol(t), pf.GetProtocol(t)
+	for {
+		ok, err := processor.Process(ctx, in, out)
+		if err, isTransport := err.(thrift.TTransportException); isTransport && err.TypeId() == thrift.END_OF_FILE {
+			return
+		} else if err != nil {
+			if id, ok := CallerFromContext(ctx); ok {
+				log.Debugf("error while serving %s: %v", id.Pretty(), err)
+			} else {
+				log.Debugf("error while serving request: %v", err)
+			}
+			return
+		}
+		if !ok {
+			return
+		}
+	}
+}
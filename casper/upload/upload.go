@@ -0,0 +1,370 @@
+// Package upload implements resumable uploads. Client creates a session
+// with the size of the file and sends its data in any number of requests,
+// each continuing from the offset stored in the session. Sessions are
+// kept in the repo datastore and their data in staging files, so that
+// upload can be resumed after dropped connection or restart of the node.
+package upload
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	"gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+)
+
+var log = logging.Logger("upload")
+
+const (
+	// DefaultTTL is the time session is kept after the last write
+	DefaultTTL = 24 * time.Hour
+	// StagingDir is the directory in repo where data of sessions is stored
+	StagingDir = "uploads"
+
+	sessionKeyPrefix = "/local/upload/"
+	idBytes          = 16
+)
+
+var (
+	ErrNotFound       = errors.New("upload session does not exist or expired")
+	ErrInvalidLength  = errors.New("upload length must be positive")
+	ErrOffsetMismatch = errors.New("offset does not match uploaded size")
+	ErrTooLarge       = errors.New("data exceeds upload length")
+	ErrIncomplete     = errors.New("upload is not complete")
+	ErrBusy           = errors.New("upload session is being written")
+)
+
+// Session is an upload of a single file.
+type Session struct {
+	ID   string
+	Name string
+	// Length is the size of the file
+	Length int64
+	// Offset is the number of bytes which were stored
+	Offset  int64
+	Created time.Time
+	Updated time.Time
+}
+
+// Complete checks if all data of the file was uploaded.
+func (s *Session) Complete() bool {
+	return s.Offset == s.Length
+}
+
+// mtx guards sessions in datastore and busy, because every
+// HTTP handler creates its own Store.
+var (
+	mtx  sync.Mutex
+	busy = make(map[string]bool)
+)
+
+type Store struct {
+	// TTL is the time session is kept after the last write
+	TTL time.Duration
+
+	ds  ds.Datastore
+	dir string
+}
+
+// NewStore returns store which keeps sessions in d and their data in dir.
+func NewStore(d ds.Datastore, dir string) *Store {
+	return &Store{TTL: DefaultTTL, ds: d, dir: dir}
+}
+
+// Create starts upload of the file with specified name and size.
+func (s *Store) Create(name string, length int64) (*Session, error) {
+	if length <= 0 {
+		return nil, ErrInvalidLength
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, err
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if err := s.cleanup(); err != nil {
+		log.Error(err)
+	}
+
+	now := time.Now()
+	sess := &Session{Name: name, Length: length, Created: now, Updated: now}
+	for sess.ID == "" {
+		id, err := genID()
+		if err != nil {
+			return nil, err
+		}
+		if has, err := s.ds.Has(sessionKey(id)); err != nil {
+			return nil, err
+		} else if !has {
+			sess.ID = id
+		}
+	}
+
+	f, err := os.OpenFile(s.dataPath(sess.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.Close(); err != nil {
+		return nil, err
+	}
+	if err = s.put(sess); err != nil {
+		return nil, err
+	}
+	log.Debugf("upload %s of %d bytes started", sess.ID, length)
+	return sess, nil
+}
+
+func (s *Store) Get(id string) (*Session, error) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	return s.get(id)
+}
+
+// Write appends data from r to the file. offset must be equal to the
+// number of bytes already stored. Data which was read from r before
+// error is kept, so that client can continue from the new offset.
+func (s *Store) Write(id string, offset int64, r io.Reader) (*Session, error) {
+	mtx.Lock()
+	sess, err := s.get(id)
+	if err == nil && busy[id] {
+		err = ErrBusy
+	}
+	if err == nil && offset != sess.Offset {
+		err = ErrOffsetMismatch
+	}
+	if err != nil {
+		mtx.Unlock()
+		return nil, err
+	}
+	busy[id] = true
+	mtx.Unlock()
+
+	n, werr := s.writeData(sess, r)
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	delete(busy, id)
+
+	if n > 0 {
+		sess.Offset += n
+		sess.Updated = time.Now()
+		if err = s.put(sess); err != nil {
+			return nil, err
+		}
+	}
+	return sess, werr
+}
+
+// writeData writes data from r after the stored part of the file
+// and returns number of written bytes.
+func (s *Store) writeData(sess *Session, r io.Reader) (int64, error) {
+	f, err := os.OpenFile(s.dataPath(sess.ID), os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	// drop data which was written but not recorded in session
+	if err = f.Truncate(sess.Offset); err != nil {
+		return 0, err
+	}
+	if _, err = f.Seek(sess.Offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(f, io.LimitReader(r, sess.Length-sess.Offset))
+	if serr := f.Sync(); err == nil {
+		err = serr
+	}
+	if err == nil && sess.Offset+n == sess.Length {
+		var b [1]byte
+		if m, _ := r.Read(b[:]); m > 0 {
+			err = ErrTooLarge
+		}
+	}
+	return n, err
+}
+
+// Commit calls add with data of the complete upload. Session is
+// removed if add succeeds and kept for another attempt otherwise.
+func (s *Store) Commit(id string, add func(f *os.File, sess *Session) error) error {
+	mtx.Lock()
+	sess, err := s.get(id)
+	if err == nil && busy[id] {
+		err = ErrBusy
+	}
+	if err == nil && !sess.Complete() {
+		err = ErrIncomplete
+	}
+	if err != nil {
+		mtx.Unlock()
+		return err
+	}
+	busy[id] = true
+	mtx.Unlock()
+
+	f, err := os.Open(s.dataPath(id))
+	if err == nil {
+		err = add(f, sess)
+		f.Close()
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	delete(busy, id)
+
+	if err != nil {
+		return err
+	}
+	log.Debugf("upload %s was committed", id)
+	return s.remove(id)
+}
+
+// List returns active sessions sorted by creation time.
+func (s *Store) List() ([]*Session, error) {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if err := s.cleanup(); err != nil {
+		return nil, err
+	}
+	return s.list()
+}
+
+// Remove aborts upload and removes its data.
+func (s *Store) Remove(id string) error {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if _, err := s.get(id); err != nil {
+		return err
+	}
+	if busy[id] {
+		return ErrBusy
+	}
+	return s.remove(id)
+}
+
+func sessionKey(id string) ds.Key {
+	return ds.NewKey(sessionKeyPrefix + id)
+}
+
+func (s *Store) dataPath(id string) string {
+	return filepath.Join(s.dir, id)
+}
+
+func (s *Store) expired(sess *Session, now time.Time) bool {
+	return s.TTL > 0 && now.Sub(sess.Updated) > s.TTL
+}
+
+func (s *Store) get(id string) (*Session, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+
+	v, err := s.ds.Get(sessionKey(id))
+	if err == ds.ErrNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	sess := &Session{}
+	if err = json.Unmarshal(v.([]byte), sess); err != nil {
+		return nil, err
+	}
+	if !busy[id] && s.expired(sess, time.Now()) {
+		log.Debugf("upload %s has expired", id)
+		if err = s.remove(id); err != nil {
+			log.Error(err)
+		}
+		return nil, ErrNotFound
+	}
+	return sess, nil
+}
+
+func (s *Store) put(sess *Session) error {
+	b, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	return s.ds.Put(sessionKey(sess.ID), b)
+}
+
+func (s *Store) remove(id string) error {
+	if err := os.Remove(s.dataPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return s.ds.Delete(sessionKey(id))
+}
+
+func (s *Store) list() ([]*Session, error) {
+	res, err := s.ds.Query(query.Query{Prefix: sessionKeyPrefix})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*Session
+	for _, e := range entries {
+		sess := &Session{}
+		if err = json.Unmarshal(e.Value.([]byte), sess); err != nil {
+			log.Errorf("invalid upload session at %s: %v", e.Key, err)
+			continue
+		}
+		sessions = append(sessions, sess)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Created.Before(sessions[j].Created) })
+	return sessions, nil
+}
+
+// cleanup removes sessions which were not written for TTL.
+func (s *Store) cleanup() error {
+	sessions, err := s.list()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, sess := range sessions {
+		if busy[sess.ID] || !s.expired(sess, now) {
+			continue
+		}
+		log.Debugf("upload %s has expired", sess.ID)
+		if err = s.remove(sess.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func genID() (string, error) {
+	b := make([]byte, idBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validID checks that id can be used as a file name.
+func validID(id string) bool {
+	if len(id) != 2*idBytes {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
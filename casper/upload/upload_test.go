@@ -0,0 +1,136 @@
+package upload
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+)
+
+func newTestStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "casper-upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewStore(dssync.MutexWrap(ds.NewMapDatastore()), dir), func() { os.RemoveAll(dir) }
+}
+
+// brokenReader returns data and then fails like a dropped connection.
+type brokenReader struct {
+	data []byte
+}
+
+func (r *brokenReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestResumeUpload(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	data := []byte("0123456789")
+	sess, err := s.Create("digits.txt", int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sess, err = s.Write(sess.ID, 0, &brokenReader{data[:4]})
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected write error, got %v", err)
+	}
+	if sess.Offset != 4 {
+		t.Fatalf("data before error must be kept, offset is %d", sess.Offset)
+	}
+	if _, err = s.Write(sess.ID, 2, bytes.NewReader(data[2:])); err != ErrOffsetMismatch {
+		t.Fatalf("expected ErrOffsetMismatch, got %v", err)
+	}
+	if err = s.Commit(sess.ID, nil); err != ErrIncomplete {
+		t.Fatalf("expected ErrIncomplete, got %v", err)
+	}
+
+	// session is loaded by a new store like after restart
+	s = NewStore(s.ds, s.dir)
+	if sess, err = s.Get(sess.ID); err != nil || sess.Offset != 4 {
+		t.Fatalf("unexpected session %+v: %v", sess, err)
+	}
+	if sess, err = s.Write(sess.ID, 4, bytes.NewReader(data[4:])); err != nil {
+		t.Fatal(err)
+	}
+	if !sess.Complete() {
+		t.Fatal("upload must be complete")
+	}
+
+	failed := errors.New("add failed")
+	err = s.Commit(sess.ID, func(f *os.File, sess *Session) error { return failed })
+	if err != failed {
+		t.Fatalf("expected add error, got %v", err)
+	}
+	err = s.Commit(sess.ID, func(f *os.File, sess *Session) error {
+		b, err := ioutil.ReadAll(f)
+		if err == nil && !bytes.Equal(b, data) {
+			err = errors.New("unexpected data " + string(b))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Get(sess.ID); err != ErrNotFound {
+		t.Fatalf("committed session must be removed, got %v", err)
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	if _, err := s.Create("", 0); err != ErrInvalidLength {
+		t.Fatalf("expected ErrInvalidLength, got %v", err)
+	}
+
+	sess, err := s.Create("", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err = s.Write(sess.ID, 0, bytes.NewReader([]byte("abcd")))
+	if err != ErrTooLarge || sess.Offset != 3 {
+		t.Fatalf("expected ErrTooLarge at offset 3, got %v", err)
+	}
+	if _, err = s.Get("../../etc/passwd"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestExpiredUpload(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	s.TTL = time.Millisecond
+	sess, err := s.Create("", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	sessions, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Fatalf("expired session must be removed: %v", sessions)
+	}
+	if _, err = os.Stat(s.dataPath(sess.ID)); !os.IsNotExist(err) {
+		t.Fatalf("data of expired session must be removed: %v", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	uuid "github.com/satori/go.uuid"
 
 	"gx/ipfs/QmNp85zy9RLrQ5oQD4hPyS39ezrrXpcaa7R4Y9kxdWQLLQ/go-cid"
+	"gx/ipfs/QmT8rehPR3F6bmwL6zjUN8XpiDBFFpMP2myPdC6ApsWfJf/go-base58"
 	"gx/ipfs/QmU9a9NV9RdPNwZQDYd5uKsm6N6LJLSvLbywDDYFbaaC6P/go-multihash"
 )
 
@@ -31,3 +32,17 @@ func UUIDToCid(uuid []byte) *cid.Cid {
 	mhash, _ := multihash.Sum(uuid, multihash.SHA2_256, -1)
 	return cid.NewCidV0(mhash)
 }
+
+// FileCid returns root CID of the file specified either by CID
+// or by base58 encoded UUID.
+func FileCid(hash string) (*cid.Cid, error) {
+	c, err := cid.Decode(hash)
+	if err != nil {
+		id := base58.Decode(hash)
+		if len(id) == 0 {
+			return nil, err
+		}
+		c = UUIDToCid(id)
+	}
+	return c, nil
+}
@@ -21,3 +21,17 @@ func TestUUIDToHash(t *testing.T) {
 		}
 	}
 }
+
+func TestFileCid(t *testing.T) {
+	c, err := uuid.FileCid("CTxVEi21hGKWz1ptGH7DUJ")
+	if err != nil || c.String() != "QmW6xj9bDgNBapeaW4WVuXEvLpriGLGbdVHtRmwQwwdVkK" {
+		t.Fatalf("unexpected CID of UUID: %v %v", c, err)
+	}
+	c, err = uuid.FileCid("QmXWZSRFViFme2o7oagVRKr97jBaxNrFvQ6NUffC8ytu4P")
+	if err != nil || c.String() != "QmXWZSRFViFme2o7oagVRKr97jBaxNrFvQ6NUffC8ytu4P" {
+		t.Fatalf("unexpected CID: %v %v", c, err)
+	}
+	if _, err = uuid.FileCid("0OIl"); err == nil {
+		t.Fatal("invalid hash must be rejected")
+	}
+}
@@ -2,20 +2,27 @@ package validation
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net"
 	"time"
 
 	cu "github.com/Casper-dev/Casper-server/casper/casper_utils"
+	"github.com/Casper-dev/Casper-server/casper/events"
+	"github.com/Casper-dev/Casper-server/casper/replication"
 	"github.com/Casper-dev/Casper-server/casper/sc"
 	scint "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
 	"github.com/Casper-dev/Casper-server/casper/thrift"
 
 	"github.com/Casper-dev/Casper-thrift/casperproto"
+
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
 )
 
 type Pinger struct {
+	// Replication holds jobs for files stored on banned providers
+	Replication      *replication.Queue
 	sc               scint.CasperSC
 	lastOverseerTime int64
 }
@@ -75,12 +82,15 @@ func (pinger *Pinger) checkNodeByHash(ctx context.Context, hash string) (err err
 	}
 	log.Infof("got ip: %s", ipRet)
 	host, _, err := net.SplitHostPort(ipRet)
-	if err != nil {
+	if err != nil && !thrift.IsPeerAddr(ipRet) {
 		log.Error(err)
 	}
 
 	success := false
-	if taddr := cu.GetLocalAddr().Thrift(); taddr == nil {
+	if thrift.IsPeerAddr(ipRet) {
+		// provider is reachable over libp2p only
+		success = pinger.pingNode(ctx, ipRet, hash)
+	} else if taddr := cu.GetLocalAddr().Thrift(); taddr == nil {
 		// TODO we probably should panic here
 		success = true ///It's not everyone's problem if current ip is wrong
 	} else if ip := net.ParseIP(host); ip != nil {
@@ -90,10 +100,14 @@ func (pinger *Pinger) checkNodeByHash(ctx context.Context, hash string) (err err
 	}
 
 	log.Infof("node '%s' validation succeeded: %t", hash, success)
+	if !success {
+		events.Publish(events.Event{Type: events.PingFailed, Peer: hash})
+	}
 	isBanned, err := pinger.sc.SendPingResult(hash, success)
 	if err != nil {
 		log.Error("error while validating TX:", err)
 	} else if isBanned {
+		events.Publish(events.Event{Type: events.ProviderBanned, Peer: hash})
 		log.Info("Go go replication~!")
 		go pinger.startReplication(ctx, hash)
 	}
@@ -102,7 +116,7 @@ func (pinger *Pinger) checkNodeByHash(ctx context.Context, hash string) (err err
 
 func (pinger *Pinger) pingNode(ctx context.Context, ip string, hash string) bool {
 	log.Infof("pinging: %s", ip)
-	timestamp, nodeID, err := callPing(ctx, ip)
+	timestamp, nodeID, err := callPing(ctx, ip, hash)
 	if err != nil {
 		log.Error("error during ping:", err)
 		return false
@@ -112,8 +126,12 @@ func (pinger *Pinger) pingNode(ctx context.Context, ip string, hash string) bool
 	return timestamp != 0 && hash == nodeID
 }
 
-func callPing(ctx context.Context, ip string) (int64, string, error) {
-	r, err := thrift.RunClientClosure(ip, func(c *thrift.ThriftClient) (interface{}, error) {
+func callPing(ctx context.Context, ip string, hash string) (int64, string, error) {
+	id, err := peer.IDB58Decode(hash)
+	if err != nil {
+		return 0, "", err
+	}
+	r, err := thrift.RunClientClosureTo(ip, id, func(c *thrift.ThriftClient) (interface{}, error) {
 		return c.Ping(ctx)
 	})
 	if err != nil {
@@ -139,46 +157,47 @@ func (pinger *Pinger) startReplication(ctx context.Context, hash string) (err er
 			continue
 		}
 		log.Infof("got file '%s' of size %d", id, size)
-		// Search for a new peer to store the file
-		go pinger.replicateFile(ctx, id, hash, size)
+		// Replication itself is performed by the queue
+		if _, _, err = pinger.Replication.Add(id, hash, size); err != nil {
+			log.Error(err)
+		}
 	}
 	return nil
 }
 
-func (pinger *Pinger) replicateFile(ctx context.Context, hash string, blockedAddress string, size int64) (ret string) {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Error("recovered in replicateFile():", r)
-		}
-	}()
+// ReplicateFile searches for a new peer to store the file
+// which was stored on banned provider.
+func (pinger *Pinger) ReplicateFile(ctx context.Context, hash string, blockedAddress string, size int64) error {
+	c, err := sc.GetContract()
+	if err != nil {
+		return err
+	}
 
-	peers, err := pinger.sc.GetPeers(size, replicateAttemptsCount)
+	peers, err := c.GetPeers(size, replicateAttemptsCount)
 	if err != nil {
-		log.Error(err)
-		return
+		return err
 	}
 
-	success := false
-	for _, peer := range peers {
-		ipPort, err := pinger.sc.GetRPCAddr(peer)
+	for _, p := range peers {
+		id, err := peer.IDB58Decode(p)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		ipPort, err := c.GetRPCAddr(p)
 		if err != nil {
 			log.Error(err)
 			continue
 		}
 
-		_, err = thrift.RunClientClosure(ipPort, func(thriftClient *thrift.ThriftClient) (interface{}, error) {
+		_, err = thrift.RunClientClosureTo(ipPort, id, func(thriftClient *thrift.ThriftClient) (interface{}, error) {
 			return thriftClient.SendReplicationQuery(ctx, hash, blockedAddress, size)
 		})
-
-		if success = err == nil; success {
-			break
+		if err == nil {
+			return nil
 		}
 		log.Error(err)
 	}
 
-	if !success {
-		log.Errorf("cannot replicate file '%s'", hash)
-	}
-
-	return
+	return errors.New("no peer has accepted the file")
 }
@@ -0,0 +1,189 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	bl "github.com/Casper-dev/Casper-server/blocks"
+	cu "github.com/Casper-dev/Casper-server/casper/casper_utils"
+	"github.com/Casper-dev/Casper-server/casper/sc"
+	uid "github.com/Casper-dev/Casper-server/casper/uuid"
+	"github.com/Casper-dev/Casper-server/core"
+	"github.com/Casper-dev/Casper-server/pin"
+
+	"gx/ipfs/QmNp85zy9RLrQ5oQD4hPyS39ezrrXpcaa7R4Y9kxdWQLLQ/go-cid"
+	node "gx/ipfs/QmPN7cwmpcc4DWXb4KTB9dNAJgjuPY69h3npsMfhRrQL9c/go-ipld-format"
+	pstore "gx/ipfs/QmPgDWmTmuzvP7QE5zwo1TmjbJme9pmZHNujB2453jkCTr/go-libp2p-peerstore"
+	blocks "gx/ipfs/QmSn9Td7xgxm9EV7iEjTckpUWmWApggzPxu7eFGWkkpwin/go-block-format"
+	"gx/ipfs/QmT8rehPR3F6bmwL6zjUN8XpiDBFFpMP2myPdC6ApsWfJf/go-base58"
+	ma "gx/ipfs/QmXY77cVe7rVRQXZZQRioukUM7aRW3BTcAgJe12MCtb3Ji/go-multiaddr"
+	"gx/ipfs/QmeS8cCKawUwejVrsBtmC1toTXmwVWZGiRJqzgTURVWeF9/go-ipfs-addr"
+)
+
+// repairing holds UUIDs which are being repaired at the moment,
+// because the same file can be reported as bad by both
+// local validation and consensus result from SC.
+var repairing = &sync.Map{}
+
+// RepairFile replaces local copy of the file with UUID uuid
+// with the one stored on other providers. Root block is always
+// fetched again, because it is addressed by UUID and can't be
+// checked by hash, while other blocks are fetched only if they are
+// missing or corrupted. Local blocks are replaced only after the
+// whole DAG has been fetched, so failed repair doesn't lose the copy
+// we have. After that the file is pinned again and update is
+// confirmed to SC.
+func RepairFile(ctx context.Context, n *core.IpfsNode, uuid string) error {
+	if _, loaded := repairing.LoadOrStore(uuid, struct{}{}); loaded {
+		log.Debugf("file %s is already being repaired", uuid)
+		return nil
+	}
+	defer repairing.Delete(uuid)
+
+	log.Infof("repairing file %s", uuid)
+	fileID := uid.UUIDToHash(base58.Decode(uuid)).B58String()
+	if err := connectStoringPeers(ctx, n, fileID); err != nil {
+		return err
+	}
+
+	root := uid.UUIDToCid(base58.Decode(uuid))
+	fetched, nd, err := fetchReplacement(ctx, n, root)
+	if err != nil {
+		return err
+	}
+	log.Infof("%d blocks of %s were refetched", len(fetched)-1, uuid)
+
+	if err = replaceBlocks(n, root, fetched); err != nil {
+		return err
+	}
+
+	size, err := nd.Size()
+	if err != nil {
+		return err
+	}
+
+	c, err := sc.GetContract()
+	if err != nil {
+		return err
+	}
+	return c.ConfirmUpdate(cu.GetLocalAddr().NodeHash(), fileID, int64(size))
+}
+
+// fetchReplacement fetches root and all blocks of its DAG which are
+// not valid locally from the network. Blocks are not written to the
+// blockstore by this function, fetched root node is returned.
+func fetchReplacement(ctx context.Context, n *core.IpfsNode, root *cid.Cid) ([]blocks.Block, node.Node, error) {
+	if n.Exchange == nil {
+		return nil, nil, fmt.Errorf("can't repair %s: node is offline", root)
+	}
+
+	b, err := n.Exchange.GetBlock(ctx, root)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't fetch root %s: %v", root, err)
+	}
+	nd, err := node.Decode(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fetched := []blocks.Block{b}
+	queue := nd.Links()
+	for len(queue) > 0 {
+		l := queue[0]
+		queue = queue[1:]
+
+		if !blockIsValid(n, l.Cid) {
+			if b, err = n.Exchange.GetBlock(ctx, l.Cid); err != nil {
+				return nil, nil, fmt.Errorf("can't fetch block %s: %v", l.Cid, err)
+			}
+			if !dataIsValid(l.Cid, b.RawData()) {
+				return nil, nil, fmt.Errorf("fetched block %s is corrupted", l.Cid)
+			}
+			fetched = append(fetched, b)
+		} else if b, err = n.Blockstore.Get(l.Cid); err != nil {
+			return nil, nil, err
+		}
+
+		child, err := node.Decode(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		queue = append(queue, child.Links()...)
+	}
+	return fetched, nd, nil
+}
+
+// replaceBlocks writes fetched blocks over local ones and pins root again.
+// Pin lock is held only here, so that pinning and GC are not blocked
+// while blocks are fetched.
+func replaceBlocks(n *core.IpfsNode, root *cid.Cid, fetched []blocks.Block) error {
+	defer n.Blockstore.PinLock().Unlock()
+
+	for _, b := range fetched {
+		// cached blockstore doesn't overwrite blocks it has,
+		// so the local copy is deleted first
+		if err := n.Blockstore.DeleteBlock(b.Cid()); err != nil {
+			log.Debugf("block %s is not stored locally: %v", b.Cid(), err)
+		}
+		if err := n.Blockstore.Put(b); err != nil {
+			return err
+		}
+	}
+
+	n.Pinning.RemovePinWithMode(root, pin.Recursive)
+	n.Pinning.PinWithMode(root, pin.Recursive)
+	return n.Pinning.Flush()
+}
+
+// blockIsValid returns true if block with CID id is stored locally
+// and its content matches the hash. Blocks with UUID are addressed
+// by UUID hash, so their content can't be checked and they are
+// considered invalid.
+func blockIsValid(n *core.IpfsNode, id *cid.Cid) bool {
+	b, err := n.Blockstore.Get(id)
+	if err != nil {
+		return false
+	}
+	return dataIsValid(id, b.RawData())
+}
+
+func dataIsValid(id *cid.Cid, raw []byte) bool {
+	u, data := bl.SplitData(raw)
+	if !uid.IsUUIDNull(u) {
+		return false
+	}
+	sum, err := id.Prefix().Sum(data)
+	return err == nil && sum.Equals(id)
+}
+
+func connectStoringPeers(ctx context.Context, n *core.IpfsNode, fileID string) error {
+	peers, err := cu.GetPeersMultiaddrsByHash(fileID)
+	if err != nil && len(peers) == 0 {
+		return err
+	}
+
+	connected := 0
+	for _, p := range peers {
+		addr, err := ipfsaddr.ParseMultiaddr(p)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if addr.ID() == n.Identity {
+			continue
+		}
+
+		pi := pstore.PeerInfo{ID: addr.ID(), Addrs: []ma.Multiaddr{addr.Transport()}}
+		if err = n.PeerHost.Connect(ctx, pi); err != nil {
+			log.Infof("can't connect to %s: %v", p, err)
+			continue
+		}
+		connected++
+	}
+
+	if connected == 0 {
+		return fmt.Errorf("no providers of %s are reachable", fileID)
+	}
+	return nil
+}
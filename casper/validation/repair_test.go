@@ -0,0 +1,51 @@
+package validation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Casper-dev/Casper-server/blocks"
+	uid "github.com/Casper-dev/Casper-server/casper/uuid"
+	"github.com/Casper-dev/Casper-server/core"
+	dag "github.com/Casper-dev/Casper-server/merkledag"
+)
+
+func TestBlockIsValid(t *testing.T) {
+	n, err := core.NewNode(context.Background(), &core.BuildCfg{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	nd := dag.NodeWithData([]byte("data"))
+	if blockIsValid(n, nd.Cid()) {
+		t.Fatal("missing block must not be valid")
+	}
+	id, err := n.DAG.Add(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !blockIsValid(n, id) {
+		t.Fatal("block must be valid")
+	}
+
+	bad, err := blocks.NewBlockWithCid(append(uid.NullUUID, []byte("corrupted")...), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = n.Blockstore.Put(bad); err != nil {
+		t.Fatal(err)
+	}
+	if blockIsValid(n, id) {
+		t.Fatal("corrupted block must not be valid")
+	}
+
+	nd = dag.NodeWithData([]byte("data"))
+	nd.SetUUID(uid.GenUUID())
+	if id, err = n.DAG.Add(nd); err != nil {
+		t.Fatal(err)
+	}
+	if blockIsValid(n, id) {
+		t.Fatal("block with UUID must be refetched")
+	}
+}
@@ -2,13 +2,17 @@ package validation
 
 import (
 	"context"
-	"fmt"
-	"math/rand"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	mrand "math/rand"
 	"net"
 	"sync"
 	"time"
 
 	cu "github.com/Casper-dev/Casper-server/casper/casper_utils"
+	"github.com/Casper-dev/Casper-server/casper/events"
+	"github.com/Casper-dev/Casper-server/casper/sc"
 	thrift "github.com/Casper-dev/Casper-server/casper/thrift"
 	uid "github.com/Casper-dev/Casper-server/casper/uuid"
 	"github.com/Casper-dev/Casper-server/core"
@@ -17,32 +21,84 @@ import (
 
 	node "gx/ipfs/QmPN7cwmpcc4DWXb4KTB9dNAJgjuPY69h3npsMfhRrQL9c/go-ipld-format"
 	"gx/ipfs/QmT8rehPR3F6bmwL6zjUN8XpiDBFFpMP2myPdC6ApsWfJf/go-base58"
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
 	"gx/ipfs/QmeS8cCKawUwejVrsBtmC1toTXmwVWZGiRJqzgTURVWeF9/go-ipfs-addr"
-	//"gx/ipfs/QmX3U3YXCQ6UYBxq2LVWF8dARS1hPUTEYLrSx654Qyxyw6/go-multiaddr-net"
 )
 
+var ErrNotEnoughProviders = errors.New("not enough providers joined validation")
+
+// RunningCheck holds the state of a single validation of an UUID.
+// The same structure is used both by initiator and by other providers.
 type RunningCheck struct {
-	info    *casperproto.ChunkInfo
-	round   *round
-	nodes   []*cu.ExternalAddr
+	info  *casperproto.ChunkInfo
+	round *round
+	nodes []*cu.ExternalAddr
+	// results maps node ID to the checksum it has reported
 	results map[string]string
-	mtx     sync.Mutex
+	// verdicts maps node ID to the checksums it expects from every node;
+	// it is filled on initiator only
+	verdicts map[string]map[string]string
+	mtx      sync.Mutex
 }
 
 func NewRunningCheck(cinfo *casperproto.ChunkInfo) *RunningCheck {
 	return &RunningCheck{
-		info:    cinfo,
-		mtx:     sync.Mutex{},
-		nodes:   make([]*cu.ExternalAddr, 0, NumChunkStoringNodes),
-		results: make(map[string]string, NumChunkStoringNodes),
+		info:     cinfo,
+		mtx:      sync.Mutex{},
+		nodes:    make([]*cu.ExternalAddr, 0, NumChunkStoringNodes),
+		results:  make(map[string]string, NumChunkStoringNodes),
+		verdicts: make(map[string]map[string]string, NumChunkStoringNodes),
+	}
+}
+
+// startRound replaces current round with the new one. If ready
+// condition is already satisfied, round is finished immediately.
+// ready is always called with rc.mtx held.
+func (rc *RunningCheck) startRound(timeout time.Duration, ready func() bool) *round {
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+
+	rc.round = newRound(timeout)
+	if ready() {
+		rc.round.Broadcast()
+	}
+	return rc.round
+}
+
+// finishRoundIf finishes current round if ready condition is satisfied.
+// Must be called with rc.mtx held.
+func (rc *RunningCheck) finishRoundIf(ready func() bool) {
+	if rc.round != nil && ready() {
+		rc.round.Broadcast()
+	}
+}
+
+func (rc *RunningCheck) allProvidersJoined() bool {
+	return len(rc.nodes) >= NumChunkStoringNodes
+}
+
+func (rc *RunningCheck) allChecksumsReceived() bool {
+	return len(rc.nodes) > 0 && len(rc.results) >= len(rc.nodes)
+}
+
+func (rc *RunningCheck) allVerdictsReceived() bool {
+	return len(rc.nodes) > 0 && len(rc.verdicts) >= len(rc.nodes)
+}
+
+func (rc *RunningCheck) hasNode(id string) bool {
+	for _, n := range rc.nodes {
+		if n.NodeHash() == id {
+			return true
+		}
 	}
+	return false
 }
 
 // round is like sync.Cond but also performs Broadcast after specified timeout
 type round struct {
-	cond   *sync.Cond
-	timer  *time.Timer
-	result interface{}
+	cond  *sync.Cond
+	timer *time.Timer
+	done  bool
 }
 
 func newRound(timeout time.Duration) *round {
@@ -51,154 +107,259 @@ func newRound(timeout time.Duration) *round {
 	return r
 }
 
+// Wait blocks until Broadcast is called or timeout expires.
 func (r *round) Wait() {
-	r.cond.Wait()
+	r.cond.L.Lock()
+	for !r.done {
+		r.cond.Wait()
+	}
+	r.cond.L.Unlock()
 }
 
 func (r *round) Broadcast() {
-	if r.timer != nil && !r.timer.Stop() {
-		<-r.timer.C
+	r.cond.L.Lock()
+	defer r.cond.L.Unlock()
+
+	if r.done {
+		return
 	}
+	r.done = true
+	r.timer.Stop()
 	r.cond.Broadcast()
 }
 
 var uuidProvMap = &sync.Map{}
 
-const NumChunkStoringNodes = 2
+// loadCheck returns running check for the specified UUID creating it if
+// necessary. Messages from other providers can arrive before we receive
+// ChunkInfo, so they are buffered in a check without info until it arrives.
+func loadCheck(uuid string) *RunningCheck {
+	v, loaded := uuidProvMap.LoadOrStore(uuid, NewRunningCheck(nil))
+	rc := v.(*RunningCheck)
+	if !loaded {
+		time.AfterFunc(round1Timeout, func() {
+			rc.mtx.Lock()
+			defer rc.mtx.Unlock()
+			if rc.info == nil {
+				uuidProvMap.Delete(uuid)
+			}
+		})
+	}
+	return rc
+}
 
-//const sendChunkInfoTimeout = 1 * time.Minute
-const sendChunkInfoTimeout = 10 * time.Second
-const sendChecksumTimeout = 10 * time.Second
-const sendVerificationQueryTimeout = 10 * time.Second
+// NumChunkStoringNodes is a number of nodes storing every file (including initiator).
+const NumChunkStoringNodes = 4
+
+const sendChunkInfoTimeout = 1 * time.Minute
+const sendChecksumTimeout = 1 * time.Minute
+const sendVerificationQueryTimeout = 1 * time.Minute
 const round1Timeout = 5 * time.Minute
 
 const validateBlockSize int64 = 1024
 const diffuseLength = 16
 
-func PerformValidation(ctx context.Context, n *core.IpfsNode, uuid string) error {
-	rc := NewRunningCheck(nil)
-	uuidProvMap.Store(uuid, rc)
-	defer uuidProvMap.Delete(uuid)
+// Report contains results of validation performed by initiator.
+type Report struct {
+	UUID string
+	// Nodes contains IDs of all nodes which took part in validation
+	Nodes []string
+	// Dissenters contains IDs of nodes which store bad copy of the file
+	Dissenters []string
+}
+
+// PerformValidation initiates validation of the specified UUID.
+// All storing nodes must join validation via SendVerificationQuery;
+// after that every node calculates checksum of the same random chunk,
+// salted with its own ID, and checks checksums of all other nodes.
+// Node is considered a dissenter if majority of other nodes disagree
+// with its checksum. The result is reported to SC.
+func PerformValidation(ctx context.Context, n *core.IpfsNode, uuid string) (report *Report, err error) {
+	defer func() { publishReport(uuid, report, err) }()
 
 	node, err := n.DAG.Get(ctx, uid.UUIDToCid(base58.Decode(uuid)))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	rc.info, err = getRandomChunk(ctx, n, node, uuid, validateBlockSize)
+	info, err := getRandomChunk(ctx, n, node, uuid, validateBlockSize)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	log.Debugf("Random chunk %v %d %d", rc.info.UUID, rc.info.First, rc.info.Last)
-
 	localAddr := cu.GetLocalAddr()
-	rc.nodes = append(rc.nodes, localAddr)
-	rc.info.Providers = append(rc.info.Providers, &casperproto.NodeInfo{IpfsAddr: localAddr.String(), ThriftAddr: localAddr.Thrift().String()})
+	info.Initiator = localAddr.NodeHash()
+	info.Providers = append(info.Providers, &casperproto.NodeInfo{IpfsAddr: localAddr.String(), ThriftAddr: localAddr.Thrift().String()})
 
+	rc := NewRunningCheck(info)
+	rc.nodes = append(rc.nodes, localAddr)
 	uuidProvMap.Store(uuid, rc)
 	defer uuidProvMap.Delete(uuid)
 
-	log.Info("Sleep for %s", sendVerificationQueryTimeout)
-	time.Sleep(sendVerificationQueryTimeout)
-	log.Debugf("Nodes after sleep: %+v", rc.nodes)
+	log.Debugf("Random chunk %v %d %d", rc.info.UUID, rc.info.First, rc.info.Last)
+
+	// Let other storing nodes know that they should join validation
+	if c, err := sc.GetContract(); err != nil {
+		log.Error(err)
+	} else if err = c.NotifyVerificationTarget(localAddr.NodeHash(), uuid); err != nil {
+		log.Error(err)
+	}
+
+	rc.startRound(sendVerificationQueryTimeout, rc.allProvidersJoined).Wait()
 
-	// TODO: Call SC and initiate checking of specified uuid
+	rc.mtx.Lock()
+	nodes := append([]*cu.ExternalAddr{}, rc.nodes...)
+	rc.mtx.Unlock()
+	log.Debugf("Nodes joined validation: %+v", nodes)
+
+	// majority cannot be determined with less than 3 nodes
+	if len(nodes) < 3 {
+		return nil, ErrNotEnoughProviders
+	}
 
 	// Perform SendChunkInfo calls on all providers
-	//rc.round = newRound(sendChunkInfoTimeout)
 	wg := &sync.WaitGroup{}
-	for _, prov := range rc.nodes[1:] {
+	for _, prov := range nodes[1:] {
 		log.Debugf("SendChunkInfo to %s", prov)
 		wg.Add(1)
-		go func(addr string) {
+		go func(prov *cu.ExternalAddr) {
 			defer wg.Done()
-			thrift.RunClientClosure(addr, func(c *thrift.ThriftClient) (interface{}, error) {
+			_, err := thrift.RunClientClosureTo(prov.Thrift().String(), prov.IPFS().ID(), func(c *thrift.ThriftClient) (interface{}, error) {
 				return nil, c.SendChunkInfo(ctx, rc.info)
 			})
-		}(prov.Thrift().String())
+			if err != nil {
+				log.Error(err)
+			}
+		}(prov)
 	}
 	wg.Wait()
-	//rc.round.Wait()
-
-	// Send all nodes checksum
-	salt := getSalt(rc.info.Diffuse, n.Identity.String())
-	cs, err := ChecksumSalt(ctx, node, rc.info.First, rc.info.Last, n.DAG, salt)
-	log.Debugf("Calculated checksum:", cs.B58String())
-	//rc.round = newRound(sendChecksumTimeout)
-	for _, prov := range rc.nodes {
-		log.Debugf("SendChecksumHash to %s", prov)
-		go func(addr string) {
-			thrift.RunClientClosure(addr, func(c *thrift.ThriftClient) (interface{}, error) {
-				return nil, c.SendChecksumHash(ctx, rc.info.UUID, localAddr.String(), cs.B58String())
-			})
-		}(prov.Thrift().String())
+
+	cs, err := ChecksumSalt(ctx, node, info.First, info.Last, n.DAG, getSalt(info.Diffuse, localAddr.NodeHash()))
+	if err != nil {
+		return nil, err
 	}
-	time.Sleep(sendChecksumTimeout)
-	//rc.round.Wait()
+	log.Debugf("Calculated checksum: %s", cs.B58String())
+	sendChecksum(ctx, rc, nodes, localAddr, cs.B58String())
+	rc.startRound(sendChecksumTimeout, rc.allChecksumsReceived).Wait()
 
-	// Wait until results all results arrive
-	//rc.round = newRound(round1Timeout)
-	// Perform a call to SC
+	rc.mtx.Lock()
+	results := copyMap(rc.results)
+	rc.mtx.Unlock()
 
-	return nil
+	verdict, err := calcVerdict(ctx, node, info, n.DAG, results)
+	if err != nil {
+		return nil, err
+	}
+	AddValidationResults(ctx, uuid, localAddr.IPFS(), verdict)
+	rc.startRound(round1Timeout, rc.allVerdictsReceived).Wait()
+
+	rc.mtx.Lock()
+	report, voters, consensus := calcConsensus(uuid, nodes, rc.results, rc.verdicts)
+	rc.mtx.Unlock()
+	log.Infof("Validation of %s finished: dissenters %v", uuid, report.Dissenters)
+
+	c, err := sc.GetContract()
+	if err != nil {
+		return report, err
+	}
+	return report, c.CheckVerification(uuid, voters, consensus)
 }
 
-func RegisterUUIDProvider(uuid string, ipfsAddr ipfsaddr.IPFSAddr, tAddr net.Addr) {
-	log.Debugf("Dumping current UUID map")
-	uuidProvMap.Range(func(k, v interface{}) bool {
-		log.Debugf("%s: %s", k, v)
-		return true
+// publishReport publishes result of validation initiated by this node.
+func publishReport(uuid string, report *Report, err error) {
+	e := events.Event{Type: events.ValidationPassed, UUID: uuid}
+	if report != nil {
+		e.Dissenters = report.Dissenters
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if err != nil || len(e.Dissenters) != 0 {
+		e.Type = events.ValidationFailed
+	}
+	events.Publish(e)
+}
+
+// JoinValidation lets initiator know that the node with
+// specified address stores UUID and is ready to validate it.
+func JoinValidation(ctx context.Context, initiator peer.ID, initiatorAddr string, uuid string, localAddr *cu.ExternalAddr) error {
+	_, err := thrift.RunClientClosureTo(initiatorAddr, initiator, func(c *thrift.ThriftClient) (interface{}, error) {
+		return nil, c.SendVerificationQuery(ctx, uuid, &casperproto.NodeInfo{
+			IpfsAddr:   localAddr.IPFS().String(),
+			ThriftAddr: localAddr.Thrift().String(),
+		})
 	})
-	if v, ok := uuidProvMap.Load(uuid); ok {
-		log.Debugf("Store UUID %s, addr %s %s", ipfsAddr, tAddr)
-		rc := v.(*RunningCheck)
-		rc.mtx.Lock()
-
-		rc.nodes = append(rc.nodes, &cu.ExternalAddr{ipfsAddr, tAddr.(*net.TCPAddr)})
-		ninfo := casperproto.NodeInfo{IpfsAddr: ipfsAddr.String(), ThriftAddr: tAddr.String()}
-		rc.info.Providers = append(rc.info.Providers, &ninfo)
-		if len(rc.info.Providers) == NumChunkStoringNodes { // all nodes except current
-			log.Debugf("Received info about UUID %s for %d nodes", uuid, NumChunkStoringNodes)
-			//rc.round.Broadcast()
-		}
-		fmt.Println(rc.info.Providers)
+	return err
+}
+
+func RegisterUUIDProvider(uuid string, ipfsAddr ipfsaddr.IPFSAddr, tAddr net.Addr) {
+	v, ok := uuidProvMap.Load(uuid)
+	if !ok {
+		log.Debugf("No validation of UUID %s is running", uuid)
+		return
+	}
+
+	log.Debugf("Store UUID %s, addr %s %s", uuid, ipfsAddr, tAddr)
+	rc := v.(*RunningCheck)
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
 
-		rc.mtx.Unlock()
+	if rc.info == nil || rc.hasNode(ipfsAddr.ID().Pretty()) || rc.allProvidersJoined() {
+		return
 	}
+
+	rc.nodes = append(rc.nodes, &cu.ExternalAddr{IPFSAddr: ipfsAddr, ThriftAddr: tAddr.(*net.TCPAddr)})
+	ninfo := casperproto.NodeInfo{IpfsAddr: ipfsAddr.String(), ThriftAddr: tAddr.String()}
+	rc.info.Providers = append(rc.info.Providers, &ninfo)
+	if rc.allProvidersJoined() {
+		log.Debugf("Received info about UUID %s for %d nodes", uuid, NumChunkStoringNodes)
+	}
+	rc.finishRoundIf(rc.allProvidersJoined)
 }
 
+// AddRound1Result stores checksum reported by some node.
 func AddRound1Result(ctx context.Context, uuid string, ipfsAddr ipfsaddr.IPFSAddr, hashDiffuse string) {
-	if v, ok := uuidProvMap.Load(uuid); ok {
-		rc := v.(*RunningCheck)
-		rc.mtx.Lock()
-
-		log.Debugf("Old results: %+v", rc.results)
-		rc.results[ipfsAddr.ID().Pretty()] = hashDiffuse
-		log.Debugf("New results: %+v", rc.results)
-		if len(rc.results) == NumChunkStoringNodes {
-			//	rc.round.Broadcast()
-		}
+	rc := loadCheck(uuid)
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+
+	rc.results[ipfsAddr.ID().Pretty()] = hashDiffuse
+	log.Debugf("Checksums for %s: %+v", uuid, rc.results)
+	rc.finishRoundIf(rc.allChecksumsReceived)
+}
 
-		rc.mtx.Unlock()
-	} else {
-		log.Debugf("No value stored for UUID %s", uuid)
+// AddValidationResults stores checksums that some node expects from every node.
+func AddValidationResults(ctx context.Context, uuid string, ipfsAddr ipfsaddr.IPFSAddr, addrToHash map[string]string) {
+	v, ok := uuidProvMap.Load(uuid)
+	if !ok {
+		log.Debugf("No validation of UUID %s is running", uuid)
+		return
 	}
+
+	rc := v.(*RunningCheck)
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+
+	rc.verdicts[ipfsAddr.ID().Pretty()] = addrToHash
+	rc.finishRoundIf(rc.allVerdictsReceived)
 }
 
+// CollectResultsAndRespond is performed by every storing node
+// after it has received ChunkInfo from initiator.
 func CollectResultsAndRespond(ctx context.Context, cinfo *casperproto.ChunkInfo, configRoot string) {
-	rc := NewRunningCheck(cinfo)
-	uuidProvMap.Store(cinfo.UUID, rc)
+	rc := loadCheck(cinfo.UUID)
 	defer uuidProvMap.Delete(cinfo.UUID)
 
 	repo, err := fsrepo.Open(configRoot)
 	if err != nil {
+		log.Error(err)
 		return
 	}
 	log.Debugf("Got repo")
 
 	n, err := core.NewNode(ctx, &core.BuildCfg{Online: false, Repo: repo})
 	if err != nil {
+		log.Error(err)
 		return
 	}
 	log.Debugf("Got core node")
@@ -206,17 +367,20 @@ func CollectResultsAndRespond(ctx context.Context, cinfo *casperproto.ChunkInfo,
 	id := uid.UUIDToCid(base58.Decode(cinfo.UUID))
 	node, err := n.DAG.Get(ctx, id)
 	if err != nil {
+		log.Error(err)
 		return
 	}
 	log.Debugf("Got ipld node")
 
-	salt := getSalt(cinfo.Diffuse, n.Identity.String())
-	cs, err := ChecksumSalt(ctx, node, cinfo.First, cinfo.Last, n.DAG, salt)
-	log.Debugf("Checksum:", cs.B58String())
+	localAddr := cu.GetLocalAddr()
+	cs, err := ChecksumSalt(ctx, node, cinfo.First, cinfo.Last, n.DAG, getSalt(cinfo.Diffuse, localAddr.NodeHash()))
 	if err != nil {
+		log.Error(err)
 		return
 	}
+	log.Debugf("Checksum: %s", cs.B58String())
 
+	var nodes []*cu.ExternalAddr
 	for _, prov := range cinfo.Providers {
 		addr, err := ipfsaddr.ParseString(prov.IpfsAddr)
 		if err != nil {
@@ -228,29 +392,129 @@ func CollectResultsAndRespond(ctx context.Context, cinfo *casperproto.ChunkInfo,
 			log.Error(err)
 			continue
 		}
-		rc.nodes = append(rc.nodes, &cu.ExternalAddr{addr, taddr})
+		nodes = append(nodes, &cu.ExternalAddr{IPFSAddr: addr, ThriftAddr: taddr})
+	}
+	if len(nodes) == 0 {
+		log.Errorf("no providers in chunk info for %s", cinfo.UUID)
+		return
 	}
 
-	rc.results[n.Identity.Pretty()] = cs.B58String()
-	log.Debugf("Sleep chunk info: %s", sendChunkInfoTimeout)
-	time.Sleep(sendChunkInfoTimeout)
+	rc.mtx.Lock()
+	rc.info = cinfo
+	rc.nodes = nodes
+	rc.mtx.Unlock()
 
-	localAddr := cu.GetLocalAddr()
-	//rc.round = newRound(sendChecksumTimeout)
-	for _, prov := range rc.nodes {
-		go func(addr string) {
-			thrift.RunClientClosure(addr, func(c *thrift.ThriftClient) (interface{}, error) {
-				return nil, c.SendChecksumHash(ctx, cinfo.UUID, localAddr.IPFS().String(), cs.B58String())
-			})
-		}(prov.Thrift().String())
+	sendChecksum(ctx, rc, nodes, localAddr, cs.B58String())
+	rc.startRound(sendChecksumTimeout, rc.allChecksumsReceived).Wait()
+
+	rc.mtx.Lock()
+	results := copyMap(rc.results)
+	rc.mtx.Unlock()
+
+	verdict, err := calcVerdict(ctx, node, cinfo, n.DAG, results)
+	if err != nil {
+		log.Error(err)
+		return
 	}
-	//rc.round.Wait()
-	time.Sleep(sendChecksumTimeout)
 
-	// TODO send only to first
-	thrift.RunClientClosure(rc.nodes[0].Thrift().String(), func(c *thrift.ThriftClient) (interface{}, error) {
-		return nil, c.SendValidationResults(ctx, cinfo.UUID, localAddr.String(), rc.results)
+	// first node is always initiator
+	_, err = thrift.RunClientClosureTo(nodes[0].Thrift().String(), nodes[0].IPFS().ID(), func(c *thrift.ThriftClient) (interface{}, error) {
+		return nil, c.SendValidationResults(ctx, cinfo.UUID, localAddr.String(), verdict)
 	})
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// sendChecksum stores local checksum and sends it to all other nodes.
+func sendChecksum(ctx context.Context, rc *RunningCheck, nodes []*cu.ExternalAddr, localAddr *cu.ExternalAddr, cs string) {
+	AddRound1Result(ctx, rc.info.UUID, localAddr.IPFS(), cs)
+	for _, prov := range nodes {
+		if prov.NodeHash() == localAddr.NodeHash() {
+			continue
+		}
+		log.Debugf("SendChecksumHash to %s", prov)
+		go func(prov *cu.ExternalAddr) {
+			_, err := thrift.RunClientClosureTo(prov.Thrift().String(), prov.IPFS().ID(), func(c *thrift.ThriftClient) (interface{}, error) {
+				return nil, c.SendChecksumHash(ctx, rc.info.UUID, localAddr.String(), cs)
+			})
+			if err != nil {
+				log.Error(err)
+			}
+		}(prov)
+	}
+}
+
+// calcVerdict calculates checksums which every node from results must have
+// reported, if it stores the same data as the current node.
+func calcVerdict(ctx context.Context, n node.Node, cinfo *casperproto.ChunkInfo, serv node.NodeGetter, results map[string]string) (map[string]string, error) {
+	data, err := GetSlice(ctx, n, uint64(cinfo.First), uint64(cinfo.Last), serv)
+	if err != nil {
+		return nil, err
+	}
+
+	verdict := make(map[string]string, len(results))
+	for id := range results {
+		verdict[id] = CalcChecksum(data, getSalt(cinfo.Diffuse, id)).B58String()
+	}
+	return verdict, nil
+}
+
+// calcConsensus builds consensus matrix for SC and determines dissenting nodes.
+// Node is a dissenter if it hasn't reported its checksum or
+// if majority of other nodes disagree with it.
+// Nodes which haven't sent their verdict are left out of the matrix,
+// otherwise SC would count their empty rows as disagreement with everyone;
+// IDs of nodes in the matrix are returned as voters.
+func calcConsensus(uuid string, nodes []*cu.ExternalAddr, results map[string]string, verdicts map[string]map[string]string) (report *Report, voters []string, consensus [][]bool) {
+	report = &Report{UUID: uuid}
+	for _, n := range nodes {
+		report.Nodes = append(report.Nodes, n.NodeHash())
+	}
+
+	agrees := func(voter, id string) bool {
+		cs, ok := results[id]
+		return ok && verdicts[voter][id] == cs
+	}
+
+	for _, id := range report.Nodes {
+		if verdicts[id] != nil {
+			voters = append(voters, id)
+		}
+	}
+	consensus = make([][]bool, len(voters))
+	for i, voter := range voters {
+		consensus[i] = make([]bool, len(voters))
+		for j, id := range voters {
+			consensus[i][j] = agrees(voter, id)
+		}
+	}
+
+	for _, id := range report.Nodes {
+		agree, disagree := 0, 0
+		for _, voter := range voters {
+			if voter == id {
+				continue
+			}
+			if agrees(voter, id) {
+				agree++
+			} else {
+				disagree++
+			}
+		}
+		if _, ok := results[id]; !ok || disagree > agree {
+			report.Dissenters = append(report.Dissenters, id)
+		}
+	}
+	return report, voters, consensus
+}
+
+func copyMap(m map[string]string) map[string]string {
+	ret := make(map[string]string, len(m))
+	for k, v := range m {
+		ret[k] = v
+	}
+	return ret
 }
 
 func getRandomChunk(ctx context.Context, n *core.IpfsNode, node node.Node, uuid string, blocksize int64) (*casperproto.ChunkInfo, error) {
@@ -259,25 +523,29 @@ func getRandomChunk(ctx context.Context, n *core.IpfsNode, node node.Node, uuid
 		return nil, err
 	}
 
-	rind := rand.Int63n((int64(size) / blocksize) + 1)
+	rind := mrand.Int63n((int64(size) / blocksize) + 1)
 	first := rind * blocksize
 	last := (rind + 1) * blocksize
 	if last > int64(size) {
 		last = int64(size)
 	}
 
+	// diffuse must be unpredictable, otherwise nodes could precompute checksums
 	diffuse := make([]byte, diffuseLength)
-	rand.Read(diffuse)
+	if _, err = rand.Read(diffuse); err != nil {
+		return nil, err
+	}
 	return &casperproto.ChunkInfo{
 		UUID:      uuid,
 		First:     first,
 		Last:      last,
 		Providers: make([]*casperproto.NodeInfo, 0, NumChunkStoringNodes),
-		Diffuse:   string(diffuse),
+		Diffuse:   hex.EncodeToString(diffuse),
 	}, nil
 }
 
-func getSalt(a, b string) []byte {
-	return []byte{}
-	return []byte(a + b)
+// getSalt returns salt which is unique for every node
+// so that nodes cannot reuse checksums of each other.
+func getSalt(diffuse, nodeID string) []byte {
+	return []byte(diffuse + nodeID)
 }
@@ -0,0 +1,124 @@
+package validation
+
+import (
+	"testing"
+	"time"
+
+	cu "github.com/Casper-dev/Casper-server/casper/casper_utils"
+
+	"gx/ipfs/QmeS8cCKawUwejVrsBtmC1toTXmwVWZGiRJqzgTURVWeF9/go-ipfs-addr"
+)
+
+var testPeers = []string{
+	"QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ",
+	"QmSoLPppuBtQSGwKDZT2M73ULpjvfd3aZ6ha4oFGL1KrGM",
+	"QmSoLSafTMBsPKadTEgaXctDQVcqN88CNLHXMkTNwMKPnu",
+	"QmSoLV4Bbm51jM9C4gDYZQ9Cy3U6aXMJDAbzgu2fzaDs64",
+}
+
+func testNodes(t *testing.T) []*cu.ExternalAddr {
+	var nodes []*cu.ExternalAddr
+	for _, p := range testPeers {
+		addr, err := ipfsaddr.ParseString("/ip4/127.0.0.1/tcp/4001/ipfs/" + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, &cu.ExternalAddr{IPFSAddr: addr})
+	}
+	return nodes
+}
+
+func TestCalcConsensus(t *testing.T) {
+	nodes := testNodes(t)
+	data := []byte("some data")
+	results := make(map[string]string)
+	for _, p := range testPeers {
+		results[p] = CalcChecksum(data, getSalt("diffuse", p)).B58String()
+	}
+	// the last node stores corrupted data
+	bad := testPeers[3]
+	results[bad] = CalcChecksum([]byte("other data"), getSalt("diffuse", bad)).B58String()
+
+	verdicts := make(map[string]map[string]string)
+	for i, p := range testPeers {
+		d := data
+		if i == 3 {
+			d = []byte("other data")
+		}
+		verdicts[p] = make(map[string]string)
+		for _, q := range testPeers {
+			verdicts[p][q] = CalcChecksum(d, getSalt("diffuse", q)).B58String()
+		}
+	}
+
+	report, voters, consensus := calcConsensus("uuid", nodes, results, verdicts)
+	if len(report.Nodes) != len(testPeers) {
+		t.Fatalf("unexpected number of nodes: %d", len(report.Nodes))
+	}
+	if len(voters) != len(testPeers) {
+		t.Fatalf("unexpected number of voters: %d", len(voters))
+	}
+	if len(report.Dissenters) != 1 || report.Dissenters[0] != bad {
+		t.Fatalf("expected %s to be the only dissenter, got %v", bad, report.Dissenters)
+	}
+	if !consensus[0][1] || consensus[0][3] || consensus[3][0] || !consensus[3][3] {
+		t.Fatalf("unexpected consensus matrix: %v", consensus)
+	}
+
+	// node which has not reported checksum is a dissenter too
+	delete(results, testPeers[1])
+	delete(verdicts, testPeers[1])
+	report, voters, consensus = calcConsensus("uuid", nodes, results, verdicts)
+	if len(report.Dissenters) != 2 || report.Dissenters[0] != testPeers[1] {
+		t.Fatalf("unexpected dissenters: %v", report.Dissenters)
+	}
+	// and it is left out of the matrix sent to SC
+	if len(voters) != 3 || len(consensus) != 3 || len(consensus[0]) != 3 {
+		t.Fatalf("non-voter must not be in the matrix: %v %v", voters, consensus)
+	}
+	for _, v := range voters {
+		if v == testPeers[1] {
+			t.Fatalf("non-voter must not be in the matrix: %v", voters)
+		}
+	}
+}
+
+func TestRound(t *testing.T) {
+	rc := NewRunningCheck(nil)
+	rc.nodes = testNodes(t)
+
+	// condition is satisfied before round has started
+	rc.results = map[string]string{testPeers[0]: "", testPeers[1]: "", testPeers[2]: "", testPeers[3]: ""}
+	r := rc.startRound(time.Minute, rc.allChecksumsReceived)
+	waitRound(t, r, time.Second)
+
+	// condition is satisfied while waiting
+	rc.verdicts = make(map[string]map[string]string)
+	r = rc.startRound(time.Minute, rc.allVerdictsReceived)
+	go func() {
+		for _, p := range testPeers {
+			rc.mtx.Lock()
+			rc.verdicts[p] = nil
+			rc.finishRoundIf(rc.allVerdictsReceived)
+			rc.mtx.Unlock()
+		}
+	}()
+	waitRound(t, r, time.Second)
+
+	// round finishes after timeout
+	r = rc.startRound(10*time.Millisecond, func() bool { return false })
+	waitRound(t, r, time.Second)
+}
+
+func waitRound(t *testing.T, r *round, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		r.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatal("round has not finished")
+	}
+}
@@ -0,0 +1,112 @@
+package versions
+
+import (
+	"context"
+	"time"
+
+	uid "github.com/Casper-dev/Casper-server/casper/uuid"
+	"github.com/Casper-dev/Casper-server/core"
+	dag "github.com/Casper-dev/Casper-server/merkledag"
+	"github.com/Casper-dev/Casper-server/pin"
+
+	cid "gx/ipfs/QmNp85zy9RLrQ5oQD4hPyS39ezrrXpcaa7R4Y9kxdWQLLQ/go-cid"
+	"gx/ipfs/QmT8rehPR3F6bmwL6zjUN8XpiDBFFpMP2myPdC6ApsWfJf/go-base58"
+)
+
+// NewNodeStore returns store of n configured with Casper.Versions.
+func NewNodeStore(n *core.IpfsNode) (*Store, error) {
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	s := NewStore(n.Repo.Datastore())
+	s.Enabled = cfg.Casper.Versions.Enabled
+	s.Default.Keep = cfg.Casper.Versions.Keep
+	if cfg.Casper.Versions.MaxAge != "" {
+		if s.Default.MaxAge, err = time.ParseDuration(cfg.Casper.Versions.MaxAge); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Snapshot records current content of the file with specified UUID
+// if history is kept for it. It must be called before the root of
+// the file is replaced.
+func Snapshot(ctx context.Context, n *core.IpfsNode, uuid string) error {
+	s, err := NewNodeStore(n)
+	if err != nil {
+		return err
+	}
+	if keep, err := s.Keeps(uuid); err != nil || !keep {
+		return err
+	}
+
+	// new file has nothing to keep and must not be searched in network
+	root := uid.UUIDToCid(base58.Decode(uuid))
+	if has, err := n.Blockstore.Has(root); err != nil || !has {
+		return err
+	}
+	nd, err := n.DAG.Get(ctx, root)
+	if err != nil {
+		return err
+	}
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return dag.ErrNotProtobuf
+	}
+
+	prev := pn.Copy().(*dag.ProtoNode)
+	prev.SetUUID(nil)
+	c, err := n.DAG.Add(prev)
+	if err != nil {
+		return err
+	}
+	size, err := prev.Size()
+	if err != nil {
+		return err
+	}
+
+	n.Pinning.PinWithMode(c, pin.Recursive)
+	removed, err := s.Record(uuid, Version{CID: c.String(), Size: size, Time: time.Now().UTC()})
+	if err != nil {
+		n.Pinning.RemovePinWithMode(c, pin.Recursive)
+		return err
+	}
+	log.Debugf("version %s of %s was recorded", c, uuid)
+	return unpin(n, removed)
+}
+
+// List returns log of the file without expired versions.
+func List(n *core.IpfsNode, uuid string) (*Log, error) {
+	s, err := NewNodeStore(n)
+	if err != nil {
+		return nil, err
+	}
+	l, removed, err := s.Prune(uuid)
+	if err != nil {
+		return nil, err
+	}
+	return l, unpin(n, removed)
+}
+
+// Drop removes history of the deleted file.
+func Drop(n *core.IpfsNode, uuid string) error {
+	versions, err := NewStore(n.Repo.Datastore()).Remove(uuid)
+	if err != nil {
+		return err
+	}
+	return unpin(n, versions)
+}
+
+func unpin(n *core.IpfsNode, versions []Version) error {
+	for _, v := range versions {
+		c, err := cid.Decode(v.CID)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		n.Pinning.RemovePinWithMode(c, pin.Recursive)
+	}
+	return n.Pinning.Flush()
+}
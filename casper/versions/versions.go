@@ -0,0 +1,235 @@
+// Package versions keeps history of UUID files. Root CID of a UUID file
+// is derived from the UUID, so when the file is updated its previous
+// content is lost. If history is kept for the file, previous root is
+// stored without UUID under its own CID, pinned and recorded in a per-UUID
+// log in the repo datastore. Old versions are dropped by retention policy.
+package versions
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+)
+
+var log = logging.Logger("versions")
+
+const logKeyPrefix = "/local/versions/"
+
+var ErrNotFound = errors.New("version does not exist")
+
+// Policy limits the number of kept versions.
+type Policy struct {
+	// Keep is the number of kept versions, zero means no limit
+	Keep int `json:",omitempty"`
+	// MaxAge is how long versions are kept, zero means forever
+	MaxAge time.Duration `json:",omitempty"`
+}
+
+// Version is a previous content of the file.
+type Version struct {
+	// CID is the root of the content without UUID
+	CID  string
+	Size uint64
+	// Time is when the content was replaced
+	Time time.Time
+}
+
+// Log is the history of a single file, oldest version first.
+type Log struct {
+	UUID string
+	// Enabled is set if history is kept for the file
+	// regardless of the node configuration
+	Enabled  bool
+	Policy   Policy `json:",omitempty"`
+	Versions []Version
+}
+
+// Find returns version by its number, counted from 1 for
+// the oldest version, or by its CID.
+func (l *Log) Find(version string) (*Version, error) {
+	if i, err := strconv.Atoi(version); err == nil {
+		if i < 1 || i > len(l.Versions) {
+			return nil, ErrNotFound
+		}
+		return &l.Versions[i-1], nil
+	}
+	for i := range l.Versions {
+		if l.Versions[i].CID == version {
+			return &l.Versions[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Has checks if CID is one of recorded versions.
+func (l *Log) Has(cid string) bool {
+	_, err := l.Find(cid)
+	return err == nil && cid != ""
+}
+
+// prune removes versions which are not allowed by p and returns
+// those whose content is not used by remaining versions.
+func (l *Log) prune(p Policy, now time.Time) (removed []Version) {
+	var dropped []Version
+	kept := l.Versions[:0]
+	for i, v := range l.Versions {
+		tooMany := p.Keep > 0 && len(l.Versions)-i > p.Keep
+		tooOld := p.MaxAge > 0 && now.Sub(v.Time) > p.MaxAge
+		if tooMany || tooOld {
+			dropped = append(dropped, v)
+			continue
+		}
+		kept = append(kept, v)
+	}
+	l.Versions = kept
+
+	for _, v := range dropped {
+		if !l.Has(v.CID) {
+			removed = append(removed, v)
+		}
+	}
+	return removed
+}
+
+// mtx guards logs in datastore, because every command creates its own Store.
+var mtx sync.Mutex
+
+type Store struct {
+	// Default is the policy of files whose log does not set it
+	Default Policy
+	// Enabled makes history to be kept for all files
+	Enabled bool
+
+	ds ds.Datastore
+}
+
+// NewStore returns store which keeps logs in d.
+func NewStore(d ds.Datastore) *Store {
+	return &Store{ds: d}
+}
+
+// Get returns log of the file. Empty log is returned if
+// no versions were recorded.
+func (s *Store) Get(uuid string) (*Log, error) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	return s.get(uuid)
+}
+
+// Enable makes history to be kept for the file. Zero fields
+// of p are taken from the default policy.
+func (s *Store) Enable(uuid string, p Policy) error {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	l, err := s.get(uuid)
+	if err != nil {
+		return err
+	}
+	l.Enabled, l.Policy = true, p
+	return s.put(l)
+}
+
+// Keeps checks if history is kept for the file.
+func (s *Store) Keeps(uuid string) (bool, error) {
+	if s.Enabled {
+		return true, nil
+	}
+	l, err := s.Get(uuid)
+	if err != nil {
+		return false, err
+	}
+	return l.Enabled, nil
+}
+
+// Record appends version to the log and returns versions which were
+// dropped by retention policy. Caller must unpin them.
+func (s *Store) Record(uuid string, v Version) (removed []Version, err error) {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	l, err := s.get(uuid)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(l.Versions); n > 0 && l.Versions[n-1].CID == v.CID {
+		return nil, nil
+	}
+	l.Versions = append(l.Versions, v)
+	removed = l.prune(s.policy(l), v.Time)
+	return removed, s.put(l)
+}
+
+// Prune drops versions which have expired and returns them.
+func (s *Store) Prune(uuid string) (*Log, []Version, error) {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	l, err := s.get(uuid)
+	if err != nil {
+		return nil, nil, err
+	}
+	removed := l.prune(s.policy(l), time.Now())
+	if len(removed) == 0 {
+		return l, nil, nil
+	}
+	return l, removed, s.put(l)
+}
+
+// Remove deletes log of the file and returns all its versions.
+func (s *Store) Remove(uuid string) ([]Version, error) {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	l, err := s.get(uuid)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.ds.Delete(logKey(uuid)); err != nil && err != ds.ErrNotFound {
+		return nil, err
+	}
+	return l.Versions, nil
+}
+
+func (s *Store) policy(l *Log) Policy {
+	p := l.Policy
+	if p.Keep == 0 {
+		p.Keep = s.Default.Keep
+	}
+	if p.MaxAge == 0 {
+		p.MaxAge = s.Default.MaxAge
+	}
+	return p
+}
+
+func logKey(uuid string) ds.Key {
+	return ds.NewKey(logKeyPrefix + uuid)
+}
+
+func (s *Store) get(uuid string) (*Log, error) {
+	v, err := s.ds.Get(logKey(uuid))
+	if err == ds.ErrNotFound {
+		return &Log{UUID: uuid}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	l := &Log{}
+	if err = json.Unmarshal(v.([]byte), l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (s *Store) put(l *Log) error {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return s.ds.Put(logKey(l.UUID), b)
+}
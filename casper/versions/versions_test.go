@@ -0,0 +1,151 @@
+package versions
+
+import (
+	"testing"
+	"time"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+)
+
+const testUUID = "2jmj7l5rSw0yVb"
+
+func newTestStore() *Store {
+	return NewStore(dssync.MutexWrap(ds.NewMapDatastore()))
+}
+
+func cids(vs []Version) (res []string) {
+	for _, v := range vs {
+		res = append(res, v.CID)
+	}
+	return res
+}
+
+func checkCIDs(t *testing.T, vs []Version, expected ...string) {
+	got := cids(vs)
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestKeeps(t *testing.T) {
+	s := newTestStore()
+	if keep, err := s.Keeps(testUUID); err != nil || keep {
+		t.Fatalf("history must not be kept by default: %v %v", keep, err)
+	}
+	if err := s.Enable(testUUID, Policy{Keep: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if keep, err := s.Keeps(testUUID); err != nil || !keep {
+		t.Fatalf("history must be kept after Enable: %v %v", keep, err)
+	}
+
+	s = newTestStore()
+	s.Enabled = true
+	if keep, _ := s.Keeps(testUUID); !keep {
+		t.Fatal("history must be kept for all files if enabled in store")
+	}
+}
+
+func TestRecordKeep(t *testing.T) {
+	s := newTestStore()
+	if err := s.Enable(testUUID, Policy{Keep: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i, c := range []string{"a", "b", "b", "c"} {
+		removed, err := s.Record(testUUID, Version{CID: c, Time: now.Add(time.Duration(i) * time.Second)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c == "c" {
+			checkCIDs(t, removed, "a")
+		} else if len(removed) != 0 {
+			t.Fatalf("nothing must be removed after %s, got %v", c, cids(removed))
+		}
+	}
+
+	l, err := s.Get(testUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCIDs(t, l.Versions, "b", "c")
+
+	if v, err := l.Find("1"); err != nil || v.CID != "b" {
+		t.Fatalf("expected version b, got %v %v", v, err)
+	}
+	if v, err := l.Find("c"); err != nil || v.CID != "c" {
+		t.Fatalf("expected version c, got %v %v", v, err)
+	}
+	for _, version := range []string{"0", "3", "a"} {
+		if _, err := l.Find(version); err != ErrNotFound {
+			t.Fatalf("version %s must not exist, got %v", version, err)
+		}
+	}
+}
+
+func TestRecordSharedContent(t *testing.T) {
+	s := newTestStore()
+	s.Enabled = true
+	s.Default.Keep = 2
+
+	now := time.Now()
+	s.Record(testUUID, Version{CID: "a", Time: now})
+	s.Record(testUUID, Version{CID: "b", Time: now})
+	// content was restored, so "a" is still used by the newest version
+	removed, err := s.Record(testUUID, Version{CID: "a", Time: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 0 {
+		t.Fatalf("content in use must not be removed, got %v", cids(removed))
+	}
+}
+
+func TestPruneMaxAge(t *testing.T) {
+	s := newTestStore()
+	s.Enabled = true
+
+	now := time.Now()
+	s.Record(testUUID, Version{CID: "a", Time: now.Add(-2 * time.Hour)})
+	s.Record(testUUID, Version{CID: "b", Time: now.Add(-30 * time.Minute)})
+
+	s.Default.MaxAge = time.Hour
+
+	l, removed, err := s.Prune(testUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCIDs(t, removed, "a")
+	checkCIDs(t, l.Versions, "b")
+
+	if l, err = s.Get(testUUID); err != nil {
+		t.Fatal(err)
+	}
+	checkCIDs(t, l.Versions, "b")
+}
+
+func TestRemove(t *testing.T) {
+	s := newTestStore()
+	if vs, err := s.Remove(testUUID); err != nil || len(vs) != 0 {
+		t.Fatalf("removing missing log must succeed: %v %v", vs, err)
+	}
+
+	s.Enable(testUUID, Policy{})
+	s.Record(testUUID, Version{CID: "a", Time: time.Now()})
+	vs, err := s.Remove(testUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCIDs(t, vs, "a")
+
+	if keep, _ := s.Keeps(testUUID); keep {
+		t.Fatal("history must not be kept after Remove")
+	}
+}
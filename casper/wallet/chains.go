@@ -0,0 +1,67 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	neosc "github.com/Casper-dev/Casper-server/casper/sc/neo"
+	solsc "github.com/Casper-dev/Casper-server/casper/sc/solidity"
+
+	neowallet "github.com/CityOfZion/neo-go/pkg/wallet"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+// chain describes format of private keys of a blockchain.
+type chain struct {
+	// Generate returns new private key
+	Generate func() (string, error)
+	// Address returns address of wallet with private key
+	Address func(key string) (string, error)
+}
+
+// chains are keyed by the names used in config
+var chains = map[string]chain{
+	solsc.ChainName: {
+		// keys are hex encoded, like in geth
+		Generate: func() (string, error) {
+			k, err := ethcrypto.GenerateKey()
+			if err != nil {
+				return "", err
+			}
+			return hex.EncodeToString(ethcrypto.FromECDSA(k)), nil
+		},
+		Address: func(key string) (string, error) {
+			k, err := ethcrypto.HexToECDSA(strings.TrimPrefix(key, "0x"))
+			if err != nil {
+				return "", err
+			}
+			return ethcrypto.PubkeyToAddress(k.PublicKey).Hex(), nil
+		},
+	},
+	neosc.ChainName: {
+		// keys are WIF encoded
+		Generate: func() (string, error) {
+			k, err := neowallet.NewPrivateKey()
+			if err != nil {
+				return "", err
+			}
+			return k.WIF()
+		},
+		Address: func(key string) (string, error) {
+			k, err := neowallet.NewPrivateKeyFromWIF(key)
+			if err != nil {
+				return "", err
+			}
+			return k.Address()
+		},
+	},
+}
+
+func getChain(name string) (chain, error) {
+	c, ok := chains[name]
+	if !ok {
+		return c, fmt.Errorf("wallets are not supported for chain %s", name)
+	}
+	return c, nil
+}
@@ -0,0 +1,86 @@
+package wallet
+
+import (
+	"fmt"
+	"os"
+
+	scin "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+)
+
+var log = logging.Logger("wallet")
+
+// Keyring gives SC bindings private keys of wallets used by the node.
+// Wallet used on a chain is the one chosen with 'ipfs wallet use', or
+// the only wallet of that chain.
+type Keyring struct {
+	store      *Store
+	used       map[string]string
+	passphrase []byte
+}
+
+var _ scin.KeySource = &Keyring{}
+
+func NewKeyring(s *Store, used map[string]string, passphrase []byte) *Keyring {
+	return &Keyring{store: s, used: used, passphrase: passphrase}
+}
+
+// KeyringFromEnv returns keyring of repo at repoRoot unlocked with
+// passphrase from PassphraseEnv. The variable is removed from the
+// environment, so that it is not inherited by child processes.
+func KeyringFromEnv(repoRoot string, used map[string]string) (*Keyring, error) {
+	s, err := Open(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	passphrase := os.Getenv(PassphraseEnv)
+	os.Unsetenv(PassphraseEnv)
+	return NewKeyring(s, used, []byte(passphrase)), nil
+}
+
+// Used returns wallet used on chain.
+func (k *Keyring) Used(chain string) (*Wallet, error) {
+	if name := k.used[chain]; name != "" {
+		w, err := k.store.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if w.Chain != chain {
+			return nil, fmt.Errorf("wallet %s is not a %s wallet", name, chain)
+		}
+		return w, nil
+	}
+
+	wallets, err := k.store.List()
+	if err != nil {
+		return nil, err
+	}
+	var found *Wallet
+	for _, w := range wallets {
+		if w.Chain != chain {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("there are several %s wallets, choose one with 'ipfs wallet use'", chain)
+		}
+		found = w
+	}
+	if found == nil {
+		return nil, scin.ErrNoKey
+	}
+	return found, nil
+}
+
+// PrivateKey unlocks wallet used on chain.
+func (k *Keyring) PrivateKey(chain string) (string, error) {
+	w, err := k.Used(chain)
+	if err != nil {
+		return "", err
+	}
+	if len(k.passphrase) == 0 {
+		return "", fmt.Errorf("wallet %s is locked, set %s to unlock it", w.Name, PassphraseEnv)
+	}
+	log.Infof("using %s wallet %s (%s)", chain, w.Name, w.Address)
+	return k.store.Unlock(w.Name, k.passphrase)
+}
@@ -0,0 +1,244 @@
+// Package wallet keeps private keys of blockchain wallets encrypted with
+// a passphrase in the keystore of the repo, so that they are not stored
+// in config in plain text. Every wallet is a JSON file in keystore/wallets.
+package wallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// PassphraseEnv is the environment variable which holds passphrase
+// of wallets, so that daemon can unlock them without prompt.
+const PassphraseEnv = "CASPER_WALLET_PASSPHRASE"
+
+const (
+	walletsDir = "wallets"
+
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+	keyLen  = 32
+)
+
+var (
+	ErrNoWallet      = errors.New("no wallet by the given name was found")
+	ErrWalletExists  = errors.New("wallet by that name already exists, refusing to overwrite")
+	ErrBadPassphrase = errors.New("wrong passphrase")
+	ErrNoPassphrase  = errors.New("passphrase is empty")
+)
+
+// Wallet is the file of the wallet. Address is kept in plain text,
+// so that wallets can be listed without passphrase.
+type Wallet struct {
+	Name    string `json:"-"`
+	Chain   string
+	Address string
+	Crypto  Crypto
+}
+
+// Crypto describes encryption of the private key with AES-256-GCM
+// under the key derived from passphrase with scrypt. Chain and address
+// are authenticated too.
+type Crypto struct {
+	KDF        string
+	N, R, P    int
+	Salt       []byte
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+// Store keeps wallets in a directory.
+type Store struct {
+	dir string
+}
+
+// Open returns store of wallets of repo at repoRoot.
+func Open(repoRoot string) (*Store, error) {
+	dir := filepath.Join(repoRoot, "keystore", walletsDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+func validateName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("wallet names must be at least one character")
+	case strings.ContainsAny(name, `/\`):
+		return errors.New("wallet names may not contain slashes")
+	case strings.HasPrefix(name, "."):
+		return errors.New("wallet names may not begin with a period")
+	}
+	return nil
+}
+
+// New generates key of chain and stores it as wallet name.
+func (s *Store) New(name, chain string, passphrase []byte) (*Wallet, error) {
+	c, err := getChain(chain)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.Generate()
+	if err != nil {
+		return nil, err
+	}
+	return s.Import(name, chain, key, passphrase)
+}
+
+// Import stores private key of chain as wallet name.
+func (s *Store) Import(name, chain, key string, passphrase []byte) (*Wallet, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, ErrNoPassphrase
+	}
+	c, err := getChain(chain)
+	if err != nil {
+		return nil, err
+	}
+	key = strings.TrimSpace(key)
+	addr, err := c.Address(key)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Wallet{Name: name, Chain: chain, Address: addr}
+	if w.Crypto, err = encrypt(w, []byte(key), passphrase); err != nil {
+		return nil, err
+	}
+	b, err := json.MarshalIndent(w, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(s.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return nil, ErrWalletExists
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err = f.Write(b); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Get returns wallet without decrypting its key.
+func (s *Store) Get(name string) (*Wallet, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrNoWallet
+	} else if err != nil {
+		return nil, err
+	}
+
+	w := &Wallet{Name: name}
+	if err = json.Unmarshal(b, w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// List returns all wallets sorted by name.
+func (s *Store) List() ([]*Wallet, error) {
+	names, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	wallets := make([]*Wallet, 0, len(names))
+	for _, fi := range names {
+		if fi.IsDir() {
+			continue
+		}
+		w, err := s.Get(fi.Name())
+		if err != nil {
+			log.Errorf("invalid wallet %s: %v", fi.Name(), err)
+			continue
+		}
+		wallets = append(wallets, w)
+	}
+	sort.Slice(wallets, func(i, j int) bool { return wallets[i].Name < wallets[j].Name })
+	return wallets, nil
+}
+
+// Unlock returns private key of wallet name.
+func (s *Store) Unlock(name string, passphrase []byte) (string, error) {
+	w, err := s.Get(name)
+	if err != nil {
+		return "", err
+	}
+	key, err := decrypt(w, passphrase)
+	if err != nil {
+		return "", err
+	}
+	return string(key), nil
+}
+
+func additionalData(w *Wallet) []byte {
+	return []byte(w.Chain + "\x00" + w.Address)
+}
+
+func encrypt(w *Wallet, key, passphrase []byte) (Crypto, error) {
+	c := Crypto{KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 32)}
+	if _, err := rand.Read(c.Salt); err != nil {
+		return c, err
+	}
+	aead, err := newAEAD(&c, passphrase)
+	if err != nil {
+		return c, err
+	}
+	c.Nonce = make([]byte, aead.NonceSize())
+	if _, err = rand.Read(c.Nonce); err != nil {
+		return c, err
+	}
+	c.Ciphertext = aead.Seal(nil, c.Nonce, key, additionalData(w))
+	return c, nil
+}
+
+func decrypt(w *Wallet, passphrase []byte) ([]byte, error) {
+	if w.Crypto.KDF != "scrypt" {
+		return nil, errors.New("unsupported key derivation function: " + w.Crypto.KDF)
+	}
+	aead, err := newAEAD(&w.Crypto, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(w.Crypto.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce size")
+	}
+	key, err := aead.Open(nil, w.Crypto.Nonce, w.Crypto.Ciphertext, additionalData(w))
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+	return key, nil
+}
+
+func newAEAD(c *Crypto, passphrase []byte) (cipher.AEAD, error) {
+	dk, err := scrypt.Key(passphrase, c.Salt, c.N, c.R, c.P, keyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(dk)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
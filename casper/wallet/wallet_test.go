@@ -0,0 +1,179 @@
+package wallet
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	neosc "github.com/Casper-dev/Casper-server/casper/sc/neo"
+	scin "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+	solsc "github.com/Casper-dev/Casper-server/casper/sc/solidity"
+)
+
+const ethKey = "674393e0fb1cba8a71be3f1261e7171effb998bc5047ae0eee8b0e49e556e293"
+
+var pass = []byte("correct horse")
+
+func testStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "wallet-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, func() { os.RemoveAll(dir) }
+}
+
+func TestImportUnlock(t *testing.T) {
+	s, done := testStore(t)
+	defer done()
+
+	w, err := s.Import("eth", solsc.ChainName, ethKey, pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Address == "" {
+		t.Fatal("address is empty")
+	}
+
+	b, err := ioutil.ReadFile(s.dir + "/eth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte(ethKey)) {
+		t.Fatal("key is stored in plain text")
+	}
+
+	key, err := s.Unlock("eth", pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != ethKey {
+		t.Fatalf("expected %s, got %s", ethKey, key)
+	}
+
+	if _, err = s.Unlock("eth", []byte("wrong")); err != ErrBadPassphrase {
+		t.Fatalf("expected %v, got %v", ErrBadPassphrase, err)
+	}
+	if _, err = s.Import("eth", solsc.ChainName, ethKey, pass); err != ErrWalletExists {
+		t.Fatalf("expected %v, got %v", ErrWalletExists, err)
+	}
+	if _, err = s.Import("empty", solsc.ChainName, ethKey, nil); err != ErrNoPassphrase {
+		t.Fatalf("expected %v, got %v", ErrNoPassphrase, err)
+	}
+	if _, err = s.Import("bad", solsc.ChainName, "not a key", pass); err == nil {
+		t.Fatal("invalid key was imported")
+	}
+	if _, err = s.Get("none"); err != ErrNoWallet {
+		t.Fatalf("expected %v, got %v", ErrNoWallet, err)
+	}
+}
+
+func TestNewWallets(t *testing.T) {
+	s, done := testStore(t)
+	defer done()
+
+	for _, chain := range []string{solsc.ChainName, neosc.ChainName} {
+		w, err := s.New(chain, chain, pass)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := s.Unlock(chain, pass)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr, err := chains[chain].Address(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr != w.Address {
+			t.Fatalf("%s: expected address %s, got %s", chain, w.Address, addr)
+		}
+	}
+
+	if _, err := s.New("btc", "BTC", pass); err == nil {
+		t.Fatal("wallet of unknown chain was created")
+	}
+
+	wallets, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wallets) != 2 || wallets[0].Name != solsc.ChainName || wallets[1].Name != neosc.ChainName {
+		t.Fatalf("unexpected wallets: %+v", wallets)
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	s, done := testStore(t)
+	defer done()
+
+	k := NewKeyring(s, nil, pass)
+	if _, err := k.PrivateKey(solsc.ChainName); err != scin.ErrNoKey {
+		t.Fatalf("expected %v, got %v", scin.ErrNoKey, err)
+	}
+
+	if _, err := s.Import("a", solsc.ChainName, ethKey, pass); err != nil {
+		t.Fatal(err)
+	}
+	key, err := k.PrivateKey(solsc.ChainName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != ethKey {
+		t.Fatalf("expected %s, got %s", ethKey, key)
+	}
+
+	if _, err = s.New("b", solsc.ChainName, pass); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = k.PrivateKey(solsc.ChainName); err == nil {
+		t.Fatal("wallet was chosen among several")
+	}
+
+	k = NewKeyring(s, map[string]string{solsc.ChainName: "a"}, pass)
+	if key, err = k.PrivateKey(solsc.ChainName); err != nil || key != ethKey {
+		t.Fatalf("expected %s, got %s (%v)", ethKey, key, err)
+	}
+
+	k = NewKeyring(s, map[string]string{neosc.ChainName: "a"}, pass)
+	if _, err = k.PrivateKey(neosc.ChainName); err == nil {
+		t.Fatal("ETH wallet was used on NEO")
+	}
+
+	k = NewKeyring(s, map[string]string{solsc.ChainName: "a"}, nil)
+	if _, err = k.PrivateKey(solsc.ChainName); err == nil {
+		t.Fatal("wallet was unlocked without passphrase")
+	}
+}
+
+func TestChainKey(t *testing.T) {
+	s, done := testStore(t)
+	defer done()
+
+	opts := scin.InitOpts{"PrivateKey": "legacy"}
+	key, plain, err := scin.ChainKey(opts, solsc.ChainName, "PrivateKey")
+	if err != nil || !plain || key != "legacy" {
+		t.Fatalf("expected legacy key, got %s %t %v", key, plain, err)
+	}
+
+	opts[scin.KeysOption] = NewKeyring(s, nil, pass)
+	if key, plain, err = scin.ChainKey(opts, solsc.ChainName, "PrivateKey"); err != nil || !plain {
+		t.Fatalf("expected fallback to legacy key, got %s %t %v", key, plain, err)
+	}
+
+	if _, err = s.Import("a", solsc.ChainName, ethKey, pass); err != nil {
+		t.Fatal(err)
+	}
+	key, plain, err = scin.ChainKey(opts, solsc.ChainName, "PrivateKey")
+	if err != nil || plain || key != ethKey {
+		t.Fatalf("expected wallet key, got %s %t %v", key, plain, err)
+	}
+
+	if _, _, err = scin.ChainKey(scin.InitOpts{}, solsc.ChainName, "PrivateKey"); err != scin.ErrNoKey {
+		t.Fatalf("expected %v, got %v", scin.ErrNoKey, err)
+	}
+}
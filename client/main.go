@@ -33,7 +33,8 @@ import (
 
 var log = logging.Logger("client/handler")
 
-func HandleClientUpload(ctx context.Context, ip string, hash string, size int64, ipList []string) (err error) {
+// auth is encoded signed ownership request (see casper/owner) or empty string
+func HandleClientUpload(ctx context.Context, ip string, hash string, size int64, ipList []string, auth string) (err error) {
 	log.Infof("started upload(%s, %s, %d)", ip, hash, size)
 
 	val, err := json.Marshal(ipList)
@@ -42,34 +43,30 @@ func HandleClientUpload(ctx context.Context, ip string, hash string, size int64,
 	}
 
 	_, err = thrift.RunClientClosure(ip, func(c *thrift.ThriftClient) (interface{}, error) {
-		return c.SendUploadQuery(ctx, hash, string(val), size)
+		return c.SendUploadQuery(ctx, hash, string(val), size, auth)
 	})
 
 	fmt.Println("upload()")
 	return err
 }
 
+// wallet is the client wallet with the proof of its ownership made by sc_interface.SignWalletProof
 func HandleClientDownload(ctx context.Context, ip string, hash string, wallet string) (err error) {
-	log.Infof("started download(%s, %s, %s)", ip, hash, wallet)
+	log.Infof("started download(%s, %s)", ip, hash)
 
 	_, err = thrift.RunClientClosure(ip, func(c *thrift.ThriftClient) (interface{}, error) {
 		return c.SendDownloadQuery(ctx, hash, "2", wallet)
 	})
-	if err != nil {
-		return err
-	}
-	/// TODO: SendDownloadQuery just opens a channel; billing must be moved somewhere else
-	/// c, _ := sc.GetContract()
-	/// err = c.ConfirmDownload()
-	/// fmt.Println("download()")
-	return nil
+	// downloaded bytes are acknowledged with receipts sent to the provider
+	// by the caller, see casper/billing
+	return err
 }
 
-func HandleClientDelete(ctx context.Context, ip string, hash string) (err error) {
+func HandleClientDelete(ctx context.Context, ip string, hash string, auth string) (err error) {
 	log.Infof("started delete(%s, %s)", ip, hash)
 
 	_, err = thrift.RunClientClosure(ip, func(c *thrift.ThriftClient) (interface{}, error) {
-		return c.SendDeleteQuery(ctx, hash)
+		return c.SendDeleteQuery(ctx, hash, auth)
 	})
 	if err != nil {
 		return err
@@ -79,11 +76,11 @@ func HandleClientDelete(ctx context.Context, ip string, hash string) (err error)
 	return err
 }
 
-func HandleClientUpdate(ctx context.Context, ip string, uuid string, hash string, size int64) (err error) {
+func HandleClientUpdate(ctx context.Context, ip string, uuid string, hash string, size int64, auth string) (err error) {
 	log.Infof("started update(%s, %s, %s)", ip, uuid, hash)
 
 	h, err := thrift.RunClientClosure(ip, func(c *thrift.ThriftClient) (interface{}, error) {
-		return c.SendUpdateQuery(ctx, uuid, hash, size)
+		return c.SendUpdateQuery(ctx, uuid, hash, size, auth)
 	})
 	if err != nil {
 		return err
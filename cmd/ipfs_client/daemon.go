@@ -12,6 +12,8 @@ import (
 	"sync"
 
 	sc "github.com/Casper-dev/Casper-server/casper/sc"
+	"github.com/Casper-dev/Casper-server/casper/thrift"
+	"github.com/Casper-dev/Casper-server/casper/wallet"
 	utilmain "github.com/Casper-dev/Casper-server/cmd/ipfs_client/util"
 	cmds "github.com/Casper-dev/Casper-server/commands"
 	"github.com/Casper-dev/Casper-server/core"
@@ -281,8 +283,15 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 		return
 	}
 
+	keys, err := wallet.KeyringFromEnv(ctx.ConfigRoot, cfg.Casper.Wallets)
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	sc.SetKeySource(keys)
+
 	// Initialize SC for subsequent calls
-	_, err = sc.GetContractContext(req.Context(), cfg.Casper.Blockchain[cfg.Casper.UsedChain])
+	_, err = sc.GetContractByName(req.Context(), cfg.Casper.UsedChain, cfg.Casper.Blockchain[cfg.Casper.UsedChain])
 	if err != nil {
 		res.SetError(err, cmds.ErrNormal)
 		return
@@ -333,6 +342,15 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 		return
 	}
 	node.SetLocal(false)
+	// providers can be called by peer ID over libp2p
+	thrift.SetHost(node.PeerHost)
+	if err = thrift.SetIdentity(node.PrivateKey); err != nil {
+		res.SetError(fmt.Errorf("cant create thrift certificate: %v", err), cmds.ErrNormal)
+		return
+	}
+	if err = node.InitUUIDCache(req.Context()); err != nil {
+		log.Errorf("cant load stored UUIDs: %v", err)
+	}
 
 	if node.PNetFingerpint != nil {
 		fmt.Println("Swarm is limited to private network of peers with the swarm key")
@@ -92,12 +92,16 @@ func (d *cmdDetails) usesRepo() bool          { return !d.doesNotUseRepo }
 // properties so that other code can make decisions about whether to invoke a
 // command or return an error to the user.
 var cmdDetailsMap = map[string]cmdDetails{
-	"init":        {doesNotUseConfigAsInput: true, cannotRunOnDaemon: true, doesNotUseRepo: true},
-	"daemon":      {doesNotUseConfigAsInput: true, cannotRunOnDaemon: true},
-	"commands":    {doesNotUseRepo: true},
-	"version":     {doesNotUseConfigAsInput: true, doesNotUseRepo: true}, // must be permitted to run before init
-	"log":         {cannotRunOnClient: true},
-	"diag/cmds":   {cannotRunOnClient: true},
-	"repo/fsck":   {cannotRunOnDaemon: true},
-	"config/edit": {cannotRunOnDaemon: true, doesNotUseRepo: true},
+	"init":          {doesNotUseConfigAsInput: true, cannotRunOnDaemon: true, doesNotUseRepo: true},
+	"daemon":        {doesNotUseConfigAsInput: true, cannotRunOnDaemon: true},
+	"commands":      {doesNotUseRepo: true},
+	"version":       {doesNotUseConfigAsInput: true, doesNotUseRepo: true}, // must be permitted to run before init
+	"log":           {cannotRunOnClient: true},
+	"diag/cmds":     {cannotRunOnClient: true},
+	"repo/fsck":     {cannotRunOnDaemon: true},
+	"config/edit":   {cannotRunOnDaemon: true, doesNotUseRepo: true},
+	"wallet/new":    {doesNotUseRepo: true},
+	"wallet/import": {doesNotUseRepo: true},
+	"wallet/export": {doesNotUseRepo: true},
+	"wallet/list":   {doesNotUseRepo: true},
 }
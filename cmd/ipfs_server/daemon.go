@@ -13,14 +13,25 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/Casper-dev/Casper-server/casper/access"
+	"github.com/Casper-dev/Casper-server/casper/billing"
 	cu "github.com/Casper-dev/Casper-server/casper/casper_utils"
+	"github.com/Casper-dev/Casper-server/casper/events"
+	"github.com/Casper-dev/Casper-server/casper/paychan"
+	"github.com/Casper-dev/Casper-server/casper/replication"
 	"github.com/Casper-dev/Casper-server/casper/restapi"
+	"github.com/Casper-dev/Casper-server/casper/s3"
+	"github.com/Casper-dev/Casper-server/casper/sc"
+	scin "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
+	"github.com/Casper-dev/Casper-server/casper/thrift"
 	"github.com/Casper-dev/Casper-server/casper/validation"
+	"github.com/Casper-dev/Casper-server/casper/wallet"
 	cmds "github.com/Casper-dev/Casper-server/commands"
 	"github.com/Casper-dev/Casper-server/core"
 	"github.com/Casper-dev/Casper-server/core/commands"
 	"github.com/Casper-dev/Casper-server/core/corehttp"
 	"github.com/Casper-dev/Casper-server/core/corerepo"
+	"github.com/Casper-dev/Casper-server/exchange/bitswap/decision"
 	nodeMount "github.com/Casper-dev/Casper-server/fuse/node"
 	"github.com/Casper-dev/Casper-server/repo/config"
 	"github.com/Casper-dev/Casper-server/repo/fsrepo"
@@ -418,26 +429,95 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 		}
 	}()
 
+	keys, err := wallet.KeyringFromEnv(ctx.ConfigRoot, cfg.Casper.Wallets)
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	sc.SetKeySource(keys)
+
 	err = cu.RegisterSC(req.Context(), node, cfg, extAddrs...)
 	if err != nil {
 		res.SetError(fmt.Errorf("cant register SC: %v", err), cmds.ErrNormal)
 		return
 	}
 
+	if err = node.InitUUIDCache(req.Context()); err != nil {
+		log.Errorf("cant load stored UUIDs: %v", err)
+	}
+
 	// TODO: make pings great again
 	pinger := &validation.Pinger{}
+	pinger.Replication = replication.NewQueue(node.Repo.Datastore(), pinger.ReplicateFile)
+	node.Replication = pinger.Replication
+	go pinger.Replication.Run(req.Context())
+	events.RunWebhooks(req.Context(), cfg.Casper.Webhooks)
+	// providers replicate, repair and validate files without paying
+	decision.DefaultAccess.IsProvider = isProvider
+	if err = decision.DefaultAccess.Configure(cfg.Casper.PaidDownloads); err != nil {
+		res.SetError(fmt.Errorf("invalid PaidDownloads config: %v", err), cmds.ErrNormal)
+		return
+	}
+	receipts := billing.NewStore(node.Repo.Datastore())
+	settler, err := billing.NewSettler(receipts, cfg.Casper.Billing, func(rs []scin.DownloadReceipt) error {
+		c, err := sc.GetContract()
+		if err != nil {
+			return err
+		}
+		return c.ConfirmDownload(cu.GetLocalAddr().NodeHash(), rs)
+	})
+	if err != nil {
+		res.SetError(fmt.Errorf("invalid Billing config: %v", err), cmds.ErrNormal)
+		return
+	}
+	billing.Serve(node.PeerHost, receipts, func(wallet string, payload, sig []byte) error {
+		c, err := sc.GetContract()
+		if err != nil {
+			return err
+		}
+		wp, err := scin.WalletProofs(c)
+		if err != nil {
+			return err
+		}
+		return wp.VerifyWallet(wallet, payload, sig)
+	})
+	go billing.Meter(req.Context(), decision.DefaultAccess, receipts)
+	go settler.Run(req.Context())
+	node.Channels, err = paychan.NewManager(node.Repo.Datastore(), node.PeerHost, node.PrivateKey)
+	if err != nil {
+		res.SetError(fmt.Errorf("cant create payment channels: %v", err), cmds.ErrNormal)
+		return
+	}
+	// vouchers pay for downloads like prepaid wallets do
+	node.Channels.OnPaid = decision.DefaultAccess.Credit
+	paychan.Serve(node.PeerHost, node.Channels)
+	go node.Channels.Run(req.Context())
+	// thrift callers are identified by their libp2p keys
+	if err = thrift.SetIdentity(node.PrivateKey); err != nil {
+		res.SetError(fmt.Errorf("cant create thrift certificate: %v", err), cmds.ErrNormal)
+		return
+	}
+	thrift.ServeP2P(node.PeerHost, NewCasperServerHandler(ctx.ConfigRoot))
 	go serveThrift(req.Context(), ctx)
 	go pinger.RunPinger(req.Context())
 	go statusChecker(req.Context())
 	go verificationWatcher(req.Context(), node)
-	go verificationRunner(req.Context())
+	go verificationRunner(req.Context(), node)
 
 	ctx.ConstructNode = func() (*core.IpfsNode, error) {
 		return node, nil
 	}
 
+	// REST API, share links and S3 gateway count usage of clients together
+	ac, err := access.NewNodeControl(node)
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	go ac.Run(req.Context())
+
 	// construct api endpoint - every time
-	err, apiErrc := serveHTTPApi(req)
+	err, apiErrc := serveHTTPApi(req, ac)
 	if err != nil {
 		res.SetError(err, cmds.ErrNormal)
 		return
@@ -479,13 +559,24 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 		}
 	}
 
+	// construct S3 gateway - if it is set in the config
+	var s3Errc <-chan error
+	if len(cfg.Casper.S3.Address) > 0 {
+		var err error
+		err, s3Errc = serveHTTPS3(req, ac)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+	}
+
 	// initialize metrics collector
 	prometheus.MustRegister(&corehttp.IpfsNodeCollector{Node: node})
 
 	fmt.Printf("Daemon is ready\n")
 	// collect long-running errors and block for shutdown
 	// TODO(cryptix): our fuse currently doesnt follow this pattern for graceful shutdown
-	for err := range merge(apiErrc, gwErrc, gcErrc) {
+	for err := range merge(apiErrc, gwErrc, s3Errc, gcErrc) {
 		if err != nil {
 			log.Error(err)
 			res.SetError(err, cmds.ErrNormal)
@@ -494,7 +585,7 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 }
 
 // serveHTTPApi collects options, creates listener, prints status message and starts serving requests
-func serveHTTPApi(req cmds.Request) (error, <-chan error) {
+func serveHTTPApi(req cmds.Request, ac *access.Control) (error, <-chan error) {
 	cfg, err := req.InvocContext().GetConfig()
 	if err != nil {
 		return fmt.Errorf("serveHTTPApi: GetConfig() failed: %s", err), nil
@@ -536,8 +627,8 @@ func serveHTTPApi(req cmds.Request) (error, <-chan error) {
 	var opts = []corehttp.ServeOption{
 		corehttp.MetricsCollectionOption("api"),
 		corehttp.CommandsOption(*req.InvocContext()),
-		restapi.CasperOption(*req.InvocContext()),
-		restapi.CasperFileShareOption(*req.InvocContext()),
+		restapi.CasperOption(*req.InvocContext(), ac),
+		restapi.CasperFileShareOption(*req.InvocContext(), ac),
 		CasperThriftOption(*req.InvocContext()),
 		corehttp.WebUIOption,
 		gatewayOpt,
@@ -658,6 +749,39 @@ func serveHTTPGateway(req cmds.Request) (error, <-chan error) {
 	return nil, errc
 }
 
+// serveHTTPS3 creates listener of S3 gateway, prints status message and starts serving requests
+func serveHTTPS3(req cmds.Request, ac *access.Control) (error, <-chan error) {
+	cfg, err := req.InvocContext().GetConfig()
+	if err != nil {
+		return fmt.Errorf("serveHTTPS3: GetConfig() failed: %s", err), nil
+	}
+
+	s3Maddr, err := ma.NewMultiaddr(cfg.Casper.S3.Address)
+	if err != nil {
+		return fmt.Errorf("serveHTTPS3: invalid S3 address: %q (err: %s)", cfg.Casper.S3.Address, err), nil
+	}
+
+	s3Lis, err := manet.Listen(s3Maddr)
+	if err != nil {
+		return fmt.Errorf("serveHTTPS3: manet.Listen(%s) failed: %s", s3Maddr, err), nil
+	}
+	fmt.Printf("S3 gateway server listening on %s\n", s3Lis.Multiaddr())
+
+	node, err := req.InvocContext().ConstructNode()
+	if err != nil {
+		return fmt.Errorf("serveHTTPS3: ConstructNode() failed: %s", err), nil
+	}
+
+	errc := make(chan error)
+	go func() {
+		errc <- corehttp.Serve(node, s3Lis.NetListener(),
+			corehttp.MetricsCollectionOption("s3"),
+			s3.ServeOption(*req.InvocContext(), ac))
+		close(errc)
+	}()
+	return nil, errc
+}
+
 //collects options and opens the fuse mountpoint
 func mountFuse(req cmds.Request) error {
 	cfg, err := req.InvocContext().GetConfig()
@@ -101,4 +101,6 @@ var cmdDetailsMap = map[*cmds.Command]cmdDetails{
 	commands.ActiveReqsCmd:                {cannotRunOnClient: true},
 	commands.RepoFsckCmd:                  {cannotRunOnDaemon: true},
 	commands.ConfigCmd.Subcommand("edit"): {cannotRunOnDaemon: true, doesNotUseRepo: true},
+	commands.WalletCmd:                    {doesNotUseRepo: true},
+	commands.WalletCmd.Subcommand("use"):  {},
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Casper-dev/Casper-server/casper/owner"
+	"github.com/Casper-dev/Casper-server/casper/sc"
+	"github.com/Casper-dev/Casper-server/casper/thrift"
+	"github.com/Casper-dev/Casper-server/core"
+	"github.com/Casper-dev/Casper-server/repo/fsrepo"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
+)
+
+var (
+	errUnauthenticated = errors.New("thrift call is not authenticated")
+	errNotProvider     = errors.New("caller is not a registered provider")
+	errNotOwner        = errors.New("caller is neither a provider nor owner of the file")
+	errWrongCaller     = errors.New("provider can act only on its own behalf")
+)
+
+// Files uploaded without ownership request have no owner key. For such
+// files every provider remembers peer which has sent upload query.
+const ownerDSKeyPrefix = "/local/owner/"
+
+func ownerKey(fileID string) ds.Key {
+	return ds.NewKey(ownerDSKeyPrefix + fileID)
+}
+
+// caller returns ID of the peer which has made thrift call.
+func caller(ctx context.Context) (peer.ID, error) {
+	id, ok := thrift.CallerFromContext(ctx)
+	if !ok {
+		return "", errUnauthenticated
+	}
+	return id, nil
+}
+
+// isProvider checks if peer is registered in SC and was not banned.
+func isProvider(id peer.ID) bool {
+	c, err := sc.GetContract()
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+
+	addr, err := c.GetRPCAddr(id.Pretty())
+	if err != nil || addr == "" {
+		return false
+	}
+	banned, err := c.VerifyReplication(id.Pretty())
+	return err == nil && !banned
+}
+
+// authorizeProvider returns error if caller is not a registered provider.
+func authorizeProvider(ctx context.Context) error {
+	id, err := caller(ctx)
+	if err != nil {
+		return err
+	}
+	if !isProvider(id) {
+		log.Warningf("rejecting call from %s: not a provider", id.Pretty())
+		return errNotProvider
+	}
+	return nil
+}
+
+// authorizeProviderAs returns error if caller is not a registered
+// provider with specified id, so that providers can't send validation
+// results on behalf of other ones.
+func authorizeProviderAs(ctx context.Context, id peer.ID) error {
+	if err := authorizeProvider(ctx); err != nil {
+		return err
+	}
+	if c, _ := caller(ctx); c != id {
+		log.Warningf("rejecting call from %s on behalf of %s", c.Pretty(), id.Pretty())
+		return errWrongCaller
+	}
+	return nil
+}
+
+// authorizeFile checks that caller can perform one of ops on the file with
+// specified ID. Files which have an owner require signed request auth (see
+// casper/owner); r and next are returned by owner.Check for such files.
+// Other files can be modified by providers and by the peer which has
+// uploaded them.
+func (sh *CasperServerHandler) authorizeFile(ctx context.Context, n *core.IpfsNode, fileID, auth string, ops ...string) (r *owner.Request, next *core.UUIDInfo, err error) {
+	id, err := caller(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, next, err = owner.Check(n, fileID, auth, ops...)
+	if err != nil {
+		log.Warningf("rejecting call from %s on %s: %v", id.Pretty(), fileID, err)
+		return nil, nil, err
+	}
+	if r != nil || isProvider(id) {
+		return r, next, nil
+	}
+
+	uploader, err := sh.getOwner(fileID)
+	if err != nil && err != ds.ErrNotFound {
+		return nil, nil, err
+	}
+	if uploader != id {
+		log.Warningf("rejecting call from %s: not an owner of %s", id.Pretty(), fileID)
+		return nil, nil, errNotOwner
+	}
+	return nil, nil, nil
+}
+
+func (sh *CasperServerHandler) getOwner(fileID string) (peer.ID, error) {
+	repo, err := fsrepo.Open(sh.configRoot)
+	if err != nil {
+		return "", err
+	}
+	defer repo.Close()
+
+	v, err := repo.Datastore().Get(ownerKey(fileID))
+	if err != nil {
+		return "", err
+	}
+	return peer.IDFromBytes(v.([]byte))
+}
+
+// setOwner remembers id as owner of file unless it already has one.
+func (sh *CasperServerHandler) setOwner(fileID string, id peer.ID) error {
+	repo, err := fsrepo.Open(sh.configRoot)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	key := ownerKey(fileID)
+	if has, err := repo.Datastore().Has(key); err != nil || has {
+		return err
+	}
+	return repo.Datastore().Put(key, []byte(id))
+}
+
+func (sh *CasperServerHandler) removeOwner(fileID string) error {
+	repo, err := fsrepo.Open(sh.configRoot)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	err = repo.Datastore().Delete(ownerKey(fileID))
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -3,18 +3,23 @@ package main
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"net"
 	"time"
 
 	cu "github.com/Casper-dev/Casper-server/casper/casper_utils"
 	"github.com/Casper-dev/Casper-server/casper/sc"
+	scin "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
 	"github.com/Casper-dev/Casper-server/casper/thrift"
+	val "github.com/Casper-dev/Casper-server/casper/validation"
 	"github.com/Casper-dev/Casper-server/commands"
 	"github.com/Casper-dev/Casper-server/core"
+	config "github.com/Casper-dev/Casper-server/repo/config"
 	"github.com/Casper-dev/Casper-server/repo/fsrepo"
 
 	"gx/ipfs/QmX3U3YXCQ6UYBxq2LVWF8dARS1hPUTEYLrSx654Qyxyw6/go-multiaddr-net"
 	ma "gx/ipfs/QmXY77cVe7rVRQXZZQRioukUM7aRW3BTcAgJe12MCtb3Ji/go-multiaddr"
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
 
 	"github.com/fatih/color"
 	reuse "github.com/libp2p/go-reuseport"
@@ -27,14 +32,13 @@ const (
 	defaultStatusCheckInterval            = 5 * time.Minute
 	defaultStatusCheckTimeout             = 1 * time.Minute
 	defaultVerificationInitiationInterval = 60 * time.Minute
-	defaultVerificationInitiationTimeout  = 1 * time.Minute
 )
 
 func serveThrift(ctx context.Context, cctx *commands.Context) error {
 	log.Infof("Initializing thrift server...")
 
 	thriftIP := "0.0.0.0"
-	thriftPort := "9090"
+	thriftPort := config.DefaultCasperConnectionPort
 	if cctx.ConfigRoot != "" {
 		if cfg, err := fsrepo.ConfigAt(cctx.ConfigRoot); err == nil && cfg != nil {
 			// TODO: Find out if API can be not IP4 or thrift can use IP6
@@ -100,29 +104,31 @@ func statusChecker(ctx context.Context) {
 	}
 }
 
-var initiatedCheck string
-
-func verificationRunner(ctx context.Context) {
+func verificationRunner(ctx context.Context, node *core.IpfsNode) {
 	/// Node will run random uuid verification every defaultVerificationInitiationInterval(60 as of now) minutes
 	ticker := time.NewTicker(defaultVerificationInitiationInterval)
 	for {
 		select {
 		case <-ticker.C:
-			c, err := sc.GetContract()
-			if err != nil {
-				log.Errorf("error while getting SC: %v", err)
-				continue
-			}
-			//tctx, cancel := context.WithTimeout(ctx, defaultVerificationInitiationTimeout)
-			//auth.Context = tctx
-			// FIXME UUID
-			err = c.NotifyVerificationTarget("123", cu.GetLocalAddr().NodeHash())
-			//cancel()
-			if err != nil {
-				/// Non-critical error; logging to info/debug is ok
-				log.Info(err)
+			uuid := randomStoredUUID()
+			if uuid == "" {
+				log.Debug("no files to verify")
 				continue
 			}
+
+			go func() {
+				report, err := val.PerformValidation(ctx, node, uuid)
+				if err != nil {
+					/// Non-critical error; logging to info/debug is ok
+					log.Infof("verification of %s failed: %v", uuid, err)
+					return
+				}
+				for _, id := range report.Dissenters {
+					if id == cu.GetLocalAddr().NodeHash() {
+						repairFile(ctx, node, uuid)
+					}
+				}
+			}()
 		case <-ctx.Done():
 			log.Error(ctx.Err())
 			return
@@ -130,32 +136,86 @@ func verificationRunner(ctx context.Context) {
 	}
 }
 
-// TODO move to interface somehow
+// randomStoredUUID returns random UUID stored on this node
+// or empty string if there is none.
+func randomStoredUUID() (uuid string) {
+	n := 0
+	// reservoir sampling, because sync.Map has no length
+	core.UUIDInfoCache.Range(func(k, _ interface{}) bool {
+		n++
+		if rand.Intn(n) == 0 {
+			uuid = k.(string)
+		}
+		return true
+	})
+	return uuid
+}
+
+// verificationWatcher joins verifications initiated by other nodes
+// and repairs files if consensus says that our copy is bad.
 func verificationWatcher(ctx context.Context, node *core.IpfsNode) {
-	// FIXME when we come up with new algorithm without events subscribing
-	return
-	//c, _ := sc.GetContract()
-	//c.SubscribeVerificationTarget(ctx, func(uuid string, id string) {
-	//	if _, ok := core.UUIDInfoCache.Load(uuid); ok {
-	//		val.PerformValidation(ctx, node, uuid)
-	//	}
-	//})
-
-	//c.SubscribeConsensusResult(ctx, func(uuid string, consensus [4][32]byte) {
-	//	if _, ok := core.UUIDInfoCache.Load(uuid); ok {
-	//		for _, peer := range consensus {
-	//			// FIXME
-	//			if string(peer[:31]) == cu.GetLocalAddr().NodeHash() {
-	//				repairFile(ctx, uuid)
-	//			}
-	//		}
-	//	}
-	//})
+	c, err := sc.GetContract()
+	if err != nil {
+		log.Errorf("error while getting SC: %v", err)
+		return
+	}
+
+	go func() {
+		err := c.SubscribeVerificationTarget(ctx, func(uuid string, initiator string) {
+			localAddr := cu.GetLocalAddr()
+			if initiator == localAddr.NodeHash() {
+				return
+			}
+			if _, ok := core.UUIDInfoCache.Load(uuid); !ok {
+				return
+			}
+
+			log.Infof("joining verification of %s initiated by %s", uuid, initiator)
+			id, err := peer.IDB58Decode(initiator)
+			if err != nil {
+				log.Error(err)
+				return
+			}
+			addr, err := c.GetRPCAddr(initiator)
+			if err != nil {
+				log.Error(err)
+				return
+			}
+			if err = val.JoinValidation(ctx, id, addr, uuid, localAddr); err != nil {
+				log.Error(err)
+			}
+		})
+		log.Infof("verification target subscription finished: %v", err)
+	}()
+
+	err = c.SubscribeConsensusResult(ctx, func(uuid string, consensus [4][32]byte) {
+		if _, ok := core.UUIDInfoCache.Load(uuid); !ok {
+			return
+		}
+		for _, peer := range consensus {
+			if peer == [32]byte{} {
+				continue
+			}
+			id, err := scin.BytesToHash(peer)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			if id == cu.GetLocalAddr().NodeHash() {
+				repairFile(ctx, node, uuid)
+			}
+		}
+	})
+	log.Infof("consensus result subscription finished: %v", err)
 }
 
-func repairFile(ctx context.Context, UUID string) {
-	fmt.Println("Repairing file", UUID)
-	/// Make file repair
+func repairFile(ctx context.Context, node *core.IpfsNode, uuid string) {
+	fmt.Println("Repairing file", uuid)
+	if err := val.RepairFile(ctx, node, uuid); err != nil {
+		log.Errorf("can't repair file %s: %v", uuid, err)
+		return
+	}
+	fmt.Println("File", uuid, "repaired")
 }
 
 // TODO: implement timeout
@@ -10,17 +10,25 @@ import (
 	"os"
 	"time"
 
+	"github.com/Casper-dev/Casper-server/blockservice"
 	cu "github.com/Casper-dev/Casper-server/casper/casper_utils"
+	"github.com/Casper-dev/Casper-server/casper/catalog"
+	"github.com/Casper-dev/Casper-server/casper/events"
+	"github.com/Casper-dev/Casper-server/casper/owner"
 	"github.com/Casper-dev/Casper-server/casper/proxy"
 	"github.com/Casper-dev/Casper-server/casper/sc"
+	scin "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
 	"github.com/Casper-dev/Casper-server/casper/thrift"
 	uid "github.com/Casper-dev/Casper-server/casper/uuid"
 	val "github.com/Casper-dev/Casper-server/casper/validation"
+	"github.com/Casper-dev/Casper-server/casper/versions"
 	oldCmds "github.com/Casper-dev/Casper-server/commands"
 	"github.com/Casper-dev/Casper-server/core"
 	"github.com/Casper-dev/Casper-server/core/commands"
 	"github.com/Casper-dev/Casper-server/core/corehttp"
 	"github.com/Casper-dev/Casper-server/exchange/bitswap/decision"
+	"github.com/Casper-dev/Casper-server/exchange/offline"
+	dag "github.com/Casper-dev/Casper-server/merkledag"
 	"github.com/Casper-dev/Casper-server/repo/fsrepo"
 
 	"github.com/Casper-dev/Casper-thrift/casperproto"
@@ -32,6 +40,8 @@ import (
 	"gx/ipfs/QmeS8cCKawUwejVrsBtmC1toTXmwVWZGiRJqzgTURVWeF9/go-ipfs-addr"
 )
 
+// CasperThriftOption serves thrift over HTTP. Such calls are not
+// authenticated, so all of them except Ping are rejected by the handler.
 func CasperThriftOption(cctx oldCmds.Context) corehttp.ServeOption {
 	return func(n *core.IpfsNode, l net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
 		cmdHandler := thrift.NewHandler(NewCasperServerHandler(cctx.ConfigRoot))
@@ -63,6 +73,9 @@ func (sh *CasperServerHandler) GetNode(ctx context.Context) (*core.IpfsNode, err
 
 func (sh *CasperServerHandler) GetFileChecksum(ctx context.Context, uuid string, first, last int64, salt string) (string, error) {
 	log.Debugf("Thrift: GetFileChecksum(%s, %d, %d, %s)", uuid, first, last, salt)
+	if err := authorizeProvider(ctx); err != nil {
+		return "", err
+	}
 
 	//id := uid.UUIDToCid(base58.Decode(uuid))
 	mhash, err := multihash.FromB58String(uuid)
@@ -97,8 +110,21 @@ func (serverHandler *CasperServerHandler) Ping(ctx context.Context) (*casperprot
 	}, nil
 }
 
-func (serverHandler *CasperServerHandler) SendUploadQuery(ctx context.Context, hash string, ipAddr string, size int64) (status string, err error) {
+func (serverHandler *CasperServerHandler) SendUploadQuery(ctx context.Context, hash string, ipAddr string, size int64, auth string) (status string, err error) {
 	log.Debugf("Thrift: SendUploadQuery(%s, %s, %d)", hash, ipAddr, size)
+	id, err := caller(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	n, err := serverHandler.GetNode(ctx)
+	if err != nil {
+		return "", err
+	}
+	r, info, err := owner.Check(n, hash, auth, owner.OpCreate)
+	if err != nil {
+		return "", err
+	}
 
 	var ipList []string
 	err = json.Unmarshal([]byte(ipAddr), &ipList)
@@ -116,6 +142,19 @@ func (serverHandler *CasperServerHandler) SendUploadQuery(ctx context.Context, h
 	if err != nil {
 		return "", err
 	}
+	if r != nil {
+		err = owner.Store(n, r.UUID, info)
+	} else {
+		err = serverHandler.setOwner(hash, id)
+	}
+	if err != nil {
+		log.Error(err)
+	}
+	if err = catalog.TouchHash(ctx, n, hash); err != nil {
+		log.Error(err)
+	}
+	uuid, _, _ := owner.Lookup(hash)
+	events.Publish(events.Event{Type: events.FileStored, UUID: uuid, Hash: hash, Size: size})
 
 	c, _ := sc.GetContract()
 	err = c.ConfirmUpload(serverHandler.NodeID(), hash, size)
@@ -123,15 +162,76 @@ func (serverHandler *CasperServerHandler) SendUploadQuery(ctx context.Context, h
 	return
 }
 
-func (serverHandler *CasperServerHandler) SendDownloadQuery(ctx context.Context, hash string, ipAddr string, wallet string) (status string, err error) {
-	log.Debugf("Thrift: SendDownloadQuery(%s, %s, %s)", hash, ipAddr, wallet)
-
-	decision.AllowHash(hash, wallet)
+// proof is the wallet of the caller with the proof of its ownership, see sc_interface.SignWalletProof
+func (serverHandler *CasperServerHandler) SendDownloadQuery(ctx context.Context, hash string, ipAddr string, proof string) (status string, err error) {
+	log.Debugf("Thrift: SendDownloadQuery(%s, %s)", hash, ipAddr)
+	id, err := caller(ctx)
+	if err != nil {
+		return "", err
+	}
+	c, err := sc.GetContract()
+	if err != nil {
+		return "", err
+	}
+	wallet, err := scin.VerifyWalletProof(c, proof, id.Pretty())
+	if err != nil {
+		return "", err
+	}
+	n, err := serverHandler.GetNode(ctx)
+	if err != nil {
+		return "", err
+	}
+	root, blocks, err := fileBlocks(ctx, n, hash)
+	if err != nil {
+		return "", err
+	}
+	// download is granted even if access is not restricted,
+	// so that traffic is metered for billing; clients which
+	// pay with payment channels need no prepaid wallet
+	if decision.DefaultAccess.Enabled() && !decision.DefaultAccess.HasCredit(id) {
+		if ok, err := decision.DefaultAccess.Prepaid(wallet); err != nil || !ok {
+			return "", errors.New("download is not prepaid")
+		}
+	}
+	decision.DefaultAccess.Allow(id, wallet, root, blocks)
 	return "", nil
 }
 
-func (serverHandler *CasperServerHandler) SendDeleteQuery(ctx context.Context, hash string) (status string, err error) {
+// fileBlocks returns root CID of the file with specified hash or UUID and
+// CIDs of all its descendants. Only local blocks are used, as provider can
+// serve only what it stores.
+func fileBlocks(ctx context.Context, n *core.IpfsNode, hash string) (*cid.Cid, []*cid.Cid, error) {
+	root, err := uid.FileCid(hash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dserv := dag.NewDAGService(blockservice.New(n.Blockstore, offline.Exchange(n.Blockstore)))
+	var blocks []*cid.Cid
+	seen := cid.NewSet()
+	err = dag.EnumerateChildren(ctx, dag.GetLinksDirect(dserv), root, func(c *cid.Cid) bool {
+		if !seen.Visit(c) {
+			return false
+		}
+		blocks = append(blocks, c)
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return root, blocks, nil
+}
+
+func (serverHandler *CasperServerHandler) SendDeleteQuery(ctx context.Context, hash string, auth string) (status string, err error) {
 	log.Debugf("Thrift: SendDeleteQuery(%s)", hash)
+	n, err := serverHandler.GetNode(ctx)
+	if err != nil {
+		return "", err
+	}
+	r, _, err := serverHandler.authorizeFile(ctx, n, hash, auth, owner.OpDelete)
+	if err != nil {
+		return "", err
+	}
 
 	///TODO: We might want to reimplement this without runCommand
 	status, err = runCommand(ctx, []string{"pin", "rm", "--recursive", hash})
@@ -142,6 +242,22 @@ func (serverHandler *CasperServerHandler) SendDeleteQuery(ctx context.Context, h
 		return "", err
 	}
 
+	id, _, ok := owner.Lookup(hash)
+	if ok {
+		if err := versions.Drop(n, id); err != nil {
+			log.Error(err)
+		}
+	}
+	events.Publish(events.Event{Type: events.FileDeleted, UUID: id, Hash: hash})
+	if r != nil {
+		err = n.RemoveUUID(r.UUID)
+	} else {
+		err = serverHandler.removeOwner(hash)
+	}
+	if err != nil {
+		log.Error(err)
+	}
+
 	c, _ := sc.GetContract()
 	err = c.NotifySpaceFreed(serverHandler.NodeID(), hash, int64(commands.SizeOut))
 	if err != nil {
@@ -153,6 +269,9 @@ func (serverHandler *CasperServerHandler) SendDeleteQuery(ctx context.Context, h
 
 func (serverHandler *CasperServerHandler) SendReplicationQuery(ctx context.Context, fileID string, nodeID string, size int64) (status string, err error) {
 	log.Debugf("Thrift: SendReplicationQuery(%s, %s, %d)", nodeID, fileID, size)
+	if err = authorizeProvider(ctx); err != nil {
+		return "", err
+	}
 
 	c, _ := sc.GetContract()
 	verified, err := c.VerifyReplication(nodeID)
@@ -178,6 +297,9 @@ func (serverHandler *CasperServerHandler) SendReplicationQuery(ctx context.Conte
 		if err != nil {
 			return
 		}
+		serverHandler.fetchOwnership(ctx, fileID, peers)
+		uuid, _, _ := owner.Lookup(fileID)
+		events.Publish(events.Event{Type: events.FileStored, UUID: uuid, Hash: fileID, Size: size})
 
 		///TODO: check actual size from network
 		return "", c.ConfirmUpload(serverHandler.NodeID(), fileID, size)
@@ -185,15 +307,37 @@ func (serverHandler *CasperServerHandler) SendReplicationQuery(ctx context.Conte
 	return "", errors.New("replication verification failed")
 }
 
-func (serverHandler *CasperServerHandler) SendUpdateQuery(ctx context.Context, uuid string, hash string, size int64) (status string, err error) {
+func (serverHandler *CasperServerHandler) SendUpdateQuery(ctx context.Context, uuid string, hash string, size int64, auth string) (status string, err error) {
 	log.Debugf("Thrift: SendUpdateQuery(%s, %s, %d)", uuid, hash, size)
 
-	status, err = runCommand(ctx, []string{"upd", uuid, hash})
+	h := uid.UUIDToHash(base58.Decode(uuid)).B58String()
+	n, err := serverHandler.GetNode(ctx)
+	if err != nil {
+		return "", err
+	}
+	r, info, err := serverHandler.authorizeFile(ctx, n, h, auth, owner.OpUpdate, owner.OpTransfer)
+	if err != nil {
+		return "", err
+	}
+	if r != nil && r.Op == owner.OpTransfer {
+		// only ownership is changed
+		return "", owner.Store(n, uuid, info)
+	}
+	args := []string{"upd", uuid, hash}
+	if r != nil && r.Hash != "" {
+		// fetched content must be the one the request is signed for
+		args = append(args, "--content-hash="+r.Hash)
+	}
+	status, err = runCommand(ctx, args)
 	if err != nil {
 		return
 	}
-
-	h := uid.UUIDToHash(base58.Decode(uuid)).B58String()
+	events.Publish(events.Event{Type: events.FileUpdated, UUID: uuid, Hash: hash, Size: size})
+	if r != nil {
+		if err = owner.Store(n, uuid, info); err != nil {
+			log.Error(err)
+		}
+	}
 
 	c, _ := sc.GetContract()
 	err = c.ConfirmUpdate(serverHandler.NodeID(), h, size)
@@ -204,12 +348,14 @@ func (serverHandler *CasperServerHandler) SendUpdateQuery(ctx context.Context, u
 // message with UUID has been appeared in SC logs
 func (sh *CasperServerHandler) SendVerificationQuery(ctx context.Context, uuid string, ninfo *casperproto.NodeInfo) error {
 	log.Debugf("Thrift: VerificationQuery(%s, %+v)", uuid, ninfo)
-
 	addr, err := ipfsaddr.ParseString(ninfo.IpfsAddr)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
+	if err = authorizeProviderAs(ctx, addr.ID()); err != nil {
+		return err
+	}
 	taddr, err := net.ResolveTCPAddr("tcp", ninfo.ThriftAddr)
 	if err != nil {
 		log.Error(err)
@@ -223,6 +369,9 @@ func (sh *CasperServerHandler) SendVerificationQuery(ctx context.Context, uuid s
 
 func (sh *CasperServerHandler) SendChunkInfo(ctx context.Context, cinfo *casperproto.ChunkInfo) error {
 	log.Debugf("Thrift: ChunkSectionInfo(%+v)", cinfo)
+	if err := authorizeProvider(ctx); err != nil {
+		return err
+	}
 	go val.CollectResultsAndRespond(context.Background(), cinfo, sh.configRoot)
 	log.Debugf("fihish ChunkSectionInfo()")
 	return nil
@@ -234,21 +383,107 @@ func (sh *CasperServerHandler) SendChecksumHash(ctx context.Context, uuid string
 	if err != nil {
 		return err
 	}
+	if err = authorizeProviderAs(ctx, addr.ID()); err != nil {
+		return err
+	}
 	val.AddRound1Result(ctx, uuid, addr, hashDiffuse)
 	log.Debugf("finish SendChecksumHash()")
 	return nil
 }
 
 func (serverHandler *CasperServerHandler) SendValidationResults(ctx context.Context, uuid string, ipfsAddr string, addrToHash map[string]string) error {
-	log.Debugf("Thrift: SendValidationResults(%s, %s)", uuid, ipfsAddr, addrToHash)
+	log.Debugf("Thrift: SendValidationResults(%s, %s, %v)", uuid, ipfsAddr, addrToHash)
+	addr, err := ipfsaddr.ParseString(ipfsAddr)
+	if err != nil {
+		return err
+	}
+	if err = authorizeProviderAs(ctx, addr.ID()); err != nil {
+		return err
+	}
+	val.AddValidationResults(ctx, uuid, addr, addrToHash)
+	return nil
+}
 
-	// TODO Determine who is bad provider (if any) and send to SC
+// GetOwnership returns JSON-encoded owner.Record of the file
+// or empty string if file has no owner.
+func (serverHandler *CasperServerHandler) GetOwnership(ctx context.Context, hash string) (string, error) {
+	log.Debugf("Thrift: GetOwnership(%s)", hash)
+	if err := authorizeProvider(ctx); err != nil {
+		return "", err
+	}
 
-	return nil
+	uuid, info, ok := owner.Lookup(hash)
+	if !ok || !owner.IsOwned(info) {
+		return "", nil
+	}
+	b, err := json.Marshal(owner.NewRecord(uuid, info))
+	return string(b), err
+}
+
+// fetchOwnership asks peers which store the file about its owner,
+// so that signed requests to the new replica can be verified.
+// Records are verified, as peers are not trusted to report ownership.
+func (sh *CasperServerHandler) fetchOwnership(ctx context.Context, fileID string, peers []ma.Multiaddr) {
+	var uuid string
+	var own *core.UUIDInfo
+	for _, peer := range peers {
+		paddr, err := ipfsaddr.ParseMultiaddr(peer)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		addr, err := cu.GetThriftAddr(peer)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		res, err := thrift.RunClientClosureTo(addr, paddr.ID(), func(c *thrift.ThriftClient) (interface{}, error) {
+			return c.GetOwnership(ctx, fileID)
+		})
+		if err != nil || res.(string) == "" {
+			continue
+		}
+
+		rec := new(owner.Record)
+		if err = json.Unmarshal([]byte(res.(string)), rec); err != nil || owner.FileID(rec.UUID) != fileID {
+			log.Warningf("invalid ownership record of %s from %s", fileID, peer)
+			continue
+		}
+		v, err := rec.Verify()
+		if err != nil {
+			log.Warningf("rejecting ownership record of %s from %s: %v", fileID, peer, err)
+			continue
+		}
+		if own == nil || v.Seq > own.Seq {
+			uuid, own = rec.UUID, v
+		}
+	}
+	if own == nil {
+		return
+	}
+
+	n, err := sh.GetNode(ctx)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	err = n.UpdateUUID(uuid, func(info *core.UUIDInfo) error {
+		if owner.IsOwned(info) && info.Seq >= own.Seq {
+			return nil
+		}
+		owner.Apply(info, own)
+		return nil
+	})
+	if err != nil {
+		log.Error(err)
+	}
 }
 
 func (serverHandler *CasperServerHandler) SendConnectQuery(ctx context.Context) (string, error) {
 	log.Debugf("Thrift: SendConnectQuery")
+	if _, err := caller(ctx); err != nil {
+		return "", err
+	}
 	name, passwd := proxy.GenProxyCreds(26266637774 + time.Now().Unix()%179425859)
 	return proxy.GetProxy(name, passwd)
 }
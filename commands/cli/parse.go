@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -9,12 +10,15 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/Casper-dev/Casper-server/casper/crypto"
 	cmds "github.com/Casper-dev/Casper-server/commands"
 	files "github.com/Casper-dev/Casper-server/commands/files"
+	"github.com/Casper-dev/Casper-server/repo/fsrepo"
 
 	u "gx/ipfs/QmSU6eubNdhXjFBJBSksTp8kv8YRub8mGAPv8tVJHmL2EU/go-ipfs-util"
 	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
 	osh "gx/ipfs/QmXuBJ7DR6k3rmUEKtvVMhwjmXDuJgXXPUt4LQXKBMsU93/go-os-helper"
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
 )
 
 var log = logging.Logger("commands/cli")
@@ -87,14 +91,48 @@ func ParseArgs(req cmds.Request, inputs []string, stdin *os.File, argDefs []cmds
 		}
 	}
 
-	// TODO: use context?
-	if pwdOpt := req.Option("password"); pwdOpt != nil {
-		if pwd, pwdset, _ := pwdOpt.String(); pwdset {
-			return parseArgs(inputs, stdin, argDefs, recursive, hidden, root, []byte(pwd))
-		}
+	key, err := encryptionKey(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseArgs(inputs, stdin, argDefs, recursive, hidden, root, key)
+}
+
+// encryptionKey returns key for encryption of added files specified
+// by 'password', 'enc-key' and 'convergent' options. Keystore keys are read from the
+// local repository, as files are encrypted before they are sent to daemon.
+func encryptionKey(req cmds.Request) (*crypto.Key, error) {
+	var password, keyName string
+	if opt := req.Option("password"); opt != nil {
+		password, _, _ = opt.String()
+	}
+	if opt := req.Option("enc-key"); opt != nil {
+		keyName, _, _ = opt.String()
 	}
 
-	return parseArgs(inputs, stdin, argDefs, recursive, hidden, root, nil)
+	key, err := crypto.KeyFromOptions(password, keyName, func(name string) (ci.PrivKey, error) {
+		repoPath, _, _ := req.Option("config").String()
+		if repoPath == "" {
+			var err error
+			if repoPath, err = fsrepo.BestKnownPath(); err != nil {
+				return nil, err
+			}
+		}
+		return crypto.LoadRepoKey(repoPath, name)
+	})
+	var convergent bool
+	if opt := req.Option("convergent"); opt != nil {
+		convergent, _, _ = opt.Bool()
+	}
+	switch {
+	case err == crypto.ErrNoKey && convergent:
+		return nil, errors.New("convergent encryption requires password or enc-key")
+	case err == crypto.ErrNoKey:
+		return nil, nil
+	case err == nil && convergent:
+		return key.Convergent(), nil
+	}
+	return key, err
 }
 
 // Parse a command line made up of sub-commands, short arguments, long arguments and positional arguments
@@ -264,7 +302,7 @@ func parseOpts(args []string, root *cmds.Command) (
 
 const msgStdinInfo = "ipfs: Reading from %s; send Ctrl-d to stop."
 
-func parseArgs(inputs []string, stdin *os.File, argDefs []cmds.Argument, recursive, hidden bool, root *cmds.Command, password []byte) ([]string, []files.File, error) {
+func parseArgs(inputs []string, stdin *os.File, argDefs []cmds.Argument, recursive, hidden bool, root *cmds.Command, key *crypto.Key) ([]string, []files.File, error) {
 	// ignore stdin on Windows
 	if osh.IsWindows() {
 		stdin = nil
@@ -333,16 +371,21 @@ func parseArgs(inputs []string, stdin *os.File, argDefs []cmds.Argument, recursi
 					if err != nil {
 						return nil, nil, err
 					}
+					if key != nil {
+						if r, err = crypto.NewEncryptReadCloser(r, key); err != nil {
+							return nil, nil, err
+						}
+					}
 
 					fpath = stdin.Name()
 					file = files.NewReaderFile("", fpath, r, nil)
 				} else {
 					var nf files.File
 					var err error
-					if password == nil {
+					if key == nil {
 						nf, err = appendFile(fpath, argDef, recursive, hidden)
 					} else {
-						nf, err = appendFileEncrypted(fpath, argDef, recursive, hidden, password)
+						nf, err = appendFileEncrypted(fpath, argDef, recursive, hidden, key)
 					}
 					if err != nil {
 						return nil, nil, err
@@ -417,7 +460,7 @@ func appendFile(fpath string, argDef *cmds.Argument, recursive, hidden bool) (fi
 	return appendFileEncrypted(fpath, argDef, recursive, hidden, nil)
 }
 
-func appendFileEncrypted(fpath string, argDef *cmds.Argument, recursive, hidden bool, password []byte) (files.File, error) {
+func appendFileEncrypted(fpath string, argDef *cmds.Argument, recursive, hidden bool, key *crypto.Key) (files.File, error) {
 	// resolve Windows relative dot paths like `X:.\somepath`
 	if osh.IsWindows() {
 		if len(fpath) >= 3 && fpath[1:3] == ":." {
@@ -458,10 +501,10 @@ func appendFileEncrypted(fpath string, argDef *cmds.Argument, recursive, hidden
 	}
 
 	if osh.IsWindows() {
-		return windowsParseFile(fpath, hidden, stat, password)
+		return windowsParseFile(fpath, hidden, stat, key)
 	}
 
-	return files.NewSerialFile(path.Base(fpath), fpath, hidden, stat, password)
+	return files.NewSerialFile(path.Base(fpath), fpath, hidden, stat, key)
 }
 
 // Inform the user if a file is waiting on input
@@ -514,7 +557,7 @@ func (r *messageReader) Close() error {
 	return r.r.Close()
 }
 
-func windowsParseFile(fpath string, hidden bool, stat os.FileInfo, password []byte) (files.File, error) {
+func windowsParseFile(fpath string, hidden bool, stat os.FileInfo, key *crypto.Key) (files.File, error) {
 	// special cases for Windows drive roots i.e. `X:\` and their long form `\\?\X:\`
 	// drive path must be preserved as `X:\` (or it's longform) and not converted to `X:`, `X:.`, `\`, or `/` here
 	switch len(fpath) {
@@ -525,7 +568,7 @@ func windowsParseFile(fpath string, hidden bool, stat os.FileInfo, password []by
 		}
 		// `X:\` needs to preserve the `\`, path.Base(filepath.ToSlash(fpath)) results in `X:` which is not valid
 		if fpath[1:3] == ":\\" {
-			return files.NewSerialFile(fpath, fpath, hidden, stat, password)
+			return files.NewSerialFile(fpath, fpath, hidden, stat, key)
 		}
 	case 6:
 		// `\\?\X:` long prefix form of `X:`, still ambiguous
@@ -536,9 +579,9 @@ func windowsParseFile(fpath string, hidden bool, stat os.FileInfo, password []by
 		// `\\?\X:\` long prefix form is translated into short form `X:\`
 		if fpath[:4] == "\\\\?\\" && fpath[5] == ':' && fpath[6] == '\\' {
 			fpath = string(fpath[4]) + ":\\"
-			return files.NewSerialFile(fpath, fpath, hidden, stat, password)
+			return files.NewSerialFile(fpath, fpath, hidden, stat, key)
 		}
 	}
 
-	return files.NewSerialFile(path.Base(filepath.ToSlash(fpath)), fpath, hidden, stat, password)
+	return files.NewSerialFile(path.Base(filepath.ToSlash(fpath)), fpath, hidden, stat, key)
 }
@@ -21,11 +21,11 @@ type serialFile struct {
 	files             []os.FileInfo
 	stat              os.FileInfo
 	current           *File
-	password          []byte
+	key               *crypto.Key
 	handleHiddenFiles bool
 }
 
-func NewSerialFile(name, path string, hidden bool, stat os.FileInfo, passwd []byte) (File, error) {
+func NewSerialFile(name, path string, hidden bool, stat os.FileInfo, key *crypto.Key) (File, error) {
 
 	switch mode := stat.Mode(); {
 	case mode.IsRegular():
@@ -34,8 +34,12 @@ func NewSerialFile(name, path string, hidden bool, stat os.FileInfo, passwd []by
 			return nil, err
 		}
 
-		if passwd != nil {
-			fileEnc := crypto.NewAESEncryptReadCloser(file, passwd)
+		if key != nil {
+			fileEnc, err := crypto.NewEncryptReadCloser(file, key)
+			if err != nil {
+				file.Close()
+				return nil, err
+			}
 			return NewReaderPathFile(name, path, fileEnc, stat)
 		}
 		return NewReaderPathFile(name, path, file, stat)
@@ -47,7 +51,7 @@ func NewSerialFile(name, path string, hidden bool, stat os.FileInfo, passwd []by
 			return nil, err
 		}
 
-		return &serialFile{name, path, contents, stat, nil, passwd, hidden}, nil
+		return &serialFile{name, path, contents, stat, nil, key, hidden}, nil
 	case mode&os.ModeSymlink != 0:
 		target, err := os.Readlink(path)
 		if err != nil {
@@ -103,7 +107,7 @@ func (f *serialFile) NextFile() (File, error) {
 	// recursively call the constructor on the next file
 	// if it's a regular file, we will open it as a ReaderFile
 	// if it's a directory, files in it will be opened serially
-	sf, err := NewSerialFile(fileName, filePath, f.handleHiddenFiles, stat, f.password)
+	sf, err := NewSerialFile(fileName, filePath, f.handleHiddenFiles, stat, f.key)
 	if err != nil {
 		return nil, err
 	}
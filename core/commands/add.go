@@ -13,8 +13,12 @@ import (
 	bstore "github.com/Casper-dev/Casper-server/blocks/blockstore"
 	"github.com/Casper-dev/Casper-server/blockservice"
 	cu "github.com/Casper-dev/Casper-server/casper/casper_utils"
+	"github.com/Casper-dev/Casper-server/casper/catalog"
+	"github.com/Casper-dev/Casper-server/casper/events"
+	"github.com/Casper-dev/Casper-server/casper/owner"
 	sc "github.com/Casper-dev/Casper-server/casper/sc"
 	"github.com/Casper-dev/Casper-server/casper/uuid"
+	"github.com/Casper-dev/Casper-server/casper/versions"
 	cmds "github.com/Casper-dev/Casper-server/commands"
 	"github.com/Casper-dev/Casper-server/commands/files"
 	"github.com/Casper-dev/Casper-server/core"
@@ -67,9 +71,12 @@ MerkleDAG.
 		cmds.StringOption(hashOptionName, "Hash function to use. Will set Cid version to 1 if used. (experimental)").Default("sha2-256"),
 		cmds.StringOption(uuidOptionName, "Base58-encoded UUID to use. Generate random by default.").Default(nil),
 		cmds.BoolOption(updateOptionName, "Update file with existing UUID instead of adding new.").Default(true),
-		cmds.StringOption(passwordOptionName, "Encrypt files using password (AEC-256 CTR)."),
+		cmds.StringOption(passwordOptionName, "Encrypt files using password (AES-256-GCM)."),
+		cmds.StringOption(encKeyOptionName, "Encrypt files using key derived from keystore key, 'self' for node identity."),
+		cmds.BoolOption(convergentOptionName, "Derive file keys from contents, so that identical files encrypted with the same key are deduplicated."),
 		cmds.StringOption(peersOptionName, "JSON-encoded list of peer-multiaddrs").Default(""),
 		cmds.BoolOption(waitOptionName, "Wait until file is read").Default(""),
+		cmds.StringOption(authOptionName, "Signed create or update request (used by REST API)."),
 	},
 	PreRun: func(req cmds.Request) error {
 		quiet, _, _ := req.Option(quietOptionName).Bool()
@@ -160,6 +167,19 @@ MerkleDAG.
 		uuidOpt, _, _ := req.Option(uuidOptionName).String()
 		//waitOpt, _, _ := req.Option(waitOptionName).Bool()
 
+		// files uploaded with REST API can be bound to an owner
+		// and must be updated with a request signed by one of its keys
+		var ownReq *owner.Request
+		var ownInfo *core.UUIDInfo
+		if caller == cmds.CallerOptWeb {
+			auth, _, _ := req.Option(authOptionName).String()
+			ownReq, ownInfo, err = owner.Check(n, owner.FileID(uuidOpt), auth, owner.OpCreate, owner.OpUpdate)
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+		}
+
 		if nocopy && !cfg.Experimental.FilestoreEnabled {
 			res.SetError(errors.New("filestore is not enabled, see https://git.io/vy4XN"),
 				cmds.ErrClient)
@@ -256,7 +276,7 @@ MerkleDAG.
 
 			fileAdder.SetMfsRoot(mr)
 		}
-		contract, err := sc.GetContract(cfg.Casper.Blockchain[cfg.Casper.UsedChain])
+		contract, err := sc.GetContractByName(req.Context(), cfg.Casper.UsedChain, cfg.Casper.Blockchain[cfg.Casper.UsedChain])
 		if err != nil {
 			if caller == cmds.CallerOptWeb {
 				res.SetError(err, cmds.ErrNormal)
@@ -301,12 +321,36 @@ MerkleDAG.
 			uid := base58.Decode(uuidOpt)
 			log.Debugf("UUID: '%s'", uuidOpt)
 			pn.SetUUID(uid)
+			if ownReq != nil && ownReq.Hash != "" && ownReq.Hash != owner.ContentHash(pn) {
+				return owner.ErrWrongFile
+			}
+			// previous content is replaced when root is stored
+			if caller == cmds.CallerOptWeb {
+				if err := versions.Snapshot(req.Context(), n, uuidOpt); err != nil {
+					return err
+				}
+			}
 			exch.HasBlock(pn)
 			root = pn
-			n.AddUUID(uuidOpt, &core.UUIDInfo{PubKey: ""})
+			event := events.Event{Type: events.FileStored, UUID: uuidOpt, Hash: pn.Cid().String()}
+			if _, err := n.GetUUID(uuidOpt); err == nil {
+				event.Type = events.FileUpdated
+			}
+			if ownInfo != nil {
+				if err := owner.Store(n, uuidOpt, ownInfo); err != nil {
+					return err
+				}
+			} else if _, err := n.GetUUID(uuidOpt); err != nil {
+				n.AddUUID(uuidOpt, &core.UUIDInfo{})
+			}
+			if err := catalog.Touch(req.Context(), n, uuidOpt, pn); err != nil {
+				log.Error(err)
+			}
 
 			size, _ := root.Size()
 			log.Debug(size)
+			event.Size = int64(size)
+			events.Publish(event)
 
 			if caller == cmds.CallerOptWeb {
 				contract.ConfirmUpload(cu.GetLocalAddr().NodeHash(), root.Cid().String(), int64(size))
@@ -347,12 +391,18 @@ MerkleDAG.
 					}
 				}
 
+				// other providers must learn owner of the new file
+				var auth string
+				if ownReq != nil && ownReq.Op == owner.OpCreate {
+					auth, _, _ = req.Option(authOptionName).String()
+				}
+
 				wg := &sync.WaitGroup{}
 				wg.Add(len(peers))
 				for _, peer := range peers {
 					go func(p ma.Multiaddr) {
 						defer wg.Done()
-						uploadRoot(context.Background(), n, p, root)
+						uploadRoot(context.Background(), n, p, root, auth)
 					}(peer)
 				}
 				wg.Wait()
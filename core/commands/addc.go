@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net"
 	"strconv"
 	"strings"
 	"time"
@@ -13,6 +12,8 @@ import (
 	bstore "github.com/Casper-dev/Casper-server/blocks/blockstore"
 	"github.com/Casper-dev/Casper-server/blockservice"
 	cu "github.com/Casper-dev/Casper-server/casper/casper_utils"
+	"github.com/Casper-dev/Casper-server/casper/events"
+	"github.com/Casper-dev/Casper-server/casper/owner"
 	sc "github.com/Casper-dev/Casper-server/casper/sc"
 	"github.com/Casper-dev/Casper-server/casper/uuid"
 	"github.com/Casper-dev/Casper-server/client"
@@ -25,6 +26,7 @@ import (
 	dagtest "github.com/Casper-dev/Casper-server/merkledag/test"
 	"github.com/Casper-dev/Casper-server/mfs"
 	"github.com/Casper-dev/Casper-server/pin"
+	config "github.com/Casper-dev/Casper-server/repo/config"
 	ft "github.com/Casper-dev/Casper-server/unixfs"
 
 	u "gx/ipfs/QmSU6eubNdhXjFBJBSksTp8kv8YRub8mGAPv8tVJHmL2EU/go-ipfs-util"
@@ -58,9 +60,17 @@ const (
 	hashOptionName        = "hash"
 	uuidOptionName        = "uuid"
 	passwordOptionName    = "password"
+	encKeyOptionName      = "enc-key"
+	convergentOptionName  = "convergent"
 	updateOptionName      = "update"
 	peersOptionName       = "peers"
 	waitOptionName        = "wait"
+
+	replicasOptionName      = "replicas"
+	minReplicasOptionName   = "min-replicas"
+	spreadOriginsOptionName = "spread-origins"
+	lowLatencyOptionName    = "prefer-low-latency"
+	excludePeersOptionName  = "exclude-peers"
 )
 
 const adderOutChanSize = 8
@@ -139,9 +149,18 @@ You can now check what blocks have been created by:
 		cmds.StringOption(hashOptionName, "Hash function to use. Will set Cid version to 1 if used. (experimental)").Default("sha2-256"),
 		cmds.StringOption(uuidOptionName, "Base58-encoded UUID to use. Generate random by default.").Default(nil),
 		cmds.BoolOption(updateOptionName, "Update file with existing UUID instead of adding new.").Default(true),
-		cmds.StringOption(passwordOptionName, "Encrypt files using password (AEC-256 CTR)."),
+		cmds.StringOption(passwordOptionName, "Encrypt files using password (AES-256-GCM)."),
+		cmds.StringOption(encKeyOptionName, "Encrypt files using key derived from keystore key, 'self' for node identity."),
+		cmds.BoolOption(convergentOptionName, "Derive file keys from contents, so that identical files encrypted with the same key are deduplicated."),
 		cmds.StringOption(peersOptionName, "JSON-encoded list of peer-multiaddrs").Default(""),
 		cmds.BoolOption(waitOptionName, "Wait until file is read").Default(""),
+		cmds.IntOption(replicasOptionName, "Number of providers to store file on. Default: Casper.Replicas from config."),
+		cmds.IntOption(minReplicasOptionName, "Minimal number of providers which must store file. Default: Casper.MinReplicas from config."),
+		cmds.BoolOption(spreadOriginsOptionName, "Place replicas in as many geo locations as possible."),
+		cmds.BoolOption(lowLatencyOptionName, "Prefer providers with lower latency."),
+		cmds.StringOption(excludePeersOptionName, "Comma-separated list of provider IDs which must not store file."),
+		cmds.StringOption(keyOptionName, "k", "Name of the key which owns new file or signs update. Default: self."),
+		cmds.StringOption(writersOptionName, "Comma-separated list of key IDs which can update and delete new file."),
 	},
 	PreRun: func(req cmds.Request) error {
 		quiet, _, _ := req.Option(quietOptionName).Bool()
@@ -232,8 +251,16 @@ You can now check what blocks have been created by:
 		caller, _, _ := req.Option(cmds.CallerOpt).String()
 		uuidOpt, _, _ := req.Option(uuidOptionName).String()
 		upd, _, _ := req.Option(updateOptionName).Bool()
+		keyName, _, _ := req.Option(keyOptionName).String()
+		writers, _, _ := req.Option(writersOptionName).String()
 		//waitOpt, _, _ := req.Option(waitOptionName).Bool()
 
+		placement, err := getPlacementOpts(req, &cfg.Casper)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
 		if nocopy && !cfg.Experimental.FilestoreEnabled {
 			res.SetError(errors.New("filestore is not enabled, see https://git.io/vy4XN"),
 				cmds.ErrClient)
@@ -331,7 +358,7 @@ You can now check what blocks have been created by:
 			fileAdder.SetMfsRoot(mr)
 		}
 
-		contract, err := sc.GetContract(cfg.Casper.Blockchain[cfg.Casper.UsedChain])
+		contract, err := sc.GetContractByName(req.Context(), cfg.Casper.UsedChain, cfg.Casper.Blockchain[cfg.Casper.UsedChain])
 		if err != nil {
 			if caller == cmds.CallerOptWeb {
 				res.SetError(err, cmds.ErrNormal)
@@ -387,7 +414,9 @@ You can now check what blocks have been created by:
 			pn.SetUUID(uid)
 			exch.HasBlock(pn)
 			root = pn
-			n.AddUUID(uuidOpt, &core.UUIDInfo{PubKey: ""})
+			if _, err := n.GetUUID(uuidOpt); err != nil {
+				n.AddUUID(uuidOpt, &core.UUIDInfo{})
+			}
 
 			size, _ := pn.Size()
 			log.Debug(size)
@@ -432,44 +461,67 @@ You can now check what blocks have been created by:
 					return
 				}
 
+				r := owner.NewRequest(owner.OpUpdate, uuidOpt)
+				r.Hash = owner.ContentHash(root)
+				auth, err := signRequest(n, keyName, r)
+				if err != nil {
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+
 				for _, peer := range peers {
-					if err := updateRoot(req.Context(), n, peer, root, uuidOpt); err != nil {
+					if err := updateRoot(req.Context(), n, peer, root, uuidOpt, auth); err != nil {
 						fmt.Printf("=> error: %v\n", err)
+						publishReplica(events.ReplicaFailed, uuidOpt, root, peer.String(), err)
+						continue
 					}
+					publishReplica(events.ReplicaStored, uuidOpt, root, peer.String(), nil)
 				}
 			} else {
+				auth, err := signCreate(n, uuidOpt, keyName, splitKeyIDs(writers))
+				if err != nil {
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+
 				size, _ := root.Size()
-				peers, err = cu.GetPeersMultiaddrsBySize(int64(size), 8)
+				// request more candidates than needed, because some of them can be unreachable
+				cands, err := cu.GetCandidates(int64(size), 2*placement.Replicas, placement.ExcludePeers)
 				if err != nil {
 					log.Error(err)
 					return
 				}
+				if placement.PreferLowLatency {
+					cu.MeasureLatency(req.Context(), n, cands)
+				}
+				cands = cu.OrderCandidates(cands, placement.PreferLowLatency, placement.SpreadOrigins)
 
 				success := 0
-				uploaded := make(map[string]bool, 4)
-				for _, peer := range peers {
-					if uploaded[peer.String()] {
-						log.Debugf("peer %s has already received file", peer)
-						continue
-					}
-					if err := uploadRoot(req.Context(), n, peer, root); err != nil {
+				for _, cand := range cands {
+					if err := uploadRoot(req.Context(), n, cand.Addr, root, auth); err != nil {
 						outChan <- &coreunix.AddedObject{
-							Name: fmt.Sprintf("peer %s: error\n  %s", peer, err),
+							Name: fmt.Sprintf("peer %s: error\n  %s", cand.Addr, err),
 							Hash: finalObjectMarker,
 						}
+						publishReplica(events.ReplicaFailed, uuidOpt, root, cand.ID, err)
 						continue
 					}
-					uploaded[peer.String()] = true
+					publishReplica(events.ReplicaStored, uuidOpt, root, cand.ID, nil)
 					outChan <- &coreunix.AddedObject{
-						Name: fmt.Sprintf("peer %s: success!", peer),
+						Name: fmt.Sprintf("peer %s: success!", cand.Addr),
 						Hash: finalObjectMarker,
+						Replica: &coreunix.Replica{
+							Peer:   cand.ID,
+							Addr:   cand.Addr.String(),
+							Origin: cand.Origin,
+						},
 					}
-					if success++; success == 4 {
+					if success++; success == placement.Replicas {
 						break
 					}
 				}
-				if success < 4 {
-					res.SetError(fmt.Errorf("could not connect to %d providers", 4), cmds.ErrNormal)
+				if success < placement.MinReplicas {
+					res.SetError(fmt.Errorf("file is stored on %d providers, at least %d required", success, placement.MinReplicas), cmds.ErrNormal)
 					return
 				}
 			}
@@ -582,7 +634,65 @@ You can now check what blocks have been created by:
 	Type: coreunix.AddedObject{},
 }
 
-func uploadRoot(ctx context.Context, n *core.IpfsNode, peer ma.Multiaddr, root *dag.ProtoNode) error {
+type placementOpts struct {
+	config.Placement
+	Replicas    int
+	MinReplicas int
+}
+
+// getPlacementOpts merges placement options specified in request with config.
+func getPlacementOpts(req cmds.Request, cfg *config.Casper) (*placementOpts, error) {
+	opts := &placementOpts{Placement: cfg.Placement}
+
+	replicas, found, err := req.Option(replicasOptionName).Int()
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		if replicas = cfg.Replicas; replicas == 0 {
+			replicas = config.DefaultReplicas
+		}
+	}
+	minReplicas, found, err := req.Option(minReplicasOptionName).Int()
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		if minReplicas = cfg.MinReplicas; minReplicas == 0 || minReplicas > replicas {
+			minReplicas = replicas
+		}
+	}
+	if replicas <= 0 || minReplicas <= 0 || minReplicas > replicas {
+		return nil, fmt.Errorf("invalid number of replicas: %d (min %d)", replicas, minReplicas)
+	}
+	opts.Replicas, opts.MinReplicas = replicas, minReplicas
+
+	if spread, found, _ := req.Option(spreadOriginsOptionName).Bool(); found {
+		opts.SpreadOrigins = spread
+	}
+	if lowLatency, found, _ := req.Option(lowLatencyOptionName).Bool(); found {
+		opts.PreferLowLatency = lowLatency
+	}
+	opts.ExcludePeers = append([]string{}, cfg.Placement.ExcludePeers...)
+	if exclude, _, _ := req.Option(excludePeersOptionName).String(); exclude != "" {
+		for _, p := range strings.Split(exclude, ",") {
+			opts.ExcludePeers = append(opts.ExcludePeers, strings.TrimSpace(p))
+		}
+	}
+	return opts, nil
+}
+
+// publishReplica publishes result of storing root on the provider.
+func publishReplica(t events.Type, uuid string, root *dag.ProtoNode, peer string, err error) {
+	size, _ := root.Size()
+	e := events.Event{Type: t, UUID: uuid, Hash: root.Cid().String(), Peer: peer, Size: int64(size)}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	events.Publish(e)
+}
+
+func uploadRoot(ctx context.Context, n *core.IpfsNode, peer ma.Multiaddr, root *dag.ProtoNode, auth string) error {
 	tctx, cancel := context.WithTimeout(ctx, time.Second)
 	defer cancel()
 
@@ -591,9 +701,11 @@ func uploadRoot(ctx context.Context, n *core.IpfsNode, peer ma.Multiaddr, root *
 		return fmt.Errorf("failed to connect: %v", err)
 	}
 	size, _ := root.Size()
-	addr, _ := cu.MultiaddrToTCPAddr(peer)
-	thriftAddr := net.JoinHostPort(addr.IP.String(), "9090")
-	err = client.HandleClientUpload(ctx, thriftAddr, root.Cid().String(), int64(size), []string{})
+	thriftAddr, err := cu.GetThriftAddr(peer)
+	if err != nil {
+		return err
+	}
+	err = client.HandleClientUpload(ctx, thriftAddr, root.Cid().String(), int64(size), []string{}, auth)
 	if err != nil {
 		return fmt.Errorf("error while uploading to %s: %v", thriftAddr, err)
 	}
@@ -601,15 +713,17 @@ func uploadRoot(ctx context.Context, n *core.IpfsNode, peer ma.Multiaddr, root *
 	return nil
 }
 
-func updateRoot(ctx context.Context, n *core.IpfsNode, peer ma.Multiaddr, root *dag.ProtoNode, uuid string) error {
+func updateRoot(ctx context.Context, n *core.IpfsNode, peer ma.Multiaddr, root *dag.ProtoNode, uuid, auth string) error {
 	err := n.ConnectToPeer(ctx, peer.String())
 	if err != nil {
 		return fmt.Errorf("failed to connect: %v", err)
 	}
 	size, _ := root.Size()
-	addr, _ := cu.MultiaddrToTCPAddr(peer)
-	thriftAddr := net.JoinHostPort(addr.IP.String(), "9090")
-	err = client.HandleClientUpdate(ctx, thriftAddr, uuid, root.Cid().String(), int64(size))
+	thriftAddr, err := cu.GetThriftAddr(peer)
+	if err != nil {
+		return err
+	}
+	err = client.HandleClientUpdate(ctx, thriftAddr, uuid, root.Cid().String(), int64(size), auth)
 	if err != nil {
 		return fmt.Errorf("error while updating on %s: %v", peer, err)
 	}
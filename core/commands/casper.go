@@ -0,0 +1,170 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/casper/replication"
+	cmds "github.com/Casper-dev/Casper-server/commands"
+	"github.com/Casper-dev/Casper-server/core"
+
+	util "gx/ipfs/QmSU6eubNdhXjFBJBSksTp8kv8YRub8mGAPv8tVJHmL2EU/go-ipfs-util"
+)
+
+var CasperCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage Casper provider state.",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"channel":     channelCmd,
+		"owner":       ownerCmd,
+		"replication": replicationCmd,
+	},
+}
+
+var replicationCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage replication jobs.",
+		ShortDescription: `
+When provider is banned, its files are replicated to other providers.
+Every file is replicated by a separate job which is stored in the repo
+and retried with backoff until it succeeds or runs out of attempts.
+Job ID has form <file-id>/<banned-node-id>.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls":     replicationLsCmd,
+		"retry":  replicationRetryCmd,
+		"cancel": replicationCancelCmd,
+	},
+}
+
+type ReplicationJobList struct {
+	Jobs []*replication.Job
+}
+
+var replicationLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List replication jobs.",
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("state", "s", "Show only jobs in specified state (pending, running, done, failed, cancelled)."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		state, _, err := req.Option("state").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		jobs, err := replicationQueue(n).List()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		out := &ReplicationJobList{Jobs: []*replication.Job{}}
+		for _, job := range jobs {
+			if state == "" || string(job.State) == state {
+				out.Jobs = append(out.Jobs, job)
+			}
+		}
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*ReplicationJobList)
+			if !ok {
+				return nil, util.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			w := tabwriter.NewWriter(buf, 1, 2, 1, ' ', 0)
+			fmt.Fprintln(w, "ID\tSTATE\tATTEMPTS\tNEXT ATTEMPT\tERROR")
+			for _, job := range list.Jobs {
+				next := "-"
+				if job.State == replication.StatePending {
+					next = job.NextAttempt.Format(time.RFC3339)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", job.ID(), job.State, job.Attempts, next, job.LastError)
+			}
+			w.Flush()
+			return buf, nil
+		},
+	},
+	Type: ReplicationJobList{},
+}
+
+var replicationRetryCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Retry failed or cancelled replication job.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("job-id", true, false, "ID of the job."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		replicationJobRun(req, res, (*replication.Queue).Retry)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: replicationJobMarshaler,
+	},
+	Type: replication.Job{},
+}
+
+var replicationCancelCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Cancel replication job.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("job-id", true, false, "ID of the job."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		replicationJobRun(req, res, (*replication.Queue).Cancel)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: replicationJobMarshaler,
+	},
+	Type: replication.Job{},
+}
+
+func replicationJobRun(req cmds.Request, res cmds.Response, f func(*replication.Queue, string) (*replication.Job, error)) {
+	n, err := req.InvocContext().GetNode()
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+
+	job, err := f(replicationQueue(n), req.Arguments()[0])
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	res.SetOutput(job)
+}
+
+// replicationQueue returns queue run by daemon, so that its worker
+// is woken up by changes. Queue of its own is only used offline,
+// when there is no daemon to process jobs.
+func replicationQueue(n *core.IpfsNode) *replication.Queue {
+	if n.Replication != nil {
+		return n.Replication
+	}
+	return replication.NewQueue(n.Repo.Datastore(), nil)
+}
+
+func replicationJobMarshaler(res cmds.Response) (io.Reader, error) {
+	job, ok := res.Output().(*replication.Job)
+	if !ok {
+		return nil, util.ErrCast()
+	}
+	return bytes.NewBufferString(fmt.Sprintf("%s is %s\n", job.ID(), job.State)), nil
+}
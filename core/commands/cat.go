@@ -4,24 +4,22 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"net"
 
 	cu "github.com/Casper-dev/Casper-server/casper/casper_utils"
 	"github.com/Casper-dev/Casper-server/casper/crypto"
 	sc "github.com/Casper-dev/Casper-server/casper/sc"
+	scin "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
 	"github.com/Casper-dev/Casper-server/client"
 	cmds "github.com/Casper-dev/Casper-server/commands"
 	"github.com/Casper-dev/Casper-server/core"
 	"github.com/Casper-dev/Casper-server/core/coreunix"
 
+	ci "gx/ipfs/QmaPbCnUMBohSGo3KnxEa2bHqyJVVeEEcwtqJAYxerieBo/go-libp2p-crypto"
 	"gx/ipfs/QmeWjRodbcZFKe5tMN7poEx3izym6osrLSnTLf9UjJZBbs/pb"
 )
 
 const progressBarMinSize = 1024 * 1024 * 8 // show progress bar for outputs > 8MiB
 
-// defined in commands/add
-//const passwordOptionName = "password"
-
 var CatCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline:          "Show IPFS object data.",
@@ -32,7 +30,8 @@ var CatCmd = &cmds.Command{
 		cmds.StringArg("ipfs-path", true, false, "The path to the IPFS object(s) to be outputted.").EnableStdin(),
 	},
 	Options: []cmds.Option{
-		cmds.StringOption(passwordOptionName, "Password decryption key"),
+		cmds.StringOption(passwordOptionName, "Decrypt data using password."),
+		cmds.StringOption(encKeyOptionName, "Decrypt data using key derived from keystore key."),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		node, err := req.InvocContext().GetNode()
@@ -41,6 +40,7 @@ var CatCmd = &cmds.Command{
 			return
 		}
 
+		var meter *downloadMeter
 		caller, _, _ := req.Option(cmds.CallerOpt).String()
 		if caller == cmds.CallerOptClient {
 			hash := req.Arguments()[0]
@@ -51,18 +51,27 @@ var CatCmd = &cmds.Command{
 			}
 
 			c, _ := sc.GetContract()
-			wallet := c.GetWallet()
+			// providers accept wallet only with the proof that it is ours
+			proof, err := scin.SignWalletProof(c, node.Identity.Pretty())
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
 			for _, peer := range peers {
 				err := node.ConnectToPeer(req.Context(), peer.String())
 				if err != nil {
 					log.Error("Failed to connect: %s", err)
 					continue
 				}
-				addr, _ := cu.MultiaddrToTCPAddr(peer)
-				thriftAddr := net.JoinHostPort(addr.IP.String(), "9090")
+				thriftAddr, err := cu.GetThriftAddr(peer)
+				if err != nil {
+					log.Error(err)
+					continue
+				}
 
-				err = client.HandleClientDownload(req.Context(), thriftAddr, hash, wallet)
+				err = client.HandleClientDownload(req.Context(), thriftAddr, hash, proof)
 				if err == nil {
+					meter = newDownloadMeter(node, peer, hash, proof)
 					break
 				}
 				log.Errorf("error while downloading: %v", err)
@@ -92,6 +101,9 @@ var CatCmd = &cmds.Command{
 
 		res.SetLength(length)
 		reader := io.MultiReader(readers...)
+		if meter != nil {
+			reader = meter.Reader(req.Context(), reader)
+		}
 
 		res.SetOutput(reader)
 	},
@@ -100,8 +112,16 @@ var CatCmd = &cmds.Command{
 			return
 		}
 		reader := res.Output().(io.Reader)
-		if password, pwdset, _ := req.Option(passwordOptionName).String(); pwdset {
-			reader = crypto.NewAESReader(reader, []byte(password))
+		key, err := decryptionKey(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		if key != nil {
+			if reader, err = crypto.NewDecryptReader(reader, key); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
 		}
 
 		var bar *pb.ProgressBar
@@ -127,3 +147,18 @@ func cat(ctx context.Context, node *core.IpfsNode, paths []string) ([]io.Reader,
 	}
 	return readers, length, nil
 }
+
+// decryptionKey returns key specified by password or enc-key options, nil if
+// none is set. Files are decrypted by the client, so keystore keys are read
+// from the local repository.
+func decryptionKey(req cmds.Request) (*crypto.Key, error) {
+	password, _, _ := req.Option(passwordOptionName).String()
+	keyName, _, _ := req.Option(encKeyOptionName).String()
+	key, err := crypto.KeyFromOptions(password, keyName, func(name string) (ci.PrivKey, error) {
+		return crypto.LoadRepoKey(req.InvocContext().ConfigRoot, name)
+	})
+	if err == crypto.ErrNoKey {
+		return nil, nil
+	}
+	return key, err
+}
@@ -2,14 +2,19 @@ package commands
 
 import (
 	"fmt"
-	"net"
 
 	util "github.com/Casper-dev/Casper-server/blocks/blockstore/util"
 	cu "github.com/Casper-dev/Casper-server/casper/casper_utils"
+	"github.com/Casper-dev/Casper-server/casper/events"
+	"github.com/Casper-dev/Casper-server/casper/owner"
 	sc "github.com/Casper-dev/Casper-server/casper/sc"
+	"github.com/Casper-dev/Casper-server/casper/uuid"
+	"github.com/Casper-dev/Casper-server/casper/versions"
 	"github.com/Casper-dev/Casper-server/client"
 	cmds "github.com/Casper-dev/Casper-server/commands"
 	"github.com/Casper-dev/Casper-server/core/corerepo"
+
+	"gx/ipfs/QmT8rehPR3F6bmwL6zjUN8XpiDBFFpMP2myPdC6ApsWfJf/go-base58"
 )
 
 var DelCmd = &cmds.Command{
@@ -20,6 +25,10 @@ var DelCmd = &cmds.Command{
 	Arguments: []cmds.Argument{
 		cmds.StringArg("ipfs-path", true, false, "The path to the IPFS object to be removed.").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		cmds.StringOption(keyOptionName, "k", "Name of the key to sign request with."),
+		cmds.StringOption(authOptionName, "Signed delete request (used by REST API)."),
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.InvocContext().GetNode()
 		if err != nil {
@@ -29,6 +38,13 @@ var DelCmd = &cmds.Command{
 
 		caller, _, _ := req.Option(cmds.CallerOpt).String()
 		if caller == cmds.CallerOptWeb {
+			auth, _, _ := req.Option(authOptionName).String()
+			r, _, err := owner.Check(n, req.Arguments()[0], auth, owner.OpDelete)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+
 			removed, err := corerepo.Unpin(n, req.Context(), req.Arguments(), true)
 			if err != nil {
 				res.SetError(err, cmds.ErrNormal)
@@ -46,10 +62,35 @@ var DelCmd = &cmds.Command{
 			// wait for delete to finish
 			for _ = range ch {
 			}
+			id, _, ok := owner.Lookup(req.Arguments()[0])
+			if ok {
+				if err := versions.Drop(n, id); err != nil {
+					log.Error(err)
+				}
+			}
+			events.Publish(events.Event{Type: events.FileDeleted, UUID: id, Hash: req.Arguments()[0]})
+			if r != nil {
+				n.RemoveUUID(r.UUID)
+			}
 			return
 		}
 
-		hash := req.Arguments()[0]
+		hash, id := req.Arguments()[0], ""
+		if len(base58.Decode(hash)) == uuid.UUIDLen {
+			id, hash = hash, owner.FileID(hash)
+		} else {
+			id, _, _ = owner.Lookup(hash)
+		}
+
+		var auth string
+		if info, err := n.GetUUID(id); err == nil && owner.IsOwned(info) {
+			keyName, _, _ := req.Option(keyOptionName).String()
+			if auth, err = signRequest(n, keyName, owner.NewRequest(owner.OpDelete, id)); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+
 		c, _ := sc.GetContract()
 		c.NotifyDelete(cu.GetLocalAddr().NodeHash(), hash, 1337)
 
@@ -65,14 +106,20 @@ var DelCmd = &cmds.Command{
 				log.Error("Failed to connect: %s", err)
 				continue
 			}
-			addr, _ := cu.MultiaddrToTCPAddr(peer)
-			thriftAddr := net.JoinHostPort(addr.IP.String(), "9090")
-			err = client.HandleClientDelete(req.Context(), thriftAddr, hash)
+			thriftAddr, err := cu.GetThriftAddr(peer)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			err = client.HandleClientDelete(req.Context(), thriftAddr, hash, auth)
 			if err != nil {
 				log.Errorf("Error while deleting file from peer '%s'", peer)
 			}
 		}
 
+		if id != "" {
+			n.RemoveUUID(id)
+		}
 		fmt.Println("Success!")
 	},
 }
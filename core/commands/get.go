@@ -5,12 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net"
 	"os"
 	"strings"
 
 	cu "github.com/Casper-dev/Casper-server/casper/casper_utils"
+	"github.com/Casper-dev/Casper-server/casper/crypto"
 	sc "github.com/Casper-dev/Casper-server/casper/sc"
+	scin "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
 	"github.com/Casper-dev/Casper-server/client"
 	cmds "github.com/Casper-dev/Casper-server/commands"
 	"github.com/Casper-dev/Casper-server/core"
@@ -50,6 +51,7 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 		cmds.BoolOption("compress", "C", "Compress the output with GZIP compression.").Default(false),
 		cmds.IntOption("compression-level", "l", "The level of compression (1-9).").Default(-1),
 		cmds.StringOption(passwordOptionName, "Decrypt file(s) using password."),
+		cmds.StringOption(encKeyOptionName, "Decrypt file(s) using key derived from keystore key."),
 	},
 	PreRun: func(req cmds.Request) error {
 		_, err := getCompressOptions(req)
@@ -73,13 +75,14 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 			return
 		}
 
+		var meter *downloadMeter
 		caller, _, _ := req.Option(cmds.CallerOpt).String()
 		if caller == cmds.CallerOptClient {
 			firstHash := req.Arguments()[0]
 			fmt.Println(firstHash)
 
 			cfg, _ := fsrepo.ConfigAt(req.InvocContext().ConfigRoot)
-			c, err := sc.GetContract(cfg.Casper.Blockchain[cfg.Casper.UsedChain])
+			c, err := sc.GetContractByName(req.Context(), cfg.Casper.UsedChain, cfg.Casper.Blockchain[cfg.Casper.UsedChain])
 			if err != nil {
 				log.Error(err)
 				return
@@ -91,18 +94,27 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 				return
 			}
 
-			wallet := c.GetWallet()
+			// providers accept wallet only with the proof that it is ours
+			proof, err := scin.SignWalletProof(c, node.Identity.Pretty())
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
 			for _, peer := range peers {
 				err := node.ConnectToPeer(req.Context(), peer.String())
 				if err != nil {
 					log.Error("Failed to connect: %s", err)
 					continue
 				}
-				addr, _ := cu.MultiaddrToTCPAddr(peer)
-				thriftAddr := net.JoinHostPort(addr.IP.String(), "9090")
+				thriftAddr, err := cu.GetThriftAddr(peer)
+				if err != nil {
+					log.Error(err)
+					continue
+				}
 
-				err = client.HandleClientDownload(req.Context(), thriftAddr, firstHash, wallet)
+				err = client.HandleClientDownload(req.Context(), thriftAddr, firstHash, proof)
 				if err == nil {
+					meter = newDownloadMeter(node, peer, firstHash, proof)
 					break
 				}
 			}
@@ -140,6 +152,9 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
+		if meter != nil {
+			reader = meter.Reader(ctx, reader)
+		}
 		res.SetOutput(reader)
 	},
 	PostRun: func(req cmds.Request, res cmds.Response) {
@@ -166,9 +181,10 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 		}
 
 		archive, _, _ := req.Option("archive").Bool()
-		var password []byte
-		if pwd, pf, _ := req.Option(passwordOptionName).String(); pf {
-			password = []byte(pwd)
+		key, err := decryptionKey(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
 		}
 
 		gw := getWriter{
@@ -176,7 +192,7 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 			Err:         os.Stderr,
 			Archive:     archive,
 			Compression: cmplvl,
-			Password:    password,
+			Key:         key,
 			Size:        int64(res.Length()),
 		}
 
@@ -229,7 +245,7 @@ type getWriter struct {
 
 	Archive     bool
 	Compression int
-	Password    []byte
+	Key         *crypto.Key
 	Size        int64
 }
 
@@ -279,7 +295,7 @@ func (gw *getWriter) writeExtracted(r io.Reader, fpath string) error {
 	defer bar.Set64(gw.Size)
 
 	extractor := &tar.Extractor{
-		Password: gw.Password,
+		Key:      gw.Key,
 		Path:     fpath,
 		Progress: bar.Add64,
 	}
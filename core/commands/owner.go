@@ -0,0 +1,267 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	cu "github.com/Casper-dev/Casper-server/casper/casper_utils"
+	"github.com/Casper-dev/Casper-server/casper/owner"
+	"github.com/Casper-dev/Casper-server/client"
+	cmds "github.com/Casper-dev/Casper-server/commands"
+	"github.com/Casper-dev/Casper-server/core"
+
+	util "gx/ipfs/QmSU6eubNdhXjFBJBSksTp8kv8YRub8mGAPv8tVJHmL2EU/go-ipfs-util"
+)
+
+const (
+	keyOptionName     = "key"
+	writersOptionName = "writers"
+	authOptionName    = "auth"
+)
+
+var ownerCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage ownership of UUID files.",
+		ShortDescription: `
+Every UUID file is bound to an owner key when it is created. Owner can
+allow other keys (writers) to update and delete the file and can transfer
+ownership to another key. Keys are referred to by IDs printed by
+'key list -l'. Requests are signed with the key which was used to create
+the file, unless --key is specified.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"show":     ownerShowCmd,
+		"transfer": ownerTransferCmd,
+		"writers":  ownerWritersCmd,
+	},
+}
+
+type OwnershipOutput struct {
+	UUID    string
+	Owner   string
+	Writers []string
+}
+
+var ownerShowCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show owner and writers of the file.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("uuid", true, false, "Base58 encoded UUID."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		uuid := req.Arguments()[0]
+		info, err := n.GetUUID(uuid)
+		if err != nil {
+			res.SetError(fmt.Errorf("unknown UUID %s: %v", uuid, err), cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&OwnershipOutput{UUID: uuid, Owner: info.PubKey, Writers: info.Writers})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: ownershipMarshaler,
+	},
+	Type: OwnershipOutput{},
+}
+
+var ownerTransferCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Transfer ownership of the file to another key.",
+		ShortDescription: `
+New owner can't be changed back by the previous one. Writers are kept
+unless --writers is specified.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("uuid", true, false, "Base58 encoded UUID."),
+		cmds.StringArg("owner", true, false, "ID of the new owner key."),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(keyOptionName, "k", "Name of the key to sign request with."),
+		cmds.StringOption(writersOptionName, "Comma-separated list of writer key IDs."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		writers, found, _ := req.Option(writersOptionName).String()
+		ownershipRun(req, res, req.Arguments()[1], splitKeyIDs(writers), found)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: ownershipMarshaler,
+	},
+	Type: OwnershipOutput{},
+}
+
+var ownerWritersCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Set keys which can update and delete the file.",
+		ShortDescription: `
+Writers replace the previous list. Call without key IDs to remove all writers.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("uuid", true, false, "Base58 encoded UUID."),
+		cmds.StringArg("writers", false, true, "IDs of writer keys."),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(keyOptionName, "k", "Name of the key to sign request with."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		ownershipRun(req, res, "", req.Arguments()[1:], true)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: ownershipMarshaler,
+	},
+	Type: OwnershipOutput{},
+}
+
+// ownershipRun sends transfer request to all providers of the file.
+// Empty newOwner keeps current owner, writers are kept if setWriters is false.
+func ownershipRun(req cmds.Request, res cmds.Response, newOwner string, writers []string, setWriters bool) {
+	n, err := req.InvocContext().GetNode()
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+
+	uuid := req.Arguments()[0]
+	info, err := n.GetUUID(uuid)
+	if err != nil {
+		res.SetError(fmt.Errorf("unknown UUID %s: %v", uuid, err), cmds.ErrNormal)
+		return
+	}
+
+	r := owner.NewRequest(owner.OpTransfer, uuid)
+	r.Owner, r.Writers = info.PubKey, info.Writers
+	if newOwner != "" {
+		r.Owner = newOwner
+	}
+	if setWriters {
+		r.Writers = writers
+	}
+
+	keyName, _, _ := req.Option(keyOptionName).String()
+	auth, err := signRequest(n, keyName, r)
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	// local info keeps the proof, which is sent to new replicas
+	next, err := owner.Authorize(info, r)
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	if err = sendOwnership(req.Context(), n, uuid, auth); err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+
+	if err = owner.Store(n, uuid, next); err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	res.SetOutput(&OwnershipOutput{UUID: uuid, Owner: next.PubKey, Writers: next.Writers})
+}
+
+func sendOwnership(ctx context.Context, n *core.IpfsNode, uuid, auth string) error {
+	peers, err := cu.GetPeersMultiaddrsByHash(owner.FileID(uuid))
+	if err != nil && len(peers) == 0 {
+		return err
+	}
+
+	success := 0
+	for _, peer := range peers {
+		if err := n.ConnectToPeer(ctx, peer.String()); err != nil {
+			log.Errorf("failed to connect to %s: %v", peer, err)
+			continue
+		}
+		thriftAddr, err := cu.GetThriftAddr(peer)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if err = client.HandleClientUpdate(ctx, thriftAddr, uuid, "", 0, auth); err != nil {
+			log.Errorf("error while changing ownership on %s: %v", peer, err)
+			continue
+		}
+		success++
+	}
+	if success == 0 {
+		return fmt.Errorf("ownership was not changed on any provider")
+	}
+	return nil
+}
+
+func ownershipMarshaler(res cmds.Response) (io.Reader, error) {
+	out, ok := res.Output().(*OwnershipOutput)
+	if !ok {
+		return nil, util.ErrCast()
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "UUID: %s\nOwner: %s\n", out.UUID, out.Owner)
+	if len(out.Writers) != 0 {
+		fmt.Fprintf(buf, "Writers: %s\n", strings.Join(out.Writers, ", "))
+	}
+	return buf, nil
+}
+
+// signCreate binds new file to the key with specified name and returns
+// request which makes providers remember its owner.
+func signCreate(n *core.IpfsNode, uuid, keyName string, writers []string) (string, error) {
+	if keyName == "" {
+		keyName = "self"
+	}
+	sk, err := n.GetKey(keyName)
+	if err != nil {
+		return "", err
+	}
+	id, err := owner.KeyID(sk.GetPublic())
+	if err != nil {
+		return "", err
+	}
+
+	r := owner.NewRequest(owner.OpCreate, uuid)
+	r.Owner, r.Writers = id, writers
+	if err = r.Sign(sk); err != nil {
+		return "", err
+	}
+	auth, err := r.Encode()
+	if err != nil {
+		return "", err
+	}
+
+	next, err := owner.Authorize(nil, r)
+	if err != nil {
+		return "", err
+	}
+	return auth, n.UpdateUUID(uuid, func(info *core.UUIDInfo) error {
+		owner.Apply(info, next)
+		info.KeyName = keyName
+		return nil
+	})
+}
+
+// signRequest signs r with the key which was used to create the file
+// unless keyName is specified.
+func signRequest(n *core.IpfsNode, keyName string, r *owner.Request) (string, error) {
+	return owner.SignWith(n, owner.KeyName(n, r.UUID, keyName), r)
+}
+
+func splitKeyIDs(s string) (ids []string) {
+	for _, id := range strings.Split(s, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,263 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/casper/paychan"
+	cmds "github.com/Casper-dev/Casper-server/commands"
+
+	util "gx/ipfs/QmSU6eubNdhXjFBJBSksTp8kv8YRub8mGAPv8tVJHmL2EU/go-ipfs-util"
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
+)
+
+var channelCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage payment channels.",
+		ShortDescription: `
+Payment channel locks tokens of the client for a provider in SC once, then
+client pays for downloads with vouchers sent directly to the provider.
+Provider settles the latest voucher with SC when it wants to and closes
+the channel before it expires. After expiry client can take back tokens
+which were not claimed. Tokens paid with vouchers let the client download
+from the provider like prepaid wallet does.
+
+Payment channels need support of the contract. Contracts deployed to ETH
+and NEO do not support them yet, so they are available only with Mock
+chain for now.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"open":    channelOpenCmd,
+		"pay":     channelPayCmd,
+		"ls":      channelLsCmd,
+		"settle":  channelSettleCmd,
+		"close":   channelCloseCmd,
+		"reclaim": channelReclaimCmd,
+	},
+}
+
+type ChannelList struct {
+	Channels []*paychan.Channel
+}
+
+var channelOpenCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Open payment channel to provider.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer-id", true, false, "ID of the provider."),
+		cmds.StringArg("amount", true, false, "Number of tokens to lock."),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("ttl", "t", "How long the channel is open.").Default("24h"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		m, err := channelManager(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		provider, err := peer.IDB58Decode(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		amount, err := strconv.ParseInt(req.Arguments()[1], 10, 64)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		s, _, _ := req.Option("ttl").String()
+		ttl, err := time.ParseDuration(s)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		ch, err := m.Open(provider, amount, ttl)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(ch)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: channelMarshaler,
+	},
+	Type: paychan.Channel{},
+}
+
+var channelPayCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Send voucher to the provider of payment channel.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("channel-id", true, false, "ID of the channel."),
+		cmds.StringArg("amount", true, false, "Number of tokens to pay."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		m, err := channelManager(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		amount, err := strconv.ParseInt(req.Arguments()[1], 10, 64)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		ch, err := m.Pay(req.Context(), req.Arguments()[0], amount)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(ch)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: channelMarshaler,
+	},
+	Type: paychan.Channel{},
+}
+
+var channelLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List payment channels.",
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		m, err := channelManager(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		channels, err := m.List()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if channels == nil {
+			channels = []*paychan.Channel{}
+		}
+		res.SetOutput(&ChannelList{Channels: channels})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*ChannelList)
+			if !ok {
+				return nil, util.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			w := tabwriter.NewWriter(buf, 1, 2, 1, ' ', 0)
+			fmt.Fprintln(w, "ID\tROLE\tPEER\tCAPACITY\tPAID\tSETTLED\tEXPIRES\tSTATE")
+			for _, ch := range list.Channels {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\n", ch.ID, ch.Role, ch.Peer,
+					ch.Capacity, ch.Paid, ch.Settled, ch.Expires.Format(time.RFC3339), channelState(ch))
+			}
+			w.Flush()
+			return buf, nil
+		},
+	},
+	Type: ChannelList{},
+}
+
+var channelSettleCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Claim the latest voucher of payment channel in SC.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("channel-id", true, false, "ID of the channel."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		channelRun(req, res, (*paychan.Manager).Settle)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: channelMarshaler,
+	},
+	Type: paychan.Channel{},
+}
+
+var channelCloseCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Claim the latest voucher and close payment channel.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("channel-id", true, false, "ID of the channel."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		channelRun(req, res, (*paychan.Manager).Close)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: channelMarshaler,
+	},
+	Type: paychan.Channel{},
+}
+
+var channelReclaimCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Take back tokens which were not claimed from expired payment channel.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("channel-id", true, false, "ID of the channel."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		channelRun(req, res, (*paychan.Manager).Reclaim)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: channelMarshaler,
+	},
+	Type: paychan.Channel{},
+}
+
+// channelManager returns manager run by daemon, so that changes of
+// channels are serialized with vouchers it receives. Manager of its own
+// is only used offline, when there is no daemon.
+func channelManager(req cmds.Request) (*paychan.Manager, error) {
+	n, err := req.InvocContext().GetNode()
+	if err != nil {
+		return nil, err
+	}
+	if n.Channels != nil {
+		return n.Channels, nil
+	}
+	if n.PrivateKey == nil {
+		if err = n.LoadPrivateKey(); err != nil {
+			return nil, err
+		}
+	}
+	return paychan.NewManager(n.Repo.Datastore(), n.PeerHost, n.PrivateKey)
+}
+
+func channelRun(req cmds.Request, res cmds.Response, f func(*paychan.Manager, string) (*paychan.Channel, error)) {
+	m, err := channelManager(req)
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	ch, err := f(m, req.Arguments()[0])
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	res.SetOutput(ch)
+}
+
+func channelState(ch *paychan.Channel) string {
+	if ch.Closed {
+		return "closed"
+	}
+	return "open"
+}
+
+func channelMarshaler(res cmds.Response) (io.Reader, error) {
+	ch, ok := res.Output().(*paychan.Channel)
+	if !ok {
+		return nil, util.ErrCast()
+	}
+	return bytes.NewBufferString(fmt.Sprintf("%s is %s, %d of %d tokens paid\n", ch.ID, channelState(ch), ch.Paid, ch.Capacity)), nil
+}
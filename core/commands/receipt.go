@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"context"
+	"io"
+
+	"github.com/Casper-dev/Casper-server/casper/billing"
+	uid "github.com/Casper-dev/Casper-server/casper/uuid"
+	"github.com/Casper-dev/Casper-server/core"
+	"github.com/Casper-dev/Casper-server/exchange/bitswap"
+
+	ma "gx/ipfs/QmXY77cVe7rVRQXZZQRioukUM7aRW3BTcAgJe12MCtb3Ji/go-multiaddr"
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
+	"gx/ipfs/QmeS8cCKawUwejVrsBtmC1toTXmwVWZGiRJqzgTURVWeF9/go-ipfs-addr"
+)
+
+// downloadMeter counts bytes received from the provider of a file
+// since the download was started, so that they can be acknowledged
+// with a signed receipt when the download is complete.
+type downloadMeter struct {
+	node     *core.IpfsNode
+	bs       *bitswap.Bitswap
+	provider peer.ID
+	// proof is the wallet with the proof of its ownership
+	proof    string
+	root     string
+	baseline uint64
+}
+
+// newDownloadMeter starts metering download of the file with specified
+// hash from provider. It returns nil if traffic can't be metered.
+func newDownloadMeter(node *core.IpfsNode, provider ma.Multiaddr, hash, proof string) *downloadMeter {
+	bs, ok := node.Exchange.(*bitswap.Bitswap)
+	if !ok {
+		return nil
+	}
+	addr, err := ipfsaddr.ParseMultiaddr(provider)
+	if err != nil {
+		log.Errorf("can't meter download from %s: %v", provider, err)
+		return nil
+	}
+	root, err := uid.FileCid(hash)
+	if err != nil {
+		log.Errorf("can't meter download of %s: %v", hash, err)
+		return nil
+	}
+
+	return &downloadMeter{
+		node:     node,
+		bs:       bs,
+		provider: addr.ID(),
+		proof:    proof,
+		root:     root.String(),
+		baseline: bs.LedgerForPeer(addr.ID()).Recv,
+	}
+}
+
+// Reader returns r which sends receipt to the provider after it is
+// read to the end. Receipt covers all bytes received from the provider
+// meanwhile, as bitswap does not tell which file they belong to.
+func (m *downloadMeter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	return &receiptReader{Reader: r, ctx: ctx, meter: m}
+}
+
+func (m *downloadMeter) sendReceipt(ctx context.Context) error {
+	recv := m.bs.LedgerForPeer(m.provider).Recv
+	// ledger is reset if provider has disconnected
+	if recv <= m.baseline {
+		return nil
+	}
+
+	r, err := billing.NewReceipt(m.provider, m.node.Identity, m.proof, m.root, recv-m.baseline)
+	if err != nil {
+		return err
+	}
+	if err = r.Sign(m.node.PrivateKey); err != nil {
+		return err
+	}
+	if err = billing.Send(ctx, m.node.PeerHost, m.provider, r); err != nil {
+		return err
+	}
+	m.baseline = recv
+	return nil
+}
+
+type receiptReader struct {
+	io.Reader
+	ctx   context.Context
+	meter *downloadMeter
+	sent  bool
+}
+
+func (r *receiptReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF && !r.sent {
+		r.sent = true
+		if err := r.meter.sendReceipt(r.ctx); err != nil {
+			log.Errorf("can't send download receipt to %s: %v", r.meter.provider.Pretty(), err)
+		}
+	}
+	return n, err
+}
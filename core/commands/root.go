@@ -33,6 +33,7 @@ BASIC COMMANDS
   ls <ref>      List links from an object
   refs <ref>    List hashes of links from an object
   upd           Update reference to object by UUID
+  uuid          List UUID files and their metadata
 
 DATA STRUCTURE COMMANDS
   block         Interact with raw blocks in the datastore
@@ -130,10 +131,14 @@ var rootSubcommands = map[string]*cmds.Command{
 	"file":      unixfs.UnixFSCmd,
 	"update":    ExternalBinary(),
 	"upd":       UpdCmd,
+	"uuid":      UUIDCmd,
 	"version":   VersionCmd,
+	"versions":  VersionsCmd,
+	"wallet":    WalletCmd,
 	"bitswap":   BitswapCmd,
 	"filestore": FileStoreCmd,
 	"validate":  ValidateCmd,
+	"casper":    CasperCmd,
 	"shutdown":  daemonShutdownCmd,
 }
 
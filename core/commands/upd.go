@@ -6,9 +6,13 @@ import (
 	"gx/ipfs/QmT8rehPR3F6bmwL6zjUN8XpiDBFFpMP2myPdC6ApsWfJf/go-base58"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/Casper-dev/Casper-server/blocks/blockstore"
 	"github.com/Casper-dev/Casper-server/blockservice"
+	"github.com/Casper-dev/Casper-server/casper/catalog"
+	"github.com/Casper-dev/Casper-server/casper/owner"
+	"github.com/Casper-dev/Casper-server/casper/versions"
 	cmds "github.com/Casper-dev/Casper-server/commands"
 	"github.com/Casper-dev/Casper-server/exchange/offline"
 	dag "github.com/Casper-dev/Casper-server/merkledag"
@@ -16,6 +20,13 @@ import (
 	pin "github.com/Casper-dev/Casper-server/pin"
 )
 
+const (
+	keepHistoryOptionName = "keep-history"
+	keepOptionName        = "keep"
+	maxAgeOptionName      = "max-age"
+	contentHashOptionName = "content-hash"
+)
+
 var UpdCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Updates file corresponding to specified UUID.",
@@ -25,6 +36,13 @@ Recursively downloads blocks and pins them to local storage.
 		LongDescription: `
 Makes DAG node with UUID <uuid> contain <ipfs-path>.
 <ipfs-path> is recursively downloaded and pinned to local storage.
+
+With --keep-history previous content of this and all following updates
+is kept as a version, see 'versions'. --keep and --max-age override
+retention policy from Casper.Versions config for the file.
+
+With --content-hash the update fails unless <ipfs-path> has this content
+(see 'owner'), so that provider stores exactly what the signed request allows.
 `,
 	},
 
@@ -32,6 +50,12 @@ Makes DAG node with UUID <uuid> contain <ipfs-path>.
 		cmds.StringArg("uuid", true, false, "Base58 encoded UUID."),
 		cmds.StringArg("ipfs-path", true, false, "The path to the IPFS object."),
 	},
+	Options: []cmds.Option{
+		cmds.BoolOption(keepHistoryOptionName, "Keep previous versions of the file.").Default(false),
+		cmds.IntOption(keepOptionName, "Number of versions to keep. Config value is used by default."),
+		cmds.StringOption(maxAgeOptionName, "How long versions are kept, like '720h'. Config value is used by default."),
+		cmds.StringOption(contentHashOptionName, "Expected CID of the new content without UUID."),
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.InvocContext().GetNode()
 		if err != nil {
@@ -50,7 +74,31 @@ Makes DAG node with UUID <uuid> contain <ipfs-path>.
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
-		pn := obj.(*dag.ProtoNode)
+		pn, ok := obj.(*dag.ProtoNode)
+		if !ok {
+			res.SetError(dag.ErrNotProtobuf, cmds.ErrNormal)
+			return
+		}
+		uuid := req.Arguments()[0]
+		if h, found, _ := req.Option(contentHashOptionName).String(); found && h != owner.ContentHash(pn) {
+			res.SetError(owner.ErrWrongFile, cmds.ErrClient)
+			return
+		}
+
+		if keep, _, _ := req.Option(keepHistoryOptionName).Bool(); keep {
+			var p versions.Policy
+			p.Keep, _, _ = req.Option(keepOptionName).Int()
+			if maxAge, found, _ := req.Option(maxAgeOptionName).String(); found {
+				if p.MaxAge, err = time.ParseDuration(maxAge); err != nil {
+					res.SetError(err, cmds.ErrClient)
+					return
+				}
+			}
+			if err = versions.NewStore(n.Repo.Datastore()).Enable(uuid, p); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
 
 		addblockstore := blockstore.NewGCBlockstore(n.BaseBlocks, n.GCLocker)
 		exch := offline.Exchange(addblockstore)
@@ -59,12 +107,20 @@ Makes DAG node with UUID <uuid> contain <ipfs-path>.
 
 		defer n.Blockstore.PinLock().Unlock()
 
+		if err = versions.Snapshot(req.Context(), n, uuid); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
 		// TODO: make an option to disable this behaviour
 		oldCid := pn.Cid()
-		log.Debugf("Remove pin on CID: %s", oldCid.String())
-		n.Pinning.RemovePinWithMode(oldCid, pin.Recursive)
+		// version which is restored must stay in history
+		if l, err := versions.NewStore(n.Repo.Datastore()).Get(uuid); err != nil || !l.Has(oldCid.String()) {
+			log.Debugf("Remove pin on CID: %s", oldCid.String())
+			n.Pinning.RemovePinWithMode(oldCid, pin.Recursive)
+		}
 
-		pn.SetUUID(base58.Decode(req.Arguments()[0]))
+		pn.SetUUID(base58.Decode(uuid))
 
 		rnk, err := dserv.Add(pn)
 		if err != nil {
@@ -79,6 +135,9 @@ Makes DAG node with UUID <uuid> contain <ipfs-path>.
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
+		if err = catalog.Touch(req.Context(), n, uuid, pn); err != nil {
+			log.Error(err)
+		}
 
 		res.SetOutput(pn)
 	},
@@ -0,0 +1,181 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/casper/catalog"
+	cmds "github.com/Casper-dev/Casper-server/commands"
+
+	util "gx/ipfs/QmSU6eubNdhXjFBJBSksTp8kv8YRub8mGAPv8tVJHmL2EU/go-ipfs-util"
+)
+
+const (
+	tagOptionName    = "tag"
+	prefixOptionName = "prefix"
+	afterOptionName  = "after"
+	limitOptionName  = "limit"
+	removeOptionName = "remove"
+)
+
+var UUIDCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List UUID files stored on this node and their metadata.",
+		ShortDescription: `
+Name, MIME type, size and CID of current contents of a UUID file are
+recorded every time the file is added or updated on this node. Files
+can be labelled with tags and listed by tag or name prefix.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls":   uuidLsCmd,
+		"info": uuidInfoCmd,
+		"tag":  uuidTagCmd,
+	},
+}
+
+var uuidLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List UUID files.",
+		ShortDescription: `
+Files are ordered by UUID. If there are more files than --limit, the next
+page is requested with --after set to the last printed UUID.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(tagOptionName, "t", "Show only files with specified tag."),
+		cmds.StringOption(prefixOptionName, "p", "Show only files whose name starts with prefix."),
+		cmds.StringOption(afterOptionName, "Show files with UUIDs after specified one."),
+		cmds.IntOption(limitOptionName, "n", "Max number of files to show.").Default(catalog.DefaultLimit),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		var q catalog.Filter
+		q.Tag, _, _ = req.Option(tagOptionName).String()
+		q.Prefix, _, _ = req.Option(prefixOptionName).String()
+		after, _, _ := req.Option(afterOptionName).String()
+		limit, _, _ := req.Option(limitOptionName).Int()
+
+		res.SetOutput(catalog.List(q, after, limit))
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			p, ok := res.Output().(*catalog.Page)
+			if !ok {
+				return nil, util.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			w := tabwriter.NewWriter(buf, 1, 2, 1, ' ', 0)
+			fmt.Fprintln(w, "UUID\tSIZE\tUPDATED\tNAME\tTAGS")
+			for _, f := range p.Files {
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", f.UUID, f.Size, formatTime(f.Updated), f.Name, strings.Join(f.Tags, ","))
+			}
+			w.Flush()
+			if p.Next != "" {
+				fmt.Fprintf(buf, "more files after %s\n", p.Next)
+			}
+			return buf, nil
+		},
+	},
+	Type: catalog.Page{},
+}
+
+var uuidInfoCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show metadata of the file.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("uuid", true, false, "Base58 encoded UUID."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		f, err := catalog.Info(n, req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(f)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: uuidFileMarshaler,
+	},
+	Type: catalog.File{},
+}
+
+var uuidTagCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Add tags to the file or remove them.",
+		ShortDescription: `
+Tags are only stored on this node. Tags must not contain commas.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("uuid", true, false, "Base58 encoded UUID."),
+		cmds.StringArg("tags", true, true, "Tags to add or remove."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(removeOptionName, "r", "Remove tags instead of adding them.").Default(false),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		var add, remove []string
+		if rm, _, _ := req.Option(removeOptionName).Bool(); rm {
+			remove = req.Arguments()[1:]
+		} else {
+			add = req.Arguments()[1:]
+		}
+		f, err := catalog.Tag(n, req.Arguments()[0], add, remove)
+		if err == catalog.ErrBadTag {
+			res.SetError(err, cmds.ErrClient)
+			return
+		} else if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(f)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: uuidFileMarshaler,
+	},
+	Type: catalog.File{},
+}
+
+func uuidFileMarshaler(res cmds.Response) (io.Reader, error) {
+	f, ok := res.Output().(*catalog.File)
+	if !ok {
+		return nil, util.ErrCast()
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "UUID: %s\nName: %s\nType: %s\nSize: %d\nRoot: %s\n", f.UUID, f.Name, f.Type, f.Size, f.Root)
+	fmt.Fprintf(buf, "Created: %s\nUpdated: %s\n", formatTime(f.Created), formatTime(f.Updated))
+	if len(f.Tags) != 0 {
+		fmt.Fprintf(buf, "Tags: %s\n", strings.Join(f.Tags, ", "))
+	}
+	if f.Owner != "" {
+		fmt.Fprintf(buf, "Owner: %s\n", f.Owner)
+	}
+	return buf, nil
+}
+
+// formatTime prints "-" for times which were not recorded.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
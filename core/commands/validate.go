@@ -1,11 +1,13 @@
 package commands
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+
 	cu "github.com/Casper-dev/Casper-server/casper/casper_utils"
-	thrift "github.com/Casper-dev/Casper-server/casper/thrift"
 	val "github.com/Casper-dev/Casper-server/casper/validation"
 	cmds "github.com/Casper-dev/Casper-server/commands"
-	"github.com/Casper-dev/Casper-thrift/casperproto"
 
 	"gx/ipfs/QmX3U3YXCQ6UYBxq2LVWF8dARS1hPUTEYLrSx654Qyxyw6/go-multiaddr-net"
 	"gx/ipfs/QmeS8cCKawUwejVrsBtmC1toTXmwVWZGiRJqzgTURVWeF9/go-ipfs-addr"
@@ -23,7 +25,7 @@ Lists running and recently run commands.
 		cmds.StringArg("uuid", true, false, "UUID to validate"),
 	},
 	Options: []cmds.Option{
-		cmds.StringOption("server", "s", "Perform validation as client"),
+		cmds.StringOption("server", "s", "Perform validation as client of the initiator with thrift address /ip4/<ip>/tcp/<port>/ipfs/<id>"),
 		cmds.StringOption("node", "Node ID"),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
@@ -54,25 +56,49 @@ Lists running and recently run commands.
 			}
 			log.Debugf("Address: %s", localAddr.String())
 
-			_, err = thrift.RunClientClosure(server, func(c *thrift.ThriftClient) (interface{}, error) {
-				return nil, c.SendVerificationQuery(req.Context(), id, &casperproto.NodeInfo{
-					IpfsAddr:   localAddr.IPFS().String(),
-					ThriftAddr: localAddr.Thrift().String(),
-				})
-			})
+			initiator, err := ipfsaddr.ParseString(server)
 			if err != nil {
-				log.Error(err)
 				res.SetError(err, cmds.ErrNormal)
 				return
 			}
-		} else {
-			err := val.PerformValidation(req.Context(), n, id)
+			iaddr, err := manet.ToNetAddr(initiator.Transport())
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+
+			err = val.JoinValidation(req.Context(), initiator.ID(), iaddr.String(), id, localAddr)
 			if err != nil {
 				log.Error(err)
 				res.SetError(err, cmds.ErrNormal)
 				return
 			}
+			res.SetOutput(nil)
+			return
 		}
-		res.SetOutput(nil)
+
+		report, err := val.PerformValidation(req.Context(), n, id)
+		if err != nil {
+			log.Error(err)
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(report)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			report, ok := res.Output().(*val.Report)
+			if !ok {
+				return nil, nil
+			}
+
+			buf := new(bytes.Buffer)
+			fmt.Fprintf(buf, "Validated %s on %d nodes\n", report.UUID, len(report.Nodes))
+			for _, id := range report.Dissenters {
+				fmt.Fprintf(buf, "bad copy: %s\n", id)
+			}
+			return buf, nil
+		},
 	},
+	Type: val.Report{},
 }
@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/casper/versions"
+	cmds "github.com/Casper-dev/Casper-server/commands"
+
+	util "gx/ipfs/QmSU6eubNdhXjFBJBSksTp8kv8YRub8mGAPv8tVJHmL2EU/go-ipfs-util"
+)
+
+var VersionsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List previous versions of a UUID file.",
+		ShortDescription: `
+Prints versions which were recorded when the file was updated, oldest
+first. History is kept for files updated with 'upd --keep-history' or for
+all files if Casper.Versions.Enabled is set in config. Version can be
+downloaded with 'cat /ipfs/<cid>' or REST API 'GET file/<uuid>?version=<n>'
+and restored with 'upd <uuid> /ipfs/<cid>'.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("uuid", true, false, "Base58 encoded UUID."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		l, err := versions.List(n, req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(l)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			l, ok := res.Output().(*versions.Log)
+			if !ok {
+				return nil, util.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			for i, v := range l.Versions {
+				fmt.Fprintf(buf, "%d\t%s\t%d\t%s\n", i+1, v.CID, v.Size, v.Time.Format(time.RFC3339))
+			}
+			return buf, nil
+		},
+	},
+	Type: versions.Log{},
+}
@@ -0,0 +1,308 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	sc "github.com/Casper-dev/Casper-server/casper/sc"
+	"github.com/Casper-dev/Casper-server/casper/wallet"
+	cmds "github.com/Casper-dev/Casper-server/commands"
+	"github.com/Casper-dev/Casper-server/repo/fsrepo"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var WalletCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage blockchain wallets.",
+		ShortDescription: `
+Private keys of wallets are kept in the keystore encrypted with a passphrase.
+Passphrase is read from $CASPER_WALLET_PASSPHRASE or asked in terminal.
+Daemon unlocks wallets with $CASPER_WALLET_PASSPHRASE.
+
+  > ipfs wallet new --chain=ETH provider
+  > ipfs wallet use provider
+  > CASPER_WALLET_PASSPHRASE=... ipfs daemon
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"new":    walletNewCmd,
+		"import": walletImportCmd,
+		"export": walletExportCmd,
+		"list":   walletListCmd,
+		"use":    walletUseCmd,
+	},
+}
+
+// WalletOutput describes wallet without its key
+type WalletOutput struct {
+	Name    string
+	Chain   string
+	Address string
+	Used    bool
+}
+
+type WalletOutputList struct {
+	Wallets []WalletOutput
+}
+
+var walletNewCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Create a new wallet.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name of wallet to create."),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("chain", "c", "Chain of the wallet.").Default(sc.DefaultChain),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		chain, _, _ := req.Option("chain").String()
+		s, err := wallet.Open(req.InvocContext().ConfigRoot)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		pass, err := readPassphrase(true)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		w, err := s.New(req.Arguments()[0], chain, pass)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&WalletOutput{Name: w.Name, Chain: w.Chain, Address: w.Address})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: walletMarshaler,
+	},
+	Type: WalletOutput{},
+}
+
+var walletImportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Import private key as a wallet.",
+		ShortDescription: `
+Key is hex encoded for ETH and WIF for NEO. Pass it on stdin
+to keep it out of shell history:
+
+  > ipfs wallet import --chain=NEO provider < key.txt
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name of wallet to create."),
+		cmds.StringArg("key", true, false, "Private key of wallet.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("chain", "c", "Chain of the wallet.").Default(sc.DefaultChain),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		chain, _, _ := req.Option("chain").String()
+		s, err := wallet.Open(req.InvocContext().ConfigRoot)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		pass, err := readPassphrase(true)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		w, err := s.Import(req.Arguments()[0], chain, req.Arguments()[1], pass)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&WalletOutput{Name: w.Name, Chain: w.Chain, Address: w.Address})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: walletMarshaler,
+	},
+	Type: WalletOutput{},
+}
+
+var walletExportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print private key of a wallet.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name of wallet to export."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		s, err := wallet.Open(req.InvocContext().ConfigRoot)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		pass, err := readPassphrase(false)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		key, err := s.Unlock(req.Arguments()[0], pass)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(bytes.NewReader([]byte(key + "\n")))
+	},
+}
+
+var walletListCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List wallets.",
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		root := req.InvocContext().ConfigRoot
+		s, err := wallet.Open(root)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		cfg, err := fsrepo.ConfigAt(root)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		wallets, err := s.List()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		out := &WalletOutputList{Wallets: make([]WalletOutput, 0, len(wallets))}
+		for _, w := range wallets {
+			out.Wallets = append(out.Wallets, WalletOutput{
+				Name:    w.Name,
+				Chain:   w.Chain,
+				Address: w.Address,
+				Used:    cfg.Casper.Wallets[w.Chain] == w.Name,
+			})
+		}
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*WalletOutputList)
+			if !ok {
+				return nil, fmt.Errorf("expected a WalletOutputList as command result")
+			}
+
+			buf := new(bytes.Buffer)
+			w := tabwriter.NewWriter(buf, 1, 2, 1, ' ', 0)
+			for _, o := range list.Wallets {
+				used := ""
+				if o.Used {
+					used = "*"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", o.Name, o.Chain, o.Address, used)
+			}
+			w.Flush()
+			return buf, nil
+		},
+	},
+	Type: WalletOutputList{},
+}
+
+var walletUseCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Use wallet on its chain.",
+		ShortDescription: `
+Wallet is used on its chain after daemon restart. If no wallet
+is chosen, the only wallet of the chain is used.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name of wallet to use."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		root := req.InvocContext().ConfigRoot
+		s, err := wallet.Open(root)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		w, err := s.Get(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		r, err := fsrepo.Open(root)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		defer r.Close()
+
+		cfg, err := r.Config()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		wallets := make(map[string]string, len(cfg.Casper.Wallets)+1)
+		for chain, name := range cfg.Casper.Wallets {
+			wallets[chain] = name
+		}
+		wallets[w.Chain] = w.Name
+		if err := r.SetConfigKey("Casper.Wallets", wallets); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&WalletOutput{Name: w.Name, Chain: w.Chain, Address: w.Address, Used: true})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: walletMarshaler,
+	},
+	Type: WalletOutput{},
+}
+
+func walletMarshaler(res cmds.Response) (io.Reader, error) {
+	w, ok := res.Output().(*WalletOutput)
+	if !ok {
+		return nil, fmt.Errorf("expected a WalletOutput as command result")
+	}
+	return bytes.NewBufferString(fmt.Sprintf("%s %s %s\n", w.Name, w.Chain, w.Address)), nil
+}
+
+// readPassphrase returns passphrase from wallet.PassphraseEnv or asks
+// it in terminal. New passphrase is asked twice.
+func readPassphrase(confirm bool) ([]byte, error) {
+	if pass := os.Getenv(wallet.PassphraseEnv); pass != "" {
+		return []byte(pass), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return nil, fmt.Errorf("stdin is not a terminal, set %s", wallet.PassphraseEnv)
+	}
+	fmt.Fprint(os.Stderr, "Passphrase: ")
+	pass, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if !confirm {
+		return pass, nil
+	}
+
+	fmt.Fprint(os.Stderr, "Repeat passphrase: ")
+	again, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(pass, again) {
+		return nil, errors.New("passphrases do not match")
+	}
+	return pass, nil
+}
@@ -26,6 +26,8 @@ import (
 	bl "github.com/Casper-dev/Casper-server/blocks"
 	bstore "github.com/Casper-dev/Casper-server/blocks/blockstore"
 	bserv "github.com/Casper-dev/Casper-server/blockservice"
+	"github.com/Casper-dev/Casper-server/casper/paychan"
+	"github.com/Casper-dev/Casper-server/casper/replication"
 	uid "github.com/Casper-dev/Casper-server/casper/uuid"
 	exchange "github.com/Casper-dev/Casper-server/exchange"
 	bitswap "github.com/Casper-dev/Casper-server/exchange/bitswap"
@@ -143,6 +145,11 @@ type IpfsNode struct {
 	Floodsub *floodsub.PubSub
 	P2P      *p2p.P2P
 
+	// Casper services run by daemon; commands use them
+	// instead of creating their own on the same datastore
+	Replication *replication.Queue
+	Channels    *paychan.Manager
+
 	proc goprocess.Process
 	ctx  context.Context
 
@@ -722,18 +729,53 @@ const (
 	uuidChanBufLen  = 128
 )
 
+// UUIDInfo describes file with some UUID: who is allowed to modify it
+// and metadata of its current contents.
 type UUIDInfo struct {
+	// PubKey is ID of the owner key. Empty if file has no owner.
 	PubKey string
+	// Writers contains IDs of other keys which can update and delete file.
+	Writers []string `json:",omitempty"`
+	// Seq is the sequence number of the last accepted signed request.
+	Seq int64 `json:",omitempty"`
+	// Proof contains encoded signed requests which have set the current
+	// owner, starting with create. Last is the last accepted update or
+	// delete request. Other providers verify them before they accept
+	// ownership of a new replica.
+	Proof []string `json:",omitempty"`
+	Last  string   `json:",omitempty"`
+	// KeyName is the name of the local key used to sign requests.
+	// It is set only on the node where file was created.
+	KeyName string `json:",omitempty"`
+
+	// Name is the name of the file as it was added.
+	Name string `json:",omitempty"`
+	// Type is the MIME type of the file.
+	Type string `json:",omitempty"`
+	// Size is the size of raw data.
+	Size uint64 `json:",omitempty"`
+	// Root is the CID of current contents. Root CID of a UUID file
+	// is derived from the UUID and does not change on update.
+	Root string `json:",omitempty"`
+	// Created and Updated are times when the file was first stored
+	// on this node and when its contents were last replaced.
+	Created time.Time
+	Updated time.Time
+	// Tags are labels set by user to find the file.
+	Tags []string `json:",omitempty"`
 }
 
 var UUIDInfoCache = &sync.Map{}
 
+// uuidMtx serializes read-modify-write of UUID infos.
+var uuidMtx sync.Mutex
+
 func keyByUUID(uuid string) ds.Key {
 	return ds.NewKey(uuidDSKeyPrefix + uuid)
 }
 
 func (n *IpfsNode) InitUUIDCache(ctx context.Context) error {
-	q := query.Query{KeysOnly: true, Prefix: uuidDSKeyPrefix}
+	q := query.Query{Prefix: uuidDSKeyPrefix}
 	res, err := n.Repo.Datastore().Query(q)
 	if err != nil {
 		return err
@@ -804,6 +846,25 @@ func (n *IpfsNode) GetUUID(uuid string) (*UUIDInfo, error) {
 	return info, err
 }
 
+// UpdateUUID applies f to a copy of the info of the file with specified
+// UUID and stores the result. f gets empty info if UUID is not known yet.
+func (n *IpfsNode) UpdateUUID(uuid string, f func(info *UUIDInfo) error) error {
+	uuidMtx.Lock()
+	defer uuidMtx.Unlock()
+
+	next := &UUIDInfo{}
+	info, err := n.GetUUID(uuid)
+	if err == nil {
+		*next = *info
+	} else if err != ds.ErrNotFound {
+		return err
+	}
+	if err = f(next); err != nil {
+		return err
+	}
+	return n.AddUUID(uuid, next)
+}
+
 func (n *IpfsNode) AllUUIDChan(ctx context.Context) (<-chan string, error) {
 	q := query.Query{KeysOnly: true, Prefix: uuidDSKeyPrefix}
 	res, err := n.Repo.Datastore().Query(q)
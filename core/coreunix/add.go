@@ -70,11 +70,19 @@ func (e *ignoreFileError) Error() string {
 }
 
 type AddedObject struct {
-	Name  string
-	Hash  string `json:",omitempty"`
-	Bytes int64  `json:",omitempty"`
-	UUID  string `json:",omitempty"`
-	Size  string `json:",omitempty"`
+	Name    string
+	Hash    string   `json:",omitempty"`
+	Bytes   int64    `json:",omitempty"`
+	UUID    string   `json:",omitempty"`
+	Size    string   `json:",omitempty"`
+	Replica *Replica `json:",omitempty"`
+}
+
+// Replica describes provider which has successfully stored added file
+type Replica struct {
+	Peer   string
+	Addr   string
+	Origin string `json:",omitempty"`
 }
 
 func NewAdder(ctx context.Context, p pin.Pinner, bs bstore.GCBlockstore, ds dag.DAGService) (*Adder, error) {
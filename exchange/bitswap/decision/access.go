@@ -0,0 +1,408 @@
+package decision
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Casper-dev/Casper-server/casper/sc"
+	config "github.com/Casper-dev/Casper-server/repo/config"
+
+	"gx/ipfs/QmNp85zy9RLrQ5oQD4hPyS39ezrrXpcaa7R4Y9kxdWQLLQ/go-cid"
+	"gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
+)
+
+const (
+	// DefaultDownloadTTL is how long download is allowed after it was paid
+	DefaultDownloadTTL = time.Hour
+	// DefaultBytesPerToken is how much is downloaded for a token paid with channel
+	DefaultBytesPerToken = 1 << 20
+	// checkInterval is how often wallet is checked to still be prepaid
+	// and peer to still be a provider
+	checkInterval = time.Minute
+)
+
+// grant allows peer to download blocks of a file paid with wallet.
+type grant struct {
+	wallet  string
+	root    *cid.Cid
+	blocks  map[string]struct{}
+	expires time.Time
+}
+
+// check is the cached result of SC call made at checked.
+type check struct {
+	ok       bool
+	checked  time.Time
+	checking bool
+}
+
+// DownloadAccess decides which blocks are served to which peers. When it
+// is enabled, a peer gets only blocks of files it was allowed to download
+// with a prepaid wallet: the root and all of its descendants. Instead of
+// prepaying, peer can pay with payment channel, then it has credit of bytes
+// which are not billed to its wallet. Registered
+// providers get everything, as they replicate, repair and validate files.
+// Disabled access lets everyone download everything, like plain bitswap does.
+//
+// Allowed is called by engine with ledger locked, so it never calls SC:
+// wallets and providers are checked in background and the cached result
+// is used until then. Engines are notified when peer gets new access, so
+// that wants which were denied are served.
+type DownloadAccess struct {
+	mtx           sync.Mutex
+	enabled       bool
+	ttl           time.Duration
+	bytesPerToken uint64
+	// grants of every peer by root CID
+	grants map[peer.ID]map[string]*grant
+	// credit is the number of bytes paid with payment channels
+	credit map[peer.ID]uint64
+	// usage is the traffic served since the last TakeUsage
+	usage map[usageKey]*Usage
+
+	wallets   map[string]*check
+	providers map[peer.ID]*check
+	listeners map[int]func(peer.ID)
+	nextID    int
+
+	// IsPrepaid checks if wallet has paid for the download
+	IsPrepaid func(wallet string) (bool, error)
+	// IsProvider checks if peer is a registered provider
+	IsProvider func(p peer.ID) bool
+	now        func() time.Time
+	// async runs background checks
+	async func(func())
+}
+
+func NewDownloadAccess() *DownloadAccess {
+	return &DownloadAccess{
+		ttl:           DefaultDownloadTTL,
+		bytesPerToken: DefaultBytesPerToken,
+		grants:        make(map[peer.ID]map[string]*grant),
+		credit:        make(map[peer.ID]uint64),
+		usage:         make(map[usageKey]*Usage),
+		wallets:       make(map[string]*check),
+		providers:     make(map[peer.ID]*check),
+		listeners:     make(map[int]func(peer.ID)),
+		IsPrepaid:     isPrepaid,
+		IsProvider:    func(peer.ID) bool { return false },
+		now:           time.Now,
+		async:         func(f func()) { go f() },
+	}
+}
+
+func isPrepaid(wallet string) (bool, error) {
+	c, err := sc.GetContract()
+	if err != nil {
+		return false, err
+	}
+	return c.IsPrepaid(wallet)
+}
+
+// DefaultAccess is used by engines of the node.
+var DefaultAccess = NewDownloadAccess()
+
+// Configure applies settings from config.
+func (a *DownloadAccess) Configure(cfg config.PaidDownloads) error {
+	ttl := DefaultDownloadTTL
+	if cfg.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(cfg.TTL); err != nil {
+			return err
+		}
+	}
+
+	bytesPerToken := uint64(DefaultBytesPerToken)
+	if cfg.BytesPerToken > 0 {
+		bytesPerToken = cfg.BytesPerToken
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.enabled = cfg.Enabled
+	a.ttl = ttl
+	a.bytesPerToken = bytesPerToken
+	return nil
+}
+
+// Enabled reports if downloads are restricted.
+func (a *DownloadAccess) Enabled() bool {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.enabled
+}
+
+// Allow lets p download root and blocks, which must be all descendants
+// of root, until TTL passes. Allowing the same root again extends the TTL.
+// Grants are made even if access is disabled, so that traffic is metered.
+func (a *DownloadAccess) Allow(p peer.ID, wallet string, root *cid.Cid, blocks []*cid.Cid) {
+	g := &grant{wallet: wallet, root: root, blocks: make(map[string]struct{}, len(blocks)+1)}
+	g.blocks[root.KeyString()] = struct{}{}
+	for _, c := range blocks {
+		g.blocks[c.KeyString()] = struct{}{}
+	}
+
+	a.mtx.Lock()
+	now := a.now()
+	g.expires = now.Add(a.ttl)
+	if a.grants[p] == nil {
+		a.grants[p] = make(map[string]*grant)
+	}
+	a.dropExpired(p, now)
+	a.grants[p][root.KeyString()] = g
+	a.mtx.Unlock()
+
+	log.Debugf("peer %s is allowed to download %s with wallet %s", p, root, wallet)
+	a.notify(p)
+}
+
+// Credit lets p download bytes worth of tokens it has paid with payment
+// channel. Credit is spent on any file p is allowed to download.
+func (a *DownloadAccess) Credit(p peer.ID, tokens int64) {
+	if tokens <= 0 {
+		return
+	}
+	a.mtx.Lock()
+	a.credit[p] += uint64(tokens) * a.bytesPerToken
+	a.mtx.Unlock()
+
+	log.Debugf("peer %s has paid %d tokens with payment channel", p, tokens)
+	a.notify(p)
+}
+
+// HasCredit reports if p has bytes paid with payment channel.
+func (a *DownloadAccess) HasCredit(p peer.ID) bool {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.credit[p] > 0
+}
+
+// Revoke forbids p to download root.
+func (a *DownloadAccess) Revoke(p peer.ID, root *cid.Cid) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	delete(a.grants[p], root.KeyString())
+	if len(a.grants[p]) == 0 {
+		delete(a.grants, p)
+	}
+}
+
+// Allowed checks if block k can be sent to p.
+func (a *DownloadAccess) Allowed(p peer.ID, k *cid.Cid) bool {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if !a.enabled {
+		return true
+	}
+
+	if a.cachedProvider(p) {
+		return true
+	}
+	a.dropExpired(p, a.now())
+	for _, g := range a.grants[p] {
+		if _, ok := g.blocks[k.KeyString()]; ok && (a.credit[p] > 0 || a.cachedPrepaid(g.wallet)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *DownloadAccess) dropExpired(p peer.ID, now time.Time) {
+	for root, g := range a.grants[p] {
+		if now.After(g.expires) {
+			delete(a.grants[p], root)
+		}
+	}
+}
+
+// Prepaid checks if wallet is prepaid with SC and caches the result.
+// It must not be called by engine.
+func (a *DownloadAccess) Prepaid(wallet string) (bool, error) {
+	ok, err := a.IsPrepaid(wallet)
+	if err != nil {
+		return false, err
+	}
+	a.setPrepaid(wallet, ok)
+	return ok, nil
+}
+
+// stale reports if c must be checked again; mtx must be held.
+func (a *DownloadAccess) stale(c *check) bool {
+	return !c.checking && (c.checked.IsZero() || a.now().Sub(c.checked) >= checkInterval)
+}
+
+// cachedPrepaid returns the last known state of wallet, a new check
+// is started if it is stale; mtx must be held.
+func (a *DownloadAccess) cachedPrepaid(wallet string) bool {
+	c := a.wallets[wallet]
+	if c == nil {
+		c = &check{}
+		a.wallets[wallet] = c
+	}
+	if a.stale(c) {
+		c.checking = true
+		a.async(func() {
+			ok, err := a.IsPrepaid(wallet)
+			if err != nil {
+				log.Errorf("can't check if wallet %s is prepaid: %v", wallet, err)
+			}
+			a.setPrepaid(wallet, ok && err == nil)
+		})
+	}
+	return c.ok
+}
+
+// setPrepaid caches state of wallet and notifies engines about peers
+// which can download with it now.
+func (a *DownloadAccess) setPrepaid(wallet string, ok bool) {
+	a.mtx.Lock()
+	c := a.wallets[wallet]
+	if c == nil {
+		c = &check{}
+		a.wallets[wallet] = c
+	}
+	paid := ok && !c.ok
+	c.ok, c.checked, c.checking = ok, a.now(), false
+
+	var peers []peer.ID
+	if paid {
+		for p, grants := range a.grants {
+			for _, g := range grants {
+				if g.wallet == wallet {
+					peers = append(peers, p)
+					break
+				}
+			}
+		}
+	}
+	a.mtx.Unlock()
+
+	for _, p := range peers {
+		a.notify(p)
+	}
+}
+
+// cachedProvider returns the last known state of p, a new check
+// is started if it is stale; mtx must be held.
+func (a *DownloadAccess) cachedProvider(p peer.ID) bool {
+	c := a.providers[p]
+	if c == nil {
+		c = &check{}
+		a.providers[p] = c
+	}
+	if a.stale(c) {
+		c.checking = true
+		a.async(func() {
+			ok := a.IsProvider(p)
+
+			a.mtx.Lock()
+			registered := ok && !c.ok
+			c.ok, c.checked, c.checking = ok, a.now(), false
+			a.mtx.Unlock()
+
+			if registered {
+				a.notify(p)
+			}
+		})
+	}
+	return c.ok
+}
+
+// Subscribe calls f whenever p may have got access to blocks it was
+// denied before, until ctx is done.
+func (a *DownloadAccess) Subscribe(ctx context.Context, f func(p peer.ID)) {
+	a.mtx.Lock()
+	id := a.nextID
+	a.nextID++
+	a.listeners[id] = f
+	a.mtx.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		a.mtx.Lock()
+		delete(a.listeners, id)
+		a.mtx.Unlock()
+	}()
+}
+
+func (a *DownloadAccess) notify(p peer.ID) {
+	a.mtx.Lock()
+	listeners := make([]func(peer.ID), 0, len(a.listeners))
+	for _, f := range a.listeners {
+		listeners = append(listeners, f)
+	}
+	a.mtx.Unlock()
+
+	for _, f := range listeners {
+		f(p)
+	}
+}
+
+// Usage is the number of bytes of the file with root CID Root
+// sent to Peer, who has asked for its download with Wallet.
+type Usage struct {
+	Peer   peer.ID
+	Wallet string
+	Root   *cid.Cid
+	Bytes  uint64
+}
+
+type usageKey struct {
+	peer   peer.ID
+	wallet string
+	root   string
+}
+
+// Sent records that n bytes of block k were sent to p. Traffic is
+// attributed to the file which p was allowed to download, blocks which
+// belong to no such file are not metered. If block is shared by several
+// files, it is attributed to one of them. Traffic is paid with credit of
+// p first, only the rest is metered for billing.
+func (a *DownloadAccess) Sent(p peer.ID, k *cid.Cid, n int) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	for _, g := range a.grants[p] {
+		if _, ok := g.blocks[k.KeyString()]; !ok {
+			continue
+		}
+		bytes := a.spendCredit(p, uint64(n))
+		if bytes == 0 {
+			return
+		}
+		key := usageKey{peer: p, wallet: g.wallet, root: g.root.KeyString()}
+		u := a.usage[key]
+		if u == nil {
+			u = &Usage{Peer: p, Wallet: g.wallet, Root: g.root}
+			a.usage[key] = u
+		}
+		u.Bytes += bytes
+		return
+	}
+}
+
+// spendCredit pays for n bytes with credit of p and returns
+// the number of bytes which were not paid; mtx must be held.
+func (a *DownloadAccess) spendCredit(p peer.ID, n uint64) uint64 {
+	credit := a.credit[p]
+	if credit > n {
+		a.credit[p] = credit - n
+		return 0
+	}
+	delete(a.credit, p)
+	return n - credit
+}
+
+// TakeUsage returns traffic metered since the previous call.
+func (a *DownloadAccess) TakeUsage() []Usage {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	usage := make([]Usage, 0, len(a.usage))
+	for key, u := range a.usage {
+		usage = append(usage, *u)
+		delete(a.usage, key)
+	}
+	return usage
+}
@@ -0,0 +1,284 @@
+package decision
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blockstore "github.com/Casper-dev/Casper-server/blocks/blockstore"
+	"github.com/Casper-dev/Casper-server/casper/uuid"
+	message "github.com/Casper-dev/Casper-server/exchange/bitswap/message"
+	config "github.com/Casper-dev/Casper-server/repo/config"
+
+	"gx/ipfs/QmNp85zy9RLrQ5oQD4hPyS39ezrrXpcaa7R4Y9kxdWQLLQ/go-cid"
+	blocks "gx/ipfs/QmSn9Td7xgxm9EV7iEjTckpUWmWApggzPxu7eFGWkkpwin/go-block-format"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+	peer "gx/ipfs/QmXYjuNuxVzXKJCfWasQk1RqkhVLDM9jtUKhqc2WPQmFSB/go-libp2p-peer"
+)
+
+type testAccess struct {
+	*DownloadAccess
+	clock     time.Time
+	prepaid   map[string]bool
+	providers map[peer.ID]bool
+	checks    int
+	// pending are background checks, they are run by runChecks
+	pending []func()
+}
+
+func newTestAccess(t *testing.T) *testAccess {
+	ta := &testAccess{
+		DownloadAccess: NewDownloadAccess(),
+		clock:          time.Unix(1500000000, 0),
+		prepaid:        map[string]bool{},
+		providers:      map[peer.ID]bool{},
+	}
+	ta.now = func() time.Time { return ta.clock }
+	ta.async = func(f func()) { ta.pending = append(ta.pending, f) }
+	ta.IsPrepaid = func(wallet string) (bool, error) {
+		ta.checks++
+		return ta.prepaid[wallet], nil
+	}
+	ta.IsProvider = func(p peer.ID) bool { return ta.providers[p] }
+	if err := ta.Configure(config.PaidDownloads{Enabled: true, TTL: "10m"}); err != nil {
+		t.Fatal(err)
+	}
+	return ta
+}
+
+func (ta *testAccess) runChecks() {
+	pending := ta.pending
+	ta.pending = nil
+	for _, f := range pending {
+		f()
+	}
+}
+
+func TestAccessDisabled(t *testing.T) {
+	a := NewDownloadAccess()
+	if !a.Allowed(peer.ID("p"), blocks.NewBlock([]byte("a")).Cid()) {
+		t.Fatal("everything must be allowed when access is disabled")
+	}
+	if err := a.Configure(config.PaidDownloads{TTL: "never"}); err == nil {
+		t.Fatal("invalid TTL must be rejected")
+	}
+}
+
+func TestAccessDescendants(t *testing.T) {
+	a := newTestAccess(t)
+	a.prepaid["wallet"] = true
+	root, child, other := blocks.NewBlock([]byte("root")), blocks.NewBlock([]byte("child")), blocks.NewBlock([]byte("other"))
+	p, q := peer.ID("p"), peer.ID("q")
+
+	if a.Allowed(p, root.Cid()) {
+		t.Fatal("root must not be allowed before download is paid")
+	}
+	a.Allow(p, "wallet", root.Cid(), []*cid.Cid{child.Cid()})
+	if _, err := a.Prepaid("wallet"); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Allowed(p, root.Cid()) || !a.Allowed(p, child.Cid()) {
+		t.Fatal("root and its descendants must be allowed")
+	}
+	if a.Allowed(p, other.Cid()) {
+		t.Fatal("other blocks must not be allowed")
+	}
+	if a.Allowed(q, child.Cid()) {
+		t.Fatal("other peers must not be allowed")
+	}
+
+	a.Revoke(p, root.Cid())
+	if a.Allowed(p, child.Cid()) {
+		t.Fatal("revoked download must not be allowed")
+	}
+}
+
+func TestAccessExpiry(t *testing.T) {
+	a := newTestAccess(t)
+	a.prepaid["wallet"] = true
+	root := blocks.NewBlock([]byte("root"))
+	p := peer.ID("p")
+
+	a.Allow(p, "wallet", root.Cid(), nil)
+	if _, err := a.Prepaid("wallet"); err != nil {
+		t.Fatal(err)
+	}
+	a.clock = a.clock.Add(9 * time.Minute)
+	if !a.Allowed(p, root.Cid()) {
+		t.Fatal("download must be allowed until TTL passes")
+	}
+	a.clock = a.clock.Add(2 * time.Minute)
+	if a.Allowed(p, root.Cid()) {
+		t.Fatal("download must expire")
+	}
+}
+
+func TestAccessPrepaid(t *testing.T) {
+	a := newTestAccess(t)
+	root := blocks.NewBlock([]byte("root"))
+	p := peer.ID("p")
+
+	a.prepaid["wallet"] = true
+	a.Allow(p, "wallet", root.Cid(), nil)
+	if a.Allowed(p, root.Cid()) {
+		t.Fatal("wallet must not be checked by Allowed")
+	}
+	// peer is checked to be a provider too
+	if a.checks != 0 || len(a.pending) != 2 {
+		t.Fatalf("wallet must be checked in background, got %d checks, %d pending", a.checks, len(a.pending))
+	}
+	a.Allowed(p, root.Cid())
+	if len(a.pending) != 2 {
+		t.Fatal("wallet must be checked once at a time")
+	}
+	a.runChecks()
+	for i := 0; i < 3; i++ {
+		if !a.Allowed(p, root.Cid()) {
+			t.Fatal("prepaid download must be allowed")
+		}
+	}
+	if a.checks != 1 || len(a.pending) != 0 {
+		t.Fatalf("prepaid check must be cached, got %d checks", a.checks)
+	}
+
+	a.prepaid["wallet"] = false
+	a.clock = a.clock.Add(checkInterval)
+	a.Allowed(p, root.Cid())
+	a.runChecks()
+	if a.Allowed(p, root.Cid()) {
+		t.Fatal("download must stop when wallet is no longer prepaid")
+	}
+}
+
+func TestAccessProvider(t *testing.T) {
+	a := newTestAccess(t)
+	k := blocks.NewBlock([]byte("replica")).Cid()
+	p, q := peer.ID("provider"), peer.ID("client")
+	a.providers[p] = true
+
+	a.Allowed(p, k)
+	a.Allowed(q, k)
+	a.runChecks()
+	if !a.Allowed(p, k) {
+		t.Fatal("providers must download without grants")
+	}
+	if a.Allowed(q, k) {
+		t.Fatal("clients must not download without grants")
+	}
+}
+
+func TestEngineAccess(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	paid, unpaid := newUUIDBlock("paid"), newUUIDBlock("unpaid")
+	if err := bs.PutMany([]blocks.Block{paid, unpaid}); err != nil {
+		t.Fatal(err)
+	}
+	a := newTestAccess(t)
+	a.prepaid["wallet"] = true
+	e := newEngineWithAccess(ctx, bs, a.DownloadAccess)
+
+	p := peer.ID("p")
+	a.Allow(p, "wallet", paid.Cid(), nil)
+	if _, err := a.Prepaid("wallet"); err != nil {
+		t.Fatal(err)
+	}
+	m := message.New(false)
+	m.AddEntry(paid.Cid(), 1)
+	m.AddEntry(unpaid.Cid(), 2)
+	if err := e.MessageReceived(p, m); err != nil {
+		t.Fatal(err)
+	}
+	a.runChecks()
+
+	if next := nextBlock(t, e); !next.Cid().Equals(paid.Cid()) {
+		t.Fatalf("only paid block must be sent, got %s", next.Cid())
+	}
+
+	// want which was denied is served once it is allowed
+	a.Allow(p, "wallet", unpaid.Cid(), nil)
+	if next := nextBlock(t, e); !next.Cid().Equals(unpaid.Cid()) {
+		t.Fatalf("block must be sent after it is paid, got %s", next.Cid())
+	}
+}
+
+// newUUIDBlock returns block with null UUID, as blockstore
+// of the node keeps UUID in front of the block data.
+func newUUIDBlock(data string) blocks.Block {
+	return blocks.NewBlock(append(make([]byte, uuid.UUIDLen), data...))
+}
+
+func nextBlock(t *testing.T, e *Engine) blocks.Block {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	select {
+	case next := <-e.Outbox():
+		select {
+		case env := <-next:
+			env.Sent()
+			return env.Block
+		case <-ctx.Done():
+		}
+	case <-ctx.Done():
+	}
+	t.Fatal("no block was sent")
+	return nil
+}
+
+func TestAccessUsage(t *testing.T) {
+	a := NewDownloadAccess()
+	root, child, other := blocks.NewBlock([]byte("root")), blocks.NewBlock([]byte("child")), blocks.NewBlock([]byte("other"))
+	p, q := peer.ID("p"), peer.ID("q")
+
+	// traffic is metered even if access is disabled
+	a.Allow(p, "wallet", root.Cid(), []*cid.Cid{child.Cid()})
+	a.Sent(p, root.Cid(), 10)
+	a.Sent(p, child.Cid(), 20)
+	a.Sent(p, other.Cid(), 40)
+	a.Sent(q, child.Cid(), 80)
+
+	usage := a.TakeUsage()
+	if len(usage) != 1 {
+		t.Fatalf("expected usage of one file, got %v", usage)
+	}
+	u := usage[0]
+	if u.Peer != p || u.Wallet != "wallet" || !u.Root.Equals(root.Cid()) || u.Bytes != 30 {
+		t.Fatalf("unexpected usage %+v", u)
+	}
+	if usage = a.TakeUsage(); len(usage) != 0 {
+		t.Fatalf("usage must be taken only once, got %v", usage)
+	}
+}
+
+func TestAccessCredit(t *testing.T) {
+	a := newTestAccess(t)
+	if err := a.Configure(config.PaidDownloads{Enabled: true, BytesPerToken: 10}); err != nil {
+		t.Fatal(err)
+	}
+	root := blocks.NewBlock([]byte("root"))
+	p := peer.ID("p")
+
+	a.Allow(p, "wallet", root.Cid(), nil)
+	a.Credit(p, 3)
+	if !a.HasCredit(p) || !a.Allowed(p, root.Cid()) {
+		t.Fatal("download paid with channel must be allowed")
+	}
+	a.Sent(p, root.Cid(), 20)
+	a.Sent(p, root.Cid(), 25)
+	if a.HasCredit(p) {
+		t.Fatal("credit must be spent")
+	}
+	a.runChecks()
+	if a.Allowed(p, root.Cid()) {
+		t.Fatal("download must stop when credit is spent and wallet is not prepaid")
+	}
+
+	// only traffic which was not paid with channel is billed
+	usage := a.TakeUsage()
+	if len(usage) != 1 || usage[0].Bytes != 15 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+}
@@ -85,6 +85,9 @@ type Engine struct {
 
 	bs bstore.Blockstore
 
+	// access decides which wanted blocks peers can get
+	access *DownloadAccess
+
 	lock sync.Mutex // protects the fields immediatly below
 	// ledgerMap lists Ledgers by their Partner key.
 	ledgerMap map[peer.ID]*ledger
@@ -93,14 +96,20 @@ type Engine struct {
 }
 
 func NewEngine(ctx context.Context, bs bstore.Blockstore) *Engine {
+	return newEngineWithAccess(ctx, bs, DefaultAccess)
+}
+
+func newEngineWithAccess(ctx context.Context, bs bstore.Blockstore, access *DownloadAccess) *Engine {
 	e := &Engine{
 		ledgerMap:        make(map[peer.ID]*ledger),
 		bs:               bs,
+		access:           access,
 		peerRequestQueue: newPRQ(),
 		outbox:           make(chan (<-chan *Envelope), outboxChanBuffer),
 		workSignal:       make(chan struct{}, 1),
 		ticker:           time.NewTicker(time.Millisecond * 100),
 	}
+	e.access.Subscribe(ctx, e.peerAllowed)
 	go e.taskWorker(ctx)
 	return e
 }
@@ -238,7 +247,13 @@ func (e *Engine) MessageReceived(p peer.ID, m bsmsg.BitSwapMessage) error {
 			e.peerRequestQueue.Remove(entry.Cid, p)
 		} else {
 			log.Debugf("wants %s - %d", entry.Cid, entry.Priority)
+			// denied wants are kept, so that they are served
+			// when peer is allowed to download them
 			l.Wants(entry.Cid, entry.Priority)
+			if !e.access.Allowed(p, entry.Cid) {
+				log.Debugf("%s is not allowed to download %s", p, entry.Cid)
+				continue
+			}
 			if exists, err := e.bs.Has(entry.Cid); err == nil && exists {
 				e.peerRequestQueue.Push(entry.Entry, p)
 				newWorkExists = true
@@ -258,7 +273,7 @@ func (e *Engine) addBlock(block blocks.Block) {
 
 	for _, l := range e.ledgerMap {
 		l.lk.Lock()
-		if entry, ok := l.WantListContains(block.Cid()); ok {
+		if entry, ok := l.WantListContains(block.Cid()); ok && e.access.Allowed(l.Partner, block.Cid()) {
 			e.peerRequestQueue.Push(entry, l.Partner)
 			work = true
 		}
@@ -270,6 +285,33 @@ func (e *Engine) addBlock(block blocks.Block) {
 	}
 }
 
+// peerAllowed queues wants of p which it was not allowed to download.
+func (e *Engine) peerAllowed(p peer.ID) {
+	e.lock.Lock()
+	l, ok := e.ledgerMap[p]
+	e.lock.Unlock()
+	if !ok {
+		return
+	}
+
+	work := false
+	l.lk.Lock()
+	for _, entry := range l.wantList.Entries() {
+		if !e.access.Allowed(p, entry.Cid) {
+			continue
+		}
+		if exists, err := e.bs.Has(entry.Cid); err == nil && exists {
+			e.peerRequestQueue.Push(entry, p)
+			work = true
+		}
+	}
+	l.lk.Unlock()
+
+	if work {
+		e.signalNewWork()
+	}
+}
+
 func (e *Engine) AddBlock(block blocks.Block) {
 	e.lock.Lock()
 	defer e.lock.Unlock()
@@ -290,6 +332,7 @@ func (e *Engine) MessageSent(p peer.ID, m bsmsg.BitSwapMessage) error {
 
 	for _, block := range m.Blocks() {
 		l.SentBytes(len(block.RawData()))
+		e.access.Sent(p, block.Cid(), len(block.RawData()))
 		l.wantList.Remove(block.Cid())
 		e.peerRequestQueue.Remove(block.Cid(), p)
 	}
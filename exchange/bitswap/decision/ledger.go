@@ -4,7 +4,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/Casper-dev/Casper-server/casper/sc"
 	wl "github.com/Casper-dev/Casper-server/exchange/bitswap/wantlist"
 
 	"gx/ipfs/QmNp85zy9RLrQ5oQD4hPyS39ezrrXpcaa7R4Y9kxdWQLLQ/go-cid"
@@ -19,34 +18,6 @@ func newLedger(p peer.ID) *ledger {
 	}
 }
 
-var AllowedHashes = make(map[string][]string)
-
-func AllowHash(hash, wallet string) {
-	for _, w := range AllowedHashes[hash] {
-		if w == wallet {
-			return
-		}
-	}
-	AllowedHashes[hash] = append(AllowedHashes[hash], wallet)
-}
-
-func DisallowHash(hash, wallet string) {
-	for i, w := range AllowedHashes[hash] {
-		if w == wallet {
-			if len(AllowedHashes[hash]) == 1 {
-				delete(AllowedHashes, hash)
-			} else {
-				var tail []string
-				if i+1 < len(AllowedHashes[hash]) {
-					tail = AllowedHashes[hash][i+1:]
-				}
-				AllowedHashes[hash] = append(AllowedHashes[hash][:i], tail...)
-			}
-			return
-		}
-	}
-}
-
 // ledger stores the data exchange relationship between two peers.
 // NOT threadsafe
 type ledger struct {
@@ -106,20 +77,8 @@ func (l *ledger) ReceivedBytes(n int) {
 }
 
 func (l *ledger) Wants(k *cid.Cid, priority int) {
-	l.wantList.Add(k, priority)
-	return
 	log.Debugf("peer %s wants %s", l.Partner, k)
-	if wallets, ok := AllowedHashes[k.String()]; ok {
-		c, _ := sc.GetContract()
-
-		// TODO check add info to wantlist about wallet
-		isPre, _ := c.IsPrepaid(wallets[0])
-		log.Debugf("Wallet %s prepaid=%t", isPre)
-		if isPre {
-			l.wantList.Add(k, priority)
-			log.Infof("Hash %s was allowed to download with wallet %s\n", k.String(), wallets[0])
-		}
-	}
+	l.wantList.Add(k, priority)
 }
 
 func (l *ledger) CancelWant(k *cid.Cid) {
@@ -144,6 +144,19 @@ func (ks *FSKeystore) List() ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer dir.Close()
 
-	return dir.Readdirnames(0)
+	fis, err := dir.Readdir(0)
+	if err != nil {
+		return nil, err
+	}
+
+	// directories, like the one with wallets, are not keys
+	names := make([]string, 0, len(fis))
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			names = append(names, fi.Name())
+		}
+	}
+	return names, nil
 }
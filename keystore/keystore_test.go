@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"sort"
 	"testing"
 
@@ -163,6 +165,33 @@ func TestNonExistingKey(t *testing.T) {
 	}
 }
 
+func TestListSkipsDirs(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "keystore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := NewFSKeystore(tdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Mkdir(filepath.Join(tdir, "wallets"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("foo", privKeyOrFatal(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := ks.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l) != 1 || l[0] != "foo" {
+		t.Fatalf("expected only key foo, got %v", l)
+	}
+}
+
 func TestMakeKeystoreNoDir(t *testing.T) {
 	_, err := NewFSKeystore("/this/is/not/a/real/dir")
 	if err == nil {
@@ -2,30 +2,32 @@ package config
 
 import scin "github.com/Casper-dev/Casper-server/casper/sc/sc_interface"
 
-// TODO remove after alpha
-const DefaultETHPrivateKey = "674393e0fb1cba8a71be3f1261e7171effb998bc5047ae0eee8b0e49e556e293"
 const DefaultETHGateway = "http://94.130.182.144:8775"
 
 var DefaultETHOpts = scin.InitOpts{
-	"PrivateKey": DefaultETHPrivateKey,
-	"Gateway":    DefaultETHGateway,
+	"Gateway": DefaultETHGateway,
 }
 
-const DefaultNEOWif = "KxDgvEKzgSBPPfuVfw67oPQBSjidEiqTHURKSDL1R7yGaGYAeYnr"
 const DefaultNEOGateway = "http://127.0.0.1:10332"
 const DefaultNeonAPI = "127.0.0.1:5000"
 
 var DefaultNEOOpts = scin.InitOpts{
-	"WIF":     DefaultNEOWif,
 	"Gateway": DefaultNEOGateway,
 	"NeonAPI": DefaultNeonAPI,
 }
 
+var DefaultMockOpts = scin.InitOpts{
+	"BanThreshold": 3,
+}
+
 var DefaultMULTIOpts = scin.InitOpts{
 	"NEO": DefaultNEOOpts,
 	"ETH": DefaultETHOpts,
 }
 
+// DefaultReplicas is the number of providers which store every uploaded file
+const DefaultReplicas = 4
+
 type Casper struct {
 	DiskSizeBytes   int64
 	IPAddress       string
@@ -33,4 +35,163 @@ type Casper struct {
 	ConnectionPort  string
 	Blockchain      map[string]scin.InitOpts
 	UsedChain       string
+	// Wallets maps chain to the name of the wallet used on it.
+	// Only wallet of the chain is used if it is not set.
+	Wallets map[string]string `json:",omitempty"`
+
+	// Replicas is the number of providers file is uploaded to
+	Replicas int
+	// MinReplicas is the number of successful uploads
+	// needed for upload to be considered successful
+	MinReplicas int
+	Placement   Placement
+
+	// ThriftOverLibp2p makes provider to register its peer ID as RPC address
+	// in SC, so that other nodes call it over libp2p streams instead of TCP.
+	// It is useful for providers behind NAT.
+	ThriftOverLibp2p bool
+
+	// ShareLinks limits links to files created with REST API
+	ShareLinks ShareLinks
+	// S3 configures S3-compatible gateway
+	S3 S3
+	// Versions configures history of updated UUID files
+	Versions Versions
+	// RESTAPI restricts access to REST API
+	RESTAPI RESTAPI
+	// Webhooks receive file lifecycle events
+	Webhooks []Webhook
+	// PaidDownloads restricts blocks served to other peers
+	PaidDownloads PaidDownloads
+	// Billing settles download receipts with SC
+	Billing Billing
+}
+
+// Billing describes how receipts, which clients sign for the traffic
+// served to them, are confirmed with SC.
+type Billing struct {
+	// SettleInterval is how often receipts are sent to SC, like "1h".
+	// Empty value means one hour.
+	SettleInterval string
+	// BatchSize is the max number of receipts sent in one call,
+	// zero means 50.
+	BatchSize int
+}
+
+// PaidDownloads describes access to blocks of stored files. If it is
+// enabled, blocks of a file are served only to peers which have asked
+// for its download with a prepaid wallet, and to registered providers.
+type PaidDownloads struct {
+	Enabled bool
+	// TTL is how long peer can download the file, like "1h".
+	// Empty value means one hour.
+	TTL string
+	// BytesPerToken is how much peer can download for every token paid
+	// with payment channel instead of prepaid wallet, zero means 1 MiB.
+	BytesPerToken uint64
+}
+
+// Webhook is an URL which receives events as JSON POST requests.
+type Webhook struct {
+	URL string
+	// Secret is the key of HMAC-SHA256 signature which is sent in
+	// X-Casper-Signature header. Requests are not signed if it is empty.
+	Secret string
+	// Events are types of events sent to URL, like "file.deleted".
+	// All events are sent if it is empty.
+	Events []string
+	// MaxAttempts is the number of delivery attempts, 5 by default
+	MaxAttempts int
+	// QueueSize is the number of events waiting for delivery,
+	// 4096 by default. The oldest events are dropped when it is full.
+	QueueSize int `json:",omitempty"`
+}
+
+// RESTAPI describes clients of REST API. API is open to everyone
+// if there are no Keys and Anonymous is not set.
+type RESTAPI struct {
+	// AllowOrigins are origins allowed to call API from browsers.
+	// Empty list allows any origin.
+	AllowOrigins []string
+	// Keys are tokens of known clients
+	Keys []APIKey
+	// Anonymous are limits of clients without a key, which are counted
+	// by IP address. If it is not set and Keys are, such clients are rejected.
+	Anonymous *APILimits `json:",omitempty"`
+	// Public are limits of clients without a key on share links, which
+	// don't require a key. Anonymous limits are used if it is not set.
+	Public *APILimits `json:",omitempty"`
+}
+
+// APIKey is a token which client sends as "Authorization: Bearer <token>"
+// or "X-Api-Key: <token>" header.
+type APIKey struct {
+	// Name identifies client in usage stats
+	Name  string
+	Token string
+	// Admin allows client to see usage of all clients
+	Admin bool
+	APILimits
+}
+
+// APILimits restrict a single client. Zero values mean no limit.
+type APILimits struct {
+	// QuotaBytes is the total size of data client can upload
+	QuotaBytes int64
+	// RequestsPerMinute is the average request rate
+	RequestsPerMinute int
+	// BytesPerSecond is upload and download bandwidth
+	BytesPerSecond int64
+}
+
+// ShareLinks describes lifetime of share links. Durations are
+// written like "24h" or "30m". Empty values mean defaults.
+type ShareLinks struct {
+	// DefaultTTL is lifetime of links created without TTL
+	DefaultTTL string
+	// MaxTTL is the longest lifetime link can have. Empty means no limit.
+	MaxTTL string
+}
+
+// Versions describes which previous versions of UUID files are kept.
+type Versions struct {
+	// Enabled makes history to be kept for every file. Otherwise it is
+	// kept only for files updated with 'upd --keep-history'.
+	Enabled bool
+	// Keep is the number of kept versions of a file, zero means no limit
+	Keep int
+	// MaxAge is how long versions are kept, like "720h". Empty means forever.
+	MaxAge string
+}
+
+// S3 describes S3-compatible gateway. Every bucket belongs to one of
+// Credentials and its objects are UUID files owned by the key of that
+// credential.
+type S3 struct {
+	// Address is the multiaddr gateway listens on.
+	// Gateway is disabled if it is empty.
+	Address string
+	// Region which clients sign requests for, "us-east-1" by default
+	Region      string
+	Credentials []S3Credential
+}
+
+// S3Credential is an access key of gateway user.
+type S3Credential struct {
+	AccessKey string
+	SecretKey string
+	// KeyName is the name of the key which owns uploaded objects, "self" by default
+	KeyName string
+	// limits of requests signed with the key, see RESTAPI
+	APILimits
+}
+
+// Placement describes how providers for uploaded file are chosen
+type Placement struct {
+	// SpreadOrigins makes replicas to be stored in different geo locations
+	SpreadOrigins bool
+	// PreferLowLatency makes providers with lower ping to be tried first
+	PreferLowLatency bool
+	// ExcludePeers contains IDs of providers which are never used
+	ExcludePeers []string
 }
@@ -95,8 +95,11 @@ func Init(out io.Writer, nBitsForKeypair int) (*Config, error) {
 			Blockchain: map[string]scin.InitOpts{
 				sc.Ethereum: DefaultETHOpts,
 				sc.NEO:      DefaultNEOOpts,
+				sc.Mock:     DefaultMockOpts,
 			},
-			UsedChain: sc.DefaultChain,
+			UsedChain:   sc.DefaultChain,
+			Replicas:    DefaultReplicas,
+			MinReplicas: DefaultReplicas,
 		},
 	}
 
@@ -13,7 +13,7 @@ import (
 )
 
 type Extractor struct {
-	Password []byte
+	Key      *crypto.Key
 	Path     string
 	Progress func(int64) int64
 }
@@ -110,8 +110,12 @@ func (te *Extractor) extractFile(h *tar.Header, r *tar.Reader, depth int, rootEx
 	}
 	defer file.Close()
 
-	if te.Password != nil {
-		return copyWithProgress(file, crypto.NewAESReader(r, te.Password), te.Progress)
+	if te.Key != nil {
+		dr, err := crypto.NewDecryptReader(r, te.Key)
+		if err != nil {
+			return err
+		}
+		return copyWithProgress(file, dr, te.Progress)
 	}
 
 	return copyWithProgress(file, r, te.Progress)